@@ -13,6 +13,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 )
 
 // EventType enumerates all possible events emitted over a cluster stream.
@@ -36,6 +39,38 @@ const (
 	SpanConfigEvent
 	// SplitEvent indicates that the SplitKey field of an event holds a split key.
 	SplitEvent
+	// StreamCanceledEvent indicates that the producer job was canceled. It is the
+	// last event emitted by a subscription.
+	StreamCanceledEvent
+	// SnapshotBeginEvent indicates that the events that follow, up to the
+	// matching SnapshotEndEvent, make up a consistent snapshot as of
+	// GetSnapshotTimestamp.
+	SnapshotBeginEvent
+	// SnapshotEndEvent indicates that the snapshot started by the preceding
+	// SnapshotBeginEvent is complete and that changes follow.
+	SnapshotEndEvent
+	// DescriptorEvent indicates that GetDescriptorUpdate holds a change to a
+	// descriptor in the source's system.descriptor table.
+	DescriptorEvent
+	// GlobalCheckpointEvent indicates that every span of the subscription has
+	// emitted all changes up to GetGlobalCheckpoint, making it a consistent cut
+	// across all of them.
+	GlobalCheckpointEvent
+	// KeepaliveEvent is a no-op event that the producer emits periodically to
+	// keep an otherwise idle stream from being dropped.
+	KeepaliveEvent
+	// CatchUpCompleteEvent indicates that the historical catch-up of the
+	// stream is complete: every event at or below GetCatchUpTimestamp has been
+	// emitted, and the stream is tailing changes from here on.
+	CatchUpCompleteEvent
+	// ResumeTokenEvent indicates that GetResumeToken holds a token from which
+	// a new subscription can resume the stream at the position of the
+	// preceding CheckpointEvent.
+	ResumeTokenEvent
+	// CatchUpTimedOutEvent indicates that the stream did not catch up within
+	// the maximum catch-up duration of its subscription. It is the last event
+	// emitted by the subscription.
+	CatchUpTimedOutEvent
 )
 
 // Event describes an event emitted by a cluster to cluster stream.  Its Type
@@ -64,6 +99,63 @@ type Event interface {
 
 	// GetSplitEvent returns the split event if the EventType is a SplitEvent
 	GetSplitEvent() *roachpb.Key
+
+	// GetSnapshotTimestamp returns the timestamp of the snapshot if the
+	// EventType is SnapshotBeginEvent or SnapshotEndEvent.
+	GetSnapshotTimestamp() hlc.Timestamp
+
+	// GetSourceLocality returns the locality of the leaseholder of the source
+	// range the event was read from, if the producer annotated it.
+	GetSourceLocality() roachpb.Locality
+
+	// GetSubSpan returns the sub-span, delimited by the subscription's split
+	// hints, that the event was read from, if the producer annotated it.
+	GetSubSpan() roachpb.Span
+
+	// GetDescriptorUpdate returns the descriptor change if the EventType is
+	// DescriptorEvent.
+	GetDescriptorUpdate() *DescriptorUpdate
+
+	// GetGlobalCheckpoint returns the timestamp up to which every span has
+	// emitted all changes if the EventType is GlobalCheckpointEvent.
+	GetGlobalCheckpoint() hlc.Timestamp
+
+	// GetCatchUpTimestamp returns the timestamp the stream caught up to if the
+	// EventType is CatchUpCompleteEvent.
+	GetCatchUpTimestamp() hlc.Timestamp
+
+	// GetResumeToken returns the resume token if the EventType is
+	// ResumeTokenEvent.
+	GetResumeToken() []byte
+
+	// GetSourceClusterID returns the ID of the cluster the event was streamed
+	// from, if the subscription annotated it.
+	GetSourceClusterID() uuid.UUID
+
+	// GetRawMVCCKVs returns the KVs of a KVEvent in the encoding of the
+	// storage engine, if the subscription requested it.
+	GetRawMVCCKVs() []RawMVCCKeyValue
+}
+
+// RawMVCCKeyValue is a KV in the encoding of the storage engine, for consumers
+// that write it out as is, e.g. to build physical backups.
+type RawMVCCKeyValue struct {
+	// Key is the encoded MVCC key, including the timestamp of the KV.
+	Key []byte
+	// Value is the encoded MVCC value.
+	Value []byte
+}
+
+// DescriptorUpdate is a change to a descriptor in the source's
+// system.descriptor table.
+type DescriptorUpdate struct {
+	// ID is the ID of the changed descriptor.
+	ID descpb.ID
+	// Descriptor is the new version of the descriptor, or nil if it was
+	// deleted.
+	Descriptor *descpb.Descriptor
+	// KV is the system.descriptor KV the update was decoded from.
+	KV streampb.StreamEvent_KV
 }
 
 // kvEvent is a key value pair that needs to be ingested.
@@ -139,6 +231,25 @@ func (ce checkpointEvent) GetResolvedSpans() []jobspb.ResolvedSpan {
 	return ce.resolvedSpans
 }
 
+// globalCheckpointEvent indicates that the stream has emitted every change for
+// all keys in all the spans of the subscription up until this timestamp.
+type globalCheckpointEvent struct {
+	emptyEvent
+	ts hlc.Timestamp
+}
+
+var _ Event = globalCheckpointEvent{}
+
+// Type implements the Event interface.
+func (gce globalCheckpointEvent) Type() EventType {
+	return GlobalCheckpointEvent
+}
+
+// GetGlobalCheckpoint implements the Event interface.
+func (gce globalCheckpointEvent) GetGlobalCheckpoint() hlc.Timestamp {
+	return gce.ts
+}
+
 type spanConfigEvent struct {
 	emptyEvent
 	spanConfig streampb.StreamedSpanConfigEntry
@@ -173,11 +284,194 @@ func (se splitEvent) GetSplitEvent() *roachpb.Key {
 	return &se.splitKey
 }
 
+// streamCanceledEvent indicates that the producer job was canceled and no
+// further events will be emitted.
+type streamCanceledEvent struct {
+	emptyEvent
+}
+
+var _ Event = streamCanceledEvent{}
+
+// Type implements the Event interface.
+func (sce streamCanceledEvent) Type() EventType {
+	return StreamCanceledEvent
+}
+
+// keepaliveEvent is a no-op event that keeps the stream warm.
+type keepaliveEvent struct {
+	emptyEvent
+}
+
+var _ Event = keepaliveEvent{}
+
+// Type implements the Event interface.
+func (ke keepaliveEvent) Type() EventType {
+	return KeepaliveEvent
+}
+
+// catchUpCompleteEvent marks the end of the stream's historical catch-up.
+type catchUpCompleteEvent struct {
+	emptyEvent
+	ts hlc.Timestamp
+}
+
+var _ Event = catchUpCompleteEvent{}
+
+// Type implements the Event interface.
+func (cce catchUpCompleteEvent) Type() EventType {
+	return CatchUpCompleteEvent
+}
+
+// GetCatchUpTimestamp implements the Event interface.
+func (cce catchUpCompleteEvent) GetCatchUpTimestamp() hlc.Timestamp {
+	return cce.ts
+}
+
+// catchUpTimedOutEvent indicates that the producer gave up on catching up and
+// ended the stream.
+type catchUpTimedOutEvent struct {
+	emptyEvent
+}
+
+var _ Event = catchUpTimedOutEvent{}
+
+// Type implements the Event interface.
+func (cte catchUpTimedOutEvent) Type() EventType {
+	return CatchUpTimedOutEvent
+}
+
+// resumeTokenEvent carries a token encoding the position of the stream.
+type resumeTokenEvent struct {
+	emptyEvent
+	token []byte
+}
+
+var _ Event = resumeTokenEvent{}
+
+// Type implements the Event interface.
+func (rte resumeTokenEvent) Type() EventType {
+	return ResumeTokenEvent
+}
+
+// GetResumeToken implements the Event interface.
+func (rte resumeTokenEvent) GetResumeToken() []byte {
+	return rte.token
+}
+
+// snapshotMarkerEvent brackets the events of a snapshot.
+type snapshotMarkerEvent struct {
+	emptyEvent
+	end bool
+	ts  hlc.Timestamp
+}
+
+var _ Event = snapshotMarkerEvent{}
+
+// Type implements the Event interface.
+func (sme snapshotMarkerEvent) Type() EventType {
+	if sme.end {
+		return SnapshotEndEvent
+	}
+	return SnapshotBeginEvent
+}
+
+// GetSnapshotTimestamp implements the Event interface.
+func (sme snapshotMarkerEvent) GetSnapshotTimestamp() hlc.Timestamp {
+	return sme.ts
+}
+
+// descriptorEvent is a change to a descriptor.
+type descriptorEvent struct {
+	emptyEvent
+	update DescriptorUpdate
+}
+
+var _ Event = descriptorEvent{}
+
+// Type implements the Event interface.
+func (de descriptorEvent) Type() EventType {
+	return DescriptorEvent
+}
+
+// GetDescriptorUpdate implements the Event interface.
+func (de descriptorEvent) GetDescriptorUpdate() *DescriptorUpdate {
+	return &de.update
+}
+
+// sourceLocalityEvent annotates an event with its source locality.
+type sourceLocalityEvent struct {
+	Event
+	locality roachpb.Locality
+}
+
+// GetSourceLocality implements the Event interface.
+func (sle sourceLocalityEvent) GetSourceLocality() roachpb.Locality {
+	return sle.locality
+}
+
+// WithSourceLocality returns the event annotated with the given source
+// locality.
+func WithSourceLocality(event Event, locality roachpb.Locality) Event {
+	return sourceLocalityEvent{Event: event, locality: locality}
+}
+
+// subSpanEvent annotates an event with the sub-span it was read from.
+type subSpanEvent struct {
+	Event
+	subSpan roachpb.Span
+}
+
+// GetSubSpan implements the Event interface.
+func (sse subSpanEvent) GetSubSpan() roachpb.Span {
+	return sse.subSpan
+}
+
+// WithSubSpan returns the event annotated with the given sub-span.
+func WithSubSpan(event Event, subSpan roachpb.Span) Event {
+	return subSpanEvent{Event: event, subSpan: subSpan}
+}
+
+// sourceClusterEvent annotates an event with the ID of its source cluster.
+type sourceClusterEvent struct {
+	Event
+	clusterID uuid.UUID
+}
+
+// GetSourceClusterID implements the Event interface.
+func (sce sourceClusterEvent) GetSourceClusterID() uuid.UUID {
+	return sce.clusterID
+}
+
+// WithSourceClusterID returns the event annotated with the ID of the cluster
+// it was streamed from.
+func WithSourceClusterID(event Event, clusterID uuid.UUID) Event {
+	return sourceClusterEvent{Event: event, clusterID: clusterID}
+}
+
+// rawMVCCEvent annotates a KV event with the raw MVCC encoding of its KVs.
+type rawMVCCEvent struct {
+	Event
+	kvs []RawMVCCKeyValue
+}
+
+// GetRawMVCCKVs implements the Event interface.
+func (rme rawMVCCEvent) GetRawMVCCKVs() []RawMVCCKeyValue {
+	return rme.kvs
+}
+
+// WithRawMVCCKVs returns the KV event annotated with the raw MVCC encoding of
+// its KVs.
+func WithRawMVCCKVs(event Event, kvs []RawMVCCKeyValue) Event {
+	return rawMVCCEvent{Event: event, kvs: kvs}
+}
+
 // MakeKVEvent creates an Event from a KV.
 func MakeKVEventFromKVs(kv []roachpb.KeyValue) Event {
 	kvs := make([]streampb.StreamEvent_KV, len(kv))
 	for i := range kv {
 		kvs[i].KeyValue = kv[i]
+		// Producers that send deprecated KVs don't flag deletes themselves.
+		kvs[i].IsDelete = !kv[i].Value.IsPresent()
 	}
 	return kvEvent{kv: kvs}
 }
@@ -202,6 +496,12 @@ func MakeCheckpointEvent(resolvedSpans []jobspb.ResolvedSpan) Event {
 	return checkpointEvent{resolvedSpans: resolvedSpans}
 }
 
+// MakeGlobalCheckpointEvent creates an Event from the timestamp up to which
+// every span has been resolved.
+func MakeGlobalCheckpointEvent(ts hlc.Timestamp) Event {
+	return globalCheckpointEvent{ts: ts}
+}
+
 func MakeSpanConfigEvent(streamedSpanConfig streampb.StreamedSpanConfigEntry) Event {
 	return spanConfigEvent{spanConfig: streamedSpanConfig}
 }
@@ -210,6 +510,52 @@ func MakeSplitEvent(splitKey roachpb.Key) Event {
 	return splitEvent{splitKey: splitKey}
 }
 
+// MakeStreamCanceledEvent creates an Event signaling that the producer job was
+// canceled.
+func MakeStreamCanceledEvent() Event {
+	return streamCanceledEvent{}
+}
+
+// MakeKeepaliveEvent creates a no-op Event that keeps the stream warm.
+func MakeKeepaliveEvent() Event {
+	return keepaliveEvent{}
+}
+
+// MakeCatchUpCompleteEvent creates an Event marking the end of the stream's
+// historical catch-up up to the given timestamp.
+func MakeCatchUpCompleteEvent(ts hlc.Timestamp) Event {
+	return catchUpCompleteEvent{ts: ts}
+}
+
+// MakeCatchUpTimedOutEvent creates an Event signaling that the stream did not
+// catch up in time and has ended.
+func MakeCatchUpTimedOutEvent() Event {
+	return catchUpTimedOutEvent{}
+}
+
+// MakeResumeTokenEvent creates an Event carrying a resume token issued by the
+// producer.
+func MakeResumeTokenEvent(token []byte) Event {
+	return resumeTokenEvent{token: token}
+}
+
+// MakeSnapshotBeginEvent creates an Event marking the start of a snapshot as of
+// the given timestamp.
+func MakeSnapshotBeginEvent(ts hlc.Timestamp) Event {
+	return snapshotMarkerEvent{ts: ts}
+}
+
+// MakeSnapshotEndEvent creates an Event marking the end of a snapshot as of the
+// given timestamp.
+func MakeSnapshotEndEvent(ts hlc.Timestamp) Event {
+	return snapshotMarkerEvent{end: true, ts: ts}
+}
+
+// MakeDescriptorEvent creates an Event from a descriptor change.
+func MakeDescriptorEvent(update DescriptorUpdate) Event {
+	return descriptorEvent{update: update}
+}
+
 // emptyEvent is not an event (no Type method) but it is used to
 // reduce the boilerplate above.
 type emptyEvent struct{}
@@ -243,3 +589,48 @@ func (ee emptyEvent) GetSpanConfigEvent() *streampb.StreamedSpanConfigEntry {
 func (ee emptyEvent) GetSplitEvent() *roachpb.Key {
 	return nil
 }
+
+// GetSnapshotTimestamp implements the Event interface.
+func (ee emptyEvent) GetSnapshotTimestamp() hlc.Timestamp {
+	return hlc.Timestamp{}
+}
+
+// GetSourceLocality implements the Event interface.
+func (ee emptyEvent) GetSourceLocality() roachpb.Locality {
+	return roachpb.Locality{}
+}
+
+// GetSubSpan implements the Event interface.
+func (ee emptyEvent) GetSubSpan() roachpb.Span {
+	return roachpb.Span{}
+}
+
+// GetDescriptorUpdate implements the Event interface.
+func (ee emptyEvent) GetDescriptorUpdate() *DescriptorUpdate {
+	return nil
+}
+
+// GetGlobalCheckpoint implements the Event interface.
+func (ee emptyEvent) GetGlobalCheckpoint() hlc.Timestamp {
+	return hlc.Timestamp{}
+}
+
+// GetCatchUpTimestamp implements the Event interface.
+func (ee emptyEvent) GetCatchUpTimestamp() hlc.Timestamp {
+	return hlc.Timestamp{}
+}
+
+// GetResumeToken implements the Event interface.
+func (ee emptyEvent) GetResumeToken() []byte {
+	return nil
+}
+
+// GetSourceClusterID implements the Event interface.
+func (ee emptyEvent) GetSourceClusterID() uuid.UUID {
+	return uuid.Nil
+}
+
+// GetRawMVCCKVs implements the Event interface.
+func (ee emptyEvent) GetRawMVCCKVs() []RawMVCCKeyValue {
+	return nil
+}
@@ -415,6 +415,8 @@ func (lrw *logicalReplicationWriterProcessor) handleEvent(
 		return errors.Newf("unexpected event for online stream: %v", event)
 	case crosscluster.SplitEvent:
 		log.Infof(lrw.Ctx(), "SplitEvent received on logical replication stream")
+	case crosscluster.StreamCanceledEvent:
+		return errors.New("source producer job was canceled")
 	default:
 		return errors.Newf("unknown streaming event type %v", event.Type())
 	}
@@ -18,6 +18,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/base"
+	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster/replicationtestutils"
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster/replicationutils"
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster/streamclient"
@@ -27,6 +28,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts/ptpb"
+	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/server/telemetry"
 	"github.com/cockroachdb/cockroach/pkg/sql"
@@ -41,10 +43,12 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/testutils/skip"
 	"github.com/cockroachdb/cockroach/pkg/testutils/sqlutils"
 	"github.com/cockroachdb/cockroach/pkg/testutils/storageutils"
+	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
 	"github.com/cockroachdb/cockroach/pkg/util/duration"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/rangedesc"
 	"github.com/cockroachdb/cockroach/pkg/util/span"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
@@ -1384,6 +1388,80 @@ func TestStreamingRegionalConstraint(t *testing.T) {
 	})
 }
 
+// TestStreamingSourceLocalityAnnotation tests that a subscription started with
+// WithSourceLocality receives events annotated with the locality of the
+// leaseholder of the source range.
+func TestStreamingSourceLocalityAnnotation(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+	skip.UnderDuress(t, "multi node c2c is very flaky")
+
+	ctx := context.Background()
+	args := replicationtestutils.DefaultTenantStreamingClustersArgs
+	args.SrcClusterTestRegions = []string{"mars", "venus", "mercury"}
+	args.SrcNumNodes = 3
+	marsNodeID := roachpb.NodeID(1)
+
+	c, cleanup := replicationtestutils.CreateTenantStreamingClusters(ctx, t, args)
+	defer cleanup()
+
+	c.SrcTenantSQL.Exec(t, "CREATE DATABASE test")
+	c.SrcTenantSQL.Exec(t, `ALTER DATABASE test CONFIGURE ZONE USING constraints = '[+region=mars]', num_replicas = 1;`)
+	c.SrcTenantSQL.Exec(t, "CREATE TABLE test.x (id INT PRIMARY KEY, n INT)")
+	c.SrcTenantSQL.Exec(t, "INSERT INTO test.x VALUES (1, 1)")
+
+	srcCodec := keys.MakeSQLCodec(c.Args.SrcTenantID)
+	tableDesc := desctestutils.TestingGetPublicTableDescriptor(
+		c.SrcSysServer.DB(), srcCodec, "test", "x")
+	tableSpan := tableDesc.PrimaryIndexSpan(srcCodec)
+
+	// Wait for the table's only replica, and with it the lease, to move to mars.
+	scanner := rangedesc.NewScanner(c.SrcSysServer.DB())
+	testutils.SucceedsWithin(t, func() error {
+		return scanner.Scan(ctx, 10000, func() {}, tableSpan, func(descriptors ...roachpb.RangeDescriptor) error {
+			for _, desc := range descriptors {
+				for _, replica := range desc.InternalReplicas {
+					if replica.NodeID != marsNodeID {
+						return errors.Newf("found table data located on another node %d, desc %v",
+							replica.NodeID, desc)
+					}
+				}
+			}
+			return nil
+		})
+	}, time.Second*45*5)
+
+	client, err := streamclient.NewPartitionedStreamClient(ctx, &c.SrcURL)
+	require.NoError(t, err)
+	defer func() { require.NoError(t, client.Close(ctx)) }()
+	rps, err := client.CreateForTenant(ctx, c.Args.SrcTenantName, streampb.ReplicationProducerRequest{})
+	require.NoError(t, err)
+
+	spec, err := protoutil.Marshal(&streampb.SourcePartition{Spans: []roachpb.Span{tableSpan}})
+	require.NoError(t, err)
+	sub, err := client.Subscribe(ctx, rps.StreamID, 1, 1, spec,
+		c.SrcCluster.Server(0).Clock().Now(), nil, streamclient.WithSourceLocality(true))
+	require.NoError(t, err)
+	subCtx, cancelSub := context.WithCancel(ctx)
+	defer cancelSub()
+	cg := ctxgroup.WithContext(subCtx)
+	cg.GoCtx(sub.Subscribe)
+
+	expectedLocality := roachpb.Locality{Tiers: []roachpb.Tier{{Key: "region", Value: "mars"}}}
+	var sawKV bool
+	for event := range sub.Events() {
+		if event.Type() != crosscluster.KVEvent {
+			continue
+		}
+		require.Equal(t, expectedLocality, event.GetSourceLocality())
+		sawKV = true
+		break
+	}
+	require.True(t, sawKV, "subscription ended before emitting a KV: %v", sub.Err())
+	cancelSub()
+	_ = cg.Wait()
+}
+
 func TestStreamingMismatchedMRDatabase(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 	defer log.Scope(t).Close(t)
@@ -788,16 +788,21 @@ func constructStreamIngestionPlanSpecs(
 		spanGroup.Add(partition.Spans...)
 	}
 
+	// The partitions cover the tenant's keyspace, less any spans the stream
+	// was created to exclude.
 	tenantSpan := keys.MakeTenantSpan(sourceTenantID)
-	if !spanGroup.Encloses(tenantSpan) {
-		return nil, nil, errors.AssertionFailedf("span %s not covered by %s", tenantSpan, spanGroup.Slice())
+	var trackedSpans roachpb.SpanGroup
+	trackedSpans.Add(tenantSpan)
+	trackedSpans.Sub(topology.ExcludedSpans...)
+	if !spanGroup.Encloses(trackedSpans.Slice()...) {
+		return nil, nil, errors.AssertionFailedf("spans %s not covered by %s", trackedSpans.Slice(), spanGroup.Slice())
 	}
 
 	// Create a spec for the StreamIngestionFrontier processor on the coordinator
 	// node.
 	streamIngestionFrontierSpec := &execinfrapb.StreamIngestionFrontierSpec{
 		ReplicatedTimeAtStart: previousReplicatedTimestamp,
-		TrackedSpans:          []roachpb.Span{tenantSpan},
+		TrackedSpans:          trackedSpans.Slice(),
 		JobID:                 int64(jobID),
 		StreamID:              uint64(streamID),
 		StreamAddresses:       topology.StreamAddresses(),
@@ -58,6 +58,32 @@ var minimumFlushInterval = settings.RegisterDurationSettingWithExplicitUnit(
 	settings.WithName("physical_replication.consumer.minimum_flush_interval"),
 )
 
+var minFlushBatchSize = settings.RegisterByteSizeSetting(
+	settings.SystemOnly,
+	"physical_replication.consumer.min_flush_batch_size",
+	"the buffered size below which a checkpoint does not trigger a flush until "+
+		"physical_replication.consumer.max_flush_delay has elapsed; 0 disables the size threshold",
+	0,
+)
+
+var minFlushBatchRows = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"physical_replication.consumer.min_flush_batch_rows",
+	"the number of buffered keys below which a checkpoint does not trigger a flush until "+
+		"physical_replication.consumer.max_flush_delay has elapsed; 0 disables the row threshold",
+	0,
+	settings.NonNegativeInt,
+)
+
+var maxFlushDelay = settings.RegisterDurationSetting(
+	settings.SystemOnly,
+	"physical_replication.consumer.max_flush_delay",
+	"the maximum time a checkpoint may be held back waiting for the buffer to reach "+
+		"the minimum flush batch size",
+	time.Minute,
+	settings.NonNegativeDuration,
+)
+
 var maxKVBufferSize = settings.RegisterByteSizeSetting(
 	settings.SystemOnly,
 	"bulkio.stream_ingestion.kv_buffer_size",
@@ -177,6 +203,20 @@ func (b *streamIngestionBuffer) shouldFlushOnSize(ctx context.Context, sv *setti
 	return false
 }
 
+// reachedMinFlushSize returns true if the buffer holds enough data to be
+// flushed on a checkpoint. It is always true if no minimum is configured.
+func (b *streamIngestionBuffer) reachedMinFlushSize(sv *settings.Values) bool {
+	minBytes := int(minFlushBatchSize.Get(sv))
+	minRows := int(minFlushBatchRows.Get(sv))
+	if minBytes == 0 && minRows == 0 {
+		return true
+	}
+	if minBytes > 0 && b.curKVBatchSize+b.curRangeKVBatchSize >= minBytes {
+		return true
+	}
+	return minRows > 0 && len(b.curKVBatch)+len(b.curRangeKVBatch) >= minRows
+}
+
 func (b *streamIngestionBuffer) reset() {
 	b.minTimestamp = hlc.MaxTimestamp
 
@@ -702,6 +742,10 @@ func (sip *streamIngestionProcessor) consumeEvents(ctx context.Context) error {
 			// buffer that may have been previously
 			// skipped.
 			sip.maxFlushRateTimer.Read = true
+			if delay := sip.checkpointFlushDelay(); delay > 0 {
+				sip.maxFlushRateTimer.Reset(delay)
+				continue
+			}
 			if err := sip.flush(); err != nil {
 				return err
 			}
@@ -744,13 +788,13 @@ func (sip *streamIngestionProcessor) handleEvent(event PartitionEvent) error {
 			return err
 		}
 
-		minFlushInterval := minimumFlushInterval.Get(sv)
-		if timeutil.Since(sip.lastFlushTime) < minFlushInterval {
-			// Not enough time has passed since the last flush. Let's set a timer
-			// that will trigger a flush eventually.
+		if delay := sip.checkpointFlushDelay(); delay > 0 {
+			// Either not enough time has passed since the last flush or the
+			// buffer is still too small. Let's set a timer that will trigger a
+			// flush eventually.
 			// TODO: This resets the timer every checkpoint event, but we only
 			// need to reset it once.
-			sip.maxFlushRateTimer.Reset(time.Until(sip.lastFlushTime.Add(minFlushInterval)))
+			sip.maxFlushRateTimer.Reset(delay)
 			return nil
 		}
 		if err := sip.flush(); err != nil {
@@ -761,6 +805,8 @@ func (sip *streamIngestionProcessor) handleEvent(event PartitionEvent) error {
 		if err := sip.handleSplitEvent(event.GetSplitEvent()); err != nil {
 			return err
 		}
+	case crosscluster.StreamCanceledEvent:
+		return errors.New("source producer job was canceled")
 	default:
 		return errors.Newf("unknown streaming event type %v", event.Type())
 	}
@@ -777,6 +823,26 @@ func (sip *streamIngestionProcessor) handleEvent(event PartitionEvent) error {
 	return nil
 }
 
+// checkpointFlushDelay returns how long a flush triggered by a checkpoint
+// should be held back, or 0 if the buffer should be flushed now. Flushes are
+// held back until the minimum flush interval has passed and, if configured,
+// until the buffer reaches the minimum flush batch size or the maximum flush
+// delay has passed. Holding back a flush only delays the checkpoint, since
+// flush snapshots the frontier together with the buffered data.
+func (sip *streamIngestionProcessor) checkpointFlushDelay() time.Duration {
+	sv := &sip.FlowCtx.Cfg.Settings.SV
+	sinceLastFlush := timeutil.Since(sip.lastFlushTime)
+	if minFlushInterval := minimumFlushInterval.Get(sv); sinceLastFlush < minFlushInterval {
+		return minFlushInterval - sinceLastFlush
+	}
+	if !sip.buffer.reachedMinFlushSize(sv) {
+		if maxDelay := maxFlushDelay.Get(sv); sinceLastFlush < maxDelay {
+			return maxDelay - sinceLastFlush
+		}
+	}
+	return 0
+}
+
 func (sip *streamIngestionProcessor) rekey(key roachpb.Key) ([]byte, bool, error) {
 	return sip.rekeyer.RewriteTenant(key)
 }
@@ -314,6 +314,68 @@ func TestStreamIngestionProcessor(t *testing.T) {
 		require.NoError(t, g.Wait())
 	})
 
+	t.Run("min-size-coalesced-flush", func(t *testing.T) {
+		events := func() []crosscluster.Event {
+			return []crosscluster.Event{
+				crosscluster.MakeCheckpointEvent(sampleCheckpoint(p1Span, 2)),
+				crosscluster.MakeKVEventFromKVs(sampleKV()),
+				crosscluster.MakeCheckpointEvent(sampleCheckpoint(p1Span, 3)),
+				crosscluster.MakeKVEventFromKVs(sampleKV()),
+				crosscluster.MakeCheckpointEvent(sampleCheckpoint(p1Span, 4)),
+				crosscluster.MakeKVEventFromKVs(sampleKV()),
+				crosscluster.MakeCheckpointEvent(sampleCheckpoint(p1Span, 5)),
+				crosscluster.MakeKVEventFromKVs(sampleKV()),
+				crosscluster.MakeCheckpointEvent(sampleCheckpoint(p1Span, 6)),
+			}
+		}
+		mockClient := &streamclient.MockStreamClient{
+			DoneCh:          make(chan struct{}),
+			PartitionEvents: map[string][]crosscluster.Event{string(p1): events()},
+		}
+
+		initialScanTimestamp := hlc.Timestamp{WallTime: 1}
+		partitions := []streamclient.PartitionInfo{
+			{ID: "1", SubscriptionToken: p1, Spans: []roachpb.Span{p1Span}},
+		}
+		topology := streamclient.Topology{
+			Partitions: partitions,
+		}
+
+		g := ctxgroup.WithContext(ctx)
+		sip, err := getStreamIngestionProcessor(ctx, t, registry, db,
+			topology, initialScanTimestamp, []jobspb.ResolvedSpan{}, tenantRekey, mockClient,
+			nil /* cutoverProvider */, nil /* streamingTestingKnobs */, st)
+		require.NoError(t, err)
+
+		// Without a minimum flush interval every checkpoint would flush on its
+		// own, but the buffer is only flushed once it holds 3 keys.
+		minimumFlushInterval.Override(ctx, &st.SV, 0)
+		maxKVBufferSize.Override(ctx, &st.SV, 128<<20)
+		maxRangeKeyBufferSize.Override(ctx, &st.SV, 32<<20)
+		quantize.Override(ctx, &st.SV, 0)
+		minFlushBatchRows.Override(ctx, &st.SV, 3)
+		maxFlushDelay.Override(ctx, &st.SV, 50*time.Minute)
+		defer minFlushBatchRows.Override(ctx, &st.SV, 0)
+		out := &execinfra.RowChannel{}
+		out.InitWithNumSenders(sip.OutputTypes(), 1)
+		out.Start(ctx)
+		g.Go(func() error {
+			sip.Run(ctx, out)
+			return sip.forceClientForTests.Close(ctx)
+		})
+
+		// The first checkpoint is flushed immediately since nothing has been
+		// flushed yet.
+		emittedRows := readRow(out)
+		require.Equal(t, []string{"key_1{-\\x00} 0.000000002,0"}, emittedRows, "partition 1 should advance to timestamp 2")
+		// The checkpoints at 3 and 4 are coalesced into the flush that follows
+		// the third key, and the checkpoint at 6 is held back.
+		emittedRows = readRow(out)
+		require.Equal(t, []string{"key_1{-\\x00} 0.000000005,0"}, emittedRows, "partition 1 should advance to timestamp 5")
+		close(mockClient.DoneCh)
+		require.NoError(t, g.Wait())
+	})
+
 	// Two partitions, checkpoint for each, client start time for each should match
 	t.Run("resume from checkpoint", func(t *testing.T) {
 		events := func() []crosscluster.Event {
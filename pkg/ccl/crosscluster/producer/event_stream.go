@@ -11,6 +11,8 @@ package producer
 import (
 	"context"
 	"fmt"
+	"sort"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
@@ -35,19 +37,24 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/mon"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/quotapool"
 	"github.com/cockroachdb/cockroach/pkg/util/span"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/errors"
-	"github.com/golang/snappy"
 )
 
 type eventStream struct {
 	streamID streampb.StreamID
 	execCfg  *sql.ExecutorConfig
+	evalCtx  *eval.Context
 	spec     streampb.StreamPartitionSpec
 	frontier span.Frontier
 
+	// filter, if non-nil, evaluates the spec's RowFilters. It is initialized
+	// when Start is called.
+	filter *rowFilter
+
 	// streamCh and data are used to pass rows back to be emitted to the caller.
 	streamCh chan tree.Datums
 	errCh    chan error
@@ -70,6 +77,64 @@ type eventStream struct {
 
 	lastPolled time.Time
 
+	// jobCheckTimer fires periodically to check whether the producer job has
+	// been canceled. canceled is set once the terminal StreamCanceled event has
+	// been emitted, after which the stream ends.
+	jobCheckTimer timeutil.Timer
+	canceled      bool
+
+	// keepaliveTimer fires every spec.KeepaliveInterval, if set, to emit a
+	// Keepalive event.
+	keepaliveTimer timeutil.Timer
+
+	// catchUpTimer fires once spec.MaxCatchUpDuration, if set, has elapsed, to
+	// end the stream unless catchUpDone has been set by a checkpoint that
+	// caught up to catchUpEnd. catchUpTimedOut is set once the terminal
+	// CatchUpTimedOut event has been emitted.
+	catchUpTimer    timeutil.Timer
+	catchUpDone     atomic.Bool
+	catchUpTimedOut bool
+
+	// localities, if non-nil, resolves the source locality that batches are
+	// annotated with.
+	localities *localityResolver
+
+	// subSpans, if non-empty, are the spans of the stream divided at its split
+	// hints, which batches are annotated with.
+	subSpans subSpans
+
+	// catchUpLimiter, if non-nil, limits the rate at which batches are emitted
+	// until every span has been checkpointed at or above catchUpEnd, the time at
+	// which the stream was started.
+	catchUpLimiter *quotapool.RateLimiter
+	catchUpEnd     hlc.Timestamp
+
+	// bufferCatchUp is set while the KVs read during catch-up are buffered in
+	// catchUpBuf, to be emitted newest-first once every span has been
+	// checkpointed at or above catchUpEnd. catchUpBufBytes is the memory
+	// reserved for the buffer.
+	bufferCatchUp   bool
+	catchUpBuf      []streampb.StreamEvent_KV
+	catchUpBufBytes int64
+
+	// commitGroups, if the stream was started with GroupByCommitTimestamp,
+	// holds back the KVs of the rangefeed by commit timestamp until a
+	// checkpoint resolves it. commitGroupBytes is the memory reserved for
+	// them.
+	commitGroups     map[hlc.Timestamp][]streampb.StreamEvent_KV
+	commitGroupBytes int64
+
+	// pendingSnapshotBegin is set if the SnapshotBegin marker still has to be
+	// emitted ahead of the initial scan.
+	pendingSnapshotBegin bool
+
+	// pendingCatchUpComplete is set if the CatchUpComplete event still has to
+	// be emitted once every span has been checkpointed at or above catchUpEnd.
+	pendingCatchUpComplete bool
+
+	// compressor, if non-nil, compresses the events of a Compressed stream.
+	compressor *streampb.EventCompressor
+
 	debug streampb.DebugProducerStatus
 }
 
@@ -87,6 +152,14 @@ var emitMetadata = settings.RegisterBoolSetting(
 	true,
 )
 
+var jobStatusCheckInterval = settings.RegisterDurationSetting(
+	settings.SystemOnly,
+	"physical_replication.producer.job_status_check_interval",
+	"the interval at which a running event stream checks whether its producer job has been canceled",
+	10*time.Second,
+	settings.PositiveDuration,
+)
+
 var _ eval.ValueGenerator = (*eventStream)(nil)
 
 var eventStreamReturnType = types.MakeLabeledTuple(
@@ -116,6 +189,17 @@ func (s *eventStream) Start(ctx context.Context, txn *kv.Txn) (retErr error) {
 		return err
 	}
 
+	s.filter, err = makeRowFilter(ctx, s.evalCtx, s.execCfg, s.spec.RowFilters)
+	if err != nil {
+		return err
+	}
+
+	if s.spec.Compressed {
+		if s.compressor, err = streampb.NewEventCompressor(s.spec.CompressionLevel); err != nil {
+			return pgerror.Wrap(err, pgcode.InvalidParameterValue, "invalid partition spec")
+		}
+	}
+
 	if sourceTenantID.IsSet() {
 		log.Infof(ctx, "starting physical replication event stream: tenant=%s initial_scan_timestamp=%s previous_replicated_time=%s",
 			sourceTenantID, s.spec.InitialScanTimestamp, s.spec.PreviousReplicatedTimestamp)
@@ -126,6 +210,41 @@ func (s *eventStream) Start(ctx context.Context, txn *kv.Txn) (retErr error) {
 
 	s.acc = s.mon.MakeBoundAccount()
 
+	if s.spec.WithSourceLocality {
+		s.localities = makeLocalityResolver(s.execCfg.RangeDescriptorCache, s.execCfg.NodeDescs)
+	}
+
+	if len(s.spec.SplitHints) > 0 {
+		s.subSpans = makeSubSpans(s.spec.Spans, s.spec.SplitHints)
+	}
+
+	if limit := s.spec.Config.CatchUpBytesPerSecond; limit > 0 {
+		s.catchUpLimiter = quotapool.NewRateLimiter(
+			fmt.Sprintf("stream-%d-catch-up", s.streamID), quotapool.Limit(limit), limit)
+		s.catchUpEnd = s.execCfg.Clock.Now()
+	}
+	if s.spec.NewestFirstCatchUp && !s.spec.PreviousReplicatedTimestamp.IsEmpty() {
+		s.bufferCatchUp = true
+		if s.catchUpEnd.IsEmpty() {
+			s.catchUpEnd = s.execCfg.Clock.Now()
+		}
+	}
+	if s.spec.GroupByCommitTimestamp {
+		s.commitGroups = make(map[hlc.Timestamp][]streampb.StreamEvent_KV)
+	}
+	if s.spec.WithCatchUpComplete {
+		s.pendingCatchUpComplete = true
+		if s.catchUpEnd.IsEmpty() {
+			s.catchUpEnd = s.execCfg.Clock.Now()
+		}
+	}
+	if s.spec.MaxCatchUpDuration > 0 {
+		if s.catchUpEnd.IsEmpty() {
+			s.catchUpEnd = s.execCfg.Clock.Now()
+		}
+		s.catchUpTimer.Reset(s.spec.MaxCatchUpDuration)
+	}
+
 	// errCh is buffered to ensure the sender can send an error to
 	// the buffer, without waiting, when the channel receiver is not waiting on
 	// the channel.
@@ -154,6 +273,9 @@ func (s *eventStream) Start(ctx context.Context, txn *kv.Txn) (retErr error) {
 	if emitMetadata.Get(&s.execCfg.Settings.SV) {
 		opts = append(opts, rangefeed.WithOnMetadata(s.onMetadata))
 	}
+	if s.spec.MaxStaleness > 0 {
+		opts = append(opts, rangefeed.WithMaxStaleness(s.spec.MaxStaleness))
+	}
 	if s.spec.Type == streampb.ReplicationType_LOGICAL {
 		// To prevent data looping during Logical Replication, only emit events that
 		// were written by the foreground workload, not from the LDR replication
@@ -174,6 +296,7 @@ func (s *eventStream) Start(ctx context.Context, txn *kv.Txn) (retErr error) {
 	}
 	if s.spec.PreviousReplicatedTimestamp.IsEmpty() {
 		s.addMu = &syncutil.Mutex{}
+		s.pendingSnapshotBegin = s.spec.WithSnapshot
 		log.Infof(ctx, "starting event stream with initial scan at %s", initialTimestamp)
 		opts = append(opts,
 			rangefeed.WithInitialScan(s.onInitialScanDone),
@@ -201,6 +324,11 @@ func (s *eventStream) Start(ctx context.Context, txn *kv.Txn) (retErr error) {
 		return err
 	}
 
+	s.jobCheckTimer.Reset(jobStatusCheckInterval.Get(&s.execCfg.Settings.SV))
+	if s.spec.KeepaliveInterval > 0 {
+		s.keepaliveTimer.Reset(s.spec.KeepaliveInterval)
+	}
+
 	s.debug.StreamID = s.streamID
 	s.debug.Spec = s.spec
 	streampb.RegisterProducerStatus(&s.debug)
@@ -228,26 +356,110 @@ func (s *eventStream) Next(ctx context.Context) (bool, error) {
 	s.debug.Flushes.EmitWaitNanos.Add(emitWait)
 	s.lastPolled = timeutil.Now()
 
-	select {
-	case <-ctx.Done():
-		return false, ctx.Err()
-	case err := <-s.errCh:
-		return false, err
-	case s.data = <-s.streamCh:
-		// Re-check the err Ch
+	if s.canceled || s.catchUpTimedOut {
+		// The terminal StreamCanceled or CatchUpTimedOut event has already
+		// been emitted.
+		return false, nil
+	}
+
+	if s.pendingSnapshotBegin {
+		// The initial scan cannot emit anything until we read from streamCh, so
+		// the marker is guaranteed to precede the snapshot data.
+		s.pendingSnapshotBegin = false
+		data, err := s.encodeEvent(s.snapshotMarker(streampb.StreamEvent_SnapshotMarker_BEGIN))
+		if err != nil {
+			return false, err
+		}
+		s.data = tree.Datums{tree.NewDBytes(tree.DBytes(data))}
+		return true, nil
+	}
+
+	for {
 		select {
+		case <-ctx.Done():
+			return false, ctx.Err()
 		case err := <-s.errCh:
 			return false, err
-		default:
-			produceWait := int64(timeutil.Since(s.lastPolled))
-			s.debug.Flushes.ProduceWaitNanos.Add(produceWait)
-			s.debug.Flushes.LastProduceWaitNanos.Store(produceWait)
-			s.lastPolled = timeutil.Now()
+		case <-s.jobCheckTimer.C:
+			s.jobCheckTimer.Read = true
+			if err := s.maybeEmitStreamCanceled(ctx); err != nil {
+				return false, err
+			}
+			if s.canceled {
+				return true, nil
+			}
+			s.jobCheckTimer.Reset(jobStatusCheckInterval.Get(&s.execCfg.Settings.SV))
+		case <-s.catchUpTimer.C:
+			s.catchUpTimer.Read = true
+			if s.catchUpDone.Load() {
+				continue
+			}
+			log.Infof(ctx, "event stream did not catch up to %s within %s, ending it",
+				s.catchUpEnd, s.spec.MaxCatchUpDuration)
+			data, err := s.encodeEvent(&streampb.StreamEvent{CatchUpTimedOut: true})
+			if err != nil {
+				return false, err
+			}
+			s.data = tree.Datums{tree.NewDBytes(tree.DBytes(data))}
+			s.catchUpTimedOut = true
+			return true, nil
+		case <-s.keepaliveTimer.C:
+			s.keepaliveTimer.Read = true
+			s.keepaliveTimer.Reset(s.spec.KeepaliveInterval)
+			data, err := s.encodeEvent(&streampb.StreamEvent{Keepalive: true})
+			if err != nil {
+				return false, err
+			}
+			s.data = tree.Datums{tree.NewDBytes(tree.DBytes(data))}
 			return true, nil
+		case s.data = <-s.streamCh:
+			// Re-check the err Ch
+			select {
+			case err := <-s.errCh:
+				return false, err
+			default:
+				produceWait := int64(timeutil.Since(s.lastPolled))
+				s.debug.Flushes.ProduceWaitNanos.Add(produceWait)
+				s.debug.Flushes.LastProduceWaitNanos.Store(produceWait)
+				s.lastPolled = timeutil.Now()
+				return true, nil
+			}
 		}
 	}
 }
 
+// maybeEmitStreamCanceled checks whether the producer job has been canceled
+// and, if so, prepares the terminal StreamCanceled event as the next value
+// returned to the consumer. Consumers that predate the StreamCanceled event
+// get an error instead. Observers get an error as soon as the job stops
+// running for any reason, e.g. because its liveness lapsed.
+func (s *eventStream) maybeEmitStreamCanceled(ctx context.Context) error {
+	producerJobID := jobspb.JobID(s.streamID)
+	job, err := s.execCfg.JobRegistry.LoadJob(ctx, producerJobID)
+	if err != nil {
+		return err
+	}
+	status := job.Status()
+	if s.spec.Observer && status != jobs.StatusRunning {
+		return jobIsNotRunningError(producerJobID, status, "observe stream events")
+	}
+	if status != jobs.StatusCanceled && status != jobs.StatusCancelRequested {
+		return nil
+	}
+	if s.spec.ProtocolVersion < streampb.StreamCanceledProtocolVersion {
+		return jobIsNotRunningError(producerJobID, status, "stream events")
+	}
+
+	log.Infof(ctx, "producer job %d was canceled, ending event stream", producerJobID)
+	data, err := s.encodeEvent(&streampb.StreamEvent{StreamCanceled: true})
+	if err != nil {
+		return err
+	}
+	s.data = tree.Datums{tree.NewDBytes(tree.DBytes(data))}
+	s.canceled = true
+	return nil
+}
+
 // Values implements eval.ValueGenerator interface.
 func (s *eventStream) Values() (tree.Datums, error) {
 	return s.data, nil
@@ -263,12 +475,36 @@ func (s *eventStream) Close(ctx context.Context) {
 	if s.frontier != nil {
 		s.frontier.Release()
 	}
+	s.jobCheckTimer.Stop()
+	s.keepaliveTimer.Stop()
+	s.catchUpTimer.Stop()
+	if s.compressor != nil {
+		s.compressor.Close()
+	}
 	s.acc.Close(ctx)
 }
 
 func (s *eventStream) onInitialScanDone(ctx context.Context) {
 	// We no longer expect concurrent onValue calls so we can remove the mu.
 	s.addMu = nil
+
+	if s.spec.WithSnapshot {
+		// Flush the tail of the snapshot so that no snapshot data follows the
+		// SnapshotEnd marker.
+		if s.setErr(s.flushBatch(ctx)) {
+			return
+		}
+		s.setErr(s.sendFlush(ctx, s.snapshotMarker(streampb.StreamEvent_SnapshotMarker_END)))
+	}
+}
+
+func (s *eventStream) snapshotMarker(
+	phase streampb.StreamEvent_SnapshotMarker_Phase,
+) *streampb.StreamEvent {
+	return &streampb.StreamEvent{SnapshotMarker: &streampb.StreamEvent_SnapshotMarker{
+		Phase:     phase,
+		Timestamp: s.spec.InitialScanTimestamp,
+	}}
 }
 
 func (s *eventStream) onValues(ctx context.Context, values []kv.KeyValue) {
@@ -280,7 +516,17 @@ func (s *eventStream) onValues(ctx context.Context, values []kv.KeyValue) {
 		defer s.addMu.Unlock()
 	}
 	for _, i := range values {
-		s.seb.addKV(streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{Key: i.Key, Value: *i.Value}})
+		kv := roachpb.KeyValue{Key: i.Key, Value: *i.Value}
+		if ok, err := s.filterKV(ctx, kv); err != nil || !ok {
+			if s.setErr(err) {
+				return
+			}
+			continue
+		}
+		if s.setErr(s.annotateBatch(ctx, kv.Key)) {
+			return
+		}
+		s.seb.addKV(makeStreamEventKV(kv, roachpb.Value{}))
 	}
 	s.setErr(s.maybeFlushBatch(ctx))
 }
@@ -293,12 +539,129 @@ func (s *eventStream) onValue(ctx context.Context, value *kvpb.RangeFeedValue) {
 		s.addMu.Lock()
 		defer s.addMu.Unlock()
 	}
-	s.seb.addKV(streampb.StreamEvent_KV{
-		KeyValue: roachpb.KeyValue{Key: value.Key, Value: value.Value}, PrevValue: value.PrevValue,
-	})
+	kv := roachpb.KeyValue{Key: value.Key, Value: value.Value}
+	if ok, err := s.filterKV(ctx, kv); err != nil || !ok {
+		s.setErr(err)
+		return
+	}
+	if s.bufferCatchUp {
+		s.setErr(s.bufferCatchUpKV(ctx, makeStreamEventKV(kv, value.PrevValue)))
+		return
+	}
+	if s.commitGroups != nil {
+		s.setErr(s.bufferCommitGroupKV(ctx, makeStreamEventKV(kv, value.PrevValue)))
+		return
+	}
+	if s.setErr(s.annotateBatch(ctx, kv.Key)) {
+		return
+	}
+	s.seb.addKV(makeStreamEventKV(kv, value.PrevValue))
 	s.setErr(s.maybeFlushBatch(ctx))
 }
 
+// bufferCatchUpKV holds back a KV read while catching up, until it can be
+// emitted by flushCatchUp.
+func (s *eventStream) bufferCatchUpKV(ctx context.Context, kv streampb.StreamEvent_KV) error {
+	size := int64(kv.Size())
+	if err := s.acc.Grow(ctx, size); err != nil {
+		return errors.Wrapf(err, "buffering catch-up events since %s", s.spec.PreviousReplicatedTimestamp)
+	}
+	s.catchUpBufBytes += size
+	s.catchUpBuf = append(s.catchUpBuf, kv)
+	return nil
+}
+
+// flushCatchUp emits the buffered catch-up KVs and stops buffering. KVs at or
+// below catchUpEnd are emitted newest-first, followed by any KVs above it in
+// the order they were read.
+func (s *eventStream) flushCatchUp(ctx context.Context) error {
+	buf := s.catchUpBuf
+	s.bufferCatchUp, s.catchUpBuf = false, nil
+	defer func() {
+		s.acc.Shrink(ctx, s.catchUpBufBytes)
+		s.catchUpBufBytes = 0
+	}()
+
+	sort.SliceStable(buf, func(i, j int) bool {
+		ti, tj := buf[i].KeyValue.Value.Timestamp, buf[j].KeyValue.Value.Timestamp
+		if iTail, jTail := s.catchUpEnd.Less(ti), s.catchUpEnd.Less(tj); iTail != jTail {
+			return jTail
+		} else if iTail {
+			return false
+		}
+		return tj.Less(ti)
+	})
+	log.Infof(ctx, "event stream caught up to %s; emitting %d buffered events newest-first",
+		s.catchUpEnd, len(buf))
+	for _, kv := range buf {
+		if err := s.annotateBatch(ctx, kv.KeyValue.Key); err != nil {
+			return err
+		}
+		s.seb.addKV(kv)
+		if err := s.maybeFlushBatch(ctx); err != nil {
+			return err
+		}
+	}
+	return s.flushBatch(ctx)
+}
+
+// bufferCommitGroupKV holds back a KV of the rangefeed until a checkpoint
+// resolves its commit timestamp, so that it can be emitted along with the other
+// KVs committed at that timestamp.
+func (s *eventStream) bufferCommitGroupKV(ctx context.Context, kv streampb.StreamEvent_KV) error {
+	size := int64(kv.Size())
+	if err := s.acc.Grow(ctx, size); err != nil {
+		return errors.Wrap(err, "buffering events grouped by commit timestamp")
+	}
+	s.commitGroupBytes += size
+	ts := kv.KeyValue.Value.Timestamp
+	s.commitGroups[ts] = append(s.commitGroups[ts], kv)
+	return nil
+}
+
+// flushCommitGroups emits the held back KVs committed at or below resolved,
+// oldest first, in a batch per commit timestamp, which holds the KVs of every
+// transaction that committed at that timestamp. The batches are not annotated,
+// as streams grouped by commit timestamp have neither sub-spans nor source
+// localities. The batch holding the current KVs must have been flushed.
+func (s *eventStream) flushCommitGroups(ctx context.Context, resolved hlc.Timestamp) error {
+	var ready []hlc.Timestamp
+	for ts := range s.commitGroups {
+		if ts.LessEq(resolved) {
+			ready = append(ready, ts)
+		}
+	}
+	sort.Slice(ready, func(i, j int) bool { return ready[i].Less(ready[j]) })
+	for _, ts := range ready {
+		var size int64
+		for _, kv := range s.commitGroups[ts] {
+			s.seb.addKV(kv)
+			size += int64(kv.Size())
+		}
+		delete(s.commitGroups, ts)
+		s.acc.Shrink(ctx, size)
+		s.commitGroupBytes -= size
+		if err := s.flushBatch(ctx); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// makeStreamEventKV wraps kv for the stream, flagging MVCC tombstones as
+// deletes so that consumers needn't infer them from an empty value.
+func makeStreamEventKV(kv roachpb.KeyValue, prevValue roachpb.Value) streampb.StreamEvent_KV {
+	return streampb.StreamEvent_KV{KeyValue: kv, PrevValue: prevValue, IsDelete: !kv.Value.IsPresent()}
+}
+
+// filterKV returns whether kv passes the stream's row filter, if any.
+func (s *eventStream) filterKV(ctx context.Context, kv roachpb.KeyValue) (bool, error) {
+	if s.filter == nil {
+		return true, nil
+	}
+	return s.filter.matches(ctx, kv)
+}
+
 func (s *eventStream) onCheckpoint(ctx context.Context, checkpoint *kvpb.RangeFeedCheckpoint) {
 	s.debug.RF.Checkpoints.Add(1)
 }
@@ -312,13 +675,16 @@ func (s *eventStream) onFrontier(ctx context.Context, timestamp hlc.Timestamp) {
 func (s *eventStream) onSSTable(
 	ctx context.Context, sst *kvpb.RangeFeedSSTable, registeredSpan roachpb.Span,
 ) {
-	if s.setErr(s.addSST(sst, registeredSpan)) {
+	if s.setErr(s.addSST(ctx, sst, registeredSpan)) {
 		return
 	}
 	s.setErr(s.maybeFlushBatch(ctx))
 }
 
 func (s *eventStream) onDeleteRange(ctx context.Context, delRange *kvpb.RangeFeedDeleteRange) {
+	if s.setErr(s.annotateBatch(ctx, delRange.Span.Key)) {
+		return
+	}
 	s.seb.addDelRange(*delRange)
 	s.setErr(s.maybeFlushBatch(ctx))
 }
@@ -361,8 +727,41 @@ func (s *eventStream) sendCheckpoint(ctx context.Context, frontier rangefeed.Vis
 		return span.ContinueMatch
 	})
 	s.lastCheckpointLen = len(spans)
+	if s.bufferCatchUp {
+		// Checkpoints must not resolve the buffered events before they are
+		// emitted, so hold them back until the buffer can be flushed.
+		if !caughtUp(spans, s.catchUpEnd) {
+			return
+		}
+		if s.setErr(s.flushCatchUp(ctx)) {
+			return
+		}
+	}
+	if s.commitGroups != nil {
+		if s.setErr(s.flushCommitGroups(ctx, minResolved(spans))) {
+			return
+		}
+	}
+	if s.catchUpLimiter != nil && caughtUp(spans, s.catchUpEnd) {
+		log.Infof(ctx, "event stream caught up to %s; lifting the catch-up rate limit", s.catchUpEnd)
+		s.catchUpLimiter = nil
+	}
+	if s.localities != nil {
+		// Leases move, so re-resolve the source locality after every checkpoint.
+		s.localities.invalidate()
+	}
 
-	if s.setErr(s.sendFlush(ctx, &streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: spans}})) {
+	checkpoint := &streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: spans}}
+	if s.spec.WithResumeTokens && allResolved(spans) {
+		// A token issued before every span is resolved could not skip the
+		// initial scan, so there is no position to encode yet.
+		token, err := protoutil.Marshal(&streampb.StreamResumePosition{ResolvedSpans: spans})
+		if s.setErr(err) {
+			return
+		}
+		checkpoint.ResumeToken = token
+	}
+	if s.setErr(s.sendFlush(ctx, checkpoint)) {
 		return
 	}
 	// set the local time for pacing.
@@ -371,12 +770,82 @@ func (s *eventStream) sendCheckpoint(ctx context.Context, frontier rangefeed.Vis
 	s.debug.Flushes.Checkpoints.Add(1)
 	s.debug.LastCheckpoint.Micros.Store(s.lastCheckpointTime.UnixMicro())
 	s.debug.LastCheckpoint.Spans.Store(spans)
+
+	if s.spec.MaxCatchUpDuration > 0 && caughtUp(spans, s.catchUpEnd) {
+		s.catchUpDone.Store(true)
+	}
+	if s.pendingCatchUpComplete && caughtUp(spans, s.catchUpEnd) {
+		s.pendingCatchUpComplete = false
+		catchUpEnd := s.catchUpEnd
+		s.setErr(s.sendFlush(ctx, &streampb.StreamEvent{CatchUpComplete: &catchUpEnd}))
+	}
+}
+
+// caughtUp returns whether every span has been resolved at or above ts.
+func caughtUp(spans []jobspb.ResolvedSpan, ts hlc.Timestamp) bool {
+	for _, sp := range spans {
+		if sp.Timestamp.Less(ts) {
+			return false
+		}
+	}
+	return true
+}
+
+// minResolved returns the lowest timestamp at which the spans are resolved.
+func minResolved(spans []jobspb.ResolvedSpan) hlc.Timestamp {
+	var ts hlc.Timestamp
+	for i, sp := range spans {
+		if i == 0 || sp.Timestamp.Less(ts) {
+			ts = sp.Timestamp
+		}
+	}
+	return ts
+}
+
+// allResolved returns whether every span has a non-empty resolved timestamp.
+func allResolved(spans []jobspb.ResolvedSpan) bool {
+	for _, sp := range spans {
+		if sp.Timestamp.IsEmpty() {
+			return false
+		}
+	}
+	return true
+}
+
+// annotateBatch annotates the current batch with the sub-span and source
+// locality of key, first flushing the batch if it holds events from a different
+// sub-span or locality. Sub-spans are only tracked if the consumer provided
+// split hints, and localities if it asked for them.
+func (s *eventStream) annotateBatch(ctx context.Context, key roachpb.Key) error {
+	var subSpan roachpb.Span
+	if len(s.subSpans) > 0 {
+		subSpan = s.subSpans.find(key)
+	}
+	var locality roachpb.Locality
+	if s.localities != nil {
+		var err error
+		if locality, err = s.localities.resolve(ctx, key); err != nil {
+			return err
+		}
+	}
+	if s.seb.size > 0 && (!subSpan.Equal(s.seb.batch.SubSpan) ||
+		!locality.Equals(s.seb.batch.SourceLocality)) {
+		if err := s.flushBatch(ctx); err != nil {
+			return err
+		}
+	}
+	s.seb.batch.SubSpan = subSpan
+	s.seb.batch.SourceLocality = locality
+	return nil
 }
 
 func (s *eventStream) maybeFlushBatch(ctx context.Context) error {
 	if s.seb.size > int(s.spec.Config.BatchByteSize) {
 		return s.flushBatch(ctx)
 	}
+	if maxKVs := s.spec.Config.BatchMaxKVs; maxKVs > 0 && int64(s.seb.numKVs) >= maxKVs {
+		return s.flushBatch(ctx)
+	}
 	return nil
 }
 
@@ -384,20 +853,23 @@ func (s *eventStream) flushBatch(ctx context.Context) error {
 	if s.seb.size == 0 {
 		return nil
 	}
+	if s.catchUpLimiter != nil {
+		if err := s.catchUpLimiter.WaitN(ctx, int64(s.seb.size)); err != nil {
+			return err
+		}
+	}
 	s.debug.Flushes.Batches.Add(1)
 	s.debug.Flushes.Bytes.Add(int64(s.seb.size))
 
 	defer s.seb.reset()
 	return s.sendFlush(ctx, &streampb.StreamEvent{Batch: &s.seb.batch})
 }
+
 func (s *eventStream) sendFlush(ctx context.Context, event *streampb.StreamEvent) error {
-	data, err := protoutil.Marshal(event)
+	data, err := s.encodeEvent(event)
 	if err != nil {
 		return err
 	}
-	if s.spec.Compressed {
-		data = snappy.Encode(nil, data)
-	}
 	select {
 	case <-ctx.Done():
 		return ctx.Err()
@@ -406,6 +878,19 @@ func (s *eventStream) sendFlush(ctx context.Context, event *streampb.StreamEvent
 	}
 }
 
+// encodeEvent marshals the event, compressing it at the requested level if
+// the consumer asked for compression.
+func (s *eventStream) encodeEvent(event *streampb.StreamEvent) ([]byte, error) {
+	data, err := protoutil.Marshal(event)
+	if err != nil {
+		return nil, err
+	}
+	if s.compressor != nil {
+		data = s.compressor.Compress(data)
+	}
+	return data, nil
+}
+
 type checkpointPacer struct {
 	pace    time.Duration
 	next    time.Time
@@ -454,10 +939,16 @@ func (p *checkpointPacer) shouldCheckpoint(
 }
 
 // Add a RangeFeedSSTable into current batch.
-func (s *eventStream) addSST(sst *kvpb.RangeFeedSSTable, registeredSpan roachpb.Span) error {
+func (s *eventStream) addSST(
+	ctx context.Context, sst *kvpb.RangeFeedSSTable, registeredSpan roachpb.Span,
+) error {
 	// We send over the whole SSTable if the sst span is within
-	// the registered span boundaries.
-	if registeredSpan.Contains(sst.Span) {
+	// the registered span boundaries, unless its rows need to be
+	// filtered.
+	if registeredSpan.Contains(sst.Span) && s.filter == nil {
+		if err := s.annotateBatch(ctx, sst.Span.Key); err != nil {
+			return err
+		}
 		s.seb.addSST(*sst)
 		return nil
 	}
@@ -479,12 +970,21 @@ func (s *eventStream) addSST(sst *kvpb.RangeFeedSSTable, registeredSpan roachpb.
 			if err != nil {
 				return err
 			}
-			s.seb.addKV(
-				streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
-					Key: k.Key.Key, Value: roachpb.Value{RawBytes: v.RawBytes, Timestamp: k.Key.Timestamp}},
-				})
+			kv := roachpb.KeyValue{
+				Key: k.Key.Key, Value: roachpb.Value{RawBytes: v.RawBytes, Timestamp: k.Key.Timestamp},
+			}
+			if ok, err := s.filterKV(ctx, kv); err != nil || !ok {
+				return err
+			}
+			if err := s.annotateBatch(ctx, kv.Key); err != nil {
+				return err
+			}
+			s.seb.addKV(makeStreamEventKV(kv, roachpb.Value{}))
 			return nil
 		}, func(rk storage.MVCCRangeKeyValue) error {
+			if err := s.annotateBatch(ctx, rk.RangeKey.StartKey); err != nil {
+				return err
+			}
 			s.seb.addDelRange(kvpb.RangeFeedDeleteRange{
 				Span:      roachpb.Span{Key: rk.RangeKey.StartKey, EndKey: rk.RangeKey.EndKey},
 				Timestamp: rk.RangeKey.Timestamp,
@@ -510,6 +1010,14 @@ func (s *eventStream) validateProducerJobAndSpec(ctx context.Context) (roachpb.T
 	if job.Status() != jobs.StatusRunning {
 		return roachpb.TenantID{}, jobIsNotRunningError(producerJobID, job.Status(), "stream events")
 	}
+	if len(s.spec.RowFilters) > 0 && s.spec.Type != streampb.ReplicationType_LOGICAL {
+		return roachpb.TenantID{}, pgerror.New(pgcode.FeatureNotSupported,
+			"row filters are only supported for logical replication streams")
+	}
+	if s.spec.WithSnapshot && !s.spec.PreviousReplicatedTimestamp.IsEmpty() {
+		return roachpb.TenantID{}, pgerror.New(pgcode.InvalidParameterValue,
+			"snapshot mode requires an initial scan, but the stream is resuming from a previous replicated time")
+	}
 
 	// Validate that the requested spans are a subset of the
 	// source tenant's keyspace.
@@ -526,11 +1034,35 @@ func (s *eventStream) validateProducerJobAndSpec(ctx context.Context) (roachpb.T
 			}
 		}
 	}
+	for _, excluded := range sp.StreamReplication.ExcludedSpans {
+		for _, requested := range s.spec.Spans {
+			if excluded.Overlaps(requested) {
+				return roachpb.TenantID{}, pgerror.Newf(pgcode.InvalidParameterValue,
+					"requested span %s overlaps span %s excluded from the replication stream", requested, excluded)
+			}
+		}
+	}
 	return sourceTenantID, nil
 }
 
 const defaultBatchSize = 1 << 20
 
+// checkProtocolVersion returns an error if the producer cannot emit events in
+// the stream protocol version requested by the consumer.
+func checkProtocolVersion(consumerVersion uint32) error {
+	if consumerVersion == 0 {
+		// The consumer predates protocol versioning.
+		consumerVersion = 1
+	}
+	if consumerVersion < streampb.MinStreamProtocolVersion || consumerVersion > streampb.StreamProtocolVersion {
+		return pgerror.Newf(pgcode.FeatureNotSupported,
+			"incompatible stream protocol version: consumer requested version %d, "+
+				"but producer supports versions %d through %d",
+			consumerVersion, streampb.MinStreamProtocolVersion, streampb.StreamProtocolVersion)
+	}
+	return nil
+}
+
 func streamPartition(
 	evalCtx *eval.Context, streamID streampb.StreamID, opaqueSpec []byte,
 ) (eval.ValueGenerator, error) {
@@ -544,8 +1076,36 @@ func streamPartition(
 	if len(spec.Spans) == 0 {
 		return nil, errors.AssertionFailedf("expected at least one span, got none")
 	}
-	spec.Config.BatchByteSize = defaultBatchSize
+	if err := checkProtocolVersion(spec.ProtocolVersion); err != nil {
+		return nil, err
+	}
+	if spec.GroupByCommitTimestamp {
+		// Grouped batches must not be split by key, which annotating them with
+		// their sub-span or source locality would do.
+		if spec.NewestFirstCatchUp {
+			return nil, errors.New("a stream grouped by commit timestamp cannot emit its catch-up newest-first")
+		}
+		if spec.WithSourceLocality {
+			return nil, errors.New("a stream grouped by commit timestamp cannot annotate batches with their source locality")
+		}
+		if len(spec.SplitHints) > 0 {
+			return nil, errors.New("a stream grouped by commit timestamp cannot be split by hints")
+		}
+	}
+	if len(spec.ResumeToken) > 0 {
+		if err := applyResumeToken(&spec); err != nil {
+			return nil, err
+		}
+	}
+	if spec.Config.BatchByteSize <= 0 {
+		spec.Config.BatchByteSize = defaultBatchSize
+	}
 	spec.Config.MinCheckpointFrequency = crosscluster.StreamReplicationMinCheckpointFrequency.Get(&evalCtx.Settings.SV)
+	if spec.MaxStaleness > 0 {
+		// Checkpoints spaced further apart than the staleness bound would leave
+		// the consumer behind it regardless of the resolved timestamps.
+		spec.Config.MinCheckpointFrequency = min(spec.Config.MinCheckpointFrequency, spec.MaxStaleness)
+	}
 
 	execCfg := evalCtx.Planner.ExecutorConfig().(*sql.ExecutorConfig)
 
@@ -553,7 +1113,29 @@ func streamPartition(
 		streamID: streamID,
 		spec:     spec,
 		execCfg:  execCfg,
+		evalCtx:  evalCtx,
 		mon:      evalCtx.Planner.Mon(),
 		seb:      streamEventBatcher{wrappedKVs: spec.WrappedEvents},
 	}, nil
 }
+
+// applyResumeToken replaces the starting position of spec with the one encoded
+// in its resume token.
+func applyResumeToken(spec *streampb.StreamPartitionSpec) error {
+	var pos streampb.StreamResumePosition
+	if err := protoutil.Unmarshal(spec.ResumeToken, &pos); err != nil {
+		return pgerror.Wrap(err, pgcode.InvalidParameterValue, "invalid resume token")
+	}
+	var resumeFrom hlc.Timestamp
+	for i, rs := range pos.ResolvedSpans {
+		if i == 0 || rs.Timestamp.Less(resumeFrom) {
+			resumeFrom = rs.Timestamp
+		}
+	}
+	if resumeFrom.IsEmpty() {
+		return pgerror.New(pgcode.InvalidParameterValue, "invalid resume token: no resolved position")
+	}
+	spec.PreviousReplicatedTimestamp = resumeFrom
+	spec.Progress = pos.ResolvedSpans
+	return nil
+}
@@ -188,6 +188,27 @@ func (r *replicationStreamManagerImpl) GetPhysicalReplicationStreamSpec(
 	return getPhysicalReplicationStreamSpec(ctx, r.evalCtx, r.txn, streamID)
 }
 
+// GetReplicationStreamHistory implements ReplicationStreamManager interface.
+func (r *replicationStreamManagerImpl) GetReplicationStreamHistory(
+	ctx context.Context, streamID streampb.StreamID,
+) (*streampb.StreamStatusHistory, error) {
+	if err := r.checkLicense(); err != nil {
+		return nil, err
+	}
+	return getReplicationStreamHistory(ctx, r.evalCtx, r.txn, streamID)
+}
+
+// GetReplicationStreamProtectedTimestamp implements ReplicationStreamManager
+// interface.
+func (r *replicationStreamManagerImpl) GetReplicationStreamProtectedTimestamp(
+	ctx context.Context, streamID streampb.StreamID,
+) (*streampb.StreamProtectedTimestamp, error) {
+	if err := r.checkLicense(); err != nil {
+		return nil, err
+	}
+	return getReplicationStreamProtectedTimestamp(ctx, r.evalCtx, r.txn, streamID)
+}
+
 // CompleteReplicationStream implements ReplicationStreamManager interface.
 func (r *replicationStreamManagerImpl) CompleteReplicationStream(
 	ctx context.Context, streamID streampb.StreamID, successfulIngestion bool,
@@ -198,6 +219,26 @@ func (r *replicationStreamManagerImpl) CompleteReplicationStream(
 	return completeReplicationStream(ctx, r.evalCtx, r.txn, streamID, successfulIngestion)
 }
 
+// PauseReplicationStream implements ReplicationStreamManager interface.
+func (r *replicationStreamManagerImpl) PauseReplicationStream(
+	ctx context.Context, streamID streampb.StreamID,
+) error {
+	if err := r.checkLicense(); err != nil {
+		return err
+	}
+	return pauseReplicationStream(ctx, r.evalCtx, r.txn, streamID)
+}
+
+// ResumeReplicationStream implements ReplicationStreamManager interface.
+func (r *replicationStreamManagerImpl) ResumeReplicationStream(
+	ctx context.Context, streamID streampb.StreamID,
+) error {
+	if err := r.checkLicense(); err != nil {
+		return err
+	}
+	return resumeReplicationStream(ctx, r.evalCtx, r.txn, streamID)
+}
+
 func (r *replicationStreamManagerImpl) SetupSpanConfigsStream(
 	ctx context.Context, tenantName roachpb.TenantName,
 ) (eval.ValueGenerator, error) {
@@ -114,6 +114,28 @@ func (d *partitionStreamDecoder) pop() crosscluster.Event {
 		return event
 	}
 
+	if d.e.ResumeToken != nil {
+		event := crosscluster.MakeResumeTokenEvent(d.e.ResumeToken)
+		d.e.ResumeToken = nil
+		return event
+	}
+
+	if d.e.CatchUpTimedOut {
+		d.e.CatchUpTimedOut = false
+		return crosscluster.MakeCatchUpTimedOutEvent()
+	}
+
+	if d.e.Keepalive {
+		d.e.Keepalive = false
+		return crosscluster.MakeKeepaliveEvent()
+	}
+
+	if d.e.CatchUpComplete != nil {
+		event := crosscluster.MakeCatchUpCompleteEvent(*d.e.CatchUpComplete)
+		d.e.CatchUpComplete = nil
+		return event
+	}
+
 	if d.e.Batch != nil {
 		event := crosscluster.MakeKVEvent(d.e.Batch.KVs[0:1])
 		d.e.Batch.KVs = d.e.Batch.KVs[1:]
@@ -131,7 +153,8 @@ func (d *partitionStreamDecoder) decode() {
 	require.NoError(d.t, d.rows.Scan(&data))
 	var streamEvent streampb.StreamEvent
 	require.NoError(d.t, protoutil.Unmarshal(data, &streamEvent))
-	if streamEvent.Checkpoint == nil && streamEvent.Batch == nil {
+	if streamEvent.Checkpoint == nil && streamEvent.Batch == nil && !streamEvent.Keepalive &&
+		streamEvent.CatchUpComplete == nil && streamEvent.ResumeToken == nil && !streamEvent.CatchUpTimedOut {
 		d.t.Fatalf("unexpected event type")
 	}
 	d.e = streamEvent
@@ -412,6 +435,97 @@ USE d;
 		require.Equal(t, expected.Value.RawBytes, secondObserved.Value.RawBytes)
 	})
 
+	t.Run("stream-table-with-diff", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t15(i INT PRIMARY KEY, a STRING, b STRING)`)
+		srcTenant.SQL.Exec(t, `INSERT INTO t15 VALUES (42, 'hello', 'there')`)
+		t15Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t15")
+		afterInsertTS := h.SysServer.Clock().Now()
+
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			afterInsertTS, "t15"), &spec))
+		spec.WithDiff = true
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		_, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		// The update carries the new value of the row along with the value it
+		// replaced.
+		srcTenant.SQL.Exec(t, `UPDATE t15 SET b = 'world' WHERE i = 42`)
+		before := replicationtestutils.EncodeKV(t, srcTenant.Codec, t15Descr, 42, "hello", "there")
+		after := replicationtestutils.EncodeKV(t, srcTenant.Codec, t15Descr, 42, "hello", "world")
+		updated := feed.ObserveKVEvent(ctx, after.Key)
+		require.Equal(t, after.Value.TagAndDataBytes(), updated.KeyValue.Value.TagAndDataBytes())
+		require.Equal(t, before.Value.TagAndDataBytes(), updated.PrevValue.TagAndDataBytes())
+	})
+
+	t.Run("stream-table-grouped-by-commit-timestamp", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t16(i INT PRIMARY KEY, a STRING)`)
+		t16Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t16")
+		afterCreateTS := h.SysServer.Clock().Now()
+
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			afterCreateTS, "t16"), &spec))
+		spec.GroupByCommitTimestamp = true
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		srcTenant.SQL.Exec(t, `BEGIN;
+INSERT INTO t16 VALUES (1, 'a');
+INSERT INTO t16 VALUES (2, 'b'), (3, 'c');
+COMMIT`)
+		var expected []roachpb.Key
+		for i := 1; i <= 3; i++ {
+			expected = append(expected, replicationtestutils.EncodeKV(t, srcTenant.Codec, t16Descr, i).Key)
+		}
+
+		// All of the transaction's rows arrive in the first batch of KVs.
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		for {
+			require.True(t, source.mu.rows.Next())
+			source.mu.codec.decode()
+			if codec.e.Batch == nil || len(codec.e.Batch.KVs) == 0 {
+				continue
+			}
+			var keys []roachpb.Key
+			for _, kv := range codec.e.Batch.KVs {
+				keys = append(keys, kv.KeyValue.Key)
+				require.Equal(t, codec.e.Batch.KVs[0].KeyValue.Value.Timestamp, kv.KeyValue.Value.Timestamp)
+			}
+			require.ElementsMatch(t, expected, keys)
+			break
+		}
+	})
+
+	t.Run("stream-deletes", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t6(i INT PRIMARY KEY, a STRING)`)
+		srcTenant.SQL.Exec(t, `INSERT INTO t6 VALUES (1, 'hello')`)
+		t6Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t6")
+
+		_, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, encodeSpec(t, h, srcTenant, initialScanTimestamp,
+				hlc.Timestamp{}, "t6"))
+		defer feed.Close(ctx)
+
+		key := replicationtestutils.EncodeKV(t, srcTenant.Codec, t6Descr, 1).Key
+		inserted := feed.ObserveKVEvent(ctx, key)
+		require.False(t, inserted.IsDelete)
+
+		srcTenant.SQL.Exec(t, `DELETE FROM t6 WHERE i = 1`)
+		deleted := feed.ObserveKVEvent(ctx, key)
+		require.True(t, deleted.IsDelete)
+		require.Equal(t, key, deleted.KeyValue.Key)
+		require.False(t, deleted.KeyValue.Value.IsPresent())
+	})
+
 	t.Run("stream-batches-events", func(t *testing.T) {
 		srcTenant.SQL.Exec(t, `
 CREATE TABLE t3(
@@ -455,6 +569,701 @@ CREATE TABLE t3(
 			}
 		}
 	})
+
+	t.Run("batch-max-kvs", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t7(i INT PRIMARY KEY, v STRING)`)
+		const numRows = 100
+		srcTenant.SQL.Exec(t, `INSERT INTO t7 SELECT i, 'v' FROM generate_series(1, $1) AS g(i)`, numRows)
+
+		const maxKVs = 8
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			hlc.Timestamp{}, "t7"), &spec))
+		spec.Config.BatchMaxKVs = maxKVs
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		// Count the wire messages carrying the initial scan's KVs. Every row
+		// must be delivered, packed into messages of at most maxKVs KVs.
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		var messages int
+		for seen := 0; seen < numRows; {
+			require.True(t, source.mu.rows.Next())
+			source.mu.codec.decode()
+			if codec.e.Batch == nil || len(codec.e.Batch.KVs) == 0 {
+				continue
+			}
+			require.LessOrEqual(t, len(codec.e.Batch.KVs), maxKVs)
+			messages++
+			seen += len(codec.e.Batch.KVs)
+		}
+		require.Less(t, messages, numRows)
+		require.GreaterOrEqual(t, messages, numRows/maxKVs)
+	})
+
+	t.Run("split-hints", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t8(i INT PRIMARY KEY, v STRING)`)
+		const numRows = 90
+		srcTenant.SQL.Exec(t, `INSERT INTO t8 SELECT i, 'v' FROM generate_series(1, $1) AS g(i)`, numRows)
+		t8Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t8")
+
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			hlc.Timestamp{}, "t8"), &spec))
+		require.Len(t, spec.Spans, 1)
+		tableSpan := spec.Spans[0]
+		hints := []roachpb.Key{
+			replicationtestutils.EncodeKV(t, srcTenant.Codec, t8Descr, 31).Key,
+			replicationtestutils.EncodeKV(t, srcTenant.Codec, t8Descr, 61).Key,
+		}
+		spec.SplitHints = hints
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		expected := []roachpb.Span{
+			{Key: tableSpan.Key, EndKey: hints[0]},
+			{Key: hints[0], EndKey: hints[1]},
+			{Key: hints[1], EndKey: tableSpan.EndKey},
+		}
+
+		// Every batch of the initial scan must be annotated with one of the
+		// sub-spans delimited by the hints, and only hold KVs within it.
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		seenSubSpans := make(map[string]int)
+		for seen := 0; seen < numRows; {
+			require.True(t, source.mu.rows.Next())
+			source.mu.codec.decode()
+			if codec.e.Batch == nil || len(codec.e.Batch.KVs) == 0 {
+				continue
+			}
+			subSpan := codec.e.Batch.SubSpan
+			require.Contains(t, expected, subSpan)
+			for _, kv := range codec.e.Batch.KVs {
+				require.True(t, subSpan.ContainsKey(kv.KeyValue.Key),
+					"%s not in %s", kv.KeyValue.Key, subSpan)
+			}
+			seenSubSpans[subSpan.String()] += len(codec.e.Batch.KVs)
+			seen += len(codec.e.Batch.KVs)
+		}
+		for _, sp := range expected {
+			require.Equal(t, numRows/len(expected), seenSubSpans[sp.String()], "rows in %s", sp)
+		}
+	})
+
+	t.Run("catch-up-rate-limit", func(t *testing.T) {
+		h.SysSQL.Exec(t, `SET CLUSTER SETTING stream_replication.min_checkpoint_frequency = '10ms'`)
+		defer h.SysSQL.Exec(t, `RESET CLUSTER SETTING stream_replication.min_checkpoint_frequency`)
+
+		srcTenant.SQL.Exec(t, `CREATE TABLE t5(i INT PRIMARY KEY, payload STRING)`)
+		beforeInsertTS := h.SysServer.Clock().Now()
+		const numRows = 40
+		srcTenant.SQL.Exec(t, `INSERT INTO t5 SELECT i, repeat('x', 1024) FROM generate_series(1, $1) AS g(i)`, numRows)
+
+		const limit = 8 << 10 // 8 KiB/s
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			beforeInsertTS, "t5"), &spec))
+		spec.Config.CatchUpBytesPerSecond = limit
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+
+		start := timeutil.Now()
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		// Read batches until the catch-up scan has delivered every row.
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		var caughtUpBytes int64
+		for seen := 0; seen < numRows; {
+			require.True(t, source.mu.rows.Next())
+			source.mu.codec.decode()
+			if codec.e.Batch == nil {
+				continue
+			}
+			for _, kv := range codec.e.Batch.KVs {
+				caughtUpBytes += int64(kv.Size())
+				seen++
+			}
+		}
+		elapsed := timeutil.Since(start)
+
+		// Apart from the limiter's initial burst of one second's worth of bytes,
+		// the catch-up scan cannot have been delivered faster than the limit.
+		require.Greater(t, caughtUpBytes, int64(2*limit))
+		minElapsed := time.Duration(float64(caughtUpBytes-limit) / limit * float64(time.Second))
+		require.GreaterOrEqual(t, elapsed, minElapsed,
+			"caught up on %d bytes in %s at a limit of %d bytes/s", caughtUpBytes, elapsed, limit)
+	})
+
+	t.Run("keepalive", func(t *testing.T) {
+		// Only the first checkpoint is emitted promptly, so the stream is idle
+		// apart from keepalives after it.
+		h.SysSQL.Exec(t, `SET CLUSTER SETTING stream_replication.min_checkpoint_frequency = '1h'`)
+		defer h.SysSQL.Exec(t, `RESET CLUSTER SETTING stream_replication.min_checkpoint_frequency`)
+
+		srcTenant.SQL.Exec(t, `CREATE TABLE t11(i INT PRIMARY KEY)`)
+		const interval = 100 * time.Millisecond
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			h.SysServer.Clock().Now(), "t11"), &spec))
+		spec.KeepaliveInterval = interval
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		var resolved hlc.Timestamp
+		for resolved.IsEmpty() {
+			ev, ok := source.Next()
+			require.True(t, ok)
+			if ev.Type() == crosscluster.CheckpointEvent {
+				resolved = ev.GetResolvedSpans()[0].Timestamp
+			}
+		}
+
+		// With no writes, keepalives keep arriving at the interval, and the
+		// frontier stays where the first checkpoint left it.
+		const numKeepalives = 5
+		start := timeutil.Now()
+		for seen := 0; seen < numKeepalives; {
+			ev, ok := source.Next()
+			require.True(t, ok)
+			switch ev.Type() {
+			case crosscluster.KeepaliveEvent:
+				seen++
+			case crosscluster.CheckpointEvent:
+				require.Equal(t, resolved, ev.GetResolvedSpans()[0].Timestamp)
+			default:
+				t.Fatalf("unexpected event %v", ev)
+			}
+		}
+		require.GreaterOrEqual(t, timeutil.Since(start), (numKeepalives-1)*interval)
+	})
+
+	t.Run("range-tombstones", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t9(i INT PRIMARY KEY)`)
+		const numRows = 20
+		srcTenant.SQL.Exec(t, `INSERT INTO t9 SELECT generate_series(1, $1)`, numRows)
+		t9Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t9")
+		tableSpan := t9Descr.PrimaryIndexSpan(srcTenant.Codec)
+
+		beforeDelRange := h.SysServer.Clock().Now()
+		require.NoError(t, h.SysServer.DB().DelRangeUsingTombstone(ctx, tableSpan.Key, tableSpan.EndKey))
+		delRangeTS := h.SysServer.Clock().Now()
+
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, encodeSpec(t, h, srcTenant, initialScanTimestamp,
+				beforeDelRange, "t9"))
+		defer feed.Close(ctx)
+
+		// The range deletion is delivered as a single DelRange covering the
+		// table rather than as a deletion of each row.
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		for {
+			require.True(t, source.mu.rows.Next())
+			source.mu.codec.decode()
+			if codec.e.Batch == nil {
+				continue
+			}
+			require.Empty(t, codec.e.Batch.KVs)
+			if len(codec.e.Batch.DelRanges) > 0 {
+				require.Len(t, codec.e.Batch.DelRanges, 1)
+				delRange := codec.e.Batch.DelRanges[0]
+				require.Equal(t, tableSpan, delRange.Span)
+				require.True(t, beforeDelRange.Less(delRange.Timestamp))
+				require.True(t, delRange.Timestamp.Less(delRangeTS))
+				break
+			}
+		}
+	})
+
+	t.Run("newest-first-catch-up", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t10(i INT PRIMARY KEY, a INT)`)
+		srcTenant.SQL.Exec(t, `INSERT INTO t10 VALUES (1, 0)`)
+		beforeUpdates := h.SysServer.Clock().Now()
+		const numVersions = 5
+		for i := 1; i <= numVersions; i++ {
+			srcTenant.SQL.Exec(t, `UPDATE t10 SET a = $1 WHERE i = 1`, i)
+		}
+
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			beforeUpdates, "t10"), &spec))
+		spec.NewestFirstCatchUp = true
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		// Every version written during the catch-up window arrives ahead of the
+		// first checkpoint, newest-first.
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		var timestamps []hlc.Timestamp
+		for {
+			require.True(t, source.mu.rows.Next())
+			source.mu.codec.decode()
+			if codec.e.Checkpoint != nil {
+				break
+			}
+			if codec.e.Batch == nil {
+				continue
+			}
+			for _, kv := range codec.e.Batch.KVs {
+				timestamps = append(timestamps, kv.KeyValue.Value.Timestamp)
+			}
+		}
+		require.Len(t, timestamps, numVersions)
+		for i := 1; i < len(timestamps); i++ {
+			require.True(t, timestamps[i].Less(timestamps[i-1]),
+				"expected %s to precede %s", timestamps[i-1], timestamps[i])
+		}
+	})
+
+	t.Run("catch-up-complete", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t12(i INT PRIMARY KEY)`)
+		beforeInserts := h.SysServer.Clock().Now()
+		const numRows = 10
+		srcTenant.SQL.Exec(t, `INSERT INTO t12 SELECT generate_series(1, $1)`, numRows)
+
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			beforeInserts, "t12"), &spec))
+		spec.WithCatchUpComplete = true
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		// Every historical row arrives ahead of the CatchUpComplete event.
+		var historical int
+		var catchUpTS hlc.Timestamp
+		for catchUpTS.IsEmpty() {
+			ev, ok := source.Next()
+			require.True(t, ok)
+			switch ev.Type() {
+			case crosscluster.KVEvent:
+				historical += len(ev.GetKVs())
+			case crosscluster.CatchUpCompleteEvent:
+				catchUpTS = ev.GetCatchUpTimestamp()
+			}
+		}
+		require.Equal(t, numRows, historical)
+
+		// Rows written after the stream caught up follow it, and the event is
+		// not repeated.
+		srcTenant.SQL.Exec(t, `INSERT INTO t12 VALUES ($1)`, numRows+1)
+		t12Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t12")
+		expected := replicationtestutils.EncodeKV(t, srcTenant.Codec, t12Descr, numRows+1)
+		for {
+			ev, ok := source.Next()
+			require.True(t, ok)
+			require.NotEqual(t, crosscluster.CatchUpCompleteEvent, ev.Type())
+			if ev.Type() != crosscluster.KVEvent {
+				continue
+			}
+			if kv := ev.GetKVs()[0].KeyValue; kv.Key.Equal(expected.Key) {
+				require.True(t, catchUpTS.Less(kv.Value.Timestamp))
+				break
+			}
+		}
+	})
+
+	t.Run("resume-token", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t13(i INT PRIMARY KEY)`)
+		t13Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t13")
+		rowKey := func(i int) string {
+			return string(replicationtestutils.EncodeKV(t, srcTenant.Codec, t13Descr, i).Key)
+		}
+		beforeInserts := h.SysServer.Clock().Now()
+		srcTenant.SQL.Exec(t, `INSERT INTO t13 VALUES (1), (2), (3)`)
+		afterInserts := h.SysServer.Clock().Now()
+
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			beforeInserts, "t13"), &spec))
+		spec.WithResumeTokens = true
+
+		// readUntil collects the rows the feed delivers until it has resolved
+		// every change up to ts, and returns them along with the resume token
+		// that follows the checkpoint.
+		readUntil := func(source *pgConnReplicationFeedSource, ts hlc.Timestamp) (map[string]int, []byte) {
+			rows := make(map[string]int)
+			var resolved hlc.Timestamp
+			for {
+				ev, ok := source.Next()
+				require.True(t, ok)
+				switch ev.Type() {
+				case crosscluster.KVEvent:
+					for _, kv := range ev.GetKVs() {
+						rows[string(kv.KeyValue.Key)]++
+					}
+				case crosscluster.CheckpointEvent:
+					resolved = ev.GetResolvedSpans()[0].Timestamp
+				case crosscluster.ResumeTokenEvent:
+					if ts.LessEq(resolved) {
+						return rows, ev.GetResumeToken()
+					}
+				}
+			}
+		}
+
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		rows, token := readUntil(source, afterInserts)
+		feed.Close(ctx)
+		require.Equal(t, map[string]int{rowKey(1): 1, rowKey(2): 1, rowKey(3): 1}, rows)
+		require.NotEmpty(t, token)
+
+		// Resuming from the token delivers the rows written since, and only
+		// those, exactly once.
+		srcTenant.SQL.Exec(t, `INSERT INTO t13 VALUES (4), (5)`)
+		afterResume := h.SysServer.Clock().Now()
+		spec.ResumeToken = token
+		opaqueSpec, err = protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		source, feed = startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+		rows, _ = readUntil(source, afterResume)
+		require.Equal(t, map[string]int{rowKey(4): 1, rowKey(5): 1}, rows)
+	})
+
+	t.Run("catch-up-timeout", func(t *testing.T) {
+		srcTenant.SQL.Exec(t, `CREATE TABLE t14(i INT PRIMARY KEY, payload STRING)`)
+		beforeInserts := h.SysServer.Clock().Now()
+		const numRows = 40
+		srcTenant.SQL.Exec(t, `INSERT INTO t14 SELECT i, repeat('x', 1024) FROM generate_series(1, $1) AS g(i)`, numRows)
+
+		// Throttle the catch-up so that it would take tens of seconds, well
+		// past the deadline.
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			beforeInserts, "t14"), &spec))
+		spec.Config.CatchUpBytesPerSecond = 1 << 10
+		spec.MaxCatchUpDuration = 500 * time.Millisecond
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		var rows int
+		for {
+			ev, ok := source.Next()
+			require.True(t, ok)
+			if ev.Type() == crosscluster.CatchUpTimedOutEvent {
+				break
+			}
+			if ev.Type() == crosscluster.KVEvent {
+				rows += len(ev.GetKVs())
+			}
+		}
+		require.Less(t, rows, numRows)
+
+		// The timeout is the last event of the stream.
+		_, ok := source.Next()
+		require.False(t, ok)
+		require.NoError(t, source.Error())
+	})
+
+	t.Run("protocol-version-mismatch", func(t *testing.T) {
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			hlc.Timestamp{}, "t1"), &spec))
+		spec.ProtocolVersion = streampb.StreamProtocolVersion + 1
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+
+		_, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		expectedErr := fmt.Sprintf("consumer requested version %d", streampb.StreamProtocolVersion+1)
+		feed.ObserveError(ctx, func(err error) bool {
+			return strings.Contains(err.Error(), "incompatible stream protocol version") &&
+				strings.Contains(err.Error(), expectedErr)
+		})
+	})
+
+	t.Run("grouped-by-commit-timestamp-with-source-locality", func(t *testing.T) {
+		var spec streampb.StreamPartitionSpec
+		require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant, initialScanTimestamp,
+			hlc.Timestamp{}, "t1"), &spec))
+		spec.GroupByCommitTimestamp = true
+		spec.WithSourceLocality = true
+		opaqueSpec, err := protoutil.Marshal(&spec)
+		require.NoError(t, err)
+
+		_, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, opaqueSpec)
+		defer feed.Close(ctx)
+
+		feed.ObserveError(ctx, func(err error) bool {
+			return strings.Contains(err.Error(), "cannot annotate batches with their source locality")
+		})
+	})
+}
+
+func TestStreamPartitionRowFilter(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	h, cleanup := replicationtestutils.NewReplicationHelper(t,
+		base.TestServerArgs{
+			DefaultTestTenant: base.TestControlsTenantsExplicitly,
+		})
+	defer cleanup()
+
+	h.SysSQL.Exec(t, `
+CREATE DATABASE d;
+CREATE TABLE d.t(region STRING, id INT, v STRING, PRIMARY KEY (region, id));
+INSERT INTO d.t VALUES ('us', 1, 'a'), ('eu', 2, 'b'), ('us', 3, 'c');
+`)
+
+	ctx := context.Background()
+	reqBytes, err := protoutil.Marshal(&streampb.ReplicationProducerRequest{TableNames: []string{"d.t"}})
+	require.NoError(t, err)
+	var rawSpec []byte
+	h.SysSQL.QueryRow(t, `SELECT crdb_internal.start_replication_stream_for_tables($1)`, reqBytes).Scan(&rawSpec)
+	var producerSpec streampb.ReplicationProducerSpec
+	require.NoError(t, protoutil.Unmarshal(rawSpec, &producerSpec))
+
+	codec := keys.SystemSQLCodec
+	desc := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), codec, "d", "t")
+	spec := &streampb.StreamPartitionSpec{
+		InitialScanTimestamp: producerSpec.ReplicationStartTime,
+		Spans:                []roachpb.Span{desc.PrimaryIndexSpan(codec)},
+		WrappedEvents:        true,
+		Type:                 streampb.ReplicationType_LOGICAL,
+		Config: streampb.StreamPartitionSpec_ExecutionConfig{
+			MinCheckpointFrequency: 10 * time.Millisecond,
+		},
+		RowFilters: []streampb.RowFilter{{
+			TableID: int32(desc.GetID()),
+			Column:  "region",
+			Op:      streampb.RowFilter_EQ,
+			Value:   "us",
+		}},
+	}
+	opaqueSpec, err := protoutil.Marshal(spec)
+	require.NoError(t, err)
+
+	source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+		`SELECT * FROM crdb_internal.stream_partition($1, $2)`, producerSpec.StreamID, opaqueSpec)
+	defer feed.Close(ctx)
+
+	// Rows written after the initial scan must be filtered too.
+	h.SysSQL.Exec(t, `INSERT INTO d.t VALUES ('eu', 4, 'd'), ('us', 5, 'e'), ('ap', 6, 'f')`)
+	afterInserts := h.SysServer.Clock().Now()
+
+	expected := make(map[string]struct{})
+	for _, id := range []int{1, 3, 5} {
+		expected[string(replicationtestutils.EncodeKV(t, codec, desc, "us", id).Key)] = struct{}{}
+	}
+	seen := make(map[string]struct{})
+	resolved := false
+	for !resolved || len(seen) < len(expected) {
+		ev, ok := source.Next()
+		require.True(t, ok, "feed ended: %v", source.Error())
+		switch ev.Type() {
+		case crosscluster.KVEvent:
+			for _, kv := range ev.GetKVs() {
+				key := string(kv.KeyValue.Key)
+				_, ok := expected[key]
+				require.True(t, ok, "unexpected key %s", kv.KeyValue.Key)
+				seen[key] = struct{}{}
+			}
+		case crosscluster.CheckpointEvent:
+			resolved = afterInserts.LessEq(ev.GetResolvedSpans()[0].Timestamp)
+		}
+	}
+}
+
+func TestStreamPartitionExcludedSpans(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	h, cleanup := replicationtestutils.NewReplicationHelper(t,
+		base.TestServerArgs{
+			DefaultTestTenant: base.TestControlsTenantsExplicitly,
+		})
+	defer cleanup()
+	testTenantName := roachpb.TenantName("test-tenant")
+	srcTenant, cleanupTenant := h.CreateTenant(t, serverutils.TestTenantID(), testTenantName)
+	defer cleanupTenant()
+
+	srcTenant.SQL.Exec(t, `
+CREATE DATABASE d;
+CREATE TABLE d.t1(i int primary key);
+CREATE TABLE d.t2(i int primary key);
+INSERT INTO d.t1 VALUES (1);
+INSERT INTO d.t2 VALUES (1);
+`)
+	t1Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t1")
+	excluded := h.TableSpan(srcTenant.Codec, "t2")
+
+	ctx := context.Background()
+	reqBytes, err := protoutil.Marshal(&streampb.ReplicationProducerRequest{
+		ExcludedSpans: []roachpb.Span{excluded},
+	})
+	require.NoError(t, err)
+	var rawProducerSpec []byte
+	h.SysSQL.QueryRow(t, `SELECT crdb_internal.start_replication_stream($1, $2)`,
+		testTenantName, reqBytes).Scan(&rawProducerSpec)
+	var producerSpec streampb.ReplicationProducerSpec
+	require.NoError(t, protoutil.Unmarshal(rawProducerSpec, &producerSpec))
+	streamID := producerSpec.StreamID
+
+	// The planned partitions cover the tenant's keyspace except for the
+	// excluded span.
+	var rawSpec []byte
+	h.SysSQL.QueryRow(t, "SELECT crdb_internal.replication_stream_spec($1)", streamID).Scan(&rawSpec)
+	var spec streampb.ReplicationStreamSpec
+	require.NoError(t, protoutil.Unmarshal(rawSpec, &spec))
+	require.Equal(t, []roachpb.Span{excluded}, spec.ExcludedSpans)
+	var planned roachpb.SpanGroup
+	for _, p := range spec.Partitions {
+		planned.Add(p.SourcePartition.Spans...)
+	}
+	var expected roachpb.SpanGroup
+	expected.Add(keys.MakeTenantSpan(srcTenant.ID))
+	expected.Sub(excluded)
+	require.Equal(t, expected.Slice(), planned.Slice())
+
+	const streamPartitionQuery = `SELECT * FROM crdb_internal.stream_partition($1, $2)`
+
+	t.Run("excluded-span-rejected", func(t *testing.T) {
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, encodeSpecForSpans(t, producerSpec.ReplicationStartTime,
+				hlc.Timestamp{}, []roachpb.Span{excluded}))
+		defer feed.Close(ctx)
+		_, ok := source.Next()
+		require.False(t, ok)
+		require.ErrorContains(t, source.Error(), "excluded from the replication stream")
+	})
+
+	t.Run("no-events-for-excluded-span", func(t *testing.T) {
+		spans := planned.Slice()
+		source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+			streamPartitionQuery, streamID, encodeSpecForSpans(t, producerSpec.ReplicationStartTime,
+				hlc.Timestamp{}, spans))
+		defer feed.Close(ctx)
+
+		srcTenant.SQL.Exec(t, `INSERT INTO d.t1 VALUES (2); INSERT INTO d.t2 VALUES (2)`)
+		afterInserts := h.SysServer.Clock().Now()
+
+		// The stream spans more than one span, so its checkpoints are read off
+		// the wire rather than through the feed.
+		t1Key := replicationtestutils.EncodeKV(t, srcTenant.Codec, t1Descr, 2).Key
+		frontier, err := span.MakeFrontier(spans...)
+		require.NoError(t, err)
+		source.mu.Lock()
+		defer source.mu.Unlock()
+		codec := source.mu.codec.(*partitionStreamDecoder)
+		sawT1 := false
+		for !sawT1 || frontier.Frontier().Less(afterInserts) {
+			require.True(t, source.mu.rows.Next(), "feed ended: %v", source.mu.rows.Err())
+			source.mu.codec.decode()
+			if codec.e.Batch != nil {
+				for _, kv := range codec.e.Batch.KVs {
+					require.False(t, excluded.ContainsKey(kv.KeyValue.Key),
+						"unexpected key %s in excluded span", kv.KeyValue.Key)
+					if kv.KeyValue.Key.Equal(t1Key) {
+						sawT1 = true
+					}
+				}
+			}
+			if codec.e.Checkpoint != nil {
+				for _, rs := range codec.e.Checkpoint.ResolvedSpans {
+					_, err := frontier.Forward(rs.Span, rs.Timestamp)
+					require.NoError(t, err)
+				}
+			}
+		}
+	})
+}
+
+func TestStreamPartitionObserver(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	h, cleanup := replicationtestutils.NewReplicationHelper(t,
+		base.TestServerArgs{
+			DefaultTestTenant: base.TestControlsTenantsExplicitly,
+			Knobs: base.TestingKnobs{
+				JobsTestingKnobs: jobs.NewTestingKnobsWithShortIntervals(),
+			},
+		})
+	defer cleanup()
+	testTenantName := roachpb.TenantName("test-tenant")
+	srcTenant, cleanupTenant := h.CreateTenant(t, serverutils.TestTenantID(), testTenantName)
+	defer cleanupTenant()
+
+	h.SysSQL.Exec(t, `SET CLUSTER SETTING stream_replication.stream_liveness_track_frequency = '50ms'`)
+	h.SysSQL.Exec(t, `SET CLUSTER SETTING physical_replication.producer.job_status_check_interval = '50ms'`)
+	srcTenant.SQL.Exec(t, `
+CREATE DATABASE d;
+CREATE TABLE d.t1(i int primary key);
+INSERT INTO d.t1 VALUES (1);
+USE d;
+`)
+	t1Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), srcTenant.Codec, "d", "t1")
+
+	ctx := context.Background()
+	replicationProducerSpec := h.StartReplicationStream(t, testTenantName)
+	streamID := replicationProducerSpec.StreamID
+	jobutils.WaitForJobToRun(t, h.SysSQL, jobspb.JobID(streamID))
+
+	var spec streampb.StreamPartitionSpec
+	require.NoError(t, protoutil.Unmarshal(encodeSpec(t, h, srcTenant,
+		replicationProducerSpec.ReplicationStartTime, hlc.Timestamp{}, "t1"), &spec))
+	spec.Observer = true
+	opaqueSpec, err := protoutil.Marshal(&spec)
+	require.NoError(t, err)
+
+	const streamPartitionQuery = `SELECT * FROM crdb_internal.stream_partition($1, $2)`
+	source, feed := startReplication(ctx, t, h, makePartitionStreamDecoder,
+		streamPartitionQuery, streamID, opaqueSpec)
+	defer feed.Close(ctx)
+
+	// The observer sees the stream's events.
+	feed.ObserveKey(ctx, replicationtestutils.EncodeKV(t, srcTenant.Codec, t1Descr, 1).Key)
+
+	// Without heartbeats, the producer job times out even though the observer
+	// is attached, and the observer's stream ends with it.
+	h.SysSQL.Exec(t, fmt.Sprintf(`ALTER TENANT '%s' SET REPLICATION EXPIRATION WINDOW ='100ms'`, testTenantName))
+	jobutils.WaitForJobToFail(t, h.SysSQL, jobspb.JobID(streamID))
+	for {
+		if _, ok := source.Next(); !ok {
+			break
+		}
+	}
+	require.ErrorContains(t, source.Error(), "must be running")
 }
 
 func TestStreamAddSSTable(t *testing.T) {
@@ -0,0 +1,189 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package producer
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/cdcevent"
+	"github.com/cockroachdb/cockroach/pkg/ccl/changefeedccl/changefeedbase"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descs"
+	"github.com/cockroachdb/cockroach/pkg/sql/isql"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgerror"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/eval"
+	"github.com/cockroachdb/cockroach/pkg/sql/sem/tree"
+	"github.com/cockroachdb/errors"
+)
+
+// rowFilter evaluates the RowFilters of a StreamPartitionSpec against the KVs
+// emitted by an eventStream.
+type rowFilter struct {
+	evalCtx *eval.Context
+	decoder cdcevent.Decoder
+	byTable map[descpb.ID][]columnFilter
+}
+
+type columnFilter struct {
+	column string
+	// isKey is set if the column is part of the primary key, in which case the
+	// filter can also be evaluated against deletions.
+	isKey bool
+	op    streampb.RowFilter_Op
+	datum tree.Datum
+}
+
+// makeRowFilter resolves the tables and columns referenced by filters and
+// returns a rowFilter that evaluates them. It returns nil if there are no
+// filters.
+func makeRowFilter(
+	ctx context.Context,
+	evalCtx *eval.Context,
+	execCfg *sql.ExecutorConfig,
+	filters []streampb.RowFilter,
+) (*rowFilter, error) {
+	if len(filters) == 0 {
+		return nil, nil
+	}
+
+	rf := &rowFilter{
+		evalCtx: evalCtx,
+		byTable: make(map[descpb.ID][]columnFilter),
+	}
+	tableDescs := make(map[descpb.ID]catalog.TableDescriptor)
+	if err := sql.DescsTxn(ctx, execCfg, func(ctx context.Context, txn isql.Txn, col *descs.Collection) error {
+		for _, f := range filters {
+			tableID := descpb.ID(f.TableID)
+			td, err := col.ByID(txn.KV()).Get().Table(ctx, tableID)
+			if err != nil {
+				return err
+			}
+			if td.NumFamilies() > 1 {
+				return pgerror.Newf(pgcode.FeatureNotSupported,
+					"row filters are not supported on table %q with multiple column families", td.GetName())
+			}
+			column, err := catalog.MustFindColumnByName(td, f.Column)
+			if err != nil {
+				return err
+			}
+			if column.IsVirtual() {
+				return pgerror.Newf(pgcode.InvalidParameterValue,
+					"row filter column %q must be a primary key or stored column", f.Column)
+			}
+			d, _, err := tree.ParseAndRequireString(column.GetType(), f.Value, evalCtx)
+			if err != nil {
+				return errors.Wrapf(err, "parsing row filter value for column %q", f.Column)
+			}
+			tableDescs[tableID] = td
+			rf.byTable[tableID] = append(rf.byTable[tableID], columnFilter{
+				column: f.Column,
+				isKey:  td.GetPrimaryIndex().CollectKeyColumnIDs().Contains(column.GetID()),
+				op:     f.Op,
+				datum:  d,
+			})
+		}
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+
+	var targets changefeedbase.Targets
+	for _, td := range tableDescs {
+		targets.Add(changefeedbase.Target{
+			Type:              jobspb.ChangefeedTargetSpecification_PRIMARY_FAMILY_ONLY,
+			TableID:           td.GetID(),
+			StatementTimeName: changefeedbase.StatementTimeName(td.GetName()),
+		})
+	}
+	// Keys are decoded with their tenant prefix stripped.
+	rfCache, err := cdcevent.NewFixedRowFetcherCache(
+		ctx, keys.SystemSQLCodec, execCfg.Settings, targets, tableDescs)
+	if err != nil {
+		return nil, err
+	}
+	rf.decoder = cdcevent.NewEventDecoderWithCache(ctx, rfCache, false, false)
+	return rf, nil
+}
+
+// matches returns whether the given KV should be emitted. KVs that are not
+// part of a filtered table always match.
+func (rf *rowFilter) matches(ctx context.Context, kv roachpb.KeyValue) (bool, error) {
+	key, err := keys.StripTenantPrefix(kv.Key)
+	if err != nil {
+		return false, err
+	}
+	_, tableID, err := keys.SystemSQLCodec.DecodeTablePrefix(key)
+	if err != nil {
+		// Not a table key.
+		return true, nil //nolint:returnerrcheck
+	}
+	filters, ok := rf.byTable[descpb.ID(tableID)]
+	if !ok {
+		return true, nil
+	}
+
+	row, err := rf.decoder.DecodeKV(
+		ctx, roachpb.KeyValue{Key: key, Value: kv.Value}, cdcevent.CurrentRow, kv.Value.Timestamp, false)
+	if err != nil {
+		return false, errors.Wrap(err, "decoding row for row filter")
+	}
+	for _, f := range filters {
+		if row.IsDeleted() && !f.isKey {
+			// The deleted row's value is unknown, so we have to emit the deletion
+			// in case the row previously matched.
+			continue
+		}
+		it, err := row.DatumNamed(f.column)
+		if err != nil {
+			return false, err
+		}
+		var match bool
+		if err := it.Datum(func(d tree.Datum, _ cdcevent.ResultColumn) error {
+			match, err = f.eval(ctx, rf.evalCtx, d)
+			return err
+		}); err != nil {
+			return false, err
+		}
+		if !match {
+			return false, nil
+		}
+	}
+	return true, nil
+}
+
+func (f columnFilter) eval(ctx context.Context, evalCtx *eval.Context, d tree.Datum) (bool, error) {
+	if d == tree.DNull {
+		return false, nil
+	}
+	cmp, err := d.Compare(ctx, evalCtx, f.datum)
+	if err != nil {
+		return false, err
+	}
+	switch f.op {
+	case streampb.RowFilter_EQ:
+		return cmp == 0, nil
+	case streampb.RowFilter_LT:
+		return cmp < 0, nil
+	case streampb.RowFilter_LE:
+		return cmp <= 0, nil
+	case streampb.RowFilter_GT:
+		return cmp > 0, nil
+	case streampb.RowFilter_GE:
+		return cmp >= 0, nil
+	default:
+		return false, errors.AssertionFailedf("unknown row filter op %s", f.op)
+	}
+}
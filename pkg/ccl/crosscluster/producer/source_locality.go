@@ -0,0 +1,74 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package producer
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvclient/kvcoord"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvclient/rangecache"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/errors"
+)
+
+// localityResolver resolves the locality of the leaseholder of the range
+// containing a key. The most recently resolved range is cached, since events
+// for neighbouring keys tend to arrive together.
+type localityResolver struct {
+	rangeCache *rangecache.RangeCache
+	nodeDescs  kvcoord.NodeDescStore
+
+	// span and locality describe the most recently resolved range. span is
+	// empty if nothing is cached.
+	span     roachpb.Span
+	locality roachpb.Locality
+}
+
+func makeLocalityResolver(
+	rangeCache *rangecache.RangeCache, nodeDescs kvcoord.NodeDescStore,
+) *localityResolver {
+	return &localityResolver{rangeCache: rangeCache, nodeDescs: nodeDescs}
+}
+
+// resolve returns the locality of the leaseholder of the range containing key.
+// An empty locality is returned if the leaseholder is not known.
+func (r *localityResolver) resolve(ctx context.Context, key roachpb.Key) (roachpb.Locality, error) {
+	if r.span.ContainsKey(key) {
+		return r.locality, nil
+	}
+	rKey, err := keys.Addr(key)
+	if err != nil {
+		return roachpb.Locality{}, err
+	}
+	ri, err := r.rangeCache.Lookup(ctx, rKey)
+	if err != nil {
+		return roachpb.Locality{}, errors.Wrapf(err, "looking up range for key %s", key)
+	}
+	nodeID := ri.Lease.Replica.NodeID
+	if nodeID == 0 {
+		// Don't cache an unknown leaseholder so that the next lookup retries.
+		r.invalidate()
+		return roachpb.Locality{}, nil
+	}
+	nodeDesc, err := r.nodeDescs.GetNodeDescriptor(nodeID)
+	if err != nil {
+		return roachpb.Locality{}, err
+	}
+	r.span = ri.Desc.RSpan().AsRawSpanWithNoLocals()
+	r.locality = nodeDesc.Locality
+	return r.locality, nil
+}
+
+// invalidate drops the cached range, forcing the next resolve to look up the
+// current leaseholder.
+func (r *localityResolver) invalidate() {
+	r.span = roachpb.Span{}
+	r.locality = roachpb.Locality{}
+}
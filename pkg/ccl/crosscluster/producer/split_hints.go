@@ -0,0 +1,49 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package producer
+
+import (
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+)
+
+// subSpans divides the spans of a stream at its split hints.
+type subSpans []roachpb.Span
+
+// makeSubSpans splits spans at every hint that falls strictly within one of
+// them. The spans must not overlap.
+func makeSubSpans(spans []roachpb.Span, hints []roachpb.Key) subSpans {
+	hints = append([]roachpb.Key(nil), hints...)
+	sort.Slice(hints, func(i, j int) bool { return hints[i].Compare(hints[j]) < 0 })
+
+	var res subSpans
+	for _, sp := range spans {
+		start := sp.Key
+		for _, hint := range hints {
+			if hint.Compare(start) <= 0 || hint.Compare(sp.EndKey) >= 0 {
+				continue
+			}
+			res = append(res, roachpb.Span{Key: start, EndKey: hint})
+			start = hint
+		}
+		res = append(res, roachpb.Span{Key: start, EndKey: sp.EndKey})
+	}
+	sort.Slice(res, func(i, j int) bool { return res[i].Key.Compare(res[j].Key) < 0 })
+	return res
+}
+
+// find returns the sub-span containing key, or an empty span if there is none.
+func (s subSpans) find(key roachpb.Key) roachpb.Span {
+	i := sort.Search(len(s), func(i int) bool { return key.Compare(s[i].EndKey) < 0 })
+	if i < len(s) && s[i].ContainsKey(key) {
+		return s[i]
+	}
+	return roachpb.Span{}
+}
@@ -18,6 +18,7 @@ import (
 type streamEventBatcher struct {
 	batch              streampb.StreamEvent_Batch
 	size               int
+	numKVs             int
 	spanConfigFrontier hlc.Timestamp
 	wrappedKVs         bool
 }
@@ -28,11 +29,14 @@ func makeStreamEventBatcher(supportsWrapping bool) *streamEventBatcher {
 
 func (seb *streamEventBatcher) reset() {
 	seb.size = 0
+	seb.numKVs = 0
 	seb.batch.KVs = seb.batch.KVs[:0]
 	seb.batch.Ssts = seb.batch.Ssts[:0]
 	seb.batch.DelRanges = seb.batch.DelRanges[:0]
 	seb.batch.SpanConfigs = seb.batch.SpanConfigs[:0]
 	seb.batch.SplitPoints = seb.batch.SplitPoints[:0]
+	seb.batch.SourceLocality = roachpb.Locality{}
+	seb.batch.SubSpan = roachpb.Span{}
 }
 
 func (seb *streamEventBatcher) addSST(sst kvpb.RangeFeedSSTable) {
@@ -41,6 +45,7 @@ func (seb *streamEventBatcher) addSST(sst kvpb.RangeFeedSSTable) {
 }
 
 func (seb *streamEventBatcher) addKV(kv streampb.StreamEvent_KV) {
+	seb.numKVs++
 	if seb.wrappedKVs {
 		seb.batch.KVs = append(seb.batch.KVs, kv)
 		seb.size += (kv.Size())
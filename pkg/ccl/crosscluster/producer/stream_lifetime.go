@@ -10,6 +10,7 @@ package producer
 
 import (
 	"context"
+	"sort"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
@@ -18,6 +19,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobsprotectedts"
 	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/kv"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/protectedts/ptpb"
@@ -55,6 +58,15 @@ var streamMaxProcsPerPartition = settings.RegisterIntSetting(
 	settings.PositiveInt,
 )
 
+var streamWeightedPartitioning = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"stream_replication.weighted_partitioning.enabled",
+	"assign the spans of each source-planned partition to ingest processors by "+
+		"the recent load of their ranges rather than round-robin, to spread hot "+
+		"ranges across processors",
+	false,
+)
+
 // notAReplicationJobError returns an error that is returned anytime
 // the user passes a job ID not related to a replication stream job.
 func notAReplicationJobError(id jobspb.JobID) error {
@@ -97,6 +109,19 @@ func StartReplicationProducerJob(
 		return streampb.ReplicationProducerSpec{}, errors.Errorf("kv.rangefeed.enabled must be true to start a replication job")
 	}
 
+	registry := execConfig.JobRegistry
+	if req.IdempotencyToken != "" {
+		spec, ok, err := findProducerJobByToken(ctx, registry, txn, tenantRecord.PhysicalReplicationProducerJobIDs, req.IdempotencyToken)
+		if err != nil {
+			return streampb.ReplicationProducerSpec{}, err
+		}
+		if ok {
+			spec.SourceTenantID = tenantID
+			spec.SourceClusterID = evalCtx.ClusterID
+			return spec, nil
+		}
+	}
+
 	var replicationStartTime hlc.Timestamp
 	if !req.ReplicationStartTime.IsEmpty() {
 		if tenantRecord.PreviousSourceTenant != nil {
@@ -123,10 +148,21 @@ func StartReplicationProducerJob(
 		}
 	}
 
-	registry := execConfig.JobRegistry
 	ptsID := uuid.MakeV4()
 
 	jr := makeProducerJobRecord(registry, tenantRecord, defaultExpirationWindow, evalCtx.SessionData().User(), ptsID, assumeSucceeded)
+	details := jr.Details.(jobspb.StreamReplicationDetails)
+	details.IdempotencyToken = req.IdempotencyToken
+	details.ReplicationStartTime = replicationStartTime
+	if len(req.ExcludedSpans) > 0 {
+		spans, err := excludeSpans(details.Spans, req.ExcludedSpans)
+		if err != nil {
+			return streampb.ReplicationProducerSpec{}, err
+		}
+		details.Spans = spans
+		details.ExcludedSpans = req.ExcludedSpans
+	}
+	jr.Details = details
 	if _, err := registry.CreateAdoptableJobWithTxn(ctx, jr, jr.JobID, txn); err != nil {
 		return streampb.ReplicationProducerSpec{}, err
 	}
@@ -157,6 +193,57 @@ func StartReplicationProducerJob(
 	}, nil
 }
 
+// excludeSpans returns the parts of spans not covered by excluded. Each
+// excluded span must be contained in spans, and may not cover all of them.
+func excludeSpans(spans, excluded roachpb.Spans) (roachpb.Spans, error) {
+	var g roachpb.SpanGroup
+	g.Add(spans...)
+	for _, sp := range excluded {
+		if !sp.Valid() || !g.Encloses(sp) {
+			return nil, pgerror.Newf(pgcode.InvalidParameterValue,
+				"excluded span %s is not contained within the replicated spans %s", sp, spans)
+		}
+	}
+	g.Sub(excluded...)
+	if g.Len() == 0 {
+		return nil, pgerror.Newf(pgcode.InvalidParameterValue,
+			"excluded spans %s cover all of the replicated spans", excluded)
+	}
+	return g.Slice(), nil
+}
+
+// findProducerJobByToken returns the spec of the non-terminal producer job
+// among jobIDs that was started by a request with the given idempotency token,
+// if there is one. The source tenant and cluster of the returned spec are left
+// to the caller.
+func findProducerJobByToken(
+	ctx context.Context,
+	registry *jobs.Registry,
+	txn isql.Txn,
+	jobIDs []jobspb.JobID,
+	token string,
+) (streampb.ReplicationProducerSpec, bool, error) {
+	for _, id := range jobIDs {
+		j, err := registry.LoadJobWithTxn(ctx, id, txn)
+		if err != nil {
+			if jobs.HasJobNotFoundError(err) {
+				continue
+			}
+			return streampb.ReplicationProducerSpec{}, false, err
+		}
+		details, ok := j.Details().(jobspb.StreamReplicationDetails)
+		if !ok || details.IdempotencyToken != token || j.Status().Terminal() {
+			continue
+		}
+		log.Infof(ctx, "returning producer job %d started with idempotency token %q", id, token)
+		return streampb.ReplicationProducerSpec{
+			StreamID:             streampb.StreamID(id),
+			ReplicationStartTime: details.ReplicationStartTime,
+		}, true, nil
+	}
+	return streampb.ReplicationProducerSpec{}, false, nil
+}
+
 // Convert the producer job's status into corresponding replication
 // stream status.
 func convertProducerJobStatusToStreamStatus(
@@ -264,8 +351,13 @@ func heartbeatReplicationStream(
 		return streampb.StreamReplicationStatus{}, pgerror.Newf(pgcode.InvalidParameterValue, "MaxTimestamp no longer accepted as frontier")
 	}
 	updateBegin := timeutil.Now()
-	return updateReplicationStreamProgress(ctx, updateBegin, execConfig.ProtectedTimestampProvider, execConfig.JobRegistry,
+	status, err := updateReplicationStreamProgress(ctx, updateBegin, execConfig.ProtectedTimestampProvider, execConfig.JobRegistry,
 		streamID, frontier, txn)
+	if err != nil {
+		return status, err
+	}
+	status.ProducerTime = execConfig.Clock.Now()
+	return status, nil
 }
 
 // getPhysicalReplicationStreamSpec gets a replication stream specification for the specified stream.
@@ -286,8 +378,67 @@ func getPhysicalReplicationStreamSpec(
 	if j.Status() != jobs.StatusRunning {
 		return nil, jobIsNotRunningError(jobID, j.Status(), "create stream spec")
 	}
-	return buildReplicationStreamSpec(ctx, evalCtx, details.TenantID, false, details.Spans)
+	spec, err := buildReplicationStreamSpec(ctx, evalCtx, details.TenantID, false, details.Spans)
+	if err != nil {
+		return nil, err
+	}
+	spec.ExcludedSpans = details.ExcludedSpans
+	return spec, nil
+}
 
+// getReplicationStreamHistory gets the status transitions of the producer job
+// of the specified stream. Unlike the stream spec, it is available after the job
+// has terminated.
+func getReplicationStreamHistory(
+	ctx context.Context, evalCtx *eval.Context, txn isql.Txn, streamID streampb.StreamID,
+) (*streampb.StreamStatusHistory, error) {
+	jobExecCtx := evalCtx.JobExecContext.(sql.JobExecContext)
+	jobID := jobspb.JobID(streamID)
+	j, err := jobExecCtx.ExecCfg().JobRegistry.LoadJobWithTxn(ctx, jobID, txn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load job for replication stream %d", streamID)
+	}
+	if _, ok := j.Details().(jobspb.StreamReplicationDetails); !ok {
+		return nil, notAReplicationJobError(jobID)
+	}
+	history := &streampb.StreamStatusHistory{}
+	if err := j.InfoStorage(txn).IterateStatusHistory(ctx, func(status jobs.Status, at time.Time) error {
+		history.Transitions = append(history.Transitions, streampb.StreamStatusHistory_Transition{
+			Status: string(status),
+			Time:   at,
+		})
+		return nil
+	}); err != nil {
+		return nil, errors.Wrapf(err, "could not read history of replication stream %d", streamID)
+	}
+	return history, nil
+}
+
+// getReplicationStreamProtectedTimestamp gets the protected timestamp record
+// of the producer job of the specified stream. The record is released once the
+// job terminates, after which an error is returned.
+func getReplicationStreamProtectedTimestamp(
+	ctx context.Context, evalCtx *eval.Context, txn isql.Txn, streamID streampb.StreamID,
+) (*streampb.StreamProtectedTimestamp, error) {
+	execCfg := evalCtx.JobExecContext.(sql.JobExecContext).ExecCfg()
+	jobID := jobspb.JobID(streamID)
+	j, err := execCfg.JobRegistry.LoadJobWithTxn(ctx, jobID, txn)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not load job for replication stream %d", streamID)
+	}
+	details, ok := j.Details().(jobspb.StreamReplicationDetails)
+	if !ok {
+		return nil, notAReplicationJobError(jobID)
+	}
+	record, err := execCfg.ProtectedTimestampProvider.WithTxn(txn).GetRecord(ctx, details.ProtectedTimestampRecordID)
+	if err != nil {
+		return nil, errors.Wrapf(err,
+			"could not read protected timestamp record of replication stream %d", streamID)
+	}
+	return &streampb.StreamProtectedTimestamp{
+		RecordID:  record.ID.GetUUID(),
+		Timestamp: record.Timestamp,
+	}, nil
 }
 
 func buildReplicationStreamSpec(
@@ -317,7 +468,18 @@ func buildReplicationStreamSpec(
 		return nil, err
 	}
 
-	spanPartitions = repartitionSpans(spanPartitions, int(streamMaxProcsPerPartition.Get(&evalCtx.Settings.SV)))
+	parts := int(streamMaxProcsPerPartition.Get(&evalCtx.Settings.SV))
+	if streamWeightedPartitioning.Get(&evalCtx.Settings.SV) {
+		loads, err := rangeLoads(ctx, jobExecCtx.ExecCfg().DB, spanPartitions)
+		if err != nil {
+			return nil, errors.Wrap(err, "fetching range loads for weighted partitioning")
+		}
+		spanPartitions = weightedRepartitionSpans(spanPartitions, parts, func(sp roachpb.Span) float64 {
+			return loads[string(sp.Key)]
+		})
+	} else {
+		spanPartitions = repartitionSpans(spanPartitions, parts)
+	}
 
 	var spanConfigsStreamID streampb.StreamID
 	if forSpanConfigs {
@@ -372,6 +534,78 @@ func repartitionSpans(partitions []sql.SpanPartition, parts int) []sql.SpanParti
 	return result
 }
 
+// weightedRepartitionSpans is like repartitionSpans, but assigns the spans of
+// each partition to its parts by load rather than round-robin. Spans are
+// assigned from most to least loaded, each to the part with the least load so
+// far, so that a hot span ends up in a part of its own rather than clumped with
+// other hot spans. The spans of each part are kept in key order.
+func weightedRepartitionSpans(
+	partitions []sql.SpanPartition, parts int, load func(roachpb.Span) float64,
+) []sql.SpanPartition {
+	result := make([]sql.SpanPartition, 0, parts*len(partitions))
+	for part := range partitions {
+		spans := append(roachpb.Spans(nil), partitions[part].Spans...)
+		loads := make(map[string]float64, len(spans))
+		for _, sp := range spans {
+			loads[string(sp.Key)] = load(sp)
+		}
+		sort.SliceStable(spans, func(i, j int) bool {
+			return loads[string(spans[i].Key)] > loads[string(spans[j].Key)]
+		})
+
+		repartitioned := make([]sql.SpanPartition, min(parts, len(spans)))
+		partLoads := make([]float64, len(repartitioned))
+		for i := range repartitioned {
+			repartitioned[i].SQLInstanceID = partitions[part].SQLInstanceID
+		}
+		for _, sp := range spans {
+			least := 0
+			for i := range partLoads {
+				if partLoads[i] < partLoads[least] {
+					least = i
+				}
+			}
+			repartitioned[least].Spans = append(repartitioned[least].Spans, sp)
+			partLoads[least] += loads[string(sp.Key)]
+		}
+		for i := range repartitioned {
+			sort.Sort(roachpb.Spans(repartitioned[i].Spans))
+		}
+		result = append(result, repartitioned...)
+	}
+	return result
+}
+
+// rangeLoads returns the recent request rate of the range containing the start
+// key of each span in partitions, keyed by that start key. The rate of a range
+// whose leaseholder hasn't measured it for long enough yet is reported as zero.
+func rangeLoads(
+	ctx context.Context, db *kv.DB, partitions []sql.SpanPartition,
+) (map[string]float64, error) {
+	ba := &kvpb.BatchRequest{}
+	for _, part := range partitions {
+		for _, sp := range part.Spans {
+			ba.Add(&kvpb.RangeStatsRequest{
+				RequestHeader: kvpb.RequestHeader{Key: sp.Key},
+			})
+		}
+	}
+	if len(ba.Requests) == 0 {
+		return nil, nil
+	}
+	br, pErr := db.NonTransactionalSender().Send(ctx, ba)
+	if pErr != nil {
+		return nil, pErr.GoError()
+	}
+	loads := make(map[string]float64, len(br.Responses))
+	for i, ru := range br.Responses {
+		res := ru.GetInner().(*kvpb.RangeStatsResponse)
+		key := ba.Requests[i].GetInner().Header().Key
+		loads[string(key)] = max(res.MaxQueriesPerSecond, 0)
+	}
+	return loads, nil
+}
+
 func completeReplicationStream(
 	ctx context.Context,
 	evalCtx *eval.Context,
@@ -391,11 +625,24 @@ func completeReplicationStream(
 	return j.WithTxn(txn).Update(ctx, func(
 		txn isql.Txn, md jobs.JobMetadata, ju *jobs.JobUpdater,
 	) error {
+		// Completing a stream is idempotent so that a consumer that lost the
+		// response to an earlier request can safely retry: once the job has
+		// finished, or has already been told how the ingestion finished, the
+		// first request decides the outcome and later ones are no-ops.
+		if md.Status.Terminal() {
+			log.Infof(ctx, "replication stream %d is already %s", streamID, md.Status)
+			return nil
+		}
+		if ingestionStatus := md.Progress.GetStreamReplication().StreamIngestionStatus; ingestionStatus != jobspb.StreamReplicationProgress_NOT_FINISHED {
+			log.Infof(ctx, "replication stream %d is already completing with ingestion status %s",
+				streamID, ingestionStatus)
+			return nil
+		}
 		// Updates the stream ingestion status, make the job resumer exit running
-		// when picking up the new status.
-		if (md.Status == jobs.StatusRunning || md.Status == jobs.StatusPending) &&
-			md.Progress.GetStreamReplication().StreamIngestionStatus ==
-				jobspb.StreamReplicationProgress_NOT_FINISHED {
+		// when picking up the new status. A paused job picks up the status once it
+		// is resumed.
+		if md.Status == jobs.StatusRunning || md.Status == jobs.StatusPending ||
+			md.Status == jobs.StatusPaused || md.Status == jobs.StatusPauseRequested {
 			if successfulIngestion {
 				md.Progress.GetStreamReplication().StreamIngestionStatus =
 					jobspb.StreamReplicationProgress_FINISHED_SUCCESSFULLY
@@ -413,6 +660,48 @@ func completeReplicationStream(
 	})
 }
 
+// pauseReplicationStream pauses the producer job of the specified stream.
+func pauseReplicationStream(
+	ctx context.Context, evalCtx *eval.Context, txn isql.Txn, streamID streampb.StreamID,
+) error {
+	jobID, err := loadReplicationStreamJobID(ctx, evalCtx, txn, streamID)
+	if err != nil {
+		return err
+	}
+	registry := evalCtx.JobExecContext.(sql.JobExecContext).ExecCfg().JobRegistry
+	return registry.PauseRequested(ctx, txn, jobID, "paused by the stream consumer")
+}
+
+// resumeReplicationStream resumes the paused producer job of the specified
+// stream.
+func resumeReplicationStream(
+	ctx context.Context, evalCtx *eval.Context, txn isql.Txn, streamID streampb.StreamID,
+) error {
+	jobID, err := loadReplicationStreamJobID(ctx, evalCtx, txn, streamID)
+	if err != nil {
+		return err
+	}
+	registry := evalCtx.JobExecContext.(sql.JobExecContext).ExecCfg().JobRegistry
+	return registry.Unpause(ctx, txn, jobID)
+}
+
+// loadReplicationStreamJobID returns the ID of the producer job of the
+// specified stream, or an error if that job is not a replication stream job.
+func loadReplicationStreamJobID(
+	ctx context.Context, evalCtx *eval.Context, txn isql.Txn, streamID streampb.StreamID,
+) (jobspb.JobID, error) {
+	jobID := jobspb.JobID(streamID)
+	registry := evalCtx.JobExecContext.(sql.JobExecContext).ExecCfg().JobRegistry
+	j, err := registry.LoadJobWithTxn(ctx, jobID, txn)
+	if err != nil {
+		return 0, errors.Wrapf(err, "could not load job for replication stream %d", streamID)
+	}
+	if _, ok := j.Details().(jobspb.StreamReplicationDetails); !ok {
+		return 0, notAReplicationJobError(jobID)
+	}
+	return jobID, nil
+}
+
 func setupSpanConfigsStream(
 	ctx context.Context, evalCtx *eval.Context, txn isql.Txn, tenantName roachpb.TenantName,
 ) (eval.ValueGenerator, error) {
@@ -58,3 +58,49 @@ func TestRepartition(t *testing.T) {
 		}
 	}
 }
+
+func TestWeightedRepartition(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	spans := make([]roachpb.Span, 8)
+	for i := range spans {
+		spans[i].Key = roachpb.Key(fmt.Sprintf("k%d-a", i))
+		spans[i].EndKey = roachpb.Key(fmt.Sprintf("k%d-b", i))
+	}
+	hot := spans[0]
+	load := func(sp roachpb.Span) float64 {
+		if sp.Equal(hot) {
+			return 1000
+		}
+		return 1
+	}
+	input := []sql.SpanPartition{{SQLInstanceID: 1, Spans: spans}}
+
+	partOf := func(partitions []sql.SpanPartition, sp roachpb.Span) sql.SpanPartition {
+		for _, part := range partitions {
+			for _, s := range part.Spans {
+				if s.Equal(sp) {
+					return part
+				}
+			}
+		}
+		t.Fatalf("span %s not found in any partition", sp)
+		return sql.SpanPartition{}
+	}
+
+	// Round-robin assignment puts other spans alongside the hot one.
+	require.Greater(t, len(partOf(repartitionSpans(input, 4), hot).Spans), 1)
+
+	got := weightedRepartitionSpans(input, 4, load)
+	require.Equal(t, 4, len(got))
+	require.Equal(t, []roachpb.Span{hot}, partOf(got, hot).Spans)
+
+	var gotSpans roachpb.Spans
+	for _, part := range got {
+		require.Equal(t, base.SQLInstanceID(1), part.SQLInstanceID)
+		require.True(t, sort.IsSorted(roachpb.Spans(part.Spans)))
+		gotSpans = append(gotSpans, part.Spans...)
+	}
+	sort.Sort(gotSpans)
+	require.Equal(t, roachpb.Spans(spans), gotSpans)
+}
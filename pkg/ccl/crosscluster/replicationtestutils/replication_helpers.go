@@ -123,6 +123,17 @@ func (rf *ReplicationFeed) ObserveKey(ctx context.Context, key roachpb.Key) roac
 	return rf.msg.GetKVs()[0].KeyValue
 }
 
+// ObserveKVEvent is like ObserveKey, but returns the KV as it was streamed,
+// including whether it is a delete.
+func (rf *ReplicationFeed) ObserveKVEvent(
+	ctx context.Context, key roachpb.Key,
+) streampb.StreamEvent_KV {
+	rf.consumeUntil(ctx, KeyMatches(key), func(err error) bool {
+		return false
+	})
+	return rf.msg.GetKVs()[0]
+}
+
 // ObserveAnySpanConfigRecord consumes the feed until any span config record is observed.
 // Note: we don't do any buffering here.  Therefore, it is required that the key
 // we want to observe will arrive at some point in the future.
@@ -188,6 +199,25 @@ func (rf *ReplicationFeed) consumeUntil(
 
 }
 
+// AssertNoEventsFor fails the test if an event arrives on events, or events is
+// closed, before the window elapses. It is useful for checking that a paused
+// or fully filtered subscription stays quiet.
+func AssertNoEventsFor(
+	ctx context.Context, t *testing.T, events <-chan crosscluster.Event, window time.Duration,
+) {
+	t.Helper()
+	select {
+	case event, ok := <-events:
+		if !ok {
+			t.Fatalf("event channel closed within %s", window)
+		}
+		t.Fatalf("unexpected event of type %d within %s: %+v", event.Type(), window, event)
+	case <-time.After(window):
+	case <-ctx.Done():
+		t.Fatal(ctx.Err())
+	}
+}
+
 // TenantState maintains test state related to tenant.
 type TenantState struct {
 	// Name is the name of the tenant.
@@ -12,15 +12,18 @@ import (
 	"context"
 	"fmt"
 	"net/url"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
 	"github.com/cockroachdb/cockroach/pkg/cloud/externalconn"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/isql"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 )
 
@@ -61,7 +64,9 @@ type Client interface {
 
 	// CreateForTenant initializes a stream with the source, potentially reserving any
 	// required resources, such as protected timestamps, and returns an ID which
-	// can be used to interact with this stream in the future.
+	// can be used to interact with this stream in the future. If the request
+	// carries an IdempotencyToken, retrying it returns the stream created by
+	// the first attempt as long as that stream is running.
 	CreateForTenant(ctx context.Context, tenant roachpb.TenantName, req streampb.ReplicationProducerRequest) (streampb.ReplicationProducerSpec, error)
 
 	// Destroy informs the source of the stream that it may terminate production
@@ -96,9 +101,64 @@ type Client interface {
 		opts ...SubscribeOption,
 	) (Subscription, error)
 
-	// Complete completes a replication stream consumption.
+	// SubscribeDescriptors opens a subscription to the system.descriptor table
+	// of the given source tenant, which delivers each descriptor change as a
+	// DescriptorEvent, along with checkpoints. It lets consumers follow schema
+	// changes on a low-volume stream that is separate from the data streams.
+	SubscribeDescriptors(
+		ctx context.Context,
+		streamID streampb.StreamID,
+		consumerNode, consumerProc int32,
+		tenantID roachpb.TenantID,
+		initialScanTime hlc.Timestamp,
+		opts ...SubscribeOption,
+	) (Subscription, error)
+
+	// SubscribeRange opens a subscription to the span of a single source range,
+	// e.g. to tap the changes of a problematic range while debugging without
+	// planning the whole stream. The range's span is resolved when the
+	// subscription is opened, so it doesn't follow later splits and merges.
+	SubscribeRange(
+		ctx context.Context,
+		streamID streampb.StreamID,
+		rangeID roachpb.RangeID,
+		initialScanTime hlc.Timestamp,
+		opts ...SubscribeOption,
+	) (Subscription, error)
+
+	// Complete completes a replication stream consumption. It is safe to retry
+	// after a failure: completing a stream that is already completing or has
+	// finished is a no-op.
 	Complete(ctx context.Context, streamID streampb.StreamID, successfulIngestion bool) error
 
+	// Pause pauses the producer job of a replication stream without cancelling
+	// it. Subsequent heartbeats report the stream as STREAM_PAUSED.
+	Pause(ctx context.Context, streamID streampb.StreamID) error
+
+	// Resume resumes the producer job of a previously paused replication
+	// stream.
+	Resume(ctx context.Context, streamID streampb.StreamID) error
+
+	// StreamHistory returns the transitions of the status of the producer job
+	// of a replication stream, oldest first. It can be used to determine why a
+	// stream stopped after its producer job has terminated.
+	StreamHistory(ctx context.Context, streamID streampb.StreamID) ([]StreamStatusTransition, error)
+
+	// WatchProgress returns a channel that delivers the progress of the
+	// producer job of a replication stream, starting with its current progress
+	// and then whenever it changes. The channel is closed once the job reaches a
+	// terminal status, after delivering that final update, or when ctx is
+	// canceled. If the progress can no longer be read, a last update carrying
+	// the error is delivered before the channel is closed.
+	WatchProgress(ctx context.Context, streamID streampb.StreamID) (<-chan StreamProgress, error)
+
+	// ProtectedTimestampRecord returns the protected timestamp record that the
+	// producer job of a replication stream installed to keep the history of
+	// the stream's spans from being garbage collected, e.g. to debug conflicts
+	// between GC and replication. An error is returned if the job no longer
+	// has a record, e.g. because the stream has ended.
+	ProtectedTimestampRecord(ctx context.Context, streamID streampb.StreamID) (ProtectedTimestampRecord, error)
+
 	// PriorReplicationDetails returns a given tenant's "historyID" as well as the
 	// historyID, if any, from which that tenant was previously replicated and the
 	// timestamp as of which that replication ended.
@@ -112,10 +172,72 @@ type Client interface {
 		ctx context.Context, tenant roachpb.TenantName,
 	) (id string, replicatedFrom string, activated hlc.Timestamp, _ error)
 
+	// ProtocolVersions returns the oldest and newest versions of the stream
+	// wire format that the producer supports, which lets a consumer check
+	// compatibility without attempting a subscription.
+	ProtocolVersions(ctx context.Context) (minVersion, maxVersion uint32, _ error)
+
+	// SourceClusterVersion returns the active cluster version of the producer
+	// cluster, which lets a consumer gate features that require a minimum
+	// source version before subscribing.
+	SourceClusterVersion(ctx context.Context) (roachpb.Version, error)
+
 	PlanLogicalReplication(ctx context.Context, req streampb.LogicalReplicationPlanRequest) (LogicalReplicationPlan, error)
 	CreateForTables(ctx context.Context, req *streampb.ReplicationProducerRequest) (*streampb.ReplicationProducerSpec, error)
 }
 
+// ClockSkew is the skew between the clocks of the producer and consumer of a
+// replication stream, as observed by a heartbeat. Resolved timestamps are
+// assigned by the producer's clock, so a large skew can make replication
+// appear to lag or lead the consumer's clock.
+type ClockSkew struct {
+	// Offset is the producer's clock reading minus the consumer's, assuming
+	// the producer read its clock halfway through the heartbeat's round trip.
+	Offset time.Duration
+	// Uncertainty bounds the error of Offset. It is half of the heartbeat's
+	// round trip time.
+	Uncertainty time.Duration
+}
+
+// ClockSkewReporter is implemented by Clients that observe the clock skew
+// between the producer and consumer in their heartbeats.
+type ClockSkewReporter interface {
+	// ObservedClockSkew returns the clock skew observed by the last
+	// successful heartbeat, and false if none has been observed yet.
+	ObservedClockSkew() (ClockSkew, bool)
+}
+
+// StreamStatusTransition records that the producer job of a replication
+// stream transitioned to Status at Time.
+type StreamStatusTransition struct {
+	Status jobs.Status
+	Time   time.Time
+}
+
+// StreamProgress describes the progress of the producer job of a replication
+// stream.
+type StreamProgress struct {
+	Status jobs.Status
+	// FractionCompleted is the fraction of the job's work that is done, if the
+	// job reports one.
+	FractionCompleted float32
+	// HighWater is the job's high-water mark, if it has one.
+	HighWater hlc.Timestamp
+	// Err is set on the last update delivered by WatchProgress if the progress
+	// could no longer be read.
+	Err error
+}
+
+// ProtectedTimestampRecord describes the protected timestamp record of the
+// producer job of a replication stream.
+type ProtectedTimestampRecord struct {
+	// ID identifies the record on the source cluster.
+	ID uuid.UUID
+	// Timestamp is the protected timestamp, at and above which the history of
+	// the stream's spans is kept.
+	Timestamp hlc.Timestamp
+}
+
 type subscribeConfig struct {
 	// withFiltering controls whether the producer-side rangefeeds
 	// should be started with the WithFiltering option which
@@ -128,10 +250,135 @@ type subscribeConfig struct {
 	// NB: Callers should note that initial scan results will not
 	// contain a diff.
 	withDiff bool
+
+	// rowFilters restrict the rows emitted by the producer.
+	rowFilters []streampb.RowFilter
+
+	// withSnapshot controls whether the initial scan is bracketed by
+	// snapshot markers.
+	withSnapshot bool
+
+	// withSourceLocality controls whether events are annotated with
+	// the locality of their source range's leaseholder.
+	withSourceLocality bool
+
+	// catchUpBytesPerSecond, if positive, limits the rate at which the
+	// producer emits events until it has caught up.
+	catchUpBytesPerSecond int64
+
+	// dedupWindow, if positive, is the number of recently delivered
+	// (key, timestamp) pairs remembered to suppress duplicate KVs.
+	dedupWindow int
+
+	// batchMaxKVs and batchMaxBytes, if positive, limit the number of KVs and
+	// bytes the producer packs into each message.
+	batchMaxKVs   int64
+	batchMaxBytes int64
+
+	// strictOrdering controls whether checkpoints are only delivered
+	// after all data events at or below their resolved timestamps.
+	strictOrdering bool
+
+	// splitHints are keys at which the producer subdivides the
+	// subscribed spans.
+	splitHints []roachpb.Key
+
+	// newestFirstCatchUp controls whether KVs read during catch-up are
+	// delivered newest-first.
+	newestFirstCatchUp bool
+
+	// minCheckpointAdvance, if positive, is the amount by which the frontier
+	// must advance before another checkpoint is delivered.
+	minCheckpointAdvance time.Duration
+
+	// globalCheckpoints controls whether a GlobalCheckpointEvent is
+	// delivered whenever the frontier of all spans advances.
+	globalCheckpoints bool
+
+	// keepaliveInterval, if positive, is the interval at which the producer
+	// emits keepalive events.
+	keepaliveInterval time.Duration
+
+	// observer is set if the subscription only observes the stream.
+	observer bool
+
+	// compressionLevel is the level at which the producer compresses events.
+	compressionLevel int32
+
+	// withCatchUpComplete is set if the producer must emit a
+	// CatchUpCompleteEvent once the stream has caught up.
+	withCatchUpComplete bool
+
+	// withResumeTokens is set if the producer must follow checkpoints with
+	// resume tokens.
+	withResumeTokens bool
+
+	// resumeToken, if set, is the token the subscription resumes from.
+	resumeToken []byte
+
+	// maxCatchUpDuration, if positive, bounds how long the producer may take
+	// to catch up.
+	maxCatchUpDuration time.Duration
+
+	// caughtUpThreshold, if positive, is how far the frontier may trail the
+	// current time for the subscription to be considered caught up.
+	caughtUpThreshold time.Duration
+
+	// maxStaleness, if positive, bounds how far the resolved timestamps of the
+	// producer's checkpoints may trail the current time.
+	maxStaleness time.Duration
+
+	// groupByCommitTS is set if the producer must deliver the KVs committed
+	// at each timestamp together.
+	groupByCommitTS bool
+
+	// batchedEvents is set if events must be delivered on the subscription's
+	// EventsBatched channel rather than its Events channel.
+	batchedEvents bool
+
+	// typedEvents is set if KV events and checkpoints must be delivered on the
+	// subscription's KVEvents and ResolvedEvents channels.
+	typedEvents bool
+
+	// rawMVCC is set if KV events must carry the raw MVCC encoding of their
+	// KVs.
+	rawMVCC bool
+
+	// maxDecompressedSize, if positive, bounds the size of each event once
+	// decompressed.
+	maxDecompressedSize int64
+
+	// transform, if set, is applied to each event before it is delivered.
+	transform EventTransform
+
+	// onRegression, if set, is called with each regression of the frontier
+	// found in a received checkpoint.
+	onRegression RegressionHandler
 }
 
 type SubscribeOption func(*subscribeConfig)
 
+// EventTransform rewrites an event received by a subscription before it is
+// delivered, e.g. to remap the tenant prefix of its keys. It must return an
+// event of the same type. An error fails the subscription.
+type EventTransform func(crosscluster.Event) (crosscluster.Event, error)
+
+// ResolvedRegression describes a checkpoint that resolved a span at a lower
+// timestamp than an earlier checkpoint of the same subscription.
+type ResolvedRegression struct {
+	// Span is the part of the checkpoint's span that was already resolved at
+	// Resolved.
+	Span roachpb.Span
+	// Resolved is the timestamp at which Span was resolved.
+	Resolved hlc.Timestamp
+	// Regressed is the lower timestamp of the checkpoint.
+	Regressed hlc.Timestamp
+}
+
+// RegressionHandler is called with a regression of the frontier of a
+// subscription. A non-nil error fails the subscription.
+type RegressionHandler func(ResolvedRegression) error
+
 // WithFiltering controls whether the producer side rangefeed is
 // started with the WithFiltering option, eliding rows where
 // OmitInRangefeed was set at write-time.
@@ -152,6 +399,298 @@ func WithDiff(enableDiff bool) SubscribeOption {
 	}
 }
 
+// WithRowFilters restricts the rows emitted by the producer to those
+// matching every given filter on their table. Filters are evaluated
+// by the producer and are only supported for logical replication.
+func WithRowFilters(filters ...streampb.RowFilter) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.rowFilters = append(cfg.rowFilters, filters...)
+	}
+}
+
+// WithSnapshot controls whether the subscription delivers its initial scan as
+// a snapshot phase: a SnapshotBeginEvent, the data as of the initial scan
+// timestamp, and a SnapshotEndEvent, after which changes are tailed. It
+// requires an initial scan.
+func WithSnapshot(enabled bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.withSnapshot = enabled
+	}
+}
+
+// WithSourceLocality controls whether the producer annotates events with the
+// locality of the leaseholder of the range they were read from. The locality
+// is available via Event.GetSourceLocality.
+func WithSourceLocality(enabled bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.withSourceLocality = enabled
+	}
+}
+
+// WithCatchUpRateLimit limits the rate, in bytes per second, at which the
+// producer emits events until it has caught up to the time the subscription
+// started, so that a large initial or catch-up scan does not saturate the
+// source cluster. A limit of zero disables rate limiting.
+func WithCatchUpRateLimit(bytesPerSecond int64) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.catchUpBytesPerSecond = bytesPerSecond
+	}
+}
+
+// WithDeduplication suppresses KVs whose key and timestamp exactly match one of
+// the last window KVs delivered by the subscription, so that events re-emitted
+// by a restarted producer are delivered at most once as long as they fall
+// within the window. Duplicates older than the window are still delivered. A
+// window of zero disables deduplication.
+func WithDeduplication(window int) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.dedupWindow = window
+	}
+}
+
+// WithBatchSize controls how the producer packs KVs into the messages it sends
+// to the subscription, which unpacks each message into individual events. A
+// message is sent once it holds maxKVs KVs or exceeds maxBytes bytes,
+// whichever comes first. Larger batches reduce per-message overhead on
+// high-throughput streams. A limit of zero leaves the producer's default in
+// place.
+func WithBatchSize(maxKVs int, maxBytes int64) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.batchMaxKVs = int64(maxKVs)
+		cfg.batchMaxBytes = maxBytes
+	}
+}
+
+// WithStrictOrdering controls whether the subscription guarantees that a
+// checkpoint is only delivered after every data event at or below the
+// timestamps it resolves. Checkpoints that arrive from the producer together
+// with data are held back until that data is delivered, and a data event for a
+// span that was already resolved at or above the event's timestamp fails the
+// subscription rather than being delivered out of order.
+func WithStrictOrdering(enabled bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.strictOrdering = enabled
+	}
+}
+
+// WithSplitHints asks the producer to subdivide the subscribed spans at the
+// given keys, e.g. to spread hot spans over finer-grained batches. Events are
+// then annotated with the sub-span they were read from, which is available via
+// Event.GetSubSpan.
+func WithSplitHints(keys ...roachpb.Key) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.splitHints = append(cfg.splitHints, keys...)
+	}
+}
+
+// WithNewestFirstCatchUp controls whether the producer delivers the KVs it reads
+// while catching up from the previous replicated time in reverse-chronological
+// order, e.g. for reconciliation that wants the most recent changes first.
+// Once caught up, the stream is delivered in the usual order. The producer
+// buffers the whole catch-up window in memory and holds back checkpoints until
+// it is delivered, so this is only suitable for bounded windows.
+func WithNewestFirstCatchUp(enabled bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.newestFirstCatchUp = enabled
+	}
+}
+
+// WithMinCheckpointAdvance coalesces checkpoints so that one is only delivered
+// once the frontier has advanced by at least minAdvance since the last
+// delivered one, sparing consumers that act on every checkpoint from a flood of
+// tiny advances. A delivered checkpoint includes the resolved spans of any that
+// were held back before it. Data events are unaffected.
+func WithMinCheckpointAdvance(minAdvance time.Duration) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.minCheckpointAdvance = minAdvance
+	}
+}
+
+// WithGlobalCheckpoints controls whether the subscription delivers a
+// GlobalCheckpointEvent after each checkpoint that advances the minimum
+// resolved timestamp across all of its spans. Every event at or below a global
+// checkpoint, in any span, is delivered before it, which makes it a consistent
+// cut of the subscribed spans.
+func WithGlobalCheckpoints(enabled bool) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.globalCheckpoints = enabled
+	}
+}
+
+// WithKeepaliveInterval asks the producer to emit a KeepaliveEvent every
+// interval, even when the stream has no data or checkpoints to deliver, so
+// that load balancers and proxies that drop idle connections keep the stream
+// open. Keepalive events carry nothing and can be ignored.
+func WithKeepaliveInterval(interval time.Duration) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.keepaliveInterval = interval
+	}
+}
+
+// WithObserver makes the subscription a read-only observer of the stream, for
+// ad-hoc debugging. An observer takes no part in the stream's liveness: it
+// can't keep a stream alive that its consumer has stopped heartbeating, and
+// the producer ends the subscription with an error once the producer job
+// stops running.
+func WithObserver() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.observer = true
+	}
+}
+
+// WithCompressionLevel sets the level at which the producer compresses the
+// stream's events, trading CPU on the source for bandwidth. Level 0, the
+// default, compresses with snappy; levels up to streampb.MaxCompressionLevel
+// compress with zstd at that level.
+func WithCompressionLevel(level int32) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.compressionLevel = level
+	}
+}
+
+// WithMaxDecompressedSize bounds the size, in bytes, to which each compressed
+// event received by the subscription may decompress. The subscription fails
+// with an error wrapping streampb.ErrDecompressedEventTooLarge on an event that
+// exceeds it, rather than exhaust the consumer's memory decompressing it.
+func WithMaxDecompressedSize(maxBytes int64) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.maxDecompressedSize = maxBytes
+	}
+}
+
+// WithTransform applies transform to each event received by the subscription
+// before it is delivered, which lets a consumer centralize the rewriting of
+// keys. The subscription tracks its frontier and paused spans in terms of the
+// events it received, so a transform doesn't affect them.
+func WithTransform(transform EventTransform) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.transform = transform
+	}
+}
+
+// WithRegressionHandler checks each checkpoint received by the subscription
+// against the checkpoints it already delivered, and calls handler, before the
+// checkpoint is delivered, for each part of its spans whose resolved timestamp
+// it would regress. The resolved timestamp of a span must never regress, so
+// this is a guard against bugs in the producer. A regressing checkpoint that
+// the handler accepts is delivered but doesn't move the frontier back.
+//
+// NB: After reconnecting, the producer resumes from the spec's original
+// progress and may resend checkpoints that the subscription already delivered.
+// The handler sees those too.
+func WithRegressionHandler(handler RegressionHandler) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.onRegression = handler
+	}
+}
+
+// WithBatchedEvents delivers the subscription's events in batches on its
+// EventsBatched channel rather than one at a time on its Events channel,
+// which reduces the per-event overhead for high-throughput consumers. Events
+// that arrive together are delivered together, in batches of up to
+// maxEventBatchSize events.
+func WithBatchedEvents() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.batchedEvents = true
+	}
+}
+
+// WithTypedEvents delivers the subscription's KV events on its KVEvents
+// channel and its checkpoints on its ResolvedEvents channel, so that consumers
+// can select on the kinds of events they care about rather than switch on the
+// type of every event. Events of other types are still delivered on Events.
+// It can't be combined with WithBatchedEvents.
+func WithTypedEvents() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.typedEvents = true
+	}
+}
+
+// WithCatchUpComplete asks the producer to deliver a single
+// CatchUpCompleteEvent once the subscription has caught up to the time it
+// started, letting the consumer switch from bulk ingestion of the historical
+// changes to applying the changes that follow as they trickle in.
+func WithCatchUpComplete() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.withCatchUpComplete = true
+	}
+}
+
+// WithResumeTokens asks the producer to follow checkpoints with a
+// ResumeTokenEvent once every span of the subscription has been resolved. A
+// consumer that stores the latest token can pass it to WithResumeToken to
+// resume the subscription where it left off, without tracking the progress of
+// each span itself.
+func WithResumeTokens() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.withResumeTokens = true
+	}
+}
+
+// WithResumeToken resumes the subscription from the position encoded in a
+// token previously delivered by a subscription over the same spans. The
+// token takes precedence over the subscription's initial scan and previous
+// replicated times.
+func WithResumeToken(token []byte) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.resumeToken = token
+	}
+}
+
+// WithMaxCatchUpDuration bounds how long the producer may take to catch up to
+// the time the subscription started. If it hasn't by then, the subscription
+// delivers a CatchUpTimedOutEvent and ends with ErrCatchUpTimedOut, so that
+// the consumer can abort and bootstrap from a snapshot instead.
+func WithMaxCatchUpDuration(d time.Duration) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.maxCatchUpDuration = d
+	}
+}
+
+// WithCaughtUpThreshold sets how far the frontier of the subscription may
+// trail the current time for IsCaughtUp to report it as caught up.
+func WithCaughtUpThreshold(threshold time.Duration) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.caughtUpThreshold = threshold
+	}
+}
+
+// WithMaxStaleness asks the producer to keep the resolved timestamps of the
+// subscription's checkpoints within maxStaleness of the current time, for
+// consumers that tolerate stale data up to a hard bound. To meet it, the
+// rangefeeds of the producer push the transactions that hold the resolved
+// timestamps back more aggressively, so a tight bound comes at the expense of
+// the source cluster's workload. The bound can't be tighter than the lag of
+// the source cluster's closed timestamps.
+func WithMaxStaleness(maxStaleness time.Duration) SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.maxStaleness = maxStaleness
+	}
+}
+
+// WithCommitTimestampGroups asks the producer to deliver the KVs committed at
+// each timestamp together, in a single KVEvent, once the subscription's
+// checkpoints have resolved that timestamp, so that the KVs committed by a
+// transaction are delivered together. The producer can't tell transactions
+// apart, so transactions that committed at the same timestamp share an event.
+// KVs from the initial scan are delivered as usual. It cannot be combined with
+// WithSourceLocality or WithSplitHints.
+func WithCommitTimestampGroups() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.groupByCommitTS = true
+	}
+}
+
+// WithRawMVCC annotates the KV events of the subscription with their KVs in
+// the encoding of the storage engine, see Event.GetRawMVCCKVs, for consumers
+// that write them out as is, e.g. to build physical backups. Only committed
+// values are streamed, so intents are never included.
+func WithRawMVCC() SubscribeOption {
+	return func(cfg *subscribeConfig) {
+		cfg.rawMVCC = true
+	}
+}
+
 // Topology is a configuration of stream partitions. These are particular to a
 // stream. It specifies the number and addresses of partitions of the stream.
 //
@@ -160,6 +699,9 @@ func WithDiff(enableDiff bool) SubscribeOption {
 type Topology struct {
 	Partitions     []PartitionInfo
 	SourceTenantID roachpb.TenantID
+	// ExcludedSpans are the spans of the source tenant that the stream was
+	// created to leave out, and which no partition covers.
+	ExcludedSpans []roachpb.Span
 }
 
 // StreamAddresses returns the list of source addresses in a topology
@@ -195,15 +737,135 @@ type PartitionInfo struct {
 type Subscription interface {
 	// Subscribe starts receiving subscription events. Terminates when context
 	// is cancelled. It will release all resources when the function returns.
+	// If ctx carries a tracing span, the catch-up phase of the subscription,
+	// the rows it receives and the checkpoints it delivers are traced under it.
 	Subscribe(ctx context.Context) error
 
 	// Events is a channel receiving streaming events.
 	// This channel is closed when no additional values will be sent to this channel.
+	// No events are sent to it if the subscription delivers them on
+	// EventsBatched instead, and no KV events or checkpoints if it delivers
+	// those on KVEvents and ResolvedEvents.
 	Events() <-chan crosscluster.Event
 
+	// EventsBatched is a channel receiving the streaming events in batches, in
+	// the same order as they would otherwise be received on Events, for
+	// consumers that process them in bulk. A checkpoint is always the last
+	// event of its batch, so the data it resolves has been received once it
+	// is. It is nil unless the subscription was created WithBatchedEvents,
+	// and it is closed along with Events.
+	EventsBatched() <-chan []crosscluster.Event
+
+	// KVEvents and ResolvedEvents are channels receiving the KV events and the
+	// checkpoints of the subscription respectively, in place of Events. Each
+	// event is only sent once the previous one was received, on whichever
+	// channel, so the data that a checkpoint resolves has been received once
+	// it is. They are nil unless the subscription was created WithTypedEvents,
+	// and they are closed before Events.
+	KVEvents() <-chan crosscluster.Event
+	ResolvedEvents() <-chan crosscluster.Event
+
 	// Err is set once when Events channel closed -- must not be called before
 	// the channel closes.
 	Err() error
+
+	// ConnectionState returns the current state of the subscription's
+	// connection to the producer. It may be called at any time.
+	ConnectionState() ConnectionState
+
+	// WaitForFrontier blocks until every span of the subscription has been
+	// resolved to at least ts by a checkpoint delivered on the Events channel.
+	// It returns an error if the subscription ends before that, or if ctx is
+	// canceled.
+	WaitForFrontier(ctx context.Context, ts hlc.Timestamp) error
+
+	// ResolvedTSForKey returns the resolved timestamp of the span containing
+	// key, as of the checkpoints delivered on the Events channel so far. It is
+	// empty until the span has been resolved, and an error is returned if key
+	// is not in the subscription's spans.
+	ResolvedTSForKey(key roachpb.Key) (hlc.Timestamp, error)
+
+	// SetThrottle sets a backpressure signal for the subscription's partition:
+	// the fraction of its full delivery rate to shed, from 0, which leaves it
+	// unthrottled, to 1, which slows it as far as possible. The subscription
+	// reads more slowly from its producer, which in turn slows the producer of
+	// the partition, so an overloaded consumer can slow its busiest partitions
+	// without affecting the others. It may be called at any time.
+	SetThrottle(factor float64) error
+
+	// PauseSpan pauses the delivery of the events within sp, e.g. those of a
+	// table whose ingestion is overloaded, while the subscription's other
+	// spans continue. The paused span's checkpoints are held back along with
+	// its data, so its resolved timestamp stalls without regressing. The held
+	// back events are buffered by the subscription, which fails if they grow
+	// past a bound, so spans must not stay paused for long. sp must not
+	// overlap a span that is already paused. It may be called at any time.
+	PauseSpan(sp roachpb.Span) error
+
+	// ResumeSpan resumes a span paused by PauseSpan, first delivering the
+	// events held back while it was paused.
+	ResumeSpan(sp roachpb.Span) error
+
+	// Spans returns the spans the subscription is serving. It may be called
+	// at any time.
+	Spans() []roachpb.Span
+
+	// IsCaughtUp returns whether the frontier of the checkpoints delivered on
+	// the Events channel is within the subscription's caught-up threshold of
+	// the current time. Since it is measured against the current time, it
+	// turns false again once the subscription, or its consumer, falls behind,
+	// even if no further checkpoints are delivered. It may be called at any
+	// time.
+	IsCaughtUp() bool
+
+	// CatchUpETA estimates how long the subscription will take to catch up,
+	// as defined by IsCaughtUp, from how far its frontier trails the current
+	// time and how quickly the frontier has advanced since it was first
+	// resolved. The estimate is refined with every delivered checkpoint, and
+	// is zero once the subscription is caught up. It returns false if there
+	// is no estimate yet, or if the frontier isn't advancing faster than the
+	// current time, in which case the subscription isn't catching up. It may
+	// be called at any time.
+	CatchUpETA() (time.Duration, bool)
+}
+
+// ConnectionStatus describes the health of a Subscription's connection to the
+// producer.
+type ConnectionStatus int
+
+const (
+	// ConnectionConnecting means the subscription is establishing its
+	// connection, or has not received anything over it yet.
+	ConnectionConnecting ConnectionStatus = iota
+	// ConnectionHealthy means the subscription is receiving from the producer.
+	ConnectionHealthy
+	// ConnectionDegraded means the subscription's connection failed, and no
+	// further events will be received over it.
+	ConnectionDegraded
+)
+
+func (s ConnectionStatus) String() string {
+	switch s {
+	case ConnectionConnecting:
+		return "connecting"
+	case ConnectionHealthy:
+		return "healthy"
+	case ConnectionDegraded:
+		return "degraded"
+	default:
+		return fmt.Sprintf("ConnectionStatus(%d)", int(s))
+	}
+}
+
+// ConnectionState is the state of a Subscription's connection to the
+// producer. Since the producer sends checkpoints even when no data changes, a
+// healthy connection with a stale LastReceive points at a stuck producer rather
+// than an idle one.
+type ConnectionState struct {
+	Status ConnectionStatus
+	// LastReceive is the time at which the subscription last received a
+	// message from the producer, or zero if it hasn't yet.
+	LastReceive time.Time
 }
 
 // NewStreamClient creates a new stream client based on the stream address.
@@ -306,6 +968,20 @@ type options struct {
 	streamID   streampb.StreamID
 	compressed bool
 	logical    bool
+
+	// keepAlive, if positive, overrides the TCP keepalive period of the
+	// client's connections.
+	keepAlive time.Duration
+	// readTimeout, if positive, bounds how long a read on any of the
+	// client's connections may wait for data.
+	readTimeout time.Duration
+
+	// wallClock, if set, replaces the system clock as the consumer's clock
+	// when estimating the clock skew between the producer and consumer.
+	wallClock hlc.WallClock
+	// clockSkewWarningThreshold, if positive, overrides the clock skew above
+	// which a warning is logged.
+	clockSkewWarningThreshold time.Duration
 }
 
 func (o *options) appName() string {
@@ -341,6 +1017,45 @@ func WithLogical() Option {
 	}
 }
 
+// WithKeepAlive sets the period of the TCP keepalive probes sent on the
+// client's connections, including those of its subscriptions, e.g. to keep
+// idle subscriptions alive through NATs and firewalls that drop idle
+// connections. It defaults to 15 seconds.
+func WithKeepAlive(interval time.Duration) Option {
+	return func(o *options) {
+		o.keepAlive = interval
+	}
+}
+
+// WithReadTimeout fails reads on the client's connections that wait longer
+// than timeout for data, so that connections that were silently dropped are
+// detected rather than waited on forever. Subscriptions receive checkpoints
+// regularly even when idle, so the timeout should comfortably exceed the
+// producer's checkpoint frequency.
+func WithReadTimeout(timeout time.Duration) Option {
+	return func(o *options) {
+		o.readTimeout = timeout
+	}
+}
+
+// WithWallClock sets the clock against which the client measures the skew of
+// the producer's clock. It defaults to the system clock, and is overridden in
+// tests to simulate a skewed clock.
+func WithWallClock(clock hlc.WallClock) Option {
+	return func(o *options) {
+		o.wallClock = clock
+	}
+}
+
+// WithClockSkewWarningThreshold sets the clock skew between the producer and
+// consumer, as observed by heartbeats, above which the client logs a warning.
+// It defaults to 250 milliseconds.
+func WithClockSkewWarningThreshold(threshold time.Duration) Option {
+	return func(o *options) {
+		o.clockSkewWarningThreshold = threshold
+	}
+}
+
 func processOptions(opts []Option) *options {
 	ret := &options{}
 	for _, o := range opts {
@@ -10,95 +10,530 @@ package streamclient
 
 import (
 	"context"
+	"math"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
-	"github.com/golang/snappy"
+	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/jackc/pgx/v4"
 	"github.com/pkg/errors"
+	"go.opentelemetry.io/otel/attribute"
 )
 
-func subscribeInternal(
-	ctx context.Context,
-	feed pgx.Rows,
-	eventCh chan crosscluster.Event,
-	closeCh chan struct{},
-	compressed bool,
-) error {
+// maxEventBatchSize is the maximum number of events that a subscription
+// delivers in one batch on its EventsBatched channel.
+const maxEventBatchSize = 1024
+
+// feedOptions configures how subscribeInternal delivers the events of a feed.
+// The partitioned stream client derives it from the subscribeConfig of the
+// subscription.
+type feedOptions struct {
+	// eventCh receives the events of the feed, unless batchCh or typed is set.
+	eventCh chan crosscluster.Event
+	// batchCh, if set, receives the events in batches in place of eventCh.
+	batchCh chan []crosscluster.Event
+	// typed, if set, receives the KV events and checkpoints in place of
+	// eventCh.
+	typed *typedEventChans
+	// closeCh is closed to stop the subscription.
+	closeCh chan struct{}
+
+	// compressed is set if the events of the feed are compressed. If
+	// maxDecompressedSize is positive, events that decompress to more than it
+	// fail the subscription.
+	compressed          bool
+	maxDecompressedSize int64
+	// strictOrdering is set if checkpoints must be delivered strictly after
+	// the data they resolve.
+	strictOrdering bool
+	// globalCheckpoints is set if a GlobalCheckpointEvent must be delivered
+	// whenever the frontier of all spans advances.
+	globalCheckpoints bool
+	// sourceClusterID, if set, annotates the events.
+	sourceClusterID uuid.UUID
+	// rawMVCC is set if KV events must be annotated with the raw MVCC encoding
+	// of their KVs.
+	rawMVCC bool
+	// transform, if set, is applied to the events before they are annotated.
+	transform EventTransform
+
+	// dedup, if set, suppresses recently delivered KVs.
+	dedup *kvDeduplicator
+	// coalescer, if set, holds back checkpoints that don't advance the
+	// frontier far enough.
+	coalescer *checkpointCoalescer
+	// conn and frontier must be set; throttle and pauser are optional.
+	conn     *connectionStateTracker
+	frontier *frontierTracker
+	throttle *feedThrottle
+	pauser   *spanPauser
+}
+
+// subscribeInternal reads the events of feed and delivers them as configured by
+// opts. If ctx carries a tracing span, the rows received and the checkpoints
+// delivered are traced under it, see feedTracer.
+func subscribeInternal(ctx context.Context, feed pgx.Rows, opts feedOptions) error {
+	tracer := newFeedTracer(ctx, opts.frontier.now())
+	defer tracer.finish()
+
+	// batch holds the events that have yet to be delivered on batchCh.
+	var batch []crosscluster.Event
+	// flush delivers the pending batch of events, returning false if the
+	// subscription should exit instead.
+	flush := func() (bool, error) {
+		if len(batch) == 0 {
+			return true, nil
+		}
+		select {
+		case opts.batchCh <- batch:
+			batch = nil
+			return true, nil
+		case <-opts.closeCh:
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
+		}
+	}
+
+	// rowReader, if set, reads the rows of the feed on its own goroutine, so
+	// that the events released by resumed spans are delivered while waiting
+	// for the next row rather than along with it. It is only started once the
+	// pauser holds back events, as only then can resuming a span release any.
+	var rowReader *feedReader
+	var releasedC <-chan struct{}
+	defer func() {
+		if rowReader != nil {
+			rowReader.stop()
+		}
+	}()
+	// readRow reads the next row of the feed, returning false at its end.
+	readRow := func() (data []byte, ok bool, err error) {
+		if rowReader == nil && opts.pauser != nil && opts.pauser.holding() {
+			rowReader = startFeedReader(feed)
+			releasedC = opts.pauser.releasedSignal()
+		}
+		if rowReader != nil {
+			return rowReader.read(releasedC)
+		}
+		if !feed.Next() {
+			return nil, false, feed.Err()
+		}
+		err = feed.Scan(&data)
+		return data, true, err
+	}
+
 	// Get the next event from the cursor.
 	var bufferedEvent *streampb.StreamEvent
 	getNextEvent := func() (crosscluster.Event, error) {
-		if e := parseEvent(bufferedEvent); e != nil {
-			return e, nil
-		}
+		// recvSp traces the receipt of the row being read, if any.
+		var recvSp *tracing.Span
+		defer func() { recvSp.Finish() }()
+		for {
+			if e := parseEvent(bufferedEvent, opts.strictOrdering); e != nil {
+				return e, nil
+			}
 
-		if !feed.Next() {
-			if err := feed.Err(); err != nil {
+			// Deliver the events parsed so far before waiting for more.
+			if ok, err := flush(); !ok {
+				if err == nil {
+					err = errSubscriptionClosed
+				}
 				return nil, err
 			}
-			return nil, nil
-		}
-		var data []byte
-		if err := feed.Scan(&data); err != nil {
-			return nil, err
+			recvSp = tracer.startReceive()
+			var readStart time.Time
+			if opts.throttle != nil {
+				readStart = timeutil.Now()
+			}
+			data, ok, err := readRow()
+			if err != nil {
+				return nil, err
+			}
+			if !ok {
+				return nil, nil
+			}
+			opts.conn.received()
+			recvSp.SetTag("bytes", attribute.IntValue(len(data)))
+			if opts.throttle != nil {
+				if err := opts.throttle.wait(ctx, opts.closeCh, timeutil.Since(readStart)); err != nil {
+					return nil, err
+				}
+			}
+			var streamEvent streampb.StreamEvent
+			var decompressionErr error
+
+			if opts.compressed {
+				var decompressed []byte
+				var err error
+				if opts.maxDecompressedSize > 0 {
+					decompressed, err = streampb.DecompressEventLimited(data, opts.maxDecompressedSize)
+				} else {
+					decompressed, err = streampb.DecompressEvent(data)
+				}
+				if errors.Is(err, streampb.ErrDecompressedEventTooLarge) {
+					return nil, err
+				}
+				if err != nil {
+					// Maybe it just wasn't compressed by an older source node; proceed to
+					// try to decode it as-is but then if that fails, return this error.
+					decompressionErr = err
+				} else {
+					data = decompressed
+				}
+			}
+
+			if err := protoutil.Unmarshal(data, &streamEvent); err != nil {
+				if decompressionErr != nil {
+					return nil, errors.Wrap(err, "decompression failed")
+				}
+				return nil, err
+			}
+			if streamEvent.Batch != nil && isEmptyBatch(streamEvent.Batch) {
+				return nil, errors.New("unexpected empty batch in stream event (source cluster version may not be supported)")
+			}
+			if recvSp != nil {
+				recvSp.SetTag("events", attribute.IntValue(numBatchEvents(streamEvent.Batch)))
+				recvSp.Finish()
+				recvSp = nil
+			}
+			var suppressed bool
+			if opts.dedup != nil && streamEvent.Batch != nil {
+				opts.dedup.filterBatch(streamEvent.Batch)
+				if isEmptyBatch(streamEvent.Batch) {
+					streamEvent.Batch = nil
+					suppressed = true
+				}
+			}
+			bufferedEvent = &streamEvent
+			if e := parseEvent(bufferedEvent, opts.strictOrdering); e != nil || !suppressed {
+				return e, nil
+			}
+			// Every KV in the batch was a duplicate and nothing else came with
+			// it, so move on to the next row rather than signaling the end of the
+			// feed.
 		}
-		var streamEvent streampb.StreamEvent
-		var decompressionErr error
+	}
 
-		if compressed {
-			decompressed, err := snappy.Decode(nil, data)
+	// deliver sends the event to the consumer, returning false if the
+	// subscription should exit instead.
+	deliver := func(event crosscluster.Event) (bool, error) {
+		if opts.transform != nil && event != nil {
+			eventType := event.Type()
+			var err error
+			if event, err = opts.transform(event); err != nil {
+				return false, errors.Wrap(err, "transforming event")
+			}
+			if event == nil {
+				return false, errors.New("transform returned no event")
+			}
+			if event.Type() != eventType {
+				return false, errors.Errorf("transform changed the event type from %d to %d",
+					eventType, event.Type())
+			}
+		}
+		if event != nil && !opts.sourceClusterID.Equal(uuid.Nil) {
+			event = crosscluster.WithSourceClusterID(event, opts.sourceClusterID)
+		}
+		if opts.rawMVCC && event != nil && event.Type() == crosscluster.KVEvent {
+			kvs, err := encodeRawMVCC(event.GetKVs())
 			if err != nil {
-				// Maybe it just wasn't compressed by an older source node; proceed to
-				// try to decode it as-is but then if that fails, return this error.
-				decompressionErr = err
-			} else {
-				data = decompressed
+				return false, err
 			}
+			event = crosscluster.WithRawMVCCKVs(event, kvs)
 		}
-
-		if err := protoutil.Unmarshal(data, &streamEvent); err != nil {
-			if decompressionErr != nil {
-				return nil, errors.Wrap(err, "decompression failed")
+		if opts.batchCh != nil {
+			batch = append(batch, event)
+			if len(batch) >= maxEventBatchSize {
+				return flush()
 			}
-			return nil, err
+			return true, nil
 		}
-		if streamEvent.Batch != nil && isEmptyBatch(streamEvent.Batch) {
-			return nil, errors.New("unexpected empty batch in stream event (source cluster version may not be supported)")
+		out := opts.eventCh
+		if opts.typed != nil {
+			out = opts.typed.route(event, opts.eventCh)
+		}
+		select {
+		case out <- event:
+			return true, nil
+		case <-opts.closeCh:
+			// Exit quietly to not cause other subscriptions in the same
+			// ctxgroup.Group to exit.
+			return false, nil
+		case <-ctx.Done():
+			return false, ctx.Err()
 		}
-		bufferedEvent = &streamEvent
-		return parseEvent(bufferedEvent), nil
 	}
 
+	// globalCheckpoint is the timestamp of the last delivered
+	// GlobalCheckpointEvent, or of the frontier that was reached before a
+	// reconnect.
+	globalCheckpoint := opts.frontier.get()
+	// process delivers the event and, if it is a checkpoint, advances the
+	// frontier, returning false if the subscription should exit instead.
+	process := func(event crosscluster.Event) (bool, error) {
+		if event != nil && event.Type() == crosscluster.CheckpointEvent {
+			sp := tracer.startCheckpoint(len(event.GetResolvedSpans()))
+			defer func() {
+				ts := opts.frontier.get()
+				if sp != nil {
+					sp.SetTag("frontier", attribute.StringValue(ts.String()))
+					sp.Finish()
+				}
+				// The span may be a child of the catch-up span, which is only
+				// finished after it.
+				tracer.observeFrontier(ts)
+			}()
+		}
+		if ok, err := deliver(event); !ok {
+			return false, err
+		}
+		if event != nil && event.Type() == crosscluster.CatchUpCompleteEvent {
+			tracer.caughtUp()
+		}
+		if event != nil && event.Type() == crosscluster.CheckpointEvent {
+			// The checkpoint must reach the consumer before the frontier
+			// reflects it, so it ends its batch.
+			if ok, err := flush(); !ok {
+				return false, err
+			}
+			if err := opts.frontier.forward(event.GetResolvedSpans()); err != nil {
+				return false, err
+			}
+			// The frontier is the minimum over all the subscription's spans,
+			// so every change at or below it has been delivered.
+			if ts := opts.frontier.get(); opts.globalCheckpoints && globalCheckpoint.Less(ts) {
+				globalCheckpoint = ts
+				if ok, err := deliver(crosscluster.MakeGlobalCheckpointEvent(ts)); !ok {
+					return false, err
+				}
+			}
+		}
+		return true, nil
+	}
 	for {
 		event, err := getNextEvent()
-		if err != nil {
+		if errors.Is(err, errSubscriptionClosed) {
+			return nil
+		} else if errors.Is(err, errSpansResumed) {
+			for _, released := range opts.pauser.takeReleased() {
+				if ok, err := process(released); !ok {
+					return err
+				}
+			}
+			continue
+		} else if err != nil {
 			return err
 		}
-		select {
-		case eventCh <- event:
-		case <-closeCh:
-			// Exit quietly to not cause other subscriptions in the same
-			// ctxgroup.Group to exit.
-			return nil
-		case <-ctx.Done():
-			return ctx.Err()
+		if opts.strictOrdering && event != nil {
+			if err := opts.frontier.checkUnresolved(event); err != nil {
+				return err
+			}
+		}
+		if event != nil && event.Type() == crosscluster.CheckpointEvent {
+			if err := opts.frontier.checkRegression(event.GetResolvedSpans()); err != nil {
+				return err
+			}
+		}
+		if opts.coalescer != nil && event != nil && event.Type() == crosscluster.CheckpointEvent {
+			if event, err = opts.coalescer.coalesce(event.GetResolvedSpans()); err != nil {
+				return err
+			}
+			if event == nil {
+				// The frontier hasn't advanced far enough since the last
+				// delivered checkpoint.
+				continue
+			}
+		}
+		if opts.pauser != nil && event != nil {
+			events, err := opts.pauser.filter(event)
+			if err != nil {
+				return err
+			}
+			if len(events) == 0 {
+				// The event was entirely in paused spans.
+				continue
+			}
+			// Events released by resumed spans come first, as they were
+			// received before the event.
+			for _, released := range events[:len(events)-1] {
+				if ok, err := process(released); !ok {
+					return err
+				}
+			}
+			event = events[len(events)-1]
+		}
+		if ok, err := process(event); !ok {
+			return err
+		}
+		if event != nil && event.Type() == crosscluster.StreamCanceledEvent {
+			// The producer job was canceled and the producer has ended the
+			// stream. The consumer has been told, so this is a clean exit.
+			_, err := flush()
+			return err
+		}
+		if event != nil && event.Type() == crosscluster.CatchUpTimedOutEvent {
+			// The producer gave up on catching up and ended the stream, which
+			// the consumer must act on, e.g. by bootstrapping from a snapshot.
+			if ok, err := flush(); !ok {
+				return err
+			}
+			return ErrCatchUpTimedOut
 		}
 	}
 }
 
+// encodeRawMVCC returns the given KVs in the encoding of the storage engine.
+func encodeRawMVCC(kvs []streampb.StreamEvent_KV) ([]crosscluster.RawMVCCKeyValue, error) {
+	raw := make([]crosscluster.RawMVCCKeyValue, len(kvs))
+	for i, kv := range kvs {
+		raw[i].Key = storage.EncodeMVCCKey(storage.MVCCKey{
+			Key:       kv.KeyValue.Key,
+			Timestamp: kv.KeyValue.Value.Timestamp,
+		})
+		value, err := storage.EncodeMVCCValue(storage.MVCCValue{Value: kv.KeyValue.Value})
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding value of %s", kv.KeyValue.Key)
+		}
+		raw[i].Value = value
+	}
+	return raw, nil
+}
+
+// errSubscriptionClosed is returned by the reader of a subscription's feed
+// when the subscription was closed while it was delivering events.
+var errSubscriptionClosed = errors.New("subscription closed")
+
+// errSpansResumed is returned by the reader of a subscription's feed when
+// paused spans were resumed while it waited for the next row, so that their
+// held back events can be delivered first.
+var errSpansResumed = errors.New("spans resumed")
+
+// feedReader reads the rows of a feed on its own goroutine, one at a time and
+// only when asked to, so that waiting for a row can be interrupted.
+type feedReader struct {
+	feed pgx.Rows
+	reqC chan struct{}
+	rowC chan feedRow
+	// pending is set while a requested row is yet to be received.
+	pending bool
+}
+
+// feedRow is a row read by a feedReader. ok is false at the end of the feed.
+type feedRow struct {
+	data []byte
+	ok   bool
+	err  error
+}
+
+func startFeedReader(feed pgx.Rows) *feedReader {
+	r := &feedReader{
+		feed: feed,
+		reqC: make(chan struct{}),
+		rowC: make(chan feedRow, 1),
+	}
+	go func() {
+		for range r.reqC {
+			var row feedRow
+			if row.ok = r.feed.Next(); row.ok {
+				row.err = r.feed.Scan(&row.data)
+			} else {
+				row.err = r.feed.Err()
+			}
+			r.rowC <- row
+		}
+	}()
+	return r
+}
+
+// read returns the next row of the feed, or errSpansResumed if interruptC
+// receives first, in which case the row is returned by the next call.
+func (r *feedReader) read(interruptC <-chan struct{}) (data []byte, ok bool, err error) {
+	if !r.pending {
+		r.reqC <- struct{}{}
+		r.pending = true
+	}
+	select {
+	case row := <-r.rowC:
+		r.pending = false
+		return row.data, row.ok, row.err
+	case <-interruptC:
+		return nil, false, errSpansResumed
+	}
+}
+
+// stop stops the reader. It waits for a pending read to complete, like a
+// subscription reading the feed directly would, so that the feed is no longer
+// in use once it returns.
+func (r *feedReader) stop() {
+	close(r.reqC)
+	if r.pending {
+		<-r.rowC
+	}
+}
+
+// ErrCatchUpTimedOut is the error of a subscription whose stream did not catch
+// up within the duration set by WithMaxCatchUpDuration.
+var ErrCatchUpTimedOut = errors.New("subscription did not catch up within its maximum catch-up duration")
+
 // parseEvent parses next event from the batch of events inside streampb.StreamEvent.
-func parseEvent(streamEvent *streampb.StreamEvent) crosscluster.Event {
+// A checkpoint is parsed ahead of the batch, unless checkpointLast is set.
+func parseEvent(streamEvent *streampb.StreamEvent, checkpointLast bool) crosscluster.Event {
 	if streamEvent == nil {
 		return nil
 	}
 
-	if streamEvent.Checkpoint != nil {
+	if streamEvent.Checkpoint != nil && (!checkpointLast || streamEvent.Batch == nil) {
 		event := crosscluster.MakeCheckpointEvent(streamEvent.Checkpoint.ResolvedSpans)
 		streamEvent.Checkpoint = nil
 		return event
 	}
 
+	// A resume token encodes the position of the checkpoint it accompanies, so
+	// it must follow that checkpoint.
+	if streamEvent.ResumeToken != nil && streamEvent.Checkpoint == nil {
+		event := crosscluster.MakeResumeTokenEvent(streamEvent.ResumeToken)
+		streamEvent.ResumeToken = nil
+		return event
+	}
+
+	if marker := streamEvent.SnapshotMarker; marker != nil {
+		streamEvent.SnapshotMarker = nil
+		if marker.Phase == streampb.StreamEvent_SnapshotMarker_END {
+			return crosscluster.MakeSnapshotEndEvent(marker.Timestamp)
+		}
+		return crosscluster.MakeSnapshotBeginEvent(marker.Timestamp)
+	}
+
+	if streamEvent.StreamCanceled {
+		streamEvent.StreamCanceled = false
+		return crosscluster.MakeStreamCanceledEvent()
+	}
+
+	if streamEvent.Keepalive {
+		streamEvent.Keepalive = false
+		return crosscluster.MakeKeepaliveEvent()
+	}
+
+	if streamEvent.CatchUpTimedOut {
+		streamEvent.CatchUpTimedOut = false
+		return crosscluster.MakeCatchUpTimedOutEvent()
+	}
+
+	if ts := streamEvent.CatchUpComplete; ts != nil {
+		streamEvent.CatchUpComplete = nil
+		return crosscluster.MakeCatchUpCompleteEvent(*ts)
+	}
+
 	var event crosscluster.Event
 	if streamEvent.Batch != nil {
 		switch {
@@ -122,6 +557,13 @@ func parseEvent(streamEvent *streampb.StreamEvent) crosscluster.Event {
 			streamEvent.Batch.SplitPoints = streamEvent.Batch.SplitPoints[1:]
 		}
 
+		if event != nil && streamEvent.Batch.SourceLocality.NonEmpty() {
+			event = crosscluster.WithSourceLocality(event, streamEvent.Batch.SourceLocality)
+		}
+		if event != nil && streamEvent.Batch.SubSpan.Valid() {
+			event = crosscluster.WithSubSpan(event, streamEvent.Batch.SubSpan)
+		}
+
 		if isEmptyBatch(streamEvent.Batch) {
 			streamEvent.Batch = nil
 		}
@@ -137,3 +579,903 @@ func isEmptyBatch(b *streampb.StreamEvent_Batch) bool {
 		len(b.SpanConfigs) == 0 &&
 		len(b.SplitPoints) == 0
 }
+
+// kvDeduplicator remembers the (key, timestamp) pairs of the most recently
+// delivered KVs and filters out exact repeats of them, such as those
+// re-emitted by a producer that restarted from an earlier checkpoint.
+type kvDeduplicator struct {
+	seen map[kvIdentity]struct{}
+	// recent is a ring buffer of the identities in seen, in delivery order;
+	// next is the position of the oldest once the buffer is full.
+	recent []kvIdentity
+	next   int
+}
+
+type kvIdentity struct {
+	key string
+	ts  hlc.Timestamp
+}
+
+func newKVDeduplicator(window int) *kvDeduplicator {
+	return &kvDeduplicator{
+		seen:   make(map[kvIdentity]struct{}, window),
+		recent: make([]kvIdentity, 0, window),
+	}
+}
+
+// isDuplicate returns true if the KV was delivered within the window, and
+// otherwise records it, evicting the oldest KV if the window is full.
+func (d *kvDeduplicator) isDuplicate(key roachpb.Key, ts hlc.Timestamp) bool {
+	id := kvIdentity{key: string(key), ts: ts}
+	if _, ok := d.seen[id]; ok {
+		return true
+	}
+	if len(d.recent) < cap(d.recent) {
+		d.recent = append(d.recent, id)
+	} else {
+		delete(d.seen, d.recent[d.next])
+		d.recent[d.next] = id
+		d.next = (d.next + 1) % len(d.recent)
+	}
+	d.seen[id] = struct{}{}
+	return false
+}
+
+// filterBatch removes the duplicate KVs from the batch in place.
+func (d *kvDeduplicator) filterBatch(b *streampb.StreamEvent_Batch) {
+	kvs := b.KVs[:0]
+	for _, kv := range b.KVs {
+		if !d.isDuplicate(kv.KeyValue.Key, kv.KeyValue.Value.Timestamp) {
+			kvs = append(kvs, kv)
+		}
+	}
+	b.KVs = kvs
+
+	deprecatedKVs := b.DeprecatedKeyValues[:0]
+	for _, kv := range b.DeprecatedKeyValues {
+		if !d.isDuplicate(kv.Key, kv.Value.Timestamp) {
+			deprecatedKVs = append(deprecatedKVs, kv)
+		}
+	}
+	b.DeprecatedKeyValues = deprecatedKVs
+}
+
+// checkpointCoalescer holds back checkpoints until the frontier they resolve
+// has advanced by at least minAdvance since the last delivered one. The resolved
+// spans of held back checkpoints are carried over into the next delivered one.
+type checkpointCoalescer struct {
+	minAdvance time.Duration
+	// frontier is the frontier of all received checkpoints. It is nil until the
+	// subscription's spans are known, either from init or, failing that, from
+	// the first checkpoint.
+	frontier span.Frontier
+	// delivered is the frontier timestamp of the last delivered checkpoint, or
+	// empty if none was delivered yet.
+	delivered hlc.Timestamp
+}
+
+func newCheckpointCoalescer(minAdvance time.Duration, spans []roachpb.Span) (*checkpointCoalescer, error) {
+	c := &checkpointCoalescer{minAdvance: minAdvance}
+	if len(spans) > 0 {
+		fr, err := span.MakeFrontier(spans...)
+		if err != nil {
+			return nil, err
+		}
+		c.frontier = fr
+	}
+	return c, nil
+}
+
+// coalesce records the resolved spans of a received checkpoint and returns the
+// checkpoint event to deliver in its place, or nil if it should be held back.
+func (c *checkpointCoalescer) coalesce(
+	resolvedSpans []jobspb.ResolvedSpan,
+) (crosscluster.Event, error) {
+	if c.frontier == nil {
+		spans := make([]roachpb.Span, len(resolvedSpans))
+		for i, rs := range resolvedSpans {
+			spans[i] = rs.Span
+		}
+		fr, err := span.MakeFrontier(spans...)
+		if err != nil {
+			return nil, err
+		}
+		c.frontier = fr
+	}
+	for _, rs := range resolvedSpans {
+		if _, err := c.frontier.Forward(rs.Span, rs.Timestamp); err != nil {
+			return nil, err
+		}
+	}
+	ts := c.frontier.Frontier()
+	if ts.Less(c.delivered.Add(c.minAdvance.Nanoseconds(), 0)) {
+		return nil, nil
+	}
+	c.delivered = ts
+	var coalesced []jobspb.ResolvedSpan
+	c.frontier.Entries(func(sp roachpb.Span, resolvedTS hlc.Timestamp) span.OpResult {
+		coalesced = append(coalesced, jobspb.ResolvedSpan{Span: sp, Timestamp: resolvedTS})
+		return span.ContinueMatch
+	})
+	return crosscluster.MakeCheckpointEvent(coalesced), nil
+}
+
+// maxThrottleDelay bounds the pause after each message read by a throttled
+// subscription, so that lowering its throttle takes effect promptly.
+const maxThrottleDelay = time.Second
+
+// feedThrottle paces the reads of a subscription from its producer according
+// to the throttle set by the consumer. It is safe for concurrent use.
+type feedThrottle struct {
+	mu struct {
+		syncutil.Mutex
+		factor float64
+	}
+}
+
+// set sets the fraction of the full read rate to shed.
+func (t *feedThrottle) set(factor float64) error {
+	if math.IsNaN(factor) || factor < 0 || factor > 1 {
+		return errors.Errorf("throttle factor must be between 0 and 1, got %f", factor)
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	t.mu.factor = factor
+	return nil
+}
+
+// delay returns how long to pause after a message that took busy to read, so
+// that messages are read at the unshed fraction of the full rate.
+func (t *feedThrottle) delay(busy time.Duration) time.Duration {
+	t.mu.Lock()
+	factor := t.mu.factor
+	t.mu.Unlock()
+	if factor == 0 {
+		return 0
+	}
+	if factor == 1 {
+		return maxThrottleDelay
+	}
+	if d := time.Duration(float64(busy) * factor / (1 - factor)); d < maxThrottleDelay {
+		return d
+	}
+	return maxThrottleDelay
+}
+
+// wait pauses after a message that took busy to read. The pause is cut short
+// if the subscription is closed.
+func (t *feedThrottle) wait(ctx context.Context, closeCh chan struct{}, busy time.Duration) error {
+	d := t.delay(busy)
+	if d == 0 {
+		return nil
+	}
+	var timer timeutil.Timer
+	defer timer.Stop()
+	timer.Reset(d)
+	select {
+	case <-timer.C:
+		timer.Read = true
+		return nil
+	case <-closeCh:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// defaultMaxPausedBytes is the default bound on the size of the events that a
+// spanPauser holds back.
+const defaultMaxPausedBytes = 64 << 20 // 64 MiB
+
+// spanPauser holds back the events of the spans of a subscription that the
+// consumer paused, and releases them when the spans are resumed. The producer
+// keeps sending the events of paused spans, so they accumulate in memory for as
+// long as the spans are paused, up to maxHeldBytes, past which the
+// subscription fails. They are dropped if the subscription ends first; since
+// the checkpoints of a paused span are held back along with its data, resuming
+// from the subscription's frontier still receives them. It is safe for
+// concurrent use.
+type spanPauser struct {
+	// maxHeldBytes bounds the size of the held back events. If zero,
+	// defaultMaxPausedBytes is used.
+	maxHeldBytes int64
+
+	mu struct {
+		syncutil.Mutex
+		// paused holds the paused spans, which don't overlap.
+		paused []pausedSpan
+		// heldBytes is the size of the events held back for all paused spans.
+		heldBytes int64
+		// released holds the events of resumed spans that are yet to be
+		// delivered.
+		released []crosscluster.Event
+		// releasedC, if set, is signaled when events are released.
+		releasedC chan struct{}
+	}
+}
+
+// pausedSpan is a paused span of a subscription along with the events held back
+// for it, in the order they were received.
+type pausedSpan struct {
+	span  roachpb.Span
+	held  []crosscluster.Event
+	bytes int64
+}
+
+// pause pauses sp, which must not overlap a span that is already paused.
+func (p *spanPauser) pause(sp roachpb.Span) error {
+	if !sp.Valid() {
+		return errors.Errorf("invalid span %s", sp)
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, ps := range p.mu.paused {
+		if ps.span.Overlaps(sp) {
+			return errors.Errorf("span %s overlaps paused span %s", sp, ps.span)
+		}
+	}
+	p.mu.paused = append(p.mu.paused, pausedSpan{span: sp})
+	return nil
+}
+
+// resume resumes sp, which must have been paused, and releases the events held
+// back for it.
+func (p *spanPauser) resume(sp roachpb.Span) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for i, ps := range p.mu.paused {
+		if ps.span.Equal(sp) {
+			p.mu.released = append(p.mu.released, ps.held...)
+			p.mu.heldBytes -= ps.bytes
+			p.mu.paused = append(p.mu.paused[:i], p.mu.paused[i+1:]...)
+			if len(ps.held) > 0 && p.mu.releasedC != nil {
+				select {
+				case p.mu.releasedC <- struct{}{}:
+				default:
+				}
+			}
+			return nil
+		}
+	}
+	return errors.Errorf("span %s is not paused", sp)
+}
+
+// releasedSignal returns a channel that receives when events are released by
+// resumed spans, see takeReleased. If events were released before it was first
+// called, the channel already holds a signal.
+func (p *spanPauser) releasedSignal() <-chan struct{} {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.mu.releasedC == nil {
+		p.mu.releasedC = make(chan struct{}, 1)
+		if len(p.mu.released) > 0 {
+			p.mu.releasedC <- struct{}{}
+		}
+	}
+	return p.mu.releasedC
+}
+
+// holding returns whether the pauser holds back events, or has released events
+// that are yet to be delivered.
+func (p *spanPauser) holding() bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if len(p.mu.released) > 0 {
+		return true
+	}
+	for _, ps := range p.mu.paused {
+		if len(ps.held) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// takeReleased returns the events released by resumed spans that are yet to be
+// delivered.
+func (p *spanPauser) takeReleased() []crosscluster.Event {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	released := p.mu.released
+	p.mu.released = nil
+	return released
+}
+
+// holdLocked holds back event for the i-th paused span. It returns an error if
+// the held back events would exceed maxHeldBytes.
+func (p *spanPauser) holdLocked(i int, event crosscluster.Event) error {
+	limit := p.maxHeldBytes
+	if limit == 0 {
+		limit = defaultMaxPausedBytes
+	}
+	size := heldEventSize(event)
+	if p.mu.heldBytes+size > limit {
+		return errors.Errorf(
+			"events held back for paused spans exceed %d bytes; span %s must be resumed sooner",
+			limit, p.mu.paused[i].span)
+	}
+	p.mu.paused[i].held = append(p.mu.paused[i].held, event)
+	p.mu.paused[i].bytes += size
+	p.mu.heldBytes += size
+	return nil
+}
+
+// heldEventSize returns the size of an event held back by a spanPauser.
+func heldEventSize(event crosscluster.Event) int64 {
+	var size int
+	switch event.Type() {
+	case crosscluster.KVEvent:
+		for _, kv := range event.GetKVs() {
+			size += kv.Size()
+		}
+	case crosscluster.SSTableEvent:
+		size = event.GetSSTable().Size()
+	case crosscluster.DeleteRangeEvent:
+		size = event.GetDeleteRange().Size()
+	case crosscluster.CheckpointEvent:
+		for _, rs := range event.GetResolvedSpans() {
+			size += rs.Size()
+		}
+	}
+	return int64(size)
+}
+
+// filter returns the events to deliver in place of event: the events released
+// by resumed spans, followed by what remains of event once its parts in paused
+// spans are held back. KVs and checkpoints are split across paused spans, while
+// SSTables and range deletions are only held back if they are entirely within
+// a paused span. Other events are never held back. An error is returned if
+// the held back events would exceed maxHeldBytes.
+func (p *spanPauser) filter(event crosscluster.Event) ([]crosscluster.Event, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	out := p.mu.released
+	p.mu.released = nil
+	if len(p.mu.paused) == 0 {
+		return append(out, event), nil
+	}
+
+	// pausedContaining returns the index of the paused span containing sp, or
+	// -1 if there is none.
+	pausedContaining := func(sp roachpb.Span) int {
+		for i, ps := range p.mu.paused {
+			if ps.span.Contains(sp) {
+				return i
+			}
+		}
+		return -1
+	}
+	switch event.Type() {
+	case crosscluster.KVEvent:
+		var kept []streampb.StreamEvent_KV
+		held := make(map[int][]streampb.StreamEvent_KV)
+		for _, kv := range event.GetKVs() {
+			key := kv.KeyValue.Key
+			if i := pausedContaining(roachpb.Span{Key: key, EndKey: key.Next()}); i >= 0 {
+				held[i] = append(held[i], kv)
+			} else {
+				kept = append(kept, kv)
+			}
+		}
+		if len(held) == 0 {
+			return append(out, event), nil
+		}
+		// Hold back the KVs of each paused span as a separate event, keeping
+		// the annotations of the original.
+		reannotate := func(kvs []streampb.StreamEvent_KV) crosscluster.Event {
+			e := crosscluster.MakeKVEvent(kvs)
+			if loc := event.GetSourceLocality(); loc.NonEmpty() {
+				e = crosscluster.WithSourceLocality(e, loc)
+			}
+			if sp := event.GetSubSpan(); sp.Valid() {
+				e = crosscluster.WithSubSpan(e, sp)
+			}
+			return e
+		}
+		for i := range p.mu.paused {
+			if kvs, ok := held[i]; ok {
+				if err := p.holdLocked(i, reannotate(kvs)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(kept) > 0 {
+			out = append(out, reannotate(kept))
+		}
+		return out, nil
+	case crosscluster.SSTableEvent:
+		if i := pausedContaining(event.GetSSTable().Span); i >= 0 {
+			return out, p.holdLocked(i, event)
+		}
+	case crosscluster.DeleteRangeEvent:
+		if i := pausedContaining(event.GetDeleteRange().Span); i >= 0 {
+			return out, p.holdLocked(i, event)
+		}
+	case crosscluster.CheckpointEvent:
+		pausedSpans := make(roachpb.Spans, len(p.mu.paused))
+		for i, ps := range p.mu.paused {
+			pausedSpans[i] = ps.span
+		}
+		var kept []jobspb.ResolvedSpan
+		held := make(map[int][]jobspb.ResolvedSpan)
+		for _, rs := range event.GetResolvedSpans() {
+			for i, ps := range p.mu.paused {
+				if sp := rs.Span.Intersect(ps.span); sp.Valid() {
+					held[i] = append(held[i], jobspb.ResolvedSpan{Span: sp, Timestamp: rs.Timestamp})
+				}
+			}
+			// SubtractSpans mutates its first argument, so it gets a fresh one.
+			for _, sp := range roachpb.SubtractSpans(roachpb.Spans{rs.Span}, pausedSpans) {
+				kept = append(kept, jobspb.ResolvedSpan{Span: sp, Timestamp: rs.Timestamp})
+			}
+		}
+		if len(held) == 0 {
+			return append(out, event), nil
+		}
+		for i := range p.mu.paused {
+			if resolvedSpans, ok := held[i]; ok {
+				if err := p.holdLocked(i, crosscluster.MakeCheckpointEvent(resolvedSpans)); err != nil {
+					return nil, err
+				}
+			}
+		}
+		if len(kept) > 0 {
+			out = append(out, crosscluster.MakeCheckpointEvent(kept))
+		}
+		return out, nil
+	}
+	return append(out, event), nil
+}
+
+// typedEventChans are the channels on which a subscription created
+// WithTypedEvents delivers its KV events and checkpoints.
+type typedEventChans struct {
+	kvs      chan crosscluster.Event
+	resolved chan crosscluster.Event
+}
+
+func newTypedEventChans() *typedEventChans {
+	return &typedEventChans{
+		kvs:      make(chan crosscluster.Event),
+		resolved: make(chan crosscluster.Event),
+	}
+}
+
+// route returns the channel on which event is delivered, which is other for
+// events that are neither KV events nor checkpoints.
+func (c *typedEventChans) route(
+	event crosscluster.Event, other chan crosscluster.Event,
+) chan crosscluster.Event {
+	if event == nil {
+		return other
+	}
+	switch event.Type() {
+	case crosscluster.KVEvent:
+		return c.kvs
+	case crosscluster.CheckpointEvent:
+		return c.resolved
+	default:
+		return other
+	}
+}
+
+func (c *typedEventChans) close() {
+	close(c.kvs)
+	close(c.resolved)
+}
+
+// numBatchEvents returns the number of events carried by a batch.
+func numBatchEvents(b *streampb.StreamEvent_Batch) int {
+	if b == nil {
+		return 0
+	}
+	return len(b.KVs) + len(b.DeprecatedKeyValues) + len(b.Ssts) + len(b.DelRanges) +
+		len(b.SpanConfigs) + len(b.SplitPoints)
+}
+
+// feedTracer traces a call to subscribeInternal under the tracing span of its
+// context. Until the frontier reaches the time at which the call started, or
+// the producer reports that the stream caught up, the subscription is in its
+// catch-up phase, which is traced by a span of its own. Each row received is
+// traced by a receive span, tagged with its size and number of events, and
+// each checkpoint delivered by a checkpoint span, tagged with its number of
+// resolved spans and the resulting frontier. These are children of the
+// catch-up span during the catch-up phase, and of the context's span in the
+// steady state that follows. No spans are created if the context has none.
+type feedTracer struct {
+	ctx context.Context
+	// traced is set if ctx carries a tracing span, without which no spans are
+	// started for the rows and checkpoints of the subscription.
+	traced bool
+	// startedAt is the time at which the subscription started.
+	startedAt hlc.Timestamp
+
+	// catchUpCtx and catchUpSp trace the catch-up phase. catchUpCtx is nil
+	// once it is over.
+	catchUpCtx context.Context
+	catchUpSp  *tracing.Span
+}
+
+func newFeedTracer(ctx context.Context, startedAt time.Time) *feedTracer {
+	t := &feedTracer{
+		ctx:       ctx,
+		traced:    tracing.SpanFromContext(ctx) != nil,
+		startedAt: hlc.Timestamp{WallTime: startedAt.UnixNano()},
+	}
+	t.catchUpCtx, t.catchUpSp = tracing.ChildSpan(ctx, "streamclient.catch-up")
+	return t
+}
+
+// startChild starts a child span for the current phase of the subscription.
+// It returns nil if the subscription isn't traced.
+func (t *feedTracer) startChild(opName string) *tracing.Span {
+	if !t.traced {
+		return nil
+	}
+	parent, phase := t.ctx, "steady-state"
+	if t.catchUpCtx != nil {
+		parent, phase = t.catchUpCtx, "catch-up"
+	}
+	_, sp := tracing.ChildSpan(parent, opName)
+	sp.SetTag("phase", attribute.StringValue(phase))
+	return sp
+}
+
+// startReceive starts the span of a received row.
+func (t *feedTracer) startReceive() *tracing.Span {
+	return t.startChild("streamclient.receive")
+}
+
+// startCheckpoint starts the span of a delivered checkpoint.
+func (t *feedTracer) startCheckpoint(resolvedSpans int) *tracing.Span {
+	sp := t.startChild("streamclient.checkpoint")
+	sp.SetTag("resolved_spans", attribute.IntValue(resolvedSpans))
+	return sp
+}
+
+// observeFrontier ends the catch-up phase once the frontier reaches the time
+// at which the subscription started.
+func (t *feedTracer) observeFrontier(frontier hlc.Timestamp) {
+	if t.startedAt.LessEq(frontier) {
+		t.caughtUp()
+	}
+}
+
+// caughtUp ends the catch-up phase.
+func (t *feedTracer) caughtUp() {
+	if t.catchUpCtx == nil {
+		return
+	}
+	t.catchUpSp.SetTag("caught_up", attribute.BoolValue(true))
+	t.catchUpSp.Finish()
+	t.catchUpCtx, t.catchUpSp = nil, nil
+}
+
+// finish ends the catch-up phase if the subscription ends before catching up.
+func (t *feedTracer) finish() {
+	if t.catchUpCtx == nil {
+		return
+	}
+	t.catchUpSp.Finish()
+	t.catchUpCtx, t.catchUpSp = nil, nil
+}
+
+// connectionStateTracker tracks the ConnectionState of a subscription. It is
+// safe for concurrent use.
+type connectionStateTracker struct {
+	mu struct {
+		syncutil.Mutex
+		state ConnectionState
+	}
+}
+
+// connecting resets the status when the subscription starts connecting.
+func (c *connectionStateTracker) connecting() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.state.Status = ConnectionConnecting
+}
+
+// received records that a message was received from the producer.
+func (c *connectionStateTracker) received() {
+	now := timeutil.Now()
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.state = ConnectionState{Status: ConnectionHealthy, LastReceive: now}
+}
+
+// failed records that the connection failed.
+func (c *connectionStateTracker) failed() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.state.Status = ConnectionDegraded
+}
+
+func (c *connectionStateTracker) get() ConnectionState {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.mu.state
+}
+
+// frontierTracker tracks the frontier of the checkpoints a subscription has
+// delivered, and lets callers wait for it to reach a timestamp. It is safe for
+// concurrent use.
+type frontierTracker struct {
+	// wallClock, if set, is used in place of the system clock to time the
+	// advances of the frontier.
+	wallClock hlc.WallClock
+	// onRegression, if set, is called by checkRegression.
+	onRegression RegressionHandler
+
+	mu struct {
+		syncutil.Mutex
+		// frontier is nil until the subscription's spans are known, either from
+		// init or, failing that, from the first checkpoint.
+		frontier span.Frontier
+		// advanced, if set, is closed when the frontier advances or the
+		// subscription ends, waking up waiters.
+		advanced chan struct{}
+		done     bool
+
+		// start is the frontier at the time, startWall, that it was first
+		// resolved. The rate at which the frontier has advanced since is used
+		// to estimate when it will catch up.
+		start     hlc.Timestamp
+		startWall time.Time
+	}
+}
+
+// init sets the spans of the subscription, all of which must be resolved for
+// the frontier to advance.
+func (f *frontierTracker) init(spans []roachpb.Span) error {
+	fr, err := span.MakeFrontier(spans...)
+	if err != nil {
+		return err
+	}
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mu.frontier = fr
+	return nil
+}
+
+// forward records the resolved spans of a delivered checkpoint.
+func (f *frontierTracker) forward(resolvedSpans []jobspb.ResolvedSpan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil {
+		spans := make([]roachpb.Span, len(resolvedSpans))
+		for i, rs := range resolvedSpans {
+			spans[i] = rs.Span
+		}
+		fr, err := span.MakeFrontier(spans...)
+		if err != nil {
+			return err
+		}
+		f.mu.frontier = fr
+	}
+	for _, rs := range resolvedSpans {
+		if _, err := f.mu.frontier.Forward(rs.Span, rs.Timestamp); err != nil {
+			return err
+		}
+	}
+	if f.mu.start.IsEmpty() {
+		if frontier := f.mu.frontier.Frontier(); !frontier.IsEmpty() {
+			f.mu.start, f.mu.startWall = frontier, f.now()
+		}
+	}
+	f.notifyLocked()
+	return nil
+}
+
+func (f *frontierTracker) now() time.Time {
+	if f.wallClock != nil {
+		return f.wallClock.Now()
+	}
+	return timeutil.Now()
+}
+
+// get returns the frontier of the delivered checkpoints, which is empty until
+// the frontier is known.
+func (f *frontierTracker) get() hlc.Timestamp {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil {
+		return hlc.Timestamp{}
+	}
+	return f.mu.frontier.Frontier()
+}
+
+// spans returns the spans of the frontier, or nil if they aren't known yet.
+func (f *frontierTracker) spans() []roachpb.Span {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil {
+		return nil
+	}
+	var spans []roachpb.Span
+	f.mu.frontier.Entries(func(sp roachpb.Span, _ hlc.Timestamp) span.OpResult {
+		spans = append(spans, sp.Clone())
+		return span.ContinueMatch
+	})
+	spans, _ = roachpb.MergeSpans(&spans)
+	return spans
+}
+
+// caughtUp returns whether the frontier is known and trails now by at most
+// threshold.
+func (f *frontierTracker) caughtUp(now time.Time, threshold time.Duration) bool {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil {
+		return false
+	}
+	frontier := f.mu.frontier.Frontier()
+	return !frontier.IsEmpty() && now.Sub(frontier.GoTime()) <= threshold
+}
+
+// catchUpETA estimates how long the frontier will take to trail now by at most
+// threshold, assuming it keeps advancing at its average rate since it was
+// first resolved. It returns false if the frontier hasn't advanced since, or
+// not faster than now, in which case it isn't catching up.
+func (f *frontierTracker) catchUpETA(now time.Time, threshold time.Duration) (time.Duration, bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil || f.mu.start.IsEmpty() {
+		return 0, false
+	}
+	frontier := f.mu.frontier.Frontier()
+	behind := now.Sub(frontier.GoTime()) - threshold
+	if behind <= 0 {
+		return 0, true
+	}
+	elapsed := now.Sub(f.mu.startWall)
+	advanced := frontier.GoTime().Sub(f.mu.start.GoTime())
+	if elapsed <= 0 || advanced <= elapsed {
+		return 0, false
+	}
+	// The frontier has to close the gap to now while now advances as well, so
+	// only the part of its rate in excess of now's counts.
+	closing := float64(advanced-elapsed) / float64(elapsed)
+	return time.Duration(float64(behind) / closing), true
+}
+
+// resolvedForKey returns the resolved timestamp of the span containing key. It
+// is empty if the frontier isn't known yet.
+func (f *frontierTracker) resolvedForKey(key roachpb.Key) (hlc.Timestamp, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil {
+		return hlc.Timestamp{}, nil
+	}
+	var resolvedTS hlc.Timestamp
+	var found bool
+	f.mu.frontier.SpanEntries(roachpb.Span{Key: key, EndKey: key.Next()},
+		func(_ roachpb.Span, ts hlc.Timestamp) span.OpResult {
+			resolvedTS, found = ts, true
+			return span.StopMatch
+		})
+	if !found {
+		return hlc.Timestamp{}, errors.Errorf("key %s is not in the subscription's spans", key)
+	}
+	return resolvedTS, nil
+}
+
+// checkUnresolved returns an error if the given data event touches a span that
+// a delivered checkpoint already resolved at or above the event's timestamp,
+// meaning that the event can't be delivered without breaking the ordering of
+// data and checkpoints. Other events are never out of order.
+func (f *frontierTracker) checkUnresolved(event crosscluster.Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.mu.frontier == nil {
+		return nil
+	}
+	check := func(sp roachpb.Span, ts hlc.Timestamp) error {
+		var err error
+		f.mu.frontier.SpanEntries(sp, func(resolved roachpb.Span, resolvedTS hlc.Timestamp) span.OpResult {
+			if ts.LessEq(resolvedTS) {
+				err = errors.Errorf("received data at %s on %s after %s was resolved at %s",
+					ts, sp, resolved, resolvedTS)
+				return span.StopMatch
+			}
+			return span.ContinueMatch
+		})
+		return err
+	}
+	switch event.Type() {
+	case crosscluster.KVEvent:
+		for _, kv := range event.GetKVs() {
+			key := kv.KeyValue.Key
+			if err := check(roachpb.Span{Key: key, EndKey: key.Next()}, kv.KeyValue.Value.Timestamp); err != nil {
+				return err
+			}
+		}
+	case crosscluster.SSTableEvent:
+		sst := event.GetSSTable()
+		return check(sst.Span, sst.WriteTS)
+	case crosscluster.DeleteRangeEvent:
+		delRange := event.GetDeleteRange()
+		return check(delRange.Span, delRange.Timestamp)
+	}
+	return nil
+}
+
+// checkRegression calls the regression handler, if any, for each part of the
+// given resolved spans that was already resolved at a higher timestamp. It
+// returns the first error returned by the handler.
+func (f *frontierTracker) checkRegression(resolvedSpans []jobspb.ResolvedSpan) error {
+	if f.onRegression == nil {
+		return nil
+	}
+	var regressions []ResolvedRegression
+	func() {
+		f.mu.Lock()
+		defer f.mu.Unlock()
+		if f.mu.frontier == nil {
+			return
+		}
+		for _, rs := range resolvedSpans {
+			f.mu.frontier.SpanEntries(rs.Span, func(resolved roachpb.Span, resolvedTS hlc.Timestamp) span.OpResult {
+				if rs.Timestamp.Less(resolvedTS) {
+					regressions = append(regressions, ResolvedRegression{
+						Span:      resolved.Clone(),
+						Resolved:  resolvedTS,
+						Regressed: rs.Timestamp,
+					})
+				}
+				return span.ContinueMatch
+			})
+		}
+	}()
+	// The handler is called without holding the lock, so that it may call
+	// back into the subscription.
+	for _, r := range regressions {
+		if err := f.onRegression(r); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// finish records that the subscription has ended, so its frontier will not
+// advance any further.
+func (f *frontierTracker) finish() {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.mu.done = true
+	f.notifyLocked()
+}
+
+func (f *frontierTracker) notifyLocked() {
+	if f.mu.advanced != nil {
+		close(f.mu.advanced)
+		f.mu.advanced = nil
+	}
+}
+
+// wait blocks until the frontier reaches ts, returning an error if the
+// subscription ends first or ctx is canceled.
+func (f *frontierTracker) wait(ctx context.Context, ts hlc.Timestamp) error {
+	for {
+		f.mu.Lock()
+		reached := f.mu.frontier != nil && ts.LessEq(f.mu.frontier.Frontier())
+		done := f.mu.done
+		if f.mu.advanced == nil {
+			f.mu.advanced = make(chan struct{})
+		}
+		advanced := f.mu.advanced
+		f.mu.Unlock()
+
+		if reached {
+			return nil
+		}
+		if done {
+			return errors.Errorf("subscription ended before its frontier reached %s", ts)
+		}
+		select {
+		case <-advanced:
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
@@ -0,0 +1,1311 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package streamclient
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"math/rand"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster/replicationtestutils"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing/tracingpb"
+	"github.com/cockroachdb/errors"
+	"github.com/jackc/pgx/v4"
+	"github.com/stretchr/testify/require"
+)
+
+// fakeRows is a pgx.Rows that returns a fixed sequence of encoded
+// StreamEvents.
+type fakeRows struct {
+	pgx.Rows
+	rows [][]byte
+}
+
+func (r *fakeRows) Next() bool {
+	return len(r.rows) > 0
+}
+
+func (r *fakeRows) Scan(dest ...interface{}) error {
+	*dest[0].(*[]byte) = r.rows[0]
+	r.rows = r.rows[1:]
+	return nil
+}
+
+func (r *fakeRows) Err() error {
+	return nil
+}
+
+// makeFakeRows returns a fakeRows that returns the given events.
+func makeFakeRows(t *testing.T, events ...streampb.StreamEvent) *fakeRows {
+	feed := &fakeRows{}
+	for i := range events {
+		data, err := protoutil.Marshal(&events[i])
+		require.NoError(t, err)
+		feed.rows = append(feed.rows, data)
+	}
+	return feed
+}
+
+// startFeed runs a subscription to feed in the background, returning the
+// channel its events are delivered on, which is closed once it ends, and the
+// channel its error is sent on. The eventCh, closeCh, conn and frontier of opts
+// are created if unset.
+func startFeed(
+	ctx context.Context, feed pgx.Rows, opts feedOptions,
+) (<-chan crosscluster.Event, <-chan error) {
+	if opts.eventCh == nil {
+		opts.eventCh = make(chan crosscluster.Event)
+	}
+	if opts.closeCh == nil {
+		opts.closeCh = make(chan struct{})
+	}
+	if opts.conn == nil {
+		opts.conn = &connectionStateTracker{}
+	}
+	if opts.frontier == nil {
+		opts.frontier = &frontierTracker{}
+	}
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(opts.eventCh)
+		errCh <- subscribeInternal(ctx, feed, opts)
+	}()
+	return opts.eventCh, errCh
+}
+
+// runFeed runs a subscription to feed as startFeed does, returning the events
+// it delivered and its error once it ends.
+func runFeed(ctx context.Context, feed pgx.Rows, opts feedOptions) ([]crosscluster.Event, error) {
+	eventCh, errCh := startFeed(ctx, feed, opts)
+	var events []crosscluster.Event
+	for ev := range eventCh {
+		events = append(events, ev)
+	}
+	return events, <-errCh
+}
+
+// TestSubscribeDeduplication verifies that a KV delivered within the
+// deduplication window is suppressed, while one that has been evicted from the
+// window is delivered again.
+func TestSubscribeDeduplication(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 1}
+	kv := func(key string) streampb.StreamEvent_KV {
+		return streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key(key),
+			Value: roachpb.Value{Timestamp: ts},
+		}}
+	}
+	batch := func(keys ...string) streampb.StreamEvent {
+		b := &streampb.StreamEvent_Batch{}
+		for _, k := range keys {
+			b.KVs = append(b.KVs, kv(k))
+		}
+		return streampb.StreamEvent{Batch: b}
+	}
+
+	feed := makeFakeRows(t,
+		batch("a"),
+		// A repeat of a, which is still within the window.
+		batch("a"),
+		// b and c fill the window, evicting a.
+		batch("b", "a", "c"),
+		// a is no longer within the window, so it is delivered again.
+		batch("a"),
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	events, err := runFeed(ctx, feed, feedOptions{dedup: newKVDeduplicator(2)})
+	require.NoError(t, err)
+	var delivered [][]string
+	for _, ev := range events {
+		if ev.Type() != crosscluster.KVEvent {
+			require.Equal(t, crosscluster.StreamCanceledEvent, ev.Type())
+			continue
+		}
+		var keys []string
+		for _, kv := range ev.GetKVs() {
+			keys = append(keys, string(kv.KeyValue.Key))
+		}
+		delivered = append(delivered, keys)
+	}
+	require.Equal(t, [][]string{{"a"}, {"b", "c"}, {"a"}}, delivered)
+}
+
+// TestSubscribeRawMVCC verifies that a subscription in raw MVCC mode annotates
+// its KV events with the MVCC timestamp and raw value bytes of their KVs.
+func TestSubscribeRawMVCC(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 5, Logical: 1}
+	value := roachpb.MakeValueFromString("v")
+	value.Timestamp = ts
+	feed := makeFakeRows(t,
+		streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key("a"),
+			Value: value,
+		}}}}},
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	events, err := runFeed(ctx, feed, feedOptions{rawMVCC: true})
+	require.NoError(t, err)
+	require.Len(t, events, 2)
+	require.Equal(t, crosscluster.KVEvent, events[0].Type())
+	raw := events[0].GetRawMVCCKVs()
+	require.Len(t, raw, 1)
+	key, err := storage.DecodeMVCCKey(raw[0].Key)
+	require.NoError(t, err)
+	require.Equal(t, storage.MVCCKey{Key: roachpb.Key("a"), Timestamp: ts}, key)
+	mvccValue, err := storage.DecodeMVCCValue(raw[0].Value)
+	require.NoError(t, err)
+	require.Equal(t, value.RawBytes, mvccValue.Value.RawBytes)
+	require.Equal(t, crosscluster.StreamCanceledEvent, events[1].Type())
+}
+
+// TestSubscribeTransform verifies that a subscription applies its transform to
+// the events it delivers, and fails if the transform does.
+func TestSubscribeTransform(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	srcTenant, dstTenant := roachpb.MustMakeTenantID(10), roachpb.MustMakeTenantID(20)
+	srcKey := func(key string) roachpb.Key {
+		return append(keys.MakeTenantPrefix(srcTenant), key...)
+	}
+	subscribe := func(transform EventTransform) ([]crosscluster.Event, error) {
+		feed := makeFakeRows(t,
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{
+				{KeyValue: roachpb.KeyValue{Key: srcKey("a"), Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 1}}}},
+				{KeyValue: roachpb.KeyValue{Key: srcKey("b"), Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 1}}}},
+			}}},
+			streampb.StreamEvent{StreamCanceled: true},
+		)
+		return runFeed(ctx, feed, feedOptions{transform: transform})
+	}
+
+	// The transform remaps the keys of KV events to the destination tenant.
+	delivered, err := subscribe(func(ev crosscluster.Event) (crosscluster.Event, error) {
+		if ev.Type() != crosscluster.KVEvent {
+			return ev, nil
+		}
+		kvs := append([]streampb.StreamEvent_KV(nil), ev.GetKVs()...)
+		for i := range kvs {
+			kvs[i].KeyValue.Key = rekey(dstTenant, kvs[i].KeyValue.Key)
+		}
+		return crosscluster.MakeKVEvent(kvs), nil
+	})
+	require.NoError(t, err)
+	require.Len(t, delivered, 2)
+	require.Equal(t, crosscluster.KVEvent, delivered[0].Type())
+	var rekeyed []roachpb.Key
+	for _, kv := range delivered[0].GetKVs() {
+		rekeyed = append(rekeyed, kv.KeyValue.Key)
+	}
+	dstPrefix := keys.MakeTenantPrefix(dstTenant)
+	require.Equal(t, []roachpb.Key{
+		append(dstPrefix.Clone(), "a"...),
+		append(dstPrefix.Clone(), "b"...),
+	}, rekeyed)
+	require.Equal(t, crosscluster.StreamCanceledEvent, delivered[1].Type())
+
+	// An error of the transform fails the subscription.
+	transformErr := errors.New("boom")
+	delivered, err = subscribe(func(ev crosscluster.Event) (crosscluster.Event, error) {
+		return nil, transformErr
+	})
+	require.ErrorIs(t, err, transformErr)
+	require.Empty(t, delivered)
+}
+
+// TestSubscribeStrictOrdering verifies that a subscription with strict
+// ordering delivers a checkpoint only after the data that arrived with it, and
+// fails rather than deliver data below an already resolved timestamp.
+func TestSubscribeStrictOrdering(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	kvs := func(key string, wallTime int64) *streampb.StreamEvent_Batch {
+		return &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key(key),
+			Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: wallTime}},
+		}}}}
+	}
+	checkpoint := func(wallTime int64) *streampb.StreamEvent_StreamCheckpoint {
+		return &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: []jobspb.ResolvedSpan{{
+			Span:      roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")},
+			Timestamp: hlc.Timestamp{WallTime: wallTime},
+		}}}
+	}
+	// subscribe delivers the given events and returns the keys of the data
+	// events and the timestamps of the checkpoints, in delivery order.
+	subscribe := func(strict bool, events ...streampb.StreamEvent) ([]string, error) {
+		feed := makeFakeRows(t, append(events, streampb.StreamEvent{StreamCanceled: true})...)
+		delivered, err := runFeed(ctx, feed, feedOptions{strictOrdering: strict})
+		var desc []string
+		for _, ev := range delivered {
+			switch ev.Type() {
+			case crosscluster.KVEvent:
+				desc = append(desc, string(ev.GetKVs()[0].KeyValue.Key))
+			case crosscluster.CheckpointEvent:
+				desc = append(desc, ev.GetResolvedSpans()[0].Timestamp.String())
+			}
+		}
+		return desc, err
+	}
+
+	// A checkpoint that arrives together with data is only delivered after it
+	// under strict ordering.
+	interleaved := []streampb.StreamEvent{
+		{Batch: kvs("a", 5)},
+		{Checkpoint: checkpoint(10), Batch: kvs("b", 8)},
+		{Batch: kvs("c", 12)},
+		{Checkpoint: checkpoint(15)},
+	}
+	delivered, err := subscribe(false /* strict */, interleaved...)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "0.000000010,0", "b", "c", "0.000000015,0"}, delivered)
+	delivered, err = subscribe(true /* strict */, interleaved...)
+	require.NoError(t, err)
+	require.Equal(t, []string{"a", "b", "0.000000010,0", "c", "0.000000015,0"}, delivered)
+
+	// Data below a timestamp that was already resolved can't be delivered in
+	// order, so it fails the subscription under strict ordering.
+	late := []streampb.StreamEvent{
+		{Checkpoint: checkpoint(10)},
+		{Batch: kvs("c", 9)},
+	}
+	delivered, err = subscribe(false /* strict */, late...)
+	require.NoError(t, err)
+	require.Equal(t, []string{"0.000000010,0", "c"}, delivered)
+	delivered, err = subscribe(true /* strict */, late...)
+	require.ErrorContains(t, err, "was resolved at 0.000000010,0")
+	require.Equal(t, []string{"0.000000010,0"}, delivered)
+}
+
+// TestSubscribeMinCheckpointAdvance verifies that a subscription with a
+// minimum checkpoint advance only delivers checkpoints once the frontier has
+// advanced far enough, while delivering every data event.
+func TestSubscribeMinCheckpointAdvance(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	spans := []roachpb.Span{
+		{Key: roachpb.Key("a"), EndKey: roachpb.Key("m")},
+		{Key: roachpb.Key("m"), EndKey: roachpb.Key("z")},
+	}
+	// Each span is resolved by its own checkpoint, one nanosecond at a time,
+	// with some data in between.
+	var events []streampb.StreamEvent
+	for wallTime := int64(1); wallTime <= 50; wallTime++ {
+		for _, sp := range spans {
+			events = append(events, streampb.StreamEvent{
+				Checkpoint: &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: []jobspb.ResolvedSpan{{
+					Span: sp, Timestamp: hlc.Timestamp{WallTime: wallTime},
+				}}},
+			})
+		}
+		if wallTime%5 == 0 {
+			events = append(events, streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{
+				KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+					Key:   roachpb.Key("b"),
+					Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: wallTime + 1}},
+				}}},
+			}})
+		}
+	}
+	feed := makeFakeRows(t, append(events, streampb.StreamEvent{StreamCanceled: true})...)
+
+	coalescer, err := newCheckpointCoalescer(10, spans)
+	require.NoError(t, err)
+	delivered, err := runFeed(ctx, feed, feedOptions{coalescer: coalescer})
+	require.NoError(t, err)
+	var kvs int
+	var checkpoints []int64
+	for _, ev := range delivered {
+		switch ev.Type() {
+		case crosscluster.KVEvent:
+			kvs++
+		case crosscluster.CheckpointEvent:
+			// Every delivered checkpoint resolves all spans at the frontier.
+			resolved := ev.GetResolvedSpans()
+			require.Len(t, resolved, len(spans))
+			for i, rs := range resolved {
+				require.Equal(t, spans[i], rs.Span)
+				require.Equal(t, resolved[0].Timestamp, rs.Timestamp)
+			}
+			checkpoints = append(checkpoints, resolved[0].Timestamp.WallTime)
+		}
+	}
+	require.Equal(t, 10, kvs)
+	require.Equal(t, []int64{10, 20, 30, 40, 50}, checkpoints)
+}
+
+// TestSubscribeGlobalCheckpoints verifies that a subscription with global
+// checkpoints delivers one whenever the minimum resolved timestamp across all
+// spans advances, and only after the checkpoint that advanced it.
+func TestSubscribeGlobalCheckpoints(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	left := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("m")}
+	right := roachpb.Span{Key: roachpb.Key("m"), EndKey: roachpb.Key("z")}
+	checkpoint := func(sp roachpb.Span, wallTime int64) streampb.StreamEvent {
+		return streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{
+			ResolvedSpans: []jobspb.ResolvedSpan{{Span: sp, Timestamp: hlc.Timestamp{WallTime: wallTime}}},
+		}}
+	}
+	// The spans advance unevenly, taking turns at being behind.
+	feed := makeFakeRows(t,
+		checkpoint(left, 5),
+		checkpoint(right, 3),
+		streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key("n"),
+			Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 4}},
+		}}}}},
+		checkpoint(right, 8),
+		checkpoint(left, 6),
+		checkpoint(left, 7),
+		checkpoint(left, 10),
+		checkpoint(right, 12),
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	var frontier frontierTracker
+	require.NoError(t, frontier.init([]roachpb.Span{left, right}))
+	events, err := runFeed(ctx, feed, feedOptions{globalCheckpoints: true, frontier: &frontier})
+	require.NoError(t, err)
+	var delivered []string
+	for _, ev := range events {
+		switch ev.Type() {
+		case crosscluster.KVEvent:
+			delivered = append(delivered, string(ev.GetKVs()[0].KeyValue.Key))
+		case crosscluster.CheckpointEvent:
+			rs := ev.GetResolvedSpans()[0]
+			delivered = append(delivered, fmt.Sprintf("%s@%d", rs.Span.Key, rs.Timestamp.WallTime))
+		case crosscluster.GlobalCheckpointEvent:
+			delivered = append(delivered, fmt.Sprintf("global@%d", ev.GetGlobalCheckpoint().WallTime))
+		}
+	}
+	require.Equal(t, []string{
+		"a@5",
+		"m@3", "global@3",
+		"n",
+		"m@8", "global@5",
+		"a@6", "global@6",
+		"a@7", "global@7",
+		"a@10", "global@8",
+		"m@12", "global@10",
+	}, delivered)
+}
+
+// TestSubscribeResolvedTSForKey verifies that the resolved timestamp of a key
+// is the frontier of the subscription's span that contains it.
+func TestSubscribeResolvedTSForKey(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	left := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("m")}
+	right := roachpb.Span{Key: roachpb.Key("m"), EndKey: roachpb.Key("z")}
+	var events []streampb.StreamEvent
+	for _, rs := range []jobspb.ResolvedSpan{
+		{Span: left, Timestamp: hlc.Timestamp{WallTime: 5}},
+		{Span: right, Timestamp: hlc.Timestamp{WallTime: 3}},
+		{Span: left, Timestamp: hlc.Timestamp{WallTime: 10}},
+	} {
+		events = append(events, streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{
+			ResolvedSpans: []jobspb.ResolvedSpan{rs},
+		}})
+	}
+	feed := makeFakeRows(t, append(events, streampb.StreamEvent{StreamCanceled: true})...)
+
+	var frontier frontierTracker
+	require.NoError(t, frontier.init([]roachpb.Span{left, right}))
+	ts, err := frontier.resolvedForKey(roachpb.Key("b"))
+	require.NoError(t, err)
+	require.True(t, ts.IsEmpty())
+
+	_, err = runFeed(ctx, feed, feedOptions{frontier: &frontier})
+	require.NoError(t, err)
+
+	for _, tc := range []struct {
+		key      string
+		expected int64
+	}{
+		{"a", 10},
+		{"l", 10},
+		{"m", 3},
+		{"y", 3},
+	} {
+		ts, err := frontier.resolvedForKey(roachpb.Key(tc.key))
+		require.NoError(t, err)
+		require.Equal(t, hlc.Timestamp{WallTime: tc.expected}, ts, "key %s", tc.key)
+	}
+	_, err = frontier.resolvedForKey(roachpb.Key("zz"))
+	require.ErrorContains(t, err, "not in the subscription's spans")
+}
+
+// TestSubscribeIsCaughtUp verifies that a subscription reports being caught up
+// while the frontier of its delivered checkpoints is recent, and stops once it
+// falls behind.
+func TestSubscribeIsCaughtUp(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	checkpoint := func(sec int64) streampb.StreamEvent {
+		return streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{
+			ResolvedSpans: []jobspb.ResolvedSpan{{Span: sp, Timestamp: hlc.Timestamp{WallTime: sec * 1e9}}},
+		}}
+	}
+	feed := makeFakeRows(t,
+		checkpoint(50),
+		checkpoint(95),
+		checkpoint(158),
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	clock := timeutil.NewManualTime(timeutil.Unix(100, 0))
+	sub := &partitionedStreamSubscription{wallClock: clock, caughtUpThreshold: 10 * time.Second}
+	require.NoError(t, sub.frontier.init([]roachpb.Span{sp}))
+	eventCh, errCh := startFeed(ctx, feed, feedOptions{frontier: &sub.frontier})
+	// nextResolved receives the next checkpoint and waits for the frontier to
+	// reflect it.
+	nextResolved := func(sec int64) {
+		ev := <-eventCh
+		require.Equal(t, crosscluster.CheckpointEvent, ev.Type())
+		require.Eventually(t, func() bool {
+			return sub.frontier.get() == hlc.Timestamp{WallTime: sec * 1e9}
+		}, 10*time.Second, time.Millisecond)
+	}
+
+	// The subscription starts out behind.
+	require.False(t, sub.IsCaughtUp())
+	nextResolved(50)
+	require.False(t, sub.IsCaughtUp())
+
+	// It catches up once a checkpoint within the threshold is delivered.
+	nextResolved(95)
+	require.True(t, sub.IsCaughtUp())
+
+	// While the consumer is paused, no checkpoints are delivered and the
+	// subscription falls behind as time passes.
+	clock.Advance(time.Minute)
+	require.False(t, sub.IsCaughtUp())
+
+	// Once the consumer resumes, it catches up again.
+	nextResolved(158)
+	require.True(t, sub.IsCaughtUp())
+
+	require.Equal(t, crosscluster.StreamCanceledEvent, (<-eventCh).Type())
+	require.NoError(t, <-errCh)
+}
+
+// TestSubscribeCatchUpETA verifies that the catch-up estimate of a subscription
+// resuming far behind the current time decreases toward zero as its frontier
+// advances.
+func TestSubscribeCatchUpETA(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	// The subscription resumes 900s behind, and its frontier advances by 100s
+	// for every second that passes, until it is caught up.
+	var events []streampb.StreamEvent
+	for sec := int64(100); sec <= 1000; sec += 100 {
+		events = append(events, streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{
+			ResolvedSpans: []jobspb.ResolvedSpan{{Span: sp, Timestamp: hlc.Timestamp{WallTime: sec * 1e9}}},
+		}})
+	}
+	feed := makeFakeRows(t, append(events, streampb.StreamEvent{StreamCanceled: true})...)
+
+	clock := timeutil.NewManualTime(timeutil.Unix(1000, 0))
+	sub := &partitionedStreamSubscription{wallClock: clock, caughtUpThreshold: 10 * time.Second}
+	sub.frontier.wallClock = clock
+	require.NoError(t, sub.frontier.init([]roachpb.Span{sp}))
+	eventCh, errCh := startFeed(ctx, feed, feedOptions{frontier: &sub.frontier})
+	nextResolved := func(sec int64) {
+		ev := <-eventCh
+		require.Equal(t, crosscluster.CheckpointEvent, ev.Type())
+		require.Eventually(t, func() bool {
+			return sub.frontier.get() == hlc.Timestamp{WallTime: sec * 1e9}
+		}, 10*time.Second, time.Millisecond)
+	}
+
+	// There is no estimate until the frontier has been resolved and has
+	// advanced since.
+	_, ok := sub.CatchUpETA()
+	require.False(t, ok)
+	nextResolved(100)
+	_, ok = sub.CatchUpETA()
+	require.False(t, ok)
+
+	prev := time.Duration(math.MaxInt64)
+	for sec := int64(200); sec <= 1000; sec += 100 {
+		clock.Advance(time.Second)
+		nextResolved(sec)
+		eta, ok := sub.CatchUpETA()
+		require.True(t, ok)
+		require.Less(t, eta, prev, "frontier %ds", sec)
+		prev = eta
+	}
+	require.Zero(t, prev)
+	require.True(t, sub.IsCaughtUp())
+
+	require.Equal(t, crosscluster.StreamCanceledEvent, (<-eventCh).Type())
+	require.NoError(t, <-errCh)
+}
+
+// TestSubscribeRegressionHandler verifies that a checkpoint that would regress
+// the resolved timestamp of a span is reported to the regression handler, and
+// fails the subscription if the handler returns an error.
+func TestSubscribeRegressionHandler(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	regressed := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("m")}
+	checkpoint := func(sp roachpb.Span, wallTime int64) streampb.StreamEvent {
+		return streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{
+			ResolvedSpans: []jobspb.ResolvedSpan{{Span: sp, Timestamp: hlc.Timestamp{WallTime: wallTime}}},
+		}}
+	}
+
+	run := func(handler RegressionHandler) ([]crosscluster.Event, *frontierTracker, error) {
+		feed := makeFakeRows(t,
+			checkpoint(sp, 10),
+			// Resolves [a, m) below the timestamp it was already resolved at.
+			checkpoint(regressed, 5),
+			checkpoint(sp, 20),
+			streampb.StreamEvent{StreamCanceled: true},
+		)
+		frontier := &frontierTracker{onRegression: handler}
+		require.NoError(t, frontier.init([]roachpb.Span{sp}))
+		events, err := runFeed(ctx, feed, feedOptions{frontier: frontier})
+		return events, frontier, err
+	}
+
+	t.Run("reported", func(t *testing.T) {
+		var regressions []ResolvedRegression
+		events, frontier, err := run(func(r ResolvedRegression) error {
+			regressions = append(regressions, r)
+			return nil
+		})
+		require.NoError(t, err)
+		require.Equal(t, []ResolvedRegression{{
+			Span:      regressed,
+			Resolved:  hlc.Timestamp{WallTime: 10},
+			Regressed: hlc.Timestamp{WallTime: 5},
+		}}, regressions)
+		// The regressing checkpoint is delivered, but doesn't move the frontier
+		// back.
+		require.Len(t, events, 4)
+		require.Equal(t, hlc.Timestamp{WallTime: 20}, frontier.get())
+	})
+
+	t.Run("error", func(t *testing.T) {
+		events, frontier, err := run(func(r ResolvedRegression) error {
+			return errors.Newf("%s regressed from %s to %s", r.Span, r.Resolved, r.Regressed)
+		})
+		require.ErrorContains(t, err, "regressed from 0.000000010,0 to 0.000000005,0")
+		require.Len(t, events, 1)
+		require.Equal(t, hlc.Timestamp{WallTime: 10}, frontier.get())
+	})
+}
+
+// TestSubscribeTracing verifies that a subscription traces the rows it receives
+// and the checkpoints it delivers, under a catch-up span until its frontier
+// reaches the time at which it started, and under the subscription's span
+// after that.
+func TestSubscribeTracing(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	sec := func(s int64) hlc.Timestamp { return hlc.Timestamp{WallTime: s * 1e9} }
+	batch := func(ts hlc.Timestamp, keys ...string) streampb.StreamEvent {
+		b := &streampb.StreamEvent_Batch{}
+		for _, k := range keys {
+			b.KVs = append(b.KVs, streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
+				Key:   roachpb.Key(k),
+				Value: roachpb.Value{Timestamp: ts},
+			}})
+		}
+		return streampb.StreamEvent{Batch: b}
+	}
+	checkpoint := func(ts hlc.Timestamp) streampb.StreamEvent {
+		return streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{
+			ResolvedSpans: []jobspb.ResolvedSpan{{Span: sp, Timestamp: ts}},
+		}}
+	}
+	feed := makeFakeRows(t,
+		batch(sec(50), "a", "b"),
+		checkpoint(sec(60)),
+		// The subscription starts at 100s, so this ends the catch-up phase.
+		checkpoint(sec(100)),
+		batch(sec(110), "c"),
+		checkpoint(sec(120)),
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	tr := tracing.NewTracer()
+	ctx, getRecAndFinish := tracing.ContextWithRecordingSpan(context.Background(), tr, "subscription")
+	frontier := &frontierTracker{wallClock: timeutil.NewManualTime(timeutil.Unix(100, 0))}
+	require.NoError(t, frontier.init([]roachpb.Span{sp}))
+	_, err := runFeed(ctx, feed, feedOptions{frontier: frontier})
+	require.NoError(t, err)
+	rec := getRecAndFinish()
+
+	ops := make(map[tracingpb.SpanID]string)
+	for _, s := range rec {
+		ops[s.SpanID] = s.Operation
+	}
+	tag := func(s tracingpb.RecordedSpan, key string) string {
+		v, _ := s.FindTagGroup(tracingpb.AnonymousTagGroupName).FindTag(key)
+		return v
+	}
+	var traced []string
+	for _, s := range rec {
+		desc := fmt.Sprintf("%s under %s", s.Operation, ops[s.ParentSpanID])
+		switch s.Operation {
+		case "streamclient.catch-up":
+			desc += fmt.Sprintf(" caught_up=%s", tag(s, "caught_up"))
+		case "streamclient.receive":
+			require.NotEmpty(t, tag(s, "bytes"))
+			desc += fmt.Sprintf(" phase=%s events=%s", tag(s, "phase"), tag(s, "events"))
+		case "streamclient.checkpoint":
+			desc += fmt.Sprintf(" phase=%s resolved_spans=%s frontier=%s",
+				tag(s, "phase"), tag(s, "resolved_spans"), tag(s, "frontier"))
+		default:
+			continue
+		}
+		traced = append(traced, desc)
+	}
+	require.ElementsMatch(t, []string{
+		"streamclient.catch-up under subscription caught_up=true",
+		"streamclient.receive under streamclient.catch-up phase=catch-up events=2",
+		"streamclient.receive under streamclient.catch-up phase=catch-up events=0",
+		"streamclient.checkpoint under streamclient.catch-up phase=catch-up resolved_spans=1 frontier=60.000000000,0",
+		"streamclient.receive under streamclient.catch-up phase=catch-up events=0",
+		"streamclient.checkpoint under streamclient.catch-up phase=catch-up resolved_spans=1 frontier=100.000000000,0",
+		"streamclient.receive under subscription phase=steady-state events=1",
+		"streamclient.receive under subscription phase=steady-state events=0",
+		"streamclient.checkpoint under subscription phase=steady-state resolved_spans=1 frontier=120.000000000,0",
+		"streamclient.receive under subscription phase=steady-state events=0",
+	}, traced)
+}
+
+// TestSubscribeCatchUpTimedOut verifies that a subscription whose producer
+// gave up on catching up delivers the timeout and ends with
+// ErrCatchUpTimedOut.
+func TestSubscribeCatchUpTimedOut(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	feed := makeFakeRows(t,
+		streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key("a"),
+			Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 1}},
+		}}}}},
+		streampb.StreamEvent{CatchUpTimedOut: true},
+	)
+
+	events, err := runFeed(ctx, feed, feedOptions{})
+	require.ErrorIs(t, err, ErrCatchUpTimedOut)
+	var delivered []crosscluster.EventType
+	for _, ev := range events {
+		delivered = append(delivered, ev.Type())
+	}
+	require.Equal(t, []crosscluster.EventType{crosscluster.KVEvent, crosscluster.CatchUpTimedOutEvent}, delivered)
+}
+
+// TestSubscribePausedSpan verifies that the events of a paused span are held
+// back while those of the subscription's other spans are delivered, and that
+// they are released once the span is resumed.
+func TestSubscribePausedSpan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	left := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("m")}
+	right := roachpb.Span{Key: roachpb.Key("m"), EndKey: roachpb.Key("z")}
+	kv := func(key string) streampb.StreamEvent_KV {
+		return streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key(key),
+			Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 2}},
+		}}
+	}
+	feed := makeFakeRows(t,
+		streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{kv("b"), kv("n"), kv("c")}}},
+		streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: []jobspb.ResolvedSpan{
+			{Span: roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}, Timestamp: hlc.Timestamp{WallTime: 5}},
+		}}},
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	describe := func(ev crosscluster.Event) string {
+		switch ev.Type() {
+		case crosscluster.KVEvent:
+			var keys []string
+			for _, kv := range ev.GetKVs() {
+				keys = append(keys, string(kv.KeyValue.Key))
+			}
+			return fmt.Sprint(keys)
+		case crosscluster.CheckpointEvent:
+			var resolved []string
+			for _, rs := range ev.GetResolvedSpans() {
+				resolved = append(resolved, fmt.Sprintf("%s-%s@%d", rs.Span.Key, rs.Span.EndKey, rs.Timestamp.WallTime))
+			}
+			return fmt.Sprint(resolved)
+		case crosscluster.StreamCanceledEvent:
+			return "canceled"
+		case crosscluster.KeepaliveEvent:
+			return "keepalive"
+		default:
+			return fmt.Sprintf("unexpected event type %d", ev.Type())
+		}
+	}
+
+	var pauser spanPauser
+	require.NoError(t, pauser.pause(left))
+	require.ErrorContains(t, pauser.pause(roachpb.Span{Key: roachpb.Key("l"), EndKey: roachpb.Key("n")}),
+		"overlaps paused span")
+
+	var frontier frontierTracker
+	require.NoError(t, frontier.init([]roachpb.Span{left, right}))
+	events, err := runFeed(ctx, feed, feedOptions{frontier: &frontier, pauser: &pauser})
+	require.NoError(t, err)
+	var delivered []string
+	for _, ev := range events {
+		delivered = append(delivered, describe(ev))
+	}
+	// Only the right span's KV and part of the checkpoint are delivered.
+	require.Equal(t, []string{"[n]", "[m-z@5]", "canceled"}, delivered)
+
+	// The paused span's resolved timestamp stalls, while the other advances.
+	ts, err := frontier.resolvedForKey(roachpb.Key("b"))
+	require.NoError(t, err)
+	require.True(t, ts.IsEmpty())
+	ts, err = frontier.resolvedForKey(roachpb.Key("n"))
+	require.NoError(t, err)
+	require.Equal(t, hlc.Timestamp{WallTime: 5}, ts)
+
+	// Once the span is resumed, its held back events are released ahead of the
+	// next event, in the order they were received.
+	require.ErrorContains(t, pauser.resume(right), "is not paused")
+	require.NoError(t, pauser.resume(left))
+	delivered = delivered[:0]
+	events, err = pauser.filter(crosscluster.MakeKeepaliveEvent())
+	require.NoError(t, err)
+	for _, ev := range events {
+		delivered = append(delivered, describe(ev))
+	}
+	require.Equal(t, []string{"[b c]", "[a-m@5]", "keepalive"}, delivered)
+}
+
+// TestSubscribeCompressionLevels verifies that events compressed at any level
+// are delivered intact, and that higher levels produce smaller events.
+func TestSubscribeCompressionLevels(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	// The values are drawn from a small vocabulary so that they compress, but
+	// not so trivially that every level does equally well.
+	rng := rand.New(rand.NewSource(1))
+	words := []string{"alpha", "bravo", "charlie", "delta", "echo", "foxtrot", "golf"}
+	batch := &streampb.StreamEvent_Batch{}
+	for i := 0; i < 500; i++ {
+		var value []byte
+		for j := 0; j < 20; j++ {
+			value = append(value, words[rng.Intn(len(words))]...)
+			value = append(value, byte(rng.Intn(256)))
+		}
+		batch.KVs = append(batch.KVs, streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key(fmt.Sprintf("key-%04d", i)),
+			Value: roachpb.MakeValueFromBytesAndTimestamp(value, hlc.Timestamp{WallTime: 1}),
+		}})
+	}
+	batchData, err := protoutil.Marshal(&streampb.StreamEvent{Batch: batch})
+	require.NoError(t, err)
+	canceledData, err := protoutil.Marshal(&streampb.StreamEvent{StreamCanceled: true})
+	require.NoError(t, err)
+
+	// roundTrip delivers the batch compressed at level, returning the size of
+	// the compressed batch.
+	roundTrip := func(t *testing.T, level int32) int {
+		compressor, err := streampb.NewEventCompressor(level)
+		require.NoError(t, err)
+		defer compressor.Close()
+		compressed := compressor.Compress(batchData)
+		feed := &fakeRows{rows: [][]byte{compressed, compressor.Compress(canceledData)}}
+
+		events, err := runFeed(ctx, feed, feedOptions{compressed: true})
+		require.NoError(t, err)
+		var delivered []streampb.StreamEvent_KV
+		for _, ev := range events {
+			if ev.Type() == crosscluster.KVEvent {
+				delivered = append(delivered, ev.GetKVs()...)
+			}
+		}
+		require.Equal(t, batch.KVs, delivered)
+		return len(compressed)
+	}
+
+	_, err = streampb.NewEventCompressor(streampb.MaxCompressionLevel + 1)
+	require.Error(t, err)
+
+	roundTrip(t, 0 /* snappy */)
+	low, high := roundTrip(t, 1), roundTrip(t, 19)
+	require.Less(t, high, low)
+	require.Less(t, low, len(batchData))
+}
+
+// TestSubscribeMaxDecompressedSize verifies that a subscription fails on an
+// event that decompresses to more than its maximum decompressed size, at every
+// compression level, rather than decompress it.
+func TestSubscribeMaxDecompressedSize(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	const maxSize = 1 << 10
+	// A large value of zeros compresses to a small fraction of its size.
+	bomb, err := protoutil.Marshal(&streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{
+		KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key("a"),
+			Value: roachpb.Value{RawBytes: make([]byte, 1<<20), Timestamp: hlc.Timestamp{WallTime: 1}},
+		}}},
+	}})
+	require.NoError(t, err)
+	canceledData, err := protoutil.Marshal(&streampb.StreamEvent{StreamCanceled: true})
+	require.NoError(t, err)
+
+	for _, level := range []int32{0 /* snappy */, 3} {
+		t.Run(fmt.Sprintf("level=%d", level), func(t *testing.T) {
+			compressor, err := streampb.NewEventCompressor(level)
+			require.NoError(t, err)
+			defer compressor.Close()
+			compressed := compressor.Compress(bomb)
+			require.Less(t, len(compressed), maxSize)
+			feed := &fakeRows{rows: [][]byte{compressed, compressor.Compress(canceledData)}}
+
+			events, err := runFeed(ctx, feed, feedOptions{compressed: true, maxDecompressedSize: maxSize})
+			require.ErrorIs(t, err, streampb.ErrDecompressedEventTooLarge)
+			require.Empty(t, events)
+
+			// Events within the limit are decompressed as usual.
+			decompressed, err := streampb.DecompressEventLimited(compressor.Compress(canceledData), maxSize)
+			require.NoError(t, err)
+			require.Equal(t, canceledData, decompressed)
+		})
+	}
+}
+
+// slowRows is a fakeRows that takes a fixed time to produce each row, like a
+// producer streaming as fast as it can.
+type slowRows struct {
+	fakeRows
+	delay time.Duration
+}
+
+func (r *slowRows) Next() bool {
+	time.Sleep(r.delay)
+	return r.fakeRows.Next()
+}
+
+// TestSubscribeThrottle verifies that throttling a subscription slows its
+// delivery rate without slowing another subscription that is not throttled.
+func TestSubscribeThrottle(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	const numRows = 20
+	const rowDelay = 5 * time.Millisecond
+	var events []streampb.StreamEvent
+	for i := 0; i < numRows; i++ {
+		events = append(events, streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{
+			KeyValue: roachpb.KeyValue{
+				Key:   roachpb.Key(fmt.Sprintf("k%d", i)),
+				Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 1}},
+			},
+		}}}})
+	}
+	events = append(events, streampb.StreamEvent{StreamCanceled: true})
+
+	var throttle feedThrottle
+	require.Error(t, throttle.set(-0.1))
+	require.Error(t, throttle.set(1.1))
+	// Shedding three quarters of the rate makes each row take at least four
+	// times as long to deliver.
+	require.NoError(t, throttle.set(0.75))
+
+	type result struct {
+		kvs     int
+		elapsed time.Duration
+		err     error
+	}
+	// subscribe consumes a feed, reporting how long it took to deliver every
+	// row.
+	subscribe := func(throttle *feedThrottle) <-chan result {
+		feed := &slowRows{fakeRows: *makeFakeRows(t, events...), delay: rowDelay}
+		resCh := make(chan result, 1)
+		go func() {
+			start := timeutil.Now()
+			var res result
+			var delivered []crosscluster.Event
+			delivered, res.err = runFeed(ctx, feed, feedOptions{throttle: throttle})
+			res.elapsed = timeutil.Since(start)
+			for _, ev := range delivered {
+				if ev.Type() == crosscluster.KVEvent {
+					res.kvs++
+				}
+			}
+			resCh <- res
+		}()
+		return resCh
+	}
+	throttledCh, unthrottledCh := subscribe(&throttle), subscribe(nil)
+	throttled, unthrottled := <-throttledCh, <-unthrottledCh
+	for _, res := range []result{throttled, unthrottled} {
+		require.NoError(t, res.err)
+		require.Equal(t, numRows, res.kvs)
+	}
+
+	require.GreaterOrEqual(t, throttled.elapsed, 4*numRows*rowDelay)
+	require.Less(t, unthrottled.elapsed, throttled.elapsed)
+}
+
+// TestSubscribeBatchedEvents verifies that a subscription delivering its
+// events in batches delivers the same events in the same order as one
+// delivering them one at a time, and that every checkpoint ends its batch.
+func TestSubscribeBatchedEvents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 1}
+	kv := func(key string) streampb.StreamEvent_KV {
+		return streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key(key),
+			Value: roachpb.Value{Timestamp: ts},
+		}}
+	}
+	delRange := func(key, endKey string) roachpb.RangeFeedDeleteRange {
+		return roachpb.RangeFeedDeleteRange{
+			Span:      roachpb.Span{Key: roachpb.Key(key), EndKey: roachpb.Key(endKey)},
+			Timestamp: ts,
+		}
+	}
+	checkpoint := func(wallTime int64) *streampb.StreamEvent_StreamCheckpoint {
+		return &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: []jobspb.ResolvedSpan{{
+			Span:      roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")},
+			Timestamp: hlc.Timestamp{WallTime: wallTime},
+		}}}
+	}
+	makeFeed := func() *fakeRows {
+		return makeFakeRows(t,
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{
+				KVs:       []streampb.StreamEvent_KV{kv("a"), kv("b")},
+				DelRanges: []roachpb.RangeFeedDeleteRange{delRange("c", "d"), delRange("e", "f")},
+			}},
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{kv("g")}}, Checkpoint: checkpoint(2)},
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{
+				DelRanges: []roachpb.RangeFeedDeleteRange{delRange("h", "i"), delRange("j", "k")},
+			}},
+			streampb.StreamEvent{Keepalive: true},
+			streampb.StreamEvent{Checkpoint: checkpoint(3)},
+			streampb.StreamEvent{StreamCanceled: true},
+		)
+	}
+
+	events, err := runFeed(ctx, makeFeed(), feedOptions{})
+	require.NoError(t, err)
+
+	var batches [][]crosscluster.Event
+	batchCh := make(chan []crosscluster.Event)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(batchCh)
+		errCh <- subscribeInternal(ctx, makeFeed(), feedOptions{
+			batchCh:  batchCh,
+			closeCh:  make(chan struct{}),
+			conn:     &connectionStateTracker{},
+			frontier: &frontierTracker{},
+		})
+	}()
+	for batch := range batchCh {
+		batches = append(batches, batch)
+	}
+	require.NoError(t, <-errCh)
+
+	var batched []crosscluster.Event
+	for _, batch := range batches {
+		require.NotEmpty(t, batch)
+		for i, ev := range batch {
+			if ev.Type() == crosscluster.CheckpointEvent {
+				require.Equal(t, len(batch)-1, i, "checkpoint not at the end of its batch")
+			}
+		}
+		batched = append(batched, batch...)
+	}
+	require.Equal(t, events, batched)
+	require.Less(t, len(batches), len(events))
+}
+
+// TestSubscribeTypedEvents verifies that a subscription delivering its events
+// WithTypedEvents delivers only KV events on KVEvents and only checkpoints on
+// ResolvedEvents, and together with Events the same events in the same order
+// as one delivering all of them on Events.
+func TestSubscribeTypedEvents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	ts := hlc.Timestamp{WallTime: 1}
+	kv := func(key string) streampb.StreamEvent_KV {
+		return streampb.StreamEvent_KV{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key(key),
+			Value: roachpb.Value{Timestamp: ts},
+		}}
+	}
+	checkpoint := func(wallTime int64) *streampb.StreamEvent_StreamCheckpoint {
+		return &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: []jobspb.ResolvedSpan{{
+			Span:      roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")},
+			Timestamp: hlc.Timestamp{WallTime: wallTime},
+		}}}
+	}
+	makeFeed := func() *fakeRows {
+		return makeFakeRows(t,
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{
+				KVs: []streampb.StreamEvent_KV{kv("a"), kv("b")},
+				DelRanges: []roachpb.RangeFeedDeleteRange{{
+					Span:      roachpb.Span{Key: roachpb.Key("c"), EndKey: roachpb.Key("d")},
+					Timestamp: ts,
+				}},
+			}},
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{kv("e")}}, Checkpoint: checkpoint(2)},
+			streampb.StreamEvent{Keepalive: true},
+			streampb.StreamEvent{Checkpoint: checkpoint(3)},
+			streampb.StreamEvent{StreamCanceled: true},
+		)
+	}
+
+	events, err := runFeed(ctx, makeFeed(), feedOptions{})
+	require.NoError(t, err)
+
+	var kvs, resolved, typedEvents []crosscluster.Event
+	typed := newTypedEventChans()
+	otherCh := make(chan crosscluster.Event)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(otherCh)
+		defer typed.close()
+		errCh <- subscribeInternal(ctx, makeFeed(), feedOptions{
+			eventCh:  otherCh,
+			typed:    typed,
+			closeCh:  make(chan struct{}),
+			conn:     &connectionStateTracker{},
+			frontier: &frontierTracker{},
+		})
+	}()
+	kvCh, resolvedCh := typed.kvs, typed.resolved
+	for kvCh != nil || resolvedCh != nil || otherCh != nil {
+		select {
+		case ev, ok := <-kvCh:
+			if !ok {
+				kvCh = nil
+				continue
+			}
+			kvs = append(kvs, ev)
+			typedEvents = append(typedEvents, ev)
+		case ev, ok := <-resolvedCh:
+			if !ok {
+				resolvedCh = nil
+				continue
+			}
+			resolved = append(resolved, ev)
+			typedEvents = append(typedEvents, ev)
+		case ev, ok := <-otherCh:
+			if !ok {
+				otherCh = nil
+				continue
+			}
+			require.NotEqual(t, crosscluster.KVEvent, ev.Type())
+			require.NotEqual(t, crosscluster.CheckpointEvent, ev.Type())
+			typedEvents = append(typedEvents, ev)
+		}
+	}
+	require.NoError(t, <-errCh)
+
+	require.Len(t, kvs, 2)
+	for _, ev := range kvs {
+		require.Equal(t, crosscluster.KVEvent, ev.Type())
+	}
+	require.Len(t, resolved, 2)
+	for _, ev := range resolved {
+		require.Equal(t, crosscluster.CheckpointEvent, ev.Type())
+	}
+	require.Equal(t, events, typedEvents)
+}
+
+// gatedRows is a fakeRows that blocks before returning its last row until
+// release is closed.
+type gatedRows struct {
+	fakeRows
+	release chan struct{}
+}
+
+func (r *gatedRows) Next() bool {
+	if len(r.rows) == 1 {
+		<-r.release
+	}
+	return r.fakeRows.Next()
+}
+
+// TestSubscribeNoEventsWhilePaused verifies that a subscription whose only
+// span is paused delivers nothing while the producer keeps streaming.
+func TestSubscribeNoEventsWhilePaused(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	feed := &gatedRows{
+		fakeRows: *makeFakeRows(t,
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+				Key:   roachpb.Key("b"),
+				Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 2}},
+			}}}}},
+			streampb.StreamEvent{Checkpoint: &streampb.StreamEvent_StreamCheckpoint{ResolvedSpans: []jobspb.ResolvedSpan{
+				{Span: sp, Timestamp: hlc.Timestamp{WallTime: 5}},
+			}}},
+			streampb.StreamEvent{StreamCanceled: true},
+		),
+		release: make(chan struct{}),
+	}
+
+	var pauser spanPauser
+	require.NoError(t, pauser.pause(sp))
+	var frontier frontierTracker
+	require.NoError(t, frontier.init([]roachpb.Span{sp}))
+	eventCh, errCh := startFeed(ctx, feed, feedOptions{frontier: &frontier, pauser: &pauser})
+
+	// The batch and checkpoint are both held back, so nothing arrives until
+	// the producer ends the stream.
+	replicationtestutils.AssertNoEventsFor(ctx, t, eventCh, 100*time.Millisecond)
+	close(feed.release)
+	var types []crosscluster.EventType
+	for ev := range eventCh {
+		types = append(types, ev.Type())
+	}
+	require.NoError(t, <-errCh)
+	require.Equal(t, []crosscluster.EventType{crosscluster.StreamCanceledEvent}, types)
+}
+
+// TestSubscribeResumeWhileWaiting verifies that the events held back for a
+// paused span are delivered as soon as it is resumed, without waiting for the
+// producer to send another row.
+func TestSubscribeResumeWhileWaiting(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	feed := &gatedRows{
+		fakeRows: *makeFakeRows(t,
+			streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+				Key:   roachpb.Key("b"),
+				Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: 2}},
+			}}}}},
+			streampb.StreamEvent{StreamCanceled: true},
+		),
+		release: make(chan struct{}),
+	}
+
+	var pauser spanPauser
+	require.NoError(t, pauser.pause(sp))
+	var frontier frontierTracker
+	require.NoError(t, frontier.init([]roachpb.Span{sp}))
+	eventCh, errCh := startFeed(ctx, feed, feedOptions{frontier: &frontier, pauser: &pauser})
+
+	// The KV is held back while the subscription waits for the gated row, and
+	// is delivered once the span is resumed, before that row is released.
+	replicationtestutils.AssertNoEventsFor(ctx, t, eventCh, 100*time.Millisecond)
+	require.NoError(t, pauser.resume(sp))
+	select {
+	case ev := <-eventCh:
+		require.Equal(t, crosscluster.KVEvent, ev.Type())
+		require.Equal(t, roachpb.Key("b"), ev.GetKVs()[0].KeyValue.Key)
+	case <-time.After(10 * time.Second):
+		t.Fatal("resumed span's events were not delivered")
+	}
+	close(feed.release)
+	var types []crosscluster.EventType
+	for ev := range eventCh {
+		types = append(types, ev.Type())
+	}
+	require.NoError(t, <-errCh)
+	require.Equal(t, []crosscluster.EventType{crosscluster.StreamCanceledEvent}, types)
+}
+
+// TestSubscribePausedSpanBound verifies that a subscription fails once the
+// events held back for its paused spans outgrow the bound.
+func TestSubscribePausedSpanBound(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	sp := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("z")}
+	feed := makeFakeRows(t,
+		streampb.StreamEvent{Batch: &streampb.StreamEvent_Batch{KVs: []streampb.StreamEvent_KV{{KeyValue: roachpb.KeyValue{
+			Key:   roachpb.Key("b"),
+			Value: roachpb.MakeValueFromString("value"),
+		}}}}},
+		streampb.StreamEvent{StreamCanceled: true},
+	)
+
+	pauser := spanPauser{maxHeldBytes: 8}
+	require.NoError(t, pauser.pause(sp))
+	var frontier frontierTracker
+	require.NoError(t, frontier.init([]roachpb.Span{sp}))
+	events, err := runFeed(ctx, feed, feedOptions{frontier: &frontier, pauser: &pauser})
+	require.Empty(t, events)
+	require.ErrorContains(t, err, "events held back for paused spans exceed 8 bytes")
+}
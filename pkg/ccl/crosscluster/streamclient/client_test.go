@@ -17,6 +17,7 @@ import (
 
 	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
@@ -128,11 +129,73 @@ func (sc testStreamClient) Subscribe(
 	}, nil
 }
 
+// SubscribeDescriptors implements the Client interface.
+func (sc testStreamClient) SubscribeDescriptors(
+	_ context.Context,
+	_ streampb.StreamID,
+	_, _ int32,
+	_ roachpb.TenantID,
+	_ hlc.Timestamp,
+	_ ...SubscribeOption,
+) (Subscription, error) {
+	panic("unimplemented")
+}
+
+// SubscribeRange implements the streamclient.Client interface.
+func (sc testStreamClient) SubscribeRange(
+	_ context.Context, _ streampb.StreamID, _ roachpb.RangeID, _ hlc.Timestamp, _ ...SubscribeOption,
+) (Subscription, error) {
+	panic("unimplemented")
+}
+
 // Complete implements the streamclient.Client interface.
 func (sc testStreamClient) Complete(_ context.Context, _ streampb.StreamID, _ bool) error {
 	return nil
 }
 
+// Pause implements the streamclient.Client interface.
+func (sc testStreamClient) Pause(_ context.Context, _ streampb.StreamID) error {
+	return nil
+}
+
+// Resume implements the streamclient.Client interface.
+func (sc testStreamClient) Resume(_ context.Context, _ streampb.StreamID) error {
+	return nil
+}
+
+// StreamHistory implements the streamclient.Client interface.
+func (sc testStreamClient) StreamHistory(
+	_ context.Context, _ streampb.StreamID,
+) ([]StreamStatusTransition, error) {
+	return nil, nil
+}
+
+// ProtectedTimestampRecord implements the streamclient.Client interface.
+func (sc testStreamClient) ProtectedTimestampRecord(
+	_ context.Context, _ streampb.StreamID,
+) (ProtectedTimestampRecord, error) {
+	return ProtectedTimestampRecord{}, nil
+}
+
+// ProtocolVersions implements the streamclient.Client interface.
+func (sc testStreamClient) ProtocolVersions(_ context.Context) (uint32, uint32, error) {
+	return streampb.MinStreamProtocolVersion, streampb.StreamProtocolVersion, nil
+}
+
+// SourceClusterVersion implements the streamclient.Client interface.
+func (sc testStreamClient) SourceClusterVersion(_ context.Context) (roachpb.Version, error) {
+	return clusterversion.Latest.Version(), nil
+}
+
+// WatchProgress implements the streamclient.Client interface.
+func (sc testStreamClient) WatchProgress(
+	_ context.Context, _ streampb.StreamID,
+) (<-chan StreamProgress, error) {
+	progressCh := make(chan StreamProgress)
+	close(progressCh)
+	return progressCh, nil
+}
+
 // PriorReplicationDetails implements the streamclient.Client interface.
 func (sc testStreamClient) PriorReplicationDetails(
 	_ context.Context, _ roachpb.TenantName,
@@ -154,11 +217,71 @@ func (t testStreamSubscription) Events() <-chan crosscluster.Event {
 	return t.eventCh
 }
 
+// EventsBatched implements the Subscription interface.
+func (t testStreamSubscription) EventsBatched() <-chan []crosscluster.Event {
+	panic("unimplemented")
+}
+
+// KVEvents implements the Subscription interface.
+func (t testStreamSubscription) KVEvents() <-chan crosscluster.Event {
+	panic("unimplemented")
+}
+
+// ResolvedEvents implements the Subscription interface.
+func (t testStreamSubscription) ResolvedEvents() <-chan crosscluster.Event {
+	panic("unimplemented")
+}
+
 // Err implements the Subscription interface.
 func (t testStreamSubscription) Err() error {
 	return nil
 }
 
+// ConnectionState implements the Subscription interface.
+func (t testStreamSubscription) ConnectionState() ConnectionState {
+	return ConnectionState{Status: ConnectionHealthy}
+}
+
+// WaitForFrontier implements the Subscription interface.
+func (t testStreamSubscription) WaitForFrontier(_ context.Context, _ hlc.Timestamp) error {
+	panic("unimplemented")
+}
+
+// ResolvedTSForKey implements the Subscription interface.
+func (t testStreamSubscription) ResolvedTSForKey(_ roachpb.Key) (hlc.Timestamp, error) {
+	panic("unimplemented")
+}
+
+// SetThrottle implements the Subscription interface.
+func (t testStreamSubscription) SetThrottle(_ float64) error {
+	panic("unimplemented")
+}
+
+// PauseSpan implements the Subscription interface.
+func (t testStreamSubscription) PauseSpan(_ roachpb.Span) error {
+	panic("unimplemented")
+}
+
+// ResumeSpan implements the Subscription interface.
+func (t testStreamSubscription) ResumeSpan(_ roachpb.Span) error {
+	panic("unimplemented")
+}
+
+// Spans implements the Subscription interface.
+func (t testStreamSubscription) Spans() []roachpb.Span {
+	panic("unimplemented")
+}
+
+// IsCaughtUp implements the Subscription interface.
+func (t testStreamSubscription) IsCaughtUp() bool {
+	panic("unimplemented")
+}
+
+// CatchUpETA implements the Subscription interface.
+func (t testStreamSubscription) CatchUpETA() (time.Duration, bool) {
+	panic("unimplemented")
+}
+
 func TestGetFirstActiveClientEmpty(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
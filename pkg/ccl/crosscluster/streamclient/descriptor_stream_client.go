@@ -0,0 +1,117 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package streamclient
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/keys"
+	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
+	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
+	"github.com/cockroachdb/errors"
+)
+
+// descriptorSpan returns the span of the tenant's system.descriptor table.
+func descriptorSpan(codec keys.SQLCodec) roachpb.Span {
+	prefix := codec.DescMetadataPrefix()
+	return roachpb.Span{Key: prefix, EndKey: prefix.PrefixEnd()}
+}
+
+// descriptorStreamSubscription wraps a subscription to a tenant's
+// system.descriptor table, translating the KVs it delivers into
+// DescriptorEvents. All other events are passed through.
+type descriptorStreamSubscription struct {
+	Subscription
+	codec      keys.SQLCodec
+	eventsChan chan crosscluster.Event
+	err        error
+}
+
+var _ Subscription = (*descriptorStreamSubscription)(nil)
+
+func newDescriptorStreamSubscription(
+	sub Subscription, codec keys.SQLCodec,
+) *descriptorStreamSubscription {
+	return &descriptorStreamSubscription{
+		Subscription: sub,
+		codec:        codec,
+		eventsChan:   make(chan crosscluster.Event),
+	}
+}
+
+// Subscribe implements the Subscription interface.
+func (d *descriptorStreamSubscription) Subscribe(ctx context.Context) error {
+	defer close(d.eventsChan)
+
+	g := ctxgroup.WithContext(ctx)
+	g.GoCtx(d.Subscription.Subscribe)
+	g.GoCtx(func(ctx context.Context) error {
+		for event := range d.Subscription.Events() {
+			var translated []crosscluster.Event
+			if event.Type() == crosscluster.KVEvent {
+				for _, kv := range event.GetKVs() {
+					update, ok, err := d.decode(kv)
+					if err != nil {
+						return err
+					}
+					if ok {
+						translated = append(translated, crosscluster.MakeDescriptorEvent(update))
+					}
+				}
+			} else {
+				translated = append(translated, event)
+			}
+			for _, e := range translated {
+				select {
+				case d.eventsChan <- e:
+				case <-ctx.Done():
+					return ctx.Err()
+				}
+			}
+		}
+		return nil
+	})
+	d.err = g.Wait()
+	return d.err
+}
+
+// decode decodes a system.descriptor KV into a DescriptorUpdate. It returns
+// false for KVs of the table's other column families.
+func (d *descriptorStreamSubscription) decode(
+	kv streampb.StreamEvent_KV,
+) (crosscluster.DescriptorUpdate, bool, error) {
+	id, err := d.codec.DecodeDescMetadataID(kv.KeyValue.Key)
+	if err != nil {
+		return crosscluster.DescriptorUpdate{}, false, errors.Wrap(err, "decoding descriptor key")
+	}
+	if !kv.KeyValue.Key.Equal(d.codec.DescMetadataKey(id)) {
+		return crosscluster.DescriptorUpdate{}, false, nil
+	}
+	update := crosscluster.DescriptorUpdate{ID: descpb.ID(id), KV: kv}
+	if kv.KeyValue.Value.IsPresent() {
+		update.Descriptor = &descpb.Descriptor{}
+		if err := kv.KeyValue.Value.GetProto(update.Descriptor); err != nil {
+			return crosscluster.DescriptorUpdate{}, false, errors.Wrapf(err, "decoding descriptor %d", id)
+		}
+	}
+	return update, true, nil
+}
+
+// Events implements the Subscription interface.
+func (d *descriptorStreamSubscription) Events() <-chan crosscluster.Event {
+	return d.eventsChan
+}
+
+// Err implements the Subscription interface.
+func (d *descriptorStreamSubscription) Err() error {
+	return d.err
+}
@@ -10,8 +10,10 @@ package streamclient
 
 import (
 	"context"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
@@ -76,11 +78,76 @@ func (m *mockSubscription) Events() <-chan crosscluster.Event {
 	return m.eventsCh
 }
 
+// EventsBatched implements the Subscription interface. Scripted events are
+// only delivered on Events.
+func (m *mockSubscription) EventsBatched() <-chan []crosscluster.Event {
+	return nil
+}
+
+// KVEvents implements the Subscription interface. Scripted events are only
+// delivered on Events.
+func (m *mockSubscription) KVEvents() <-chan crosscluster.Event {
+	return nil
+}
+
+// ResolvedEvents implements the Subscription interface. Scripted events are
+// only delivered on Events.
+func (m *mockSubscription) ResolvedEvents() <-chan crosscluster.Event {
+	return nil
+}
+
 // Err implements the Subscription interface.
 func (m *mockSubscription) Err() error {
 	return nil
 }
 
+// ConnectionState implements the Subscription interface. There is no
+// underlying connection, so it is always reported as healthy.
+func (m *mockSubscription) ConnectionState() ConnectionState {
+	return ConnectionState{Status: ConnectionHealthy}
+}
+
+// WaitForFrontier implements the Subscription interface.
+func (m *mockSubscription) WaitForFrontier(_ context.Context, _ hlc.Timestamp) error {
+	panic("unimplemented mock method")
+}
+
+// ResolvedTSForKey implements the Subscription interface.
+func (m *mockSubscription) ResolvedTSForKey(_ roachpb.Key) (hlc.Timestamp, error) {
+	panic("unimplemented mock method")
+}
+
+// SetThrottle implements the Subscription interface. Events are delivered as
+// they are scripted, so the throttle is ignored.
+func (m *mockSubscription) SetThrottle(_ float64) error {
+	return nil
+}
+
+// PauseSpan implements the Subscription interface.
+func (m *mockSubscription) PauseSpan(_ roachpb.Span) error {
+	panic("unimplemented mock method")
+}
+
+// ResumeSpan implements the Subscription interface.
+func (m *mockSubscription) ResumeSpan(_ roachpb.Span) error {
+	panic("unimplemented mock method")
+}
+
+// Spans implements the Subscription interface.
+func (m *mockSubscription) Spans() []roachpb.Span {
+	panic("unimplemented mock method")
+}
+
+// IsCaughtUp implements the Subscription interface.
+func (m *mockSubscription) IsCaughtUp() bool {
+	panic("unimplemented mock method")
+}
+
+// CatchUpETA implements the Subscription interface.
+func (m *mockSubscription) CatchUpETA() (time.Duration, bool) {
+	panic("unimplemented mock method")
+}
+
 // Subscribe implements the Client interface.
 func (m *MockStreamClient) Subscribe(
 	ctx context.Context,
@@ -126,6 +193,68 @@ func (m *MockStreamClient) Complete(_ context.Context, _ streampb.StreamID, _ bo
 	return nil
 }
 
+// SubscribeDescriptors implements the Client interface.
+func (m *MockStreamClient) SubscribeDescriptors(
+	_ context.Context,
+	_ streampb.StreamID,
+	_, _ int32,
+	_ roachpb.TenantID,
+	_ hlc.Timestamp,
+	_ ...SubscribeOption,
+) (Subscription, error) {
+	panic("unimplemented mock method")
+}
+
+// SubscribeRange implements the streamclient.Client interface.
+func (m *MockStreamClient) SubscribeRange(
+	_ context.Context, _ streampb.StreamID, _ roachpb.RangeID, _ hlc.Timestamp, _ ...SubscribeOption,
+) (Subscription, error) {
+	panic("unimplemented mock method")
+}
+
+// Pause implements the streamclient.Client interface.
+func (m *MockStreamClient) Pause(_ context.Context, _ streampb.StreamID) error {
+	return nil
+}
+
+// Resume implements the streamclient.Client interface.
+func (m *MockStreamClient) Resume(_ context.Context, _ streampb.StreamID) error {
+	return nil
+}
+
+// StreamHistory implements the streamclient.Client interface.
+func (m *MockStreamClient) StreamHistory(
+	_ context.Context, _ streampb.StreamID,
+) ([]StreamStatusTransition, error) {
+	return nil, nil
+}
+
+// ProtectedTimestampRecord implements the streamclient.Client interface.
+func (m *MockStreamClient) ProtectedTimestampRecord(
+	_ context.Context, _ streampb.StreamID,
+) (ProtectedTimestampRecord, error) {
+	return ProtectedTimestampRecord{}, nil
+}
+
+// ProtocolVersions implements the streamclient.Client interface.
+func (m *MockStreamClient) ProtocolVersions(_ context.Context) (uint32, uint32, error) {
+	return streampb.MinStreamProtocolVersion, streampb.StreamProtocolVersion, nil
+}
+
+// SourceClusterVersion implements the streamclient.Client interface.
+func (m *MockStreamClient) SourceClusterVersion(_ context.Context) (roachpb.Version, error) {
+	return clusterversion.Latest.Version(), nil
+}
+
+// WatchProgress implements the streamclient.Client interface.
+func (m *MockStreamClient) WatchProgress(
+	_ context.Context, _ streampb.StreamID,
+) (<-chan StreamProgress, error) {
+	progressCh := make(chan StreamProgress)
+	close(progressCh)
+	return progressCh, nil
+}
+
 // PriorReplicationDetails implements the streamclient.Client interface.
 func (m *MockStreamClient) PriorReplicationDetails(
 	_ context.Context, _ roachpb.TenantName,
@@ -167,3 +296,44 @@ func (m *ErrorStreamClient) Subscribe(
 func (m *ErrorStreamClient) Complete(_ context.Context, _ streampb.StreamID, _ bool) error {
 	return nil
 }
+
+// Pause implements the streamclient.Client interface.
+func (m *ErrorStreamClient) Pause(_ context.Context, _ streampb.StreamID) error {
+	return errors.New("this client always returns an error")
+}
+
+// Resume implements the streamclient.Client interface.
+func (m *ErrorStreamClient) Resume(_ context.Context, _ streampb.StreamID) error {
+	return errors.New("this client always returns an error")
+}
+
+// StreamHistory implements the streamclient.Client interface.
+func (m *ErrorStreamClient) StreamHistory(
+	_ context.Context, _ streampb.StreamID,
+) ([]StreamStatusTransition, error) {
+	return nil, errors.New("this client always returns an error")
+}
+
+// ProtectedTimestampRecord implements the streamclient.Client interface.
+func (m *ErrorStreamClient) ProtectedTimestampRecord(
+	_ context.Context, _ streampb.StreamID,
+) (ProtectedTimestampRecord, error) {
+	return ProtectedTimestampRecord{}, errors.New("this client always returns an error")
+}
+
+// ProtocolVersions implements the streamclient.Client interface.
+func (m *ErrorStreamClient) ProtocolVersions(_ context.Context) (uint32, uint32, error) {
+	return 0, 0, errors.New("this client always returns an error")
+}
+
+// SourceClusterVersion implements the streamclient.Client interface.
+func (m *ErrorStreamClient) SourceClusterVersion(_ context.Context) (roachpb.Version, error) {
+	return roachpb.Version{}, errors.New("this client always returns an error")
+}
+
+// WatchProgress implements the streamclient.Client interface.
+func (m *ErrorStreamClient) WatchProgress(
+	_ context.Context, _ streampb.StreamID,
+) (<-chan StreamProgress, error) {
+	return nil, errors.New("this client always returns an error")
+}
@@ -11,13 +11,17 @@ package streamclient
 import (
 	"context"
 	gosql "database/sql"
+	"encoding/json"
 	"fmt"
 	"net"
 	"net/url"
+	"time"
 
 	"github.com/cockroachdb/apd/v3"
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/jobs"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
@@ -26,23 +30,43 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/span"
 	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 	"github.com/jackc/pgx/v4"
 )
 
+// defaultClockSkewWarningThreshold is the clock skew between the producer and
+// consumer above which a warning is logged, unless overridden by
+// WithClockSkewWarningThreshold.
+const defaultClockSkewWarningThreshold = 250 * time.Millisecond
+
+// defaultCaughtUpThreshold is how far the frontier of a subscription may trail
+// the current time for it to be considered caught up, unless overridden by
+// WithCaughtUpThreshold.
+const defaultCaughtUpThreshold = 30 * time.Second
+
 type partitionedStreamClient struct {
 	urlPlaceholder url.URL
 	pgxConfig      *pgx.ConnConfig
 	compressed     bool
 	logical        bool
 
+	wallClock                 hlc.WallClock
+	clockSkewWarningThreshold time.Duration
+
 	mu struct {
 		syncutil.Mutex
 
 		closed              bool
 		activeSubscriptions map[*partitionedStreamSubscription]struct{}
 		srcConn             *pgx.Conn // pgx connection to the source cluster
+
+		// clockSkew is the clock skew observed by the last heartbeat, if
+		// clockSkewObserved is set.
+		clockSkew         ClockSkew
+		clockSkewObserved bool
 	}
 }
 
@@ -55,10 +79,18 @@ func NewPartitionedStreamClient(
 		return nil, err
 	}
 	client := partitionedStreamClient{
-		urlPlaceholder: *remote,
-		pgxConfig:      config,
-		compressed:     options.compressed,
-		logical:        options.logical,
+		urlPlaceholder:            *remote,
+		pgxConfig:                 config,
+		compressed:                options.compressed,
+		logical:                   options.logical,
+		wallClock:                 options.wallClock,
+		clockSkewWarningThreshold: options.clockSkewWarningThreshold,
+	}
+	if client.wallClock == nil {
+		client.wallClock = timeutil.DefaultTimeSource{}
+	}
+	if client.clockSkewWarningThreshold <= 0 {
+		client.clockSkewWarningThreshold = defaultClockSkewWarningThreshold
 	}
 	client.mu.activeSubscriptions = make(map[*partitionedStreamSubscription]struct{})
 	client.mu.srcConn = conn
@@ -66,6 +98,7 @@ func NewPartitionedStreamClient(
 }
 
 var _ Client = &partitionedStreamClient{}
+var _ ClockSkewReporter = &partitionedStreamClient{}
 
 // CreateForTenant implements Client interface.
 func (p *partitionedStreamClient) CreateForTenant(
@@ -81,7 +114,7 @@ func (p *partitionedStreamClient) CreateForTenant(
 	}
 
 	var row pgx.Row
-	if !req.ReplicationStartTime.IsEmpty() {
+	if !req.ReplicationStartTime.IsEmpty() || req.IdempotencyToken != "" {
 		reqBytes, err := protoutil.Marshal(&req)
 		if err != nil {
 			return streampb.ReplicationProducerSpec{}, err
@@ -121,6 +154,7 @@ func (p *partitionedStreamClient) Heartbeat(
 
 	p.mu.Lock()
 	defer p.mu.Unlock()
+	sent := p.wallClock.Now()
 	row := p.mu.srcConn.QueryRow(ctx,
 		`SELECT crdb_internal.replication_stream_progress($1, $2)`, streamID, consumed.String())
 	var rawStatus []byte
@@ -128,13 +162,48 @@ func (p *partitionedStreamClient) Heartbeat(
 		return streampb.StreamReplicationStatus{},
 			errors.Wrapf(err, "error sending heartbeat to replication stream %d", streamID)
 	}
+	received := p.wallClock.Now()
 	var status streampb.StreamReplicationStatus
 	if err := protoutil.Unmarshal(rawStatus, &status); err != nil {
 		return streampb.StreamReplicationStatus{}, err
 	}
+	// Producers that predate clock readings in heartbeats leave them empty.
+	if !status.ProducerTime.IsEmpty() {
+		p.recordClockSkewLocked(ctx, status.ProducerTime, sent, received)
+	}
 	return status, nil
 }
 
+// recordClockSkewLocked records the clock skew observed by a heartbeat that
+// was sent at sent and answered at received, according to the consumer's
+// clock, and that the producer handled at producerTime, according to its own.
+func (p *partitionedStreamClient) recordClockSkewLocked(
+	ctx context.Context, producerTime hlc.Timestamp, sent, received time.Time,
+) {
+	halfRoundTrip := received.Sub(sent) / 2
+	skew := ClockSkew{
+		Offset:      producerTime.GoTime().Sub(sent.Add(halfRoundTrip)),
+		Uncertainty: halfRoundTrip,
+	}
+	p.mu.clockSkew, p.mu.clockSkewObserved = skew, true
+
+	magnitude := skew.Offset
+	if magnitude < 0 {
+		magnitude = -magnitude
+	}
+	if magnitude-skew.Uncertainty > p.clockSkewWarningThreshold {
+		log.Warningf(ctx, "producer clock is offset by %s (+/- %s) from the consumer clock, "+
+			"more than the %s threshold", skew.Offset, skew.Uncertainty, p.clockSkewWarningThreshold)
+	}
+}
+
+// ObservedClockSkew implements the ClockSkewReporter interface.
+func (p *partitionedStreamClient) ObservedClockSkew() (ClockSkew, bool) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.mu.clockSkew, p.mu.clockSkewObserved
+}
+
 // postgresURL converts an SQL serving address into a postgres URL.
 func (p *partitionedStreamClient) postgresURL(servingAddr string) (url.URL, error) {
 	host, port, err := net.SplitHostPort(servingAddr)
@@ -176,6 +245,7 @@ func (p *partitionedStreamClient) createTopology(
 ) (Topology, error) {
 	topology := Topology{
 		SourceTenantID: spec.SourceTenantID,
+		ExcludedSpans:  spec.ExcludedSpans,
 	}
 	for _, sp := range spec.Partitions {
 		pgURL, err := p.postgresURL(sp.SQLAddress.String())
@@ -252,14 +322,35 @@ func (p *partitionedStreamClient) Subscribe(
 	sps.ConsumerNode = consumerNode
 	sps.ConsumerProc = consumerProc
 	sps.Compressed = true
+	sps.ProtocolVersion = streampb.StreamProtocolVersion
 	sps.WrappedEvents = true
 	sps.WithDiff = cfg.withDiff
 	sps.WithFiltering = cfg.withFiltering
+	sps.RowFilters = cfg.rowFilters
+	sps.WithSnapshot = cfg.withSnapshot
+	sps.WithSourceLocality = cfg.withSourceLocality
+	sps.SplitHints = cfg.splitHints
+	sps.NewestFirstCatchUp = cfg.newestFirstCatchUp
+	sps.KeepaliveInterval = cfg.keepaliveInterval
+	sps.Observer = cfg.observer
+	sps.CompressionLevel = cfg.compressionLevel
+	sps.WithCatchUpComplete = cfg.withCatchUpComplete
+	sps.WithResumeTokens = cfg.withResumeTokens
+	sps.ResumeToken = cfg.resumeToken
+	sps.MaxCatchUpDuration = cfg.maxCatchUpDuration
+	sps.MaxStaleness = cfg.maxStaleness
+	sps.GroupByCommitTimestamp = cfg.groupByCommitTS
+	sps.Config.CatchUpBytesPerSecond = cfg.catchUpBytesPerSecond
+	sps.Config.BatchMaxKVs = cfg.batchMaxKVs
+	sps.Config.BatchByteSize = cfg.batchMaxBytes
 	sps.Type = streampb.ReplicationType_PHYSICAL
 	if p.logical {
 		sps.Type = streampb.ReplicationType_LOGICAL
 	}
 
+	if err := ValidatePartitionSpec(&sps); err != nil {
+		return nil, err
+	}
 	specBytes, err := protoutil.Marshal(&sps)
 	if err != nil {
 		return nil, err
@@ -270,8 +361,52 @@ func (p *partitionedStreamClient) Subscribe(
 		srcConnConfig: p.pgxConfig,
 		specBytes:     specBytes,
 		streamID:      streamID,
+		spans:         sps.Spans,
 		closeChan:     make(chan struct{}),
-		compressed:    sps.Compressed,
+
+		wallClock:         p.wallClock,
+		caughtUpThreshold: cfg.caughtUpThreshold,
+	}
+	if res.caughtUpThreshold <= 0 {
+		res.caughtUpThreshold = defaultCaughtUpThreshold
+	}
+	if cfg.batchedEvents {
+		res.batchesChan = make(chan []crosscluster.Event)
+	}
+	if cfg.typedEvents {
+		if cfg.batchedEvents {
+			return nil, errors.New("typed events cannot be batched")
+		}
+		res.typed = newTypedEventChans()
+	}
+	res.opts = feedOptions{
+		eventCh:             res.eventsChan,
+		batchCh:             res.batchesChan,
+		typed:               res.typed,
+		closeCh:             res.closeChan,
+		compressed:          sps.Compressed,
+		maxDecompressedSize: cfg.maxDecompressedSize,
+		strictOrdering:      cfg.strictOrdering,
+		globalCheckpoints:   cfg.globalCheckpoints,
+		rawMVCC:             cfg.rawMVCC,
+		transform:           cfg.transform,
+		conn:                &res.conn,
+		frontier:            &res.frontier,
+		throttle:            &res.throttle,
+		pauser:              &res.pauser,
+	}
+	if cfg.dedupWindow > 0 {
+		res.opts.dedup = newKVDeduplicator(cfg.dedupWindow)
+	}
+	if cfg.minCheckpointAdvance > 0 {
+		if res.opts.coalescer, err = newCheckpointCoalescer(cfg.minCheckpointAdvance, sps.Spans); err != nil {
+			return nil, err
+		}
+	}
+	res.frontier.wallClock = p.wallClock
+	res.frontier.onRegression = cfg.onRegression
+	if err := res.frontier.init(sps.Spans); err != nil {
+		return nil, err
 	}
 	p.mu.Lock()
 	defer p.mu.Unlock()
@@ -279,6 +414,132 @@ func (p *partitionedStreamClient) Subscribe(
 	return res, nil
 }
 
+// ValidatePartitionSpec checks that a producer could serve spec, so that a
+// malformed spec is rejected before subscribing rather than by the producer
+// once the stream is running. It checks that the spans are well-formed ranges,
+// that none of the intervals, rates or batch limits are negative, and that the
+// protocol version and compression level are ones that producers support.
+func ValidatePartitionSpec(spec *streampb.StreamPartitionSpec) error {
+	if len(spec.Spans) == 0 {
+		return errors.New("invalid partition spec: no spans")
+	}
+	for _, sp := range spec.Spans {
+		if len(sp.EndKey) == 0 || !sp.Valid() {
+			return errors.Newf("invalid partition spec: invalid span %s, "+
+				"its end key must sort after its start key", sp)
+		}
+	}
+	for _, d := range []struct {
+		name string
+		d    time.Duration
+	}{
+		{"min checkpoint frequency", spec.Config.MinCheckpointFrequency},
+		{"keepalive interval", spec.KeepaliveInterval},
+		{"max catch-up duration", spec.MaxCatchUpDuration},
+		{"max staleness", spec.MaxStaleness},
+	} {
+		if d.d < 0 {
+			return errors.Newf("invalid partition spec: negative %s %s", d.name, d.d)
+		}
+	}
+	for _, n := range []struct {
+		name string
+		n    int64
+	}{
+		{"batch byte size", spec.Config.BatchByteSize},
+		{"batch max KVs", spec.Config.BatchMaxKVs},
+		{"catch-up bytes per second", spec.Config.CatchUpBytesPerSecond},
+	} {
+		if n.n < 0 {
+			return errors.Newf("invalid partition spec: negative %s %d", n.name, n.n)
+		}
+	}
+	if v := spec.ProtocolVersion; v != 0 &&
+		(v < streampb.MinStreamProtocolVersion || v > streampb.StreamProtocolVersion) {
+		return errors.Newf("invalid partition spec: unsupported protocol version %d, "+
+			"expected %d through %d", v, streampb.MinStreamProtocolVersion, streampb.StreamProtocolVersion)
+	}
+	if l := spec.CompressionLevel; l < 0 || l > streampb.MaxCompressionLevel {
+		return errors.Newf("invalid partition spec: unsupported compression level %d, "+
+			"expected 0 through %d", l, streampb.MaxCompressionLevel)
+	}
+	if spec.CompressionLevel > 0 && !spec.Compressed {
+		return errors.Newf("invalid partition spec: compression level %d set on an "+
+			"uncompressed stream", spec.CompressionLevel)
+	}
+	return nil
+}
+
+// SubscribeDescriptors implements the Client interface.
+func (p *partitionedStreamClient) SubscribeDescriptors(
+	ctx context.Context,
+	streamID streampb.StreamID,
+	consumerNode, consumerProc int32,
+	tenantID roachpb.TenantID,
+	initialScanTime hlc.Timestamp,
+	opts ...SubscribeOption,
+) (Subscription, error) {
+	codec := keys.MakeSQLCodec(tenantID)
+	token, err := protoutil.Marshal(&streampb.SourcePartition{
+		Spans: []roachpb.Span{descriptorSpan(codec)},
+	})
+	if err != nil {
+		return nil, err
+	}
+	// Descriptor events are translated one at a time, so they are never
+	// batched, and they are all delivered on the Events channel.
+	opts = append(opts, func(cfg *subscribeConfig) {
+		cfg.batchedEvents = false
+		cfg.typedEvents = false
+	})
+	sub, err := p.Subscribe(ctx, streamID, consumerNode, consumerProc, token,
+		initialScanTime, nil /* previousReplicatedTimes */, opts...)
+	if err != nil {
+		return nil, err
+	}
+	return newDescriptorStreamSubscription(sub, codec), nil
+}
+
+// SubscribeRange implements the streamclient.Client interface.
+func (p *partitionedStreamClient) SubscribeRange(
+	ctx context.Context,
+	streamID streampb.StreamID,
+	rangeID roachpb.RangeID,
+	initialScanTime hlc.Timestamp,
+	opts ...SubscribeOption,
+) (Subscription, error) {
+	rangeSpan, err := p.rangeSpan(ctx, rangeID)
+	if err != nil {
+		return nil, err
+	}
+	token, err := protoutil.Marshal(&streampb.SourcePartition{
+		Spans: []roachpb.Span{rangeSpan},
+	})
+	if err != nil {
+		return nil, err
+	}
+	return p.Subscribe(ctx, streamID, 0 /* consumerNode */, 0 /* consumerProc */, token,
+		initialScanTime, nil /* previousReplicatedTimes */, opts...)
+}
+
+// rangeSpan returns the current span of the source range with the given ID.
+func (p *partitionedStreamClient) rangeSpan(
+	ctx context.Context, rangeID roachpb.RangeID,
+) (roachpb.Span, error) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	var startKey, endKey []byte
+	row := p.mu.srcConn.QueryRow(ctx,
+		`SELECT start_key, end_key FROM crdb_internal.ranges_no_leases WHERE range_id = $1`, int64(rangeID))
+	if err := row.Scan(&startKey, &endKey); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return roachpb.Span{}, errors.Errorf("range %d not found", rangeID)
+		}
+		return roachpb.Span{}, errors.Wrapf(err, "error looking up range %d", rangeID)
+	}
+	return roachpb.Span{Key: startKey, EndKey: endKey}, nil
+}
+
 // Complete implements the streamclient.Client interface.
 func (p *partitionedStreamClient) Complete(
 	ctx context.Context, streamID streampb.StreamID, successfulIngestion bool,
@@ -286,6 +547,25 @@ func (p *partitionedStreamClient) Complete(
 	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.Complete")
 	defer sp.Finish()
 
+	err := p.completeOnce(ctx, streamID, successfulIngestion)
+	if err == nil || ctx.Err() != nil {
+		return err
+	}
+	// The request may have been applied even though we failed to observe its
+	// result. Completing a stream is idempotent, so unless the job has already
+	// finished we issue the request once more rather than failing outright.
+	if progress, loadErr := p.loadProgress(ctx, streamID); loadErr == nil && progress.Status.Terminal() {
+		log.Infof(ctx, "replication stream %d already %s after failed completion: %v",
+			streamID, progress.Status, err)
+		return nil
+	}
+	return p.completeOnce(ctx, streamID, successfulIngestion)
+}
+
+// completeOnce issues a single request to complete the replication stream.
+func (p *partitionedStreamClient) completeOnce(
+	ctx context.Context, streamID streampb.StreamID, successfulIngestion bool,
+) error {
 	p.mu.Lock()
 	defer p.mu.Unlock()
 	row := p.mu.srcConn.QueryRow(ctx,
@@ -296,6 +576,175 @@ func (p *partitionedStreamClient) Complete(
 	return nil
 }
 
+// Pause implements the streamclient.Client interface.
+func (p *partitionedStreamClient) Pause(ctx context.Context, streamID streampb.StreamID) error {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.Pause")
+	defer sp.Finish()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.mu.srcConn.Exec(ctx, `SELECT crdb_internal.pause_replication_stream($1)`, streamID); err != nil {
+		return errors.Wrapf(err, "error pausing replication stream %d", streamID)
+	}
+	return nil
+}
+
+// Resume implements the streamclient.Client interface.
+func (p *partitionedStreamClient) Resume(ctx context.Context, streamID streampb.StreamID) error {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.Resume")
+	defer sp.Finish()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if _, err := p.mu.srcConn.Exec(ctx, `SELECT crdb_internal.resume_replication_stream($1)`, streamID); err != nil {
+		return errors.Wrapf(err, "error resuming replication stream %d", streamID)
+	}
+	return nil
+}
+
+// StreamHistory implements the streamclient.Client interface.
+func (p *partitionedStreamClient) StreamHistory(
+	ctx context.Context, streamID streampb.StreamID,
+) ([]StreamStatusTransition, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.StreamHistory")
+	defer sp.Finish()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	row := p.mu.srcConn.QueryRow(ctx, `SELECT crdb_internal.replication_stream_history($1)`, streamID)
+	var rawHistory []byte
+	if err := row.Scan(&rawHistory); err != nil {
+		return nil, errors.Wrapf(err, "error querying history of replication stream %d", streamID)
+	}
+	var history streampb.StreamStatusHistory
+	if err := protoutil.Unmarshal(rawHistory, &history); err != nil {
+		return nil, err
+	}
+	transitions := make([]StreamStatusTransition, 0, len(history.Transitions))
+	for _, t := range history.Transitions {
+		transitions = append(transitions, StreamStatusTransition{
+			Status: jobs.Status(t.Status),
+			Time:   t.Time,
+		})
+	}
+	return transitions, nil
+}
+
+// ProtectedTimestampRecord implements the streamclient.Client interface.
+func (p *partitionedStreamClient) ProtectedTimestampRecord(
+	ctx context.Context, streamID streampb.StreamID,
+) (ProtectedTimestampRecord, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.ProtectedTimestampRecord")
+	defer sp.Finish()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	row := p.mu.srcConn.QueryRow(ctx, `SELECT crdb_internal.replication_stream_protected_timestamp($1)`, streamID)
+	var rawRecord []byte
+	if err := row.Scan(&rawRecord); err != nil {
+		return ProtectedTimestampRecord{}, errors.Wrapf(err,
+			"error querying protected timestamp record of replication stream %d", streamID)
+	}
+	var record streampb.StreamProtectedTimestamp
+	if err := protoutil.Unmarshal(rawRecord, &record); err != nil {
+		return ProtectedTimestampRecord{}, err
+	}
+	return ProtectedTimestampRecord{ID: record.RecordID, Timestamp: record.Timestamp}, nil
+}
+
+// watchProgressInterval is how often WatchProgress polls the producer job.
+var watchProgressInterval = time.Second
+
+// WatchProgress implements the streamclient.Client interface.
+func (p *partitionedStreamClient) WatchProgress(
+	ctx context.Context, streamID streampb.StreamID,
+) (<-chan StreamProgress, error) {
+	// Read the current progress up front so that a bad stream ID is reported
+	// to the caller directly.
+	progress, err := p.loadProgress(ctx, streamID)
+	if err != nil {
+		return nil, err
+	}
+
+	progressCh := make(chan StreamProgress)
+	go func() {
+		defer close(progressCh)
+		send := func(progress StreamProgress) bool {
+			select {
+			case progressCh <- progress:
+				return true
+			case <-ctx.Done():
+				return false
+			}
+		}
+		if !send(progress) {
+			return
+		}
+		ticker := time.NewTicker(watchProgressInterval)
+		defer ticker.Stop()
+		for !progress.Status.Terminal() {
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+			next, err := p.loadProgress(ctx, streamID)
+			if err != nil {
+				progress.Err = err
+				send(progress)
+				return
+			}
+			if next == progress {
+				continue
+			}
+			progress = next
+			if !send(progress) {
+				return
+			}
+		}
+	}()
+	return progressCh, nil
+}
+
+// loadProgress reads the status and progress of the producer job of a
+// replication stream.
+func (p *partitionedStreamClient) loadProgress(
+	ctx context.Context, streamID streampb.StreamID,
+) (StreamProgress, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.WatchProgress")
+	defer sp.Finish()
+
+	var status string
+	var fraction gosql.NullFloat64
+	var highWater gosql.NullString
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	row := p.mu.srcConn.QueryRow(ctx,
+		`SELECT status, fraction_completed, high_water_timestamp FROM crdb_internal.jobs WHERE job_id = $1`,
+		streamID)
+	if err := row.Scan(&status, &fraction, &highWater); err != nil {
+		if errors.Is(err, pgx.ErrNoRows) {
+			return StreamProgress{}, errors.Newf("job with ID %d does not exist", streamID)
+		}
+		return StreamProgress{}, errors.Wrapf(err, "error querying progress of replication stream %d", streamID)
+	}
+
+	progress := StreamProgress{
+		Status:            jobs.Status(status),
+		FractionCompleted: float32(fraction.Float64),
+	}
+	if highWater.Valid {
+		d, _, err := apd.NewFromString(highWater.String)
+		if err != nil {
+			return StreamProgress{}, err
+		}
+		if progress.HighWater, err = hlc.DecimalToHLC(d); err != nil {
+			return StreamProgress{}, err
+		}
+	}
+	return progress, nil
+}
+
 type LogicalReplicationPlan struct {
 	Topology      Topology
 	SourceSpans   []roachpb.Span
@@ -409,27 +858,101 @@ func (p *partitionedStreamClient) PriorReplicationDetails(
 	return id, "", hlc.Timestamp{}, nil
 }
 
+// ProtocolVersions implements the streamclient.Client interface.
+func (p *partitionedStreamClient) ProtocolVersions(
+	ctx context.Context,
+) (minVersion, maxVersion uint32, _ error) {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.ProtocolVersions")
+	defer sp.Finish()
+
+	var versions []int64
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	row := p.mu.srcConn.QueryRow(ctx, `SELECT crdb_internal.replication_stream_protocol_versions()`)
+	if err := row.Scan(&versions); err != nil {
+		return 0, 0, errors.Wrap(err, "error querying stream protocol versions")
+	}
+	if len(versions) != 2 {
+		return 0, 0, errors.AssertionFailedf("expected 2 stream protocol versions, got %v", versions)
+	}
+	return uint32(versions[0]), uint32(versions[1]), nil
+}
+
+// SourceClusterVersion implements the streamclient.Client interface.
+func (p *partitionedStreamClient) SourceClusterVersion(
+	ctx context.Context,
+) (roachpb.Version, error) {
+	ctx, sp := tracing.ChildSpan(ctx, "streamclient.Client.SourceClusterVersion")
+	defer sp.Finish()
+
+	var versionJSON string
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	row := p.mu.srcConn.QueryRow(ctx, `SELECT crdb_internal.active_version()::STRING`)
+	if err := row.Scan(&versionJSON); err != nil {
+		return roachpb.Version{}, errors.Wrap(err, "error querying source cluster version")
+	}
+	var version roachpb.Version
+	if err := json.Unmarshal([]byte(versionJSON), &version); err != nil {
+		return roachpb.Version{}, errors.Wrapf(err, "error parsing source cluster version %q", versionJSON)
+	}
+	return version, nil
+}
+
 type partitionedStreamSubscription struct {
 	err           error
 	srcConnConfig *pgx.ConnConfig
 	eventsChan    chan crosscluster.Event
+	// batchesChan, if set, receives the events in place of eventsChan.
+	batchesChan chan []crosscluster.Event
+	// typed, if set, receives the KV events and checkpoints in place of
+	// eventsChan.
+	typed *typedEventChans
 	// Channel to send signal to close the subscription.
 	closeChan chan struct{}
 
-	compressed bool
+	// opts configures the delivery of the events, see subscribeInternal. Its
+	// deduplicator is kept across calls to Subscribe so that KVs re-emitted
+	// after a reconnect are caught.
+	opts feedOptions
+
+	conn     connectionStateTracker
+	frontier frontierTracker
+	throttle feedThrottle
+	pauser   spanPauser
+
+	// wallClock and caughtUpThreshold determine whether the frontier is
+	// recent enough for the subscription to be caught up.
+	wallClock         hlc.WallClock
+	caughtUpThreshold time.Duration
 
 	specBytes []byte
 	streamID  streampb.StreamID
+	// spans are the spans of the decoded spec.
+	spans []roachpb.Span
 }
 
 var _ Subscription = (*partitionedStreamSubscription)(nil)
 
 // Subscribe implements the Subscription interface.
-func (p *partitionedStreamSubscription) Subscribe(ctx context.Context) error {
+func (p *partitionedStreamSubscription) Subscribe(ctx context.Context) (retErr error) {
 	ctx, sp := tracing.ChildSpan(ctx, "partitionedStreamSubscription.Subscribe")
 	defer sp.Finish()
 
 	defer close(p.eventsChan)
+	if p.batchesChan != nil {
+		defer close(p.batchesChan)
+	}
+	if p.typed != nil {
+		defer p.typed.close()
+	}
+	defer p.frontier.finish()
+	p.conn.connecting()
+	defer func() {
+		if retErr != nil {
+			p.conn.failed()
+		}
+	}()
 	// Each subscription has its own pgx connection.
 	srcConn, err := pgx.ConnectConfig(ctx, p.srcConnConfig)
 	if err != nil {
@@ -445,6 +968,16 @@ func (p *partitionedStreamSubscription) Subscribe(ctx context.Context) error {
 	if err != nil {
 		return err
 	}
+	// Events are annotated with the ID of the source cluster, which lets a
+	// consumer ingesting from several clusters tell them apart.
+	var clusterIDStr string
+	if err = srcConn.QueryRow(ctx, `SELECT crdb_internal.cluster_id()::STRING`).Scan(&clusterIDStr); err != nil {
+		return errors.Wrap(err, "error querying source cluster ID")
+	}
+	clusterID, err := uuid.FromString(clusterIDStr)
+	if err != nil {
+		return errors.Wrapf(err, "error parsing source cluster ID %q", clusterIDStr)
+	}
 	rows, err := srcConn.Query(ctx, `SELECT * FROM crdb_internal.stream_partition($1, $2)`,
 		p.streamID, p.specBytes)
 	if err != nil {
@@ -452,7 +985,9 @@ func (p *partitionedStreamSubscription) Subscribe(ctx context.Context) error {
 	}
 	defer rows.Close()
 
-	p.err = subscribeInternal(ctx, rows, p.eventsChan, p.closeChan, p.compressed)
+	opts := p.opts
+	opts.sourceClusterID = clusterID
+	p.err = subscribeInternal(ctx, rows, opts)
 	return p.err
 }
 
@@ -461,7 +996,79 @@ func (p *partitionedStreamSubscription) Events() <-chan crosscluster.Event {
 	return p.eventsChan
 }
 
+// EventsBatched implements the Subscription interface.
+func (p *partitionedStreamSubscription) EventsBatched() <-chan []crosscluster.Event {
+	return p.batchesChan
+}
+
+// KVEvents implements the Subscription interface.
+func (p *partitionedStreamSubscription) KVEvents() <-chan crosscluster.Event {
+	if p.typed == nil {
+		return nil
+	}
+	return p.typed.kvs
+}
+
+// ResolvedEvents implements the Subscription interface.
+func (p *partitionedStreamSubscription) ResolvedEvents() <-chan crosscluster.Event {
+	if p.typed == nil {
+		return nil
+	}
+	return p.typed.resolved
+}
+
 // Err implements the Subscription interface.
 func (p *partitionedStreamSubscription) Err() error {
 	return p.err
 }
+
+// ConnectionState implements the Subscription interface.
+func (p *partitionedStreamSubscription) ConnectionState() ConnectionState {
+	return p.conn.get()
+}
+
+// WaitForFrontier implements the Subscription interface.
+func (p *partitionedStreamSubscription) WaitForFrontier(
+	ctx context.Context, ts hlc.Timestamp,
+) error {
+	return p.frontier.wait(ctx, ts)
+}
+
+// Spans implements the Subscription interface.
+func (p *partitionedStreamSubscription) Spans() []roachpb.Span {
+	return p.spans
+}
+
+// IsCaughtUp implements the Subscription interface.
+func (p *partitionedStreamSubscription) IsCaughtUp() bool {
+	return p.frontier.caughtUp(p.wallClock.Now(), p.caughtUpThreshold)
+}
+
+// CatchUpETA implements the Subscription interface.
+func (p *partitionedStreamSubscription) CatchUpETA() (time.Duration, bool) {
+	return p.frontier.catchUpETA(p.wallClock.Now(), p.caughtUpThreshold)
+}
+
+// ResolvedTSForKey implements the Subscription interface.
+func (p *partitionedStreamSubscription) ResolvedTSForKey(key roachpb.Key) (hlc.Timestamp, error) {
+	return p.frontier.resolvedForKey(key)
+}
+
+// SetThrottle implements the Subscription interface.
+func (p *partitionedStreamSubscription) SetThrottle(factor float64) error {
+	return p.throttle.set(factor)
+}
+
+// PauseSpan implements the Subscription interface. There is no way to tell
+// the producer about the pause mid-stream, so the subscription holds back
+// the span's events as they are received, and fails if they outgrow
+// defaultMaxPausedBytes.
+func (p *partitionedStreamSubscription) PauseSpan(sp roachpb.Span) error {
+	return p.pauser.pause(sp)
+}
+
+// ResumeSpan implements the Subscription interface. The held back events are
+// delivered without waiting for the next event from the producer.
+func (p *partitionedStreamSubscription) ResumeSpan(sp roachpb.Span) error {
+	return p.pauser.resume(sp)
+}
@@ -25,6 +25,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/repstream/streampb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/sql/catalog/descpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/catalog/desctestutils"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
 	"github.com/cockroachdb/cockroach/pkg/testutils"
@@ -37,7 +38,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
 	"github.com/cockroachdb/cockroach/pkg/util/span"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 	"github.com/lib/pq"
 	"github.com/stretchr/testify/require"
@@ -150,6 +153,10 @@ func TestPartitionStreamReplicationClientWithNonRunningJobs(t *testing.T) {
 			err := client.Complete(ctx, targetStreamID, true)
 			require.ErrorContains(t, err, "not a replication stream job")
 		})
+		t.Run("protected timestamp record fails", func(t *testing.T) {
+			_, err := client.ProtectedTimestampRecord(ctx, targetStreamID)
+			require.ErrorContains(t, err, "not a replication stream job")
+		})
 	})
 	t.Run("paused-job", func(t *testing.T) {
 		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
@@ -177,6 +184,24 @@ func TestPartitionStreamReplicationClientWithNonRunningJobs(t *testing.T) {
 			require.NoError(t, err)
 		})
 	})
+	t.Run("client-paused-job", func(t *testing.T) {
+		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
+		require.NoError(t, err)
+		targetStreamID := rps.StreamID
+		expectStreamState(targetStreamID, jobs.StatusRunning)
+
+		require.NoError(t, client.Pause(ctx, targetStreamID))
+		expectStreamState(targetStreamID, jobs.StatusPaused)
+		status, err := client.Heartbeat(ctx, targetStreamID, hlc.Timestamp{WallTime: timeutil.Now().UnixNano()})
+		require.NoError(t, err)
+		require.Equal(t, streampb.StreamReplicationStatus_STREAM_PAUSED, status.StreamStatus)
+
+		require.NoError(t, client.Resume(ctx, targetStreamID))
+		expectStreamState(targetStreamID, jobs.StatusRunning)
+		status, err = client.Heartbeat(ctx, targetStreamID, hlc.Timestamp{WallTime: timeutil.Now().UnixNano()})
+		require.NoError(t, err)
+		require.Equal(t, streampb.StreamReplicationStatus_STREAM_ACTIVE, status.StreamStatus)
+	})
 	t.Run("cancelled-job", func(t *testing.T) {
 		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
 		require.NoError(t, err)
@@ -201,12 +226,85 @@ func TestPartitionStreamReplicationClientWithNonRunningJobs(t *testing.T) {
 			require.ErrorContains(t, err, "must be running")
 		})
 		t.Run("complete succeeds", func(t *testing.T) {
-			// This one is a bit surprising that we allow updating
-			// the producer job status when it has been cancelled.
+			// Completing a job that has already finished is a no-op.
 			err := client.Complete(ctx, targetStreamID, true)
 			require.NoError(t, err)
 		})
 	})
+	t.Run("job-cancelled-during-subscription", func(t *testing.T) {
+		h.SysSQL.Exec(t, `SET CLUSTER SETTING physical_replication.producer.job_status_check_interval = '50ms'`)
+		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
+		require.NoError(t, err)
+		targetStreamID := rps.StreamID
+		expectStreamState(targetStreamID, jobs.StatusRunning)
+
+		subscription, err := client.Subscribe(ctx, targetStreamID, 1, 1, encodedSpec, initialScanTimstamp, emptyFrontier)
+		require.NoError(t, err)
+		cg := ctxgroup.WithContext(ctx)
+		cg.GoCtx(subscription.Subscribe)
+
+		// Wait for the stream to be running before cancelling the job.
+		for event := range subscription.Events() {
+			if event.Type() == crosscluster.CheckpointEvent {
+				break
+			}
+		}
+		h.SysSQL.Exec(t, `CANCEL JOB $1`, targetStreamID)
+
+		// The subscription ends with a StreamCanceled event rather than an error.
+		var lastEvent crosscluster.Event
+		for event := range subscription.Events() {
+			lastEvent = event
+		}
+		require.NoError(t, cg.Wait())
+		require.NotNil(t, lastEvent)
+		require.Equal(t, crosscluster.StreamCanceledEvent, lastEvent.Type())
+	})
+	t.Run("status-history", func(t *testing.T) {
+		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
+		require.NoError(t, err)
+		targetStreamID := rps.StreamID
+		expectStreamState(targetStreamID, jobs.StatusRunning)
+
+		require.NoError(t, client.Pause(ctx, targetStreamID))
+		expectStreamState(targetStreamID, jobs.StatusPaused)
+		h.SysSQL.Exec(t, `CANCEL JOB $1`, targetStreamID)
+		expectStreamState(targetStreamID, jobs.StatusCanceled)
+
+		history, err := client.StreamHistory(ctx, targetStreamID)
+		require.NoError(t, err)
+		var statuses []jobs.Status
+		for i, transition := range history {
+			statuses = append(statuses, transition.Status)
+			if i > 0 {
+				require.False(t, transition.Time.Before(history[i-1].Time),
+					"transition %d to %s is earlier than the transition before it", i, transition.Status)
+			}
+		}
+		require.Equal(t, []jobs.Status{
+			jobs.StatusPauseRequested,
+			jobs.StatusPaused,
+			jobs.StatusCancelRequested,
+			jobs.StatusReverting,
+			jobs.StatusCanceled,
+		}, statuses)
+	})
+	t.Run("protected-timestamp-record", func(t *testing.T) {
+		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
+		require.NoError(t, err)
+		targetStreamID := rps.StreamID
+		expectStreamState(targetStreamID, jobs.StatusRunning)
+
+		record, err := client.ProtectedTimestampRecord(ctx, targetStreamID)
+		require.NoError(t, err)
+		require.NotEqual(t, uuid.Nil, record.ID)
+		require.False(t, record.Timestamp.IsEmpty())
+		require.True(t, record.Timestamp.LessEq(rps.ReplicationStartTime),
+			"record protects %s, after the stream's start at %s", record.Timestamp, rps.ReplicationStartTime)
+
+		_, err = client.ProtectedTimestampRecord(ctx, streampb.StreamID(999))
+		require.ErrorContains(t, err, "job with ID 999 does not exist")
+	})
 }
 
 func TestPartitionedStreamReplicationClient(t *testing.T) {
@@ -259,6 +357,18 @@ INSERT INTO d.t2 VALUES (2);
 	require.Empty(t, from)
 	require.True(t, ts.IsEmpty())
 
+	minVersion, maxVersion, err := client.ProtocolVersions(ctx)
+	require.NoError(t, err)
+	require.LessOrEqual(t, minVersion, streampb.StreamProtocolVersion)
+	require.GreaterOrEqual(t, maxVersion, streampb.StreamProtocolVersion)
+
+	sourceVersion, err := client.SourceClusterVersion(ctx)
+	require.NoError(t, err)
+	parsedVersion, err := roachpb.ParseVersion(sourceVersion.String())
+	require.NoError(t, err)
+	require.Equal(t, sourceVersion, parsedVersion)
+	require.Equal(t, h.SysServer.ClusterSettings().Version.ActiveVersion(ctx).Version, sourceVersion)
+
 	// Allow root to directly edit the system.tenant table, which requires node.
 	h.SysSQL.Exec(t, "INSERT INTO system.users VALUES ('node', NULL, true, 3)")
 	h.SysSQL.Exec(t, "GRANT node TO root")
@@ -284,6 +394,17 @@ INSERT INTO d.t2 VALUES (2);
 	require.NoError(t, err)
 	expectStreamState(streamID, jobs.StatusRunning)
 
+	// Retrying a request with an idempotency token returns the stream the first
+	// attempt created rather than creating another one.
+	tokenReq := streampb.ReplicationProducerRequest{IdempotencyToken: "retry-token"}
+	first, err := client.CreateForTenant(ctx, testTenantName, tokenReq)
+	require.NoError(t, err)
+	second, err := client.CreateForTenant(ctx, testTenantName, tokenReq)
+	require.NoError(t, err)
+	require.Equal(t, first.StreamID, second.StreamID)
+	require.Equal(t, first.ReplicationStartTime, second.ReplicationStartTime)
+	require.NotEqual(t, streamID, first.StreamID)
+
 	top, err := client.PlanPhysicalReplication(ctx, streamID)
 	require.NoError(t, err)
 	require.Equal(t, 1, len(top.Partitions))
@@ -292,6 +413,24 @@ INSERT INTO d.t2 VALUES (2);
 	require.NoError(t, err)
 	require.Equal(t, streampb.StreamReplicationStatus_STREAM_ACTIVE, status.StreamStatus)
 
+	// A client whose clock runs an hour ahead of the producer's observes the
+	// skew in its heartbeats.
+	skewedClock := hlc.NewHybridManualClock()
+	skewedClock.Increment(time.Hour.Nanoseconds())
+	skewedClient, err := streamclient.NewPartitionedStreamClient(ctx, maybeInlineURL,
+		streamclient.WithWallClock(skewedClock))
+	require.NoError(t, err)
+	defer func() {
+		require.NoError(t, skewedClient.Close(ctx))
+	}()
+	_, observed := skewedClient.ObservedClockSkew()
+	require.False(t, observed)
+	_, err = skewedClient.Heartbeat(ctx, streamID, hlc.Timestamp{WallTime: timeutil.Now().UnixNano()})
+	require.NoError(t, err)
+	skew, observed := skewedClient.ObservedClockSkew()
+	require.True(t, observed)
+	require.InDelta(t, -time.Hour, skew.Offset, float64(skew.Uncertainty+time.Second))
+
 	initialScanTimestamp := hlc.Timestamp{WallTime: timeutil.Now().UnixNano()}
 
 	// Testing client.Subscribe()
@@ -335,6 +474,16 @@ INSERT INTO d.t2 VALUES (2);
 	rf := replicationtestutils.MakeReplicationFeed(t, &subscriptionFeedSource{sub: sub})
 	t1Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), tenant.Codec, "d", "t1")
 
+	// The subscription serves the spans of the spec it was created with.
+	twoTableSub, err := subClient.Subscribe(ctx, streamID, 1, 1, encodeSpec("t1", "t2"),
+		initialScanTimestamp, nil)
+	require.NoError(t, err)
+	require.Equal(t, []roachpb.Span{
+		t1Descr.PrimaryIndexSpan(tenant.Codec),
+		desctestutils.TestingGetPublicTableDescriptor(
+			h.SysServer.DB(), tenant.Codec, "d", "t2").PrimaryIndexSpan(tenant.Codec),
+	}, twoTableSub.Spans())
+
 	ctxWithCancel, cancelFn := context.WithCancel(ctx)
 	cg := ctxgroup.WithContext(ctxWithCancel)
 	cg.GoCtx(sub.Subscribe)
@@ -366,9 +515,192 @@ INSERT INTO d.t2 VALUES (2);
 		return errors.Is(err, context.Canceled) || isQueryCanceledError(err)
 	})
 
+	// In snapshot mode, every row that existed as of the initial scan timestamp
+	// is delivered between the snapshot markers, before any tailed change.
+	tenant.SQL.Exec(t, `INSERT INTO d.t2 SELECT generate_series(3, 10)`)
+	snapshotTS := hlc.Timestamp{WallTime: timeutil.Now().UnixNano()}
+	t2Descr := desctestutils.TestingGetPublicTableDescriptor(h.SysServer.DB(), tenant.Codec, "d", "t2")
+	expectedSnapshot := make(map[string]struct{})
+	for i := 2; i <= 10; i++ {
+		expectedSnapshot[string(replicationtestutils.EncodeKV(t, tenant.Codec, t2Descr, i).Key)] = struct{}{}
+	}
+	snapshotSub, err := subClient.Subscribe(ctx, streamID, 1, 1, encodeSpec("t2"),
+		snapshotTS, nil, streamclient.WithSnapshot(true))
+	require.NoError(t, err)
+	snapshotCtx, cancelSnapshot := context.WithCancel(ctx)
+	snapshotGroup := ctxgroup.WithContext(snapshotCtx)
+	snapshotGroup.GoCtx(snapshotSub.Subscribe)
+
+	nextEvent := func() crosscluster.Event {
+		event, ok := <-snapshotSub.Events()
+		require.True(t, ok, "subscription ended unexpectedly: %v", snapshotSub.Err())
+		return event
+	}
+	begin := nextEvent()
+	require.Equal(t, crosscluster.SnapshotBeginEvent, begin.Type())
+	require.Equal(t, snapshotTS, begin.GetSnapshotTimestamp())
+	snapshotKeys := make(map[string]struct{})
+	for event := nextEvent(); event.Type() != crosscluster.SnapshotEndEvent; event = nextEvent() {
+		for _, kv := range event.GetKVs() {
+			require.True(t, kv.KeyValue.Value.Timestamp.LessEq(snapshotTS))
+			snapshotKeys[string(kv.KeyValue.Key)] = struct{}{}
+		}
+	}
+	require.Equal(t, expectedSnapshot, snapshotKeys)
+
+	tenant.SQL.Exec(t, `INSERT INTO d.t2 VALUES (11)`)
+	tailKey := replicationtestutils.EncodeKV(t, tenant.Codec, t2Descr, 11).Key
+	for {
+		event := nextEvent()
+		require.NotEqual(t, crosscluster.SnapshotBeginEvent, event.Type())
+		if kvs := event.GetKVs(); len(kvs) > 0 {
+			require.Equal(t, tailKey, kvs[0].KeyValue.Key)
+			break
+		}
+	}
+	cancelSnapshot()
+	_ = snapshotGroup.Wait()
+
+	// Snapshot mode cannot be combined with resuming a stream.
+	resumeFrontier, err := span.MakeFrontierAt(snapshotTS, t2Descr.PrimaryIndexSpan(tenant.Codec))
+	require.NoError(t, err)
+	defer resumeFrontier.Release()
+	resumeSub, err := subClient.Subscribe(ctx, streamID, 1, 1, encodeSpec("t2"),
+		snapshotTS, resumeFrontier, streamclient.WithSnapshot(true))
+	require.NoError(t, err)
+	require.ErrorContains(t, resumeSub.Subscribe(ctx), "snapshot mode requires an initial scan")
+
+	// WaitForFrontier returns once a checkpoint past a write has been delivered,
+	// by which point the write itself has been delivered too.
+	frontierSub, err := subClient.Subscribe(ctx, streamID, 1, 1, encodeSpec("t1"),
+		initialScanTimestamp, nil)
+	require.NoError(t, err)
+	frontierCtx, cancelFrontier := context.WithCancel(ctx)
+	frontierGroup := ctxgroup.WithContext(frontierCtx)
+	frontierGroup.GoCtx(frontierSub.Subscribe)
+	var seenMu syncutil.Mutex
+	seenKeys := make(map[string]struct{})
+	frontierGroup.Go(func() error {
+		for event := range frontierSub.Events() {
+			seenMu.Lock()
+			for _, kv := range event.GetKVs() {
+				seenKeys[string(kv.KeyValue.Key)] = struct{}{}
+			}
+			seenMu.Unlock()
+		}
+		return nil
+	})
+	tenant.SQL.Exec(t, `INSERT INTO d.t1 (i) VALUES (43)`)
+	writeTS := hlc.Timestamp{WallTime: timeutil.Now().UnixNano()}
+	require.NoError(t, frontierSub.WaitForFrontier(ctx, writeTS))
+	func() {
+		seenMu.Lock()
+		defer seenMu.Unlock()
+		require.Contains(t, seenKeys, string(replicationtestutils.EncodeKV(t, tenant.Codec, t1Descr, 43).Key))
+	}()
+	cancelFrontier()
+	_ = frontierGroup.Wait()
+	require.ErrorContains(t, frontierSub.WaitForFrontier(ctx, hlc.MaxTimestamp),
+		"subscription ended before its frontier reached")
+
+	// The descriptor stream delivers the new descriptor of an altered table.
+	descSub, err := subClient.SubscribeDescriptors(ctx, streamID, 1, 1,
+		serverutils.TestTenantID(), hlc.Timestamp{WallTime: timeutil.Now().UnixNano()})
+	require.NoError(t, err)
+	descCtx, cancelDesc := context.WithCancel(ctx)
+	descGroup := ctxgroup.WithContext(descCtx)
+	descGroup.GoCtx(descSub.Subscribe)
+	tenant.SQL.Exec(t, `ALTER TABLE d.t1 ADD COLUMN c STRING`)
+	hasColumnC := func(desc *descpb.Descriptor) bool {
+		for _, col := range desc.GetTable().Columns {
+			if col.Name == "c" {
+				return true
+			}
+		}
+		return false
+	}
+	for {
+		event, ok := <-descSub.Events()
+		require.True(t, ok, "descriptor subscription ended unexpectedly: %v", descSub.Err())
+		require.Empty(t, event.GetKVs(), "descriptor stream delivered a raw KV")
+		if event.Type() != crosscluster.DescriptorEvent {
+			continue
+		}
+		update := event.GetDescriptorUpdate()
+		if update.ID != t1Descr.GetID() || update.Descriptor == nil {
+			continue
+		}
+		require.Equal(t, tenant.Codec.DescMetadataKey(uint32(update.ID)), update.KV.KeyValue.Key)
+		if hasColumnC(update.Descriptor) {
+			break
+		}
+	}
+	cancelDesc()
+	_ = descGroup.Wait()
+
+	// A range subscription delivers the changes of the range containing t1,
+	// annotated with the ID of the source cluster.
+	sourceClusterID := h.SysServer.RPCContext().LogicalClusterID.Get()
+	t1Key := replicationtestutils.EncodeKV(t, tenant.Codec, t1Descr, 44).Key
+	var rangeID roachpb.RangeID
+	var rangeStart, rangeEnd []byte
+	h.SysSQL.QueryRow(t, `SELECT range_id, start_key, end_key FROM crdb_internal.ranges_no_leases
+WHERE start_key <= $1 AND end_key > $1`, t1Key).Scan(&rangeID, &rangeStart, &rangeEnd)
+	rangeSpan := roachpb.Span{Key: rangeStart, EndKey: rangeEnd}
+	rangeSub, err := subClient.SubscribeRange(ctx, streamID, rangeID,
+		hlc.Timestamp{WallTime: timeutil.Now().UnixNano()})
+	require.NoError(t, err)
+	rangeCtx, cancelRange := context.WithCancel(ctx)
+	rangeGroup := ctxgroup.WithContext(rangeCtx)
+	rangeGroup.GoCtx(rangeSub.Subscribe)
+	tenant.SQL.Exec(t, `INSERT INTO d.t1 (i) VALUES (44)`)
+	for found := false; !found; {
+		event, ok := <-rangeSub.Events()
+		require.True(t, ok, "range subscription ended unexpectedly: %v", rangeSub.Err())
+		require.Equal(t, sourceClusterID, event.GetSourceClusterID())
+		for _, kv := range event.GetKVs() {
+			require.True(t, rangeSpan.ContainsKey(kv.KeyValue.Key),
+				"key %s outside of range span %s", kv.KeyValue.Key, rangeSpan)
+			found = found || kv.KeyValue.Key.Equal(t1Key)
+		}
+	}
+	cancelRange()
+	_ = rangeGroup.Wait()
+	_, err = subClient.SubscribeRange(ctx, streamID, roachpb.RangeID(1<<40),
+		hlc.Timestamp{WallTime: timeutil.Now().UnixNano()})
+	require.ErrorContains(t, err, "not found")
+
+	// Killing the subscription's connection marks it degraded.
+	connSub, err := subClient.Subscribe(ctx, streamID, 1, 1, encodeSpec("t1"),
+		initialScanTimestamp, nil)
+	require.NoError(t, err)
+	require.Equal(t, streamclient.ConnectionConnecting, connSub.ConnectionState().Status)
+	connGroup := ctxgroup.WithContext(ctx)
+	connGroup.GoCtx(connSub.Subscribe)
+	connGroup.Go(func() error {
+		for range connSub.Events() {
+		}
+		return nil
+	})
+	testutils.SucceedsSoon(t, func() error {
+		if state := connSub.ConnectionState(); state.Status != streamclient.ConnectionHealthy {
+			return errors.Newf("expected a healthy connection, got %s", state.Status)
+		}
+		return nil
+	})
+	require.False(t, connSub.ConnectionState().LastReceive.IsZero())
+	h.SysSQL.Exec(t, `CANCEL SESSIONS (
+SELECT session_id FROM [SHOW CLUSTER SESSIONS]
+WHERE active_queries LIKE 'SELECT * FROM crdb_internal.stream_partition%'
+)`)
+	require.Error(t, connGroup.Wait())
+	require.Equal(t, streamclient.ConnectionDegraded, connSub.ConnectionState().Status)
+
 	// Testing client.Complete()
 	err = client.Complete(ctx, streampb.StreamID(999), true)
 	require.True(t, testutils.IsError(err, "job with ID 999 does not exist"), err)
+	_, err = client.WatchProgress(ctx, streampb.StreamID(999))
+	require.True(t, testutils.IsError(err, "job with ID 999 does not exist"), err)
 
 	// Makes producer job exit quickly.
 	h.SysSQL.Exec(t, `
@@ -377,10 +709,89 @@ SET CLUSTER SETTING stream_replication.stream_liveness_track_frequency = '200ms'
 	require.NoError(t, err)
 	streamID = rps.StreamID
 	jobutils.WaitForJobToRun(t, h.SysSQL, jobspb.JobID(streamID))
+	progressCh, err := client.WatchProgress(ctx, streamID)
+	require.NoError(t, err)
 	require.NoError(t, client.Complete(ctx, streamID, true))
 	h.SysSQL.Exec(t, fmt.Sprintf(`ALTER TENANT '%s' SET REPLICATION EXPIRATION WINDOW ='100ms'`, testTenantName))
 	jobutils.WaitForJobToSucceed(t, h.SysSQL, jobspb.JobID(streamID))
 
+	// The watch ends with the job's final status.
+	var lastProgress streamclient.StreamProgress
+	for progress := range progressCh {
+		require.NoError(t, progress.Err)
+		lastProgress = progress
+	}
+	require.Equal(t, jobs.StatusSucceeded, lastProgress.Status)
+
+}
+
+func TestPartitionedStreamReplicationClientCompleteRetry(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	h, cleanup := replicationtestutils.NewReplicationHelper(t,
+		base.TestServerArgs{
+			DefaultTestTenant: base.TestControlsTenantsExplicitly,
+			Knobs: base.TestingKnobs{
+				JobsTestingKnobs: jobs.NewTestingKnobsWithShortIntervals(),
+			},
+		},
+	)
+	defer cleanup()
+
+	testTenantName := roachpb.TenantName("test-tenant")
+	_, cleanupTenant := h.CreateTenant(t, serverutils.TestTenantID(), testTenantName)
+	defer cleanupTenant()
+
+	ctx := context.Background()
+	client, err := streamclient.NewPartitionedStreamClient(ctx, h.MaybeGenerateInlineURL(t))
+	defer func() {
+		require.NoError(t, client.Close(ctx))
+	}()
+	require.NoError(t, err)
+
+	h.SysSQL.Exec(t, `
+SET CLUSTER SETTING stream_replication.stream_liveness_track_frequency = '200ms'`)
+
+	t.Run("crash-before-confirmation", func(t *testing.T) {
+		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
+		require.NoError(t, err)
+		streamID := rps.StreamID
+		jobutils.WaitForJobToRun(t, h.SysSQL, jobspb.JobID(streamID))
+
+		// The completion request reaches the producer, but the consumer crashes
+		// before it observes the result, so it completes the stream again once
+		// it restarts.
+		h.SysSQL.Exec(t, "SELECT crdb_internal.complete_replication_stream($1, $2)", streamID, true)
+		require.NoError(t, client.Complete(ctx, streamID, true))
+		// A retry that disagrees with the first request doesn't change the
+		// outcome.
+		require.NoError(t, client.Complete(ctx, streamID, false))
+
+		h.SysSQL.Exec(t, fmt.Sprintf(`ALTER TENANT '%s' SET REPLICATION EXPIRATION WINDOW ='100ms'`, testTenantName))
+		jobutils.WaitForJobToSucceed(t, h.SysSQL, jobspb.JobID(streamID))
+
+		// Completing the finished stream is still a no-op.
+		require.NoError(t, client.Complete(ctx, streamID, true))
+		jobutils.WaitForJobToSucceed(t, h.SysSQL, jobspb.JobID(streamID))
+	})
+	t.Run("complete-while-paused", func(t *testing.T) {
+		rps, err := client.CreateForTenant(ctx, testTenantName, streampb.ReplicationProducerRequest{})
+		require.NoError(t, err)
+		streamID := rps.StreamID
+		jobutils.WaitForJobToRun(t, h.SysSQL, jobspb.JobID(streamID))
+
+		// A completion issued while the producer job is paused takes effect
+		// once the job is resumed.
+		require.NoError(t, client.Pause(ctx, streamID))
+		jobutils.WaitForJobToPause(t, h.SysSQL, jobspb.JobID(streamID))
+		require.NoError(t, client.Complete(ctx, streamID, true))
+		require.NoError(t, client.Complete(ctx, streamID, true))
+
+		h.SysSQL.Exec(t, fmt.Sprintf(`ALTER TENANT '%s' SET REPLICATION EXPIRATION WINDOW ='100ms'`, testTenantName))
+		require.NoError(t, client.Resume(ctx, streamID))
+		jobutils.WaitForJobToSucceed(t, h.SysSQL, jobspb.JobID(streamID))
+	})
 }
 
 // isQueryCanceledError returns true if the error appears to be a query cancelled error.
@@ -391,3 +802,76 @@ func isQueryCanceledError(err error) bool {
 	}
 	return strings.Contains(err.Error(), cancelchecker.QueryCanceledError.Error())
 }
+
+func TestValidatePartitionSpec(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	validSpec := func() *streampb.StreamPartitionSpec {
+		return &streampb.StreamPartitionSpec{
+			Spans:           []roachpb.Span{{Key: roachpb.Key("a"), EndKey: roachpb.Key("c")}},
+			ProtocolVersion: streampb.StreamProtocolVersion,
+			Compressed:      true,
+			Config: streampb.StreamPartitionSpec_ExecutionConfig{
+				MinCheckpointFrequency: 10 * time.Millisecond,
+			},
+		}
+	}
+	require.NoError(t, streamclient.ValidatePartitionSpec(validSpec()))
+
+	for _, tc := range []struct {
+		name   string
+		modify func(spec *streampb.StreamPartitionSpec)
+		err    string
+	}{
+		{
+			name: "inverted span",
+			modify: func(spec *streampb.StreamPartitionSpec) {
+				spec.Spans = append(spec.Spans, roachpb.Span{Key: roachpb.Key("e"), EndKey: roachpb.Key("d")})
+			},
+			err: "its end key must sort after its start key",
+		},
+		{
+			name:   "point span",
+			modify: func(spec *streampb.StreamPartitionSpec) { spec.Spans[0].EndKey = nil },
+			err:    "invalid span",
+		},
+		{
+			name:   "no spans",
+			modify: func(spec *streampb.StreamPartitionSpec) { spec.Spans = nil },
+			err:    "no spans",
+		},
+		{
+			name: "negative checkpoint frequency",
+			modify: func(spec *streampb.StreamPartitionSpec) {
+				spec.Config.MinCheckpointFrequency = -time.Second
+			},
+			err: "negative min checkpoint frequency -1s",
+		},
+		{
+			name:   "negative batch size",
+			modify: func(spec *streampb.StreamPartitionSpec) { spec.Config.BatchByteSize = -1 },
+			err:    "negative batch byte size -1",
+		},
+		{
+			name: "unsupported protocol version",
+			modify: func(spec *streampb.StreamPartitionSpec) {
+				spec.ProtocolVersion = streampb.StreamProtocolVersion + 1
+			},
+			err: "unsupported protocol version",
+		},
+		{
+			name: "unsupported compression level",
+			modify: func(spec *streampb.StreamPartitionSpec) {
+				spec.CompressionLevel = streampb.MaxCompressionLevel + 1
+			},
+			err: "unsupported compression level",
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			spec := validSpec()
+			tc.modify(spec)
+			require.ErrorContains(t, streamclient.ValidatePartitionSpec(spec), tc.err)
+		})
+	}
+}
@@ -17,6 +17,8 @@ import (
 	"net/url"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/errors"
 	"github.com/jackc/pgx/v4"
 )
@@ -62,7 +64,19 @@ func setupPGXConfig(remote *url.URL, options *options) (*pgx.ConnConfig, error)
 	// threshold, so if two nodes disconnect, we eagerly replan the job with
 	// potentially new node pairings.
 	dialer := &net.Dialer{KeepAlive: time.Second * 15}
+	if options.keepAlive > 0 {
+		dialer.KeepAlive = options.keepAlive
+	}
 	config.DialFunc = dialer.DialContext
+	if timeout := options.readTimeout; timeout > 0 {
+		config.DialFunc = func(ctx context.Context, network, addr string) (net.Conn, error) {
+			conn, err := dialer.DialContext(ctx, network, addr)
+			if err != nil {
+				return nil, err
+			}
+			return &readTimeoutConn{Conn: conn, timeout: timeout}, nil
+		}
+	}
 
 	// If the user hasn't given us an application name.
 	if _, ok := config.RuntimeParams["application_name"]; !ok {
@@ -72,6 +86,61 @@ func setupPGXConfig(remote *url.URL, options *options) (*pgx.ConnConfig, error)
 	return config, nil
 }
 
+// readTimeoutConn is a net.Conn whose reads fail if they wait longer than
+// timeout for data. Read deadlines set by the conn's user, e.g. by pgconn to
+// interrupt reads when a context is canceled, take precedence if earlier.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+
+	mu struct {
+		syncutil.Mutex
+		// userDeadline is the read deadline set by the conn's user, and
+		// timeoutDeadline the one set by the last read.
+		userDeadline    time.Time
+		timeoutDeadline time.Time
+	}
+}
+
+// Read implements net.Conn.
+func (c *readTimeoutConn) Read(b []byte) (int, error) {
+	if err := func() error {
+		c.mu.Lock()
+		defer c.mu.Unlock()
+		c.mu.timeoutDeadline = timeutil.Now().Add(c.timeout)
+		return c.setReadDeadlineLocked()
+	}(); err != nil {
+		return 0, err
+	}
+	return c.Conn.Read(b)
+}
+
+// SetDeadline implements net.Conn.
+func (c *readTimeoutConn) SetDeadline(t time.Time) error {
+	if err := c.Conn.SetWriteDeadline(t); err != nil {
+		return err
+	}
+	return c.SetReadDeadline(t)
+}
+
+// SetReadDeadline implements net.Conn.
+func (c *readTimeoutConn) SetReadDeadline(t time.Time) error {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.mu.userDeadline = t
+	return c.setReadDeadlineLocked()
+}
+
+// setReadDeadlineLocked sets the earlier of the user's and the timeout's read
+// deadlines on the underlying conn.
+func (c *readTimeoutConn) setReadDeadlineLocked() error {
+	deadline := c.mu.timeoutDeadline
+	if user := c.mu.userDeadline; !user.IsZero() && (deadline.IsZero() || user.Before(deadline)) {
+		deadline = user
+	}
+	return c.Conn.SetReadDeadline(deadline)
+}
+
 type tlsCerts struct {
 	certs        []tls.Certificate
 	rootCertPool *x509.CertPool
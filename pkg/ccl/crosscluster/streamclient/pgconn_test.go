@@ -0,0 +1,117 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+//go:build linux || (arm64 && darwin)
+
+package streamclient
+
+import (
+	"context"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/sysutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/errors"
+	"github.com/stretchr/testify/require"
+)
+
+// listenIdle starts a server that accepts connections but never writes to
+// them, like a peer whose connection a middlebox has silently dropped.
+func listenIdle(t *testing.T) net.Listener {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	go func() {
+		var conns []net.Conn
+		defer func() {
+			for _, conn := range conns {
+				_ = conn.Close()
+			}
+		}()
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			conns = append(conns, conn)
+		}
+	}()
+	return ln
+}
+
+// dialWithOptions dials addr with the DialFunc of a client created with opts.
+func dialWithOptions(t *testing.T, addr string, opts ...Option) net.Conn {
+	remote, err := url.Parse("postgresql://root@" + addr + "/?sslmode=disable")
+	require.NoError(t, err)
+	config, err := setupPGXConfig(remote, processOptions(opts))
+	require.NoError(t, err)
+	conn, err := config.DialFunc(context.Background(), "tcp", addr)
+	require.NoError(t, err)
+	return conn
+}
+
+func TestConnectionKeepAlive(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ln := listenIdle(t)
+	defer ln.Close()
+
+	// Keepalive probes are sent by the kernel, so rather than watching for them
+	// we check that the connection's socket is configured to send them.
+	for _, tc := range []struct {
+		opts     []Option
+		expected time.Duration
+	}{
+		{expected: 15 * time.Second},
+		{opts: []Option{WithKeepAlive(time.Second)}, expected: time.Second},
+	} {
+		conn := dialWithOptions(t, ln.Addr().String(), tc.opts...)
+		idleTime, probeInterval, _, err := sysutil.GetKeepAliveSettings(conn.(*net.TCPConn))
+		require.NoError(t, err)
+		require.Equal(t, tc.expected, idleTime)
+		require.Equal(t, tc.expected, probeInterval)
+		require.NoError(t, conn.Close())
+	}
+}
+
+func TestConnectionReadTimeout(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ln := listenIdle(t)
+	defer ln.Close()
+
+	const timeout = 100 * time.Millisecond
+	conn := dialWithOptions(t, ln.Addr().String(), WithReadTimeout(timeout))
+	defer conn.Close()
+
+	requireTimeout := func(t *testing.T, minWait time.Duration) {
+		start := timeutil.Now()
+		_, err := conn.Read(make([]byte, 1))
+		var netErr net.Error
+		require.True(t, errors.As(err, &netErr) && netErr.Timeout(), "expected timeout, got %v", err)
+		require.GreaterOrEqual(t, timeutil.Since(start), minWait)
+	}
+
+	// A read on the dropped connection fails rather than waiting forever.
+	requireTimeout(t, timeout)
+
+	// An earlier deadline set by the conn's user, e.g. to interrupt the read
+	// when a context is canceled, takes precedence.
+	require.NoError(t, conn.SetReadDeadline(timeutil.Now()))
+	requireTimeout(t, 0)
+
+	// Clearing the user's deadline doesn't clear the timeout.
+	require.NoError(t, conn.SetDeadline(time.Time{}))
+	requireTimeout(t, timeout)
+}
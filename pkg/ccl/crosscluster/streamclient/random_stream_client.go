@@ -17,6 +17,7 @@ import (
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
@@ -261,16 +262,22 @@ func newRandomEventGenerator(
 	}, nil
 }
 
+// span returns the span of the events generated for the partition.
+func (r *randomEventGenerator) span() roachpb.Span {
+	sp := r.tableDesc.TableSpan(r.codec)
+	if r.config.startTenant {
+		sp.Key = keys.MakeTenantSpan(r.config.tenantID).Key
+	}
+	if r.config.endTenant {
+		sp.EndKey = keys.MakeTenantSpan(r.config.tenantID).EndKey
+	}
+	return sp
+}
+
 func (r *randomEventGenerator) generateNewEvent() crosscluster.Event {
 	var event crosscluster.Event
 	if r.numEventsSinceLastResolved == r.config.eventsPerCheckpoint {
-		sp := r.tableDesc.TableSpan(r.codec)
-		if r.config.startTenant {
-			sp.Key = keys.MakeTenantSpan(r.config.tenantID).Key
-		}
-		if r.config.endTenant {
-			sp.EndKey = keys.MakeTenantSpan(r.config.tenantID).EndKey
-		}
+		sp := r.span()
 		// Emit a CheckpointEvent.
 		resolvedTime := timeutil.Now()
 		hlcResolvedTime := hlc.Timestamp{WallTime: resolvedTime.UnixNano()}
@@ -581,14 +588,77 @@ func (m *RandomStreamClient) Subscribe(
 	return &randomStreamSubscription{
 		receiveFn: receiveFn,
 		eventCh:   eventCh,
+		spans:     []roachpb.Span{reg.span()},
 	}, nil
 }
 
+// SubscribeDescriptors implements the Client interface.
+func (m *RandomStreamClient) SubscribeDescriptors(
+	_ context.Context,
+	_ streampb.StreamID,
+	_, _ int32,
+	_ roachpb.TenantID,
+	_ hlc.Timestamp,
+	_ ...SubscribeOption,
+) (Subscription, error) {
+	return nil, errors.New("descriptor streams are not supported by the random stream client")
+}
+
+// SubscribeRange implements the streamclient.Client interface.
+func (m *RandomStreamClient) SubscribeRange(
+	_ context.Context, _ streampb.StreamID, _ roachpb.RangeID, _ hlc.Timestamp, _ ...SubscribeOption,
+) (Subscription, error) {
+	return nil, errors.New("range subscriptions are not supported by the random stream client")
+}
+
 // Complete implements the streamclient.Client interface.
 func (m *RandomStreamClient) Complete(_ context.Context, _ streampb.StreamID, _ bool) error {
 	return nil
 }
 
+// Pause implements the streamclient.Client interface.
+func (m *RandomStreamClient) Pause(_ context.Context, _ streampb.StreamID) error {
+	return nil
+}
+
+// Resume implements the streamclient.Client interface.
+func (m *RandomStreamClient) Resume(_ context.Context, _ streampb.StreamID) error {
+	return nil
+}
+
+// StreamHistory implements the streamclient.Client interface.
+func (m *RandomStreamClient) StreamHistory(
+	_ context.Context, _ streampb.StreamID,
+) ([]StreamStatusTransition, error) {
+	return nil, nil
+}
+
+// ProtectedTimestampRecord implements the streamclient.Client interface.
+func (m *RandomStreamClient) ProtectedTimestampRecord(
+	_ context.Context, _ streampb.StreamID,
+) (ProtectedTimestampRecord, error) {
+	return ProtectedTimestampRecord{}, nil
+}
+
+// ProtocolVersions implements the streamclient.Client interface.
+func (m *RandomStreamClient) ProtocolVersions(_ context.Context) (uint32, uint32, error) {
+	return streampb.MinStreamProtocolVersion, streampb.StreamProtocolVersion, nil
+}
+
+// SourceClusterVersion implements the streamclient.Client interface.
+func (m *RandomStreamClient) SourceClusterVersion(_ context.Context) (roachpb.Version, error) {
+	return clusterversion.Latest.Version(), nil
+}
+
+// WatchProgress implements the streamclient.Client interface.
+func (m *RandomStreamClient) WatchProgress(
+	_ context.Context, _ streampb.StreamID,
+) (<-chan StreamProgress, error) {
+	progressCh := make(chan StreamProgress)
+	close(progressCh)
+	return progressCh, nil
+}
+
 // PriorReplicationDetails implements the streamclient.Client interface.
 func (p *RandomStreamClient) PriorReplicationDetails(
 	ctx context.Context, tenant roachpb.TenantName,
@@ -600,6 +670,7 @@ func (p *RandomStreamClient) PriorReplicationDetails(
 type randomStreamSubscription struct {
 	receiveFn func(ctx context.Context) error
 	eventCh   chan crosscluster.Event
+	spans     []roachpb.Span
 }
 
 // Subscribe implements the Subscription interface.
@@ -612,11 +683,78 @@ func (r *randomStreamSubscription) Events() <-chan crosscluster.Event {
 	return r.eventCh
 }
 
+// EventsBatched implements the Subscription interface. The random stream
+// client only delivers events on Events.
+func (r *randomStreamSubscription) EventsBatched() <-chan []crosscluster.Event {
+	return nil
+}
+
+// KVEvents implements the Subscription interface. The random stream client
+// only delivers events on Events.
+func (r *randomStreamSubscription) KVEvents() <-chan crosscluster.Event {
+	return nil
+}
+
+// ResolvedEvents implements the Subscription interface. The random stream
+// client only delivers events on Events.
+func (r *randomStreamSubscription) ResolvedEvents() <-chan crosscluster.Event {
+	return nil
+}
+
 // Err implements the Subscription interface.
 func (r *randomStreamSubscription) Err() error {
 	return nil
 }
 
+// ConnectionState implements the Subscription interface. There is no
+// underlying connection, so it is always reported as healthy.
+func (r *randomStreamSubscription) ConnectionState() ConnectionState {
+	return ConnectionState{Status: ConnectionHealthy}
+}
+
+// WaitForFrontier implements the Subscription interface.
+func (r *randomStreamSubscription) WaitForFrontier(_ context.Context, _ hlc.Timestamp) error {
+	return errors.New("WaitForFrontier is not supported by the random stream client")
+}
+
+// ResolvedTSForKey implements the Subscription interface.
+func (r *randomStreamSubscription) ResolvedTSForKey(_ roachpb.Key) (hlc.Timestamp, error) {
+	return hlc.Timestamp{}, errors.New("ResolvedTSForKey is not supported by the random stream client")
+}
+
+// SetThrottle implements the Subscription interface.
+func (r *randomStreamSubscription) SetThrottle(_ float64) error {
+	return errors.New("SetThrottle is not supported by the random stream client")
+}
+
+// PauseSpan implements the Subscription interface.
+func (r *randomStreamSubscription) PauseSpan(_ roachpb.Span) error {
+	return errors.New("PauseSpan is not supported by the random stream client")
+}
+
+// ResumeSpan implements the Subscription interface.
+func (r *randomStreamSubscription) ResumeSpan(_ roachpb.Span) error {
+	return errors.New("ResumeSpan is not supported by the random stream client")
+}
+
+// Spans implements the Subscription interface.
+func (r *randomStreamSubscription) Spans() []roachpb.Span {
+	return r.spans
+}
+
+// IsCaughtUp implements the Subscription interface. The random stream client
+// doesn't track the frontier of its subscriptions, so they never report being
+// caught up.
+func (r *randomStreamSubscription) IsCaughtUp() bool {
+	return false
+}
+
+// CatchUpETA implements the Subscription interface. Like IsCaughtUp, it
+// has no frontier to estimate from.
+func (r *randomStreamSubscription) CatchUpETA() (time.Duration, bool) {
+	return 0, false
+}
+
 func rekey(tenantID roachpb.TenantID, k roachpb.Key) roachpb.Key {
 	// Strip old prefix.
 	tenantPrefix := keys.MakeTenantPrefix(tenantID)
@@ -0,0 +1,130 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package streamclient
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/span"
+)
+
+// Sink is an external destination, such as a Kafka topic or cloud storage, to
+// which the events of a Subscription are exported by ExportToSink.
+type Sink interface {
+	// Write writes events to the sink, in the order they were received. They
+	// need not be durable until the next Flush.
+	Write(ctx context.Context, events []crosscluster.Event) error
+
+	// Flush makes every event written so far durable. It is called whenever a
+	// checkpoint is received, after all the events preceding the checkpoint
+	// have been written, with the resulting frontier of the subscription:
+	// once Flush returns, the sink holds every change to the subscription's
+	// spans up to frontier.
+	Flush(ctx context.Context, frontier hlc.Timestamp) error
+}
+
+// ExportToSink writes the events received by sub, which covers spans, to sink
+// until the subscription ends, and flushes the sink at each checkpoint.
+// Checkpoints themselves are not written to the sink. It returns the error, if
+// any, that ended the subscription.
+func ExportToSink(ctx context.Context, sub Subscription, spans []roachpb.Span, sink Sink) error {
+	frontier, err := span.MakeFrontier(spans...)
+	if err != nil {
+		return err
+	}
+	defer frontier.Release()
+
+	pending := make([]crosscluster.Event, 0, maxEventBatchSize)
+	write := func() error {
+		if len(pending) == 0 {
+			return nil
+		}
+		if err := sink.Write(ctx, pending); err != nil {
+			return err
+		}
+		// The sink may retain the written slice, so don't reuse it.
+		pending = make([]crosscluster.Event, 0, maxEventBatchSize)
+		return nil
+	}
+	consume := func(event crosscluster.Event) error {
+		if event.Type() != crosscluster.CheckpointEvent {
+			pending = append(pending, event)
+			if len(pending) >= maxEventBatchSize {
+				return write()
+			}
+			return nil
+		}
+		if err := write(); err != nil {
+			return err
+		}
+		for _, rs := range event.GetResolvedSpans() {
+			if _, err := frontier.Forward(rs.Span, rs.Timestamp); err != nil {
+				return err
+			}
+		}
+		return sink.Flush(ctx, frontier.Frontier())
+	}
+
+	events, batches := sub.Events(), sub.EventsBatched()
+	if batches != nil {
+		// Events are only delivered on one of the channels, so only wait on
+		// that one for the subscription to end.
+		events = nil
+	}
+	// KV events and checkpoints may be delivered on channels of their own,
+	// which are closed before Events.
+	kvs, resolved := sub.KVEvents(), sub.ResolvedEvents()
+	for {
+		select {
+		case event, ok := <-kvs:
+			if !ok {
+				kvs = nil
+				continue
+			}
+			if err := consume(event); err != nil {
+				return err
+			}
+		case event, ok := <-resolved:
+			if !ok {
+				resolved = nil
+				continue
+			}
+			if err := consume(event); err != nil {
+				return err
+			}
+		case event, ok := <-events:
+			if !ok {
+				if err := write(); err != nil {
+					return err
+				}
+				return sub.Err()
+			}
+			if err := consume(event); err != nil {
+				return err
+			}
+		case batch, ok := <-batches:
+			if !ok {
+				if err := write(); err != nil {
+					return err
+				}
+				return sub.Err()
+			}
+			for _, event := range batch {
+				if err := consume(event); err != nil {
+					return err
+				}
+			}
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+	}
+}
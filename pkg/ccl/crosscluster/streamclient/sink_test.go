@@ -0,0 +1,97 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Licensed as a CockroachDB Enterprise file under the Cockroach Community
+// License (the "License"); you may not use this file except in compliance with
+// the License. You may obtain a copy of the License at
+//
+//     https://github.com/cockroachdb/cockroach/blob/master/licenses/CCL.txt
+
+package streamclient
+
+import (
+	"context"
+	"testing"
+
+	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
+	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/stretchr/testify/require"
+)
+
+// memSink is an in-memory Sink that records, for each flush, the events
+// written before it.
+type memSink struct {
+	unflushed []crosscluster.Event
+	flushes   []memFlush
+}
+
+type memFlush struct {
+	events   []crosscluster.Event
+	frontier hlc.Timestamp
+}
+
+var _ Sink = (*memSink)(nil)
+
+// Write implements the Sink interface.
+func (s *memSink) Write(_ context.Context, events []crosscluster.Event) error {
+	s.unflushed = append(s.unflushed, events...)
+	return nil
+}
+
+// Flush implements the Sink interface.
+func (s *memSink) Flush(_ context.Context, frontier hlc.Timestamp) error {
+	s.flushes = append(s.flushes, memFlush{events: s.unflushed, frontier: frontier})
+	s.unflushed = nil
+	return nil
+}
+
+func TestExportToSink(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	spanAB := roachpb.Span{Key: roachpb.Key("a"), EndKey: roachpb.Key("b")}
+	spanBC := roachpb.Span{Key: roachpb.Key("b"), EndKey: roachpb.Key("c")}
+	kv := func(key string, wallTime int64) crosscluster.Event {
+		return crosscluster.MakeKVEventFromKVs([]roachpb.KeyValue{{
+			Key:   roachpb.Key(key),
+			Value: roachpb.Value{Timestamp: hlc.Timestamp{WallTime: wallTime}},
+		}})
+	}
+	checkpoint := func(sp roachpb.Span, wallTime int64) crosscluster.Event {
+		return crosscluster.MakeCheckpointEvent([]jobspb.ResolvedSpan{
+			{Span: sp, Timestamp: hlc.Timestamp{WallTime: wallTime}},
+		})
+	}
+
+	events := []crosscluster.Event{
+		kv("a1", 1),
+		kv("b1", 2),
+		checkpoint(spanAB, 5),
+		kv("b2", 6),
+		checkpoint(spanBC, 7),
+		checkpoint(spanAB, 10),
+		kv("a2", 11),
+	}
+	eventsCh := make(chan crosscluster.Event, len(events))
+	for _, ev := range events {
+		eventsCh <- ev
+	}
+	close(eventsCh)
+
+	sink := &memSink{}
+	sub := &mockSubscription{eventsCh: eventsCh}
+	require.NoError(t, ExportToSink(context.Background(), sub, []roachpb.Span{spanAB, spanBC}, sink))
+
+	// The sink is flushed at each checkpoint, once the events before it have
+	// been written, with the frontier over both spans.
+	require.Equal(t, []memFlush{
+		{events: events[0:2], frontier: hlc.Timestamp{}},
+		{events: events[3:4], frontier: hlc.Timestamp{WallTime: 5}},
+		{frontier: hlc.Timestamp{WallTime: 7}},
+	}, sink.flushes)
+	// Events after the last checkpoint are written but not flushed.
+	require.Equal(t, events[6:], sink.unflushed)
+}
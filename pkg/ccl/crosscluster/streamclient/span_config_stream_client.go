@@ -11,12 +11,15 @@ package streamclient
 import (
 	"context"
 	"net/url"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/ccl/crosscluster"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/sql/isql"
 	"github.com/cockroachdb/cockroach/pkg/sql/pgwire/pgcode"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/errors"
 	"github.com/jackc/pgconn"
@@ -122,16 +125,27 @@ type spanConfigStreamSubscription struct {
 	tenantName    roachpb.TenantName
 	// Channel to send signal to close the subscription.
 	closeChan chan struct{}
+	conn      connectionStateTracker
+	// frontier learns the span config span from the first checkpoint.
+	frontier frontierTracker
+	throttle feedThrottle
 }
 
 var _ Subscription = (*spanConfigStreamSubscription)(nil)
 
 // Subscribe implements the Subscription interface.
-func (p *spanConfigStreamSubscription) Subscribe(ctx context.Context) error {
+func (p *spanConfigStreamSubscription) Subscribe(ctx context.Context) (retErr error) {
 	ctx, sp := tracing.ChildSpan(ctx, "spanConfigStreamSubscription.Subscribe")
 	defer sp.Finish()
 
 	defer close(p.eventsChan)
+	defer p.frontier.finish()
+	p.conn.connecting()
+	defer func() {
+		if retErr != nil {
+			p.conn.failed()
+		}
+	}()
 	srcConn, err := pgx.ConnectConfig(ctx, p.srcConnConfig)
 	if err != nil {
 		return err
@@ -174,7 +188,13 @@ func (p *spanConfigStreamSubscription) Subscribe(ctx context.Context) error {
 		rows.Close()
 	}()
 
-	p.err = subscribeInternal(ctx, rows, p.eventsChan, p.closeChan, false)
+	p.err = subscribeInternal(ctx, rows, feedOptions{
+		eventCh:  p.eventsChan,
+		closeCh:  p.closeChan,
+		conn:     &p.conn,
+		frontier: &p.frontier,
+		throttle: &p.throttle,
+	})
 	return p.err
 }
 
@@ -183,7 +203,74 @@ func (p *spanConfigStreamSubscription) Events() <-chan crosscluster.Event {
 	return p.eventsChan
 }
 
+// EventsBatched implements the Subscription interface. Span config events
+// are always delivered one at a time.
+func (p *spanConfigStreamSubscription) EventsBatched() <-chan []crosscluster.Event {
+	return nil
+}
+
+// KVEvents implements the Subscription interface. Span config events are
+// only delivered on Events.
+func (p *spanConfigStreamSubscription) KVEvents() <-chan crosscluster.Event {
+	return nil
+}
+
+// ResolvedEvents implements the Subscription interface. Span config events
+// are only delivered on Events.
+func (p *spanConfigStreamSubscription) ResolvedEvents() <-chan crosscluster.Event {
+	return nil
+}
+
 // Err implements the Subscription interface.
 func (p *spanConfigStreamSubscription) Err() error {
 	return p.err
 }
+
+// ConnectionState implements the Subscription interface.
+func (p *spanConfigStreamSubscription) ConnectionState() ConnectionState {
+	return p.conn.get()
+}
+
+// WaitForFrontier implements the Subscription interface.
+func (p *spanConfigStreamSubscription) WaitForFrontier(
+	ctx context.Context, ts hlc.Timestamp,
+) error {
+	return p.frontier.wait(ctx, ts)
+}
+
+// ResolvedTSForKey implements the Subscription interface.
+func (p *spanConfigStreamSubscription) ResolvedTSForKey(key roachpb.Key) (hlc.Timestamp, error) {
+	return p.frontier.resolvedForKey(key)
+}
+
+// SetThrottle implements the Subscription interface.
+func (p *spanConfigStreamSubscription) SetThrottle(factor float64) error {
+	return p.throttle.set(factor)
+}
+
+// PauseSpan implements the Subscription interface.
+func (p *spanConfigStreamSubscription) PauseSpan(_ roachpb.Span) error {
+	return errors.New("PauseSpan is not supported by span config subscriptions")
+}
+
+// ResumeSpan implements the Subscription interface.
+func (p *spanConfigStreamSubscription) ResumeSpan(_ roachpb.Span) error {
+	return errors.New("ResumeSpan is not supported by span config subscriptions")
+}
+
+// Spans implements the Subscription interface. The span config span is only
+// known once the first checkpoint has been delivered, so it returns nil until
+// then.
+func (p *spanConfigStreamSubscription) Spans() []roachpb.Span {
+	return p.frontier.spans()
+}
+
+// IsCaughtUp implements the Subscription interface.
+func (p *spanConfigStreamSubscription) IsCaughtUp() bool {
+	return p.frontier.caughtUp(timeutil.Now(), defaultCaughtUpThreshold)
+}
+
+// CatchUpETA implements the Subscription interface.
+func (p *spanConfigStreamSubscription) CatchUpETA() (time.Duration, bool) {
+	return p.frontier.catchUpETA(timeutil.Now(), defaultCaughtUpThreshold)
+}
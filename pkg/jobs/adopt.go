@@ -511,7 +511,7 @@ const pauseAndCancelUpdate = `
 					last_run = NULL
     WHERE (status IN ('` + string(StatusPauseRequested) + `', '` + string(StatusCancelRequested) + `'))
       AND ((claim_session_id = $1) AND (claim_instance_id = $2))
-RETURNING id, status
+RETURNING id, status, job_type
 `
 
 func (r *Registry) servePauseAndCancelRequests(ctx context.Context, s sqlliveness.Session) error {
@@ -580,6 +580,15 @@ func (r *Registry) servePauseAndCancelRequests(ctx context.Context, s sqllivenes
 			default:
 				return errors.AssertionFailedf("unexpected job status %s: %v", statusString, job)
 			}
+			if typeString, ok := row[2].(*tree.DString); ok {
+				if typ, err := jobspb.TypeFromString(string(*typeString)); err == nil && recordsStatusHistory(typ) {
+					if err := InfoStorageForJob(txn, id).writeStatusTransition(
+						ctx, Status(statusString), r.clock.Now().GoTime(),
+					); err != nil {
+						return errors.Wrapf(err, "job %d: could not record status transition", id)
+					}
+				}
+			}
 		}
 		return nil
 	})
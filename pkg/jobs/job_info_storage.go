@@ -13,6 +13,10 @@ package jobs
 import (
 	"bytes"
 	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/jobs/jobspb"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
@@ -21,6 +25,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/sql/sessiondata"
 	"github.com/cockroachdb/cockroach/pkg/sql/sqlliveness"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/errors"
 )
@@ -335,6 +340,41 @@ const (
 	LegacyProgressKey = "legacy_progress"
 )
 
+// statusHistoryKeyPrefix is the info_key prefix under which the status
+// transitions of jobs for which recordsStatusHistory is true are recorded. Each
+// record's key is suffixed with the time of the transition, which orders it
+// after all earlier transitions, and its value is the status the job
+// transitioned to.
+const statusHistoryKeyPrefix = "~status-history/"
+
+// recordsStatusHistory returns whether the status transitions of jobs of the
+// given type are recorded, so that they can be inspected after the job has
+// terminated.
+func recordsStatusHistory(typ jobspb.Type) bool {
+	return typ == jobspb.TypeReplicationStreamProducer
+}
+
+// writeStatusTransition records that the job transitioned to status at the
+// given time.
+func (i InfoStorage) writeStatusTransition(ctx context.Context, status Status, now time.Time) error {
+	infoKey := fmt.Sprintf("%s%020d", statusHistoryKeyPrefix, now.UnixNano())
+	return i.write(ctx, infoKey, []byte(status))
+}
+
+// IterateStatusHistory calls fn on the recorded status transitions of the job,
+// oldest first. Transitions are only recorded for some job types.
+func (i InfoStorage) IterateStatusHistory(
+	ctx context.Context, fn func(status Status, at time.Time) error,
+) error {
+	return i.Iterate(ctx, statusHistoryKeyPrefix, func(infoKey string, value []byte) error {
+		nanos, err := strconv.ParseInt(strings.TrimPrefix(infoKey, statusHistoryKeyPrefix), 10, 64)
+		if err != nil {
+			return errors.Wrapf(err, "decoding status transition key %q", infoKey)
+		}
+		return fn(Status(value), timeutil.Unix(0, nanos))
+	})
+}
+
 // GetLegacyPayloadKey returns the info_key whose value is the jobspb.Payload of
 // the job.
 func GetLegacyPayloadKey() string {
@@ -262,6 +262,11 @@ WHERE id = $1
 			return err
 		}
 	}
+	if ju.md.Status != "" && ju.md.Status != md.Status && recordsStatusHistory(md.Payload.Type()) {
+		if err := infoStorage.writeStatusTransition(ctx, ju.md.Status, u.now()); err != nil {
+			return err
+		}
+	}
 
 	return nil
 }
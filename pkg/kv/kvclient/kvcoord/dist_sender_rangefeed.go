@@ -69,6 +69,7 @@ type rangeFeedConfig struct {
 	withFiltering         bool
 	withMetadata          bool
 	withMatchingOriginIDs []uint32
+	maxStaleness          time.Duration
 	rangeObserver         func(ForEachRangeFn)
 
 	knobs struct {
@@ -127,6 +128,16 @@ func WithMatchingOriginIDs(originIDs ...uint32) RangeFeedOption {
 	})
 }
 
+// WithMaxStaleness asks the servers of the rangefeed to keep its resolved
+// timestamps within maxStaleness of the current time, pushing the transactions
+// that hold them back more aggressively if needed. The bound is best-effort,
+// as resolved timestamps can't pass the closed timestamps of the ranges.
+func WithMaxStaleness(maxStaleness time.Duration) RangeFeedOption {
+	return optionFunc(func(c *rangeFeedConfig) {
+		c.maxStaleness = maxStaleness
+	})
+}
+
 // WithRangeObserver is called when the rangefeed starts with a function that
 // can be used to iterate over all the ranges.
 func WithRangeObserver(observer func(ForEachRangeFn)) RangeFeedOption {
@@ -666,6 +677,7 @@ func makeRangeFeedRequest(
 	withDiff bool,
 	withFiltering bool,
 	withMatchingOriginIDs []uint32,
+	maxStaleness time.Duration,
 ) kvpb.RangeFeedRequest {
 	admissionPri := admissionpb.BulkNormalPri
 	if isSystemRange {
@@ -680,6 +692,7 @@ func makeRangeFeedRequest(
 		WithDiff:              withDiff,
 		WithFiltering:         withFiltering,
 		WithMatchingOriginIDs: withMatchingOriginIDs,
+		MaxStaleness:          maxStaleness,
 		AdmissionHeader: kvpb.AdmissionHeader{
 			// NB: AdmissionHeader is used only at the start of the range feed
 			// stream since the initial catch-up scan is expensive.
@@ -44,6 +44,7 @@ type config struct {
 	withDiff              bool
 	withFiltering         bool
 	withMatchingOriginIDs []uint32
+	maxStaleness          time.Duration
 	onUnrecoverableError  OnUnrecoverableError
 	onCheckpoint          OnCheckpoint
 	frontierQuantize      time.Duration
@@ -164,6 +165,15 @@ func WithOriginIDsMatching(originIDs ...uint32) Option {
 	})
 }
 
+// WithMaxStaleness makes an option to ask the servers of the rangefeed to keep
+// its resolved timestamps within maxStaleness of the current time, pushing the
+// transactions that hold them back more aggressively if needed.
+func WithMaxStaleness(maxStaleness time.Duration) Option {
+	return optionFunc(func(c *config) {
+		c.maxStaleness = maxStaleness
+	})
+}
+
 // WithInvoker makes an option to invoke the rangefeed tasks such as running the
 // the client and processing events emitted by the client with a caller-supplied
 // function, which can make it easier to introspect into work done by a given
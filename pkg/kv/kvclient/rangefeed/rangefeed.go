@@ -351,6 +351,9 @@ func (f *RangeFeed) run(ctx context.Context, frontier span.Frontier, resumeWithF
 	if len(f.withMatchingOriginIDs) != 0 {
 		rangefeedOpts = append(rangefeedOpts, kvcoord.WithMatchingOriginIDs(f.withMatchingOriginIDs...))
 	}
+	if f.maxStaleness > 0 {
+		rangefeedOpts = append(rangefeedOpts, kvcoord.WithMaxStaleness(f.maxStaleness))
+	}
 	if f.onMetadata != nil {
 		rangefeedOpts = append(rangefeedOpts, kvcoord.WithMetadata())
 	}
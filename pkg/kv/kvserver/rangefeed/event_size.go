@@ -243,6 +243,8 @@ func (e *event) String() string {
 		return "event: initrts"
 	case e.sst != nil:
 		return "event: sst"
+	case e.initScanSlice != nil:
+		return "event: initscanslice"
 	case e.sync != nil:
 		return "event: sync"
 	default:
@@ -280,6 +282,9 @@ func MemUsage(e event) int64 {
 	case e.sync != nil:
 		// For sync event, no rangefeed events will be published.
 		return eventOverhead + syncEventOverhead
+	case e.initScanSlice != nil:
+		// For initScanSlice event, no rangefeed events will be published.
+		return eventOverhead
 	default:
 		log.Fatalf(context.Background(), "missing event variant: %+v", e)
 	}
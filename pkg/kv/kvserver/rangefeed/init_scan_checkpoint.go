@@ -0,0 +1,145 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package rangefeed
+
+import (
+	"context"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+)
+
+// defaultInitScanCheckpointInterval is the default number of intents found by
+// the initial resolved timestamp scan between checkpoints.
+const defaultInitScanCheckpointInterval = 1000
+
+// InitScanCheckpoint records the progress of an initial resolved timestamp
+// scan.
+type InitScanCheckpoint struct {
+	// ResumeKey is the key from which the scan resumes. All intents on keys
+	// before it are summarized in Txns.
+	ResumeKey roachpb.Key
+	// Txns summarizes the intents found before ResumeKey by transaction, in the
+	// order that the transactions were first encountered.
+	Txns []InitScanCheckpointTxn
+}
+
+// InitScanCheckpointTxn summarizes the intents of a single transaction found
+// by an initial resolved timestamp scan.
+type InitScanCheckpointTxn struct {
+	// Op is the write intent op of the transaction's intent with the highest
+	// timestamp.
+	Op enginepb.MVCCWriteIntentOp
+	// Count is the number of the transaction's intents that were found.
+	Count int
+}
+
+// InitScanCheckpointStore durably stores the checkpoint of a Processor's
+// initial resolved timestamp scan.
+//
+// A checkpoint is only valid against the lock table it was taken from. An
+// intent that is resolved after it is checkpointed will keep being tracked
+// after a resume, so implementations must discard checkpoints that may have
+// gone stale, e.g. because the replica applied commands in the meantime.
+type InitScanCheckpointStore interface {
+	// Load returns the stored checkpoint, if there is one.
+	Load(ctx context.Context) (_ InitScanCheckpoint, ok bool, _ error)
+	// Save replaces the stored checkpoint.
+	Save(ctx context.Context, cp InitScanCheckpoint) error
+	// Clear removes the stored checkpoint once the scan has completed.
+	Clear(ctx context.Context) error
+}
+
+// initScanCheckpointer tracks the progress of an initial resolved timestamp
+// scan and periodically saves it to an InitScanCheckpointStore.
+type initScanCheckpointer struct {
+	store InitScanCheckpointStore
+	every int
+
+	cp InitScanCheckpoint
+	// txns indexes cp.Txns by transaction ID.
+	txns map[uuid.UUID]int
+	// pending is the number of intents found since the last checkpoint.
+	pending int
+}
+
+func newInitScanCheckpointer(store InitScanCheckpointStore, every int) *initScanCheckpointer {
+	return &initScanCheckpointer{
+		store: store,
+		every: every,
+		txns:  make(map[uuid.UUID]int),
+	}
+}
+
+// resume loads the stored checkpoint, if any, passes the intents it summarizes
+// to consumer, and returns the key within span from which the scan should
+// resume. A checkpoint that doesn't fall within span is ignored.
+func (c *initScanCheckpointer) resume(
+	ctx context.Context, span roachpb.Span, consumer eventConsumer,
+) (roachpb.Key, error) {
+	cp, ok, err := c.store.Load(ctx)
+	if err != nil || !ok {
+		return span.Key, err
+	}
+	if !span.ContainsKey(cp.ResumeKey) {
+		log.Warningf(ctx, "ignoring initial scan checkpoint at %s outside of %s", cp.ResumeKey, span)
+		return span.Key, nil
+	}
+	log.VEventf(ctx, 1, "resuming initial scan at %s with %d txns", cp.ResumeKey, len(cp.Txns))
+	for _, txn := range cp.Txns {
+		c.track(txn.Op, txn.Count)
+		for i := 0; i < txn.Count; i++ {
+			consumer(txn.Op)
+		}
+	}
+	return cp.ResumeKey, nil
+}
+
+// track adds n intents of the op's transaction to the checkpoint.
+func (c *initScanCheckpointer) track(op enginepb.MVCCWriteIntentOp, n int) {
+	i, ok := c.txns[op.TxnID]
+	if !ok {
+		c.txns[op.TxnID] = len(c.cp.Txns)
+		c.cp.Txns = append(c.cp.Txns, InitScanCheckpointTxn{Op: op, Count: n})
+		return
+	}
+	txn := &c.cp.Txns[i]
+	if txn.Op.Timestamp.Less(op.Timestamp) {
+		txn.Op = op
+	}
+	txn.Count += n
+}
+
+// afterIntent records that the scan found an intent on key, and saves a
+// checkpoint if enough intents were found since the last one.
+func (c *initScanCheckpointer) afterIntent(
+	ctx context.Context, key roachpb.Key, op enginepb.MVCCWriteIntentOp,
+) error {
+	c.track(op, 1)
+	c.pending++
+	if c.pending < c.every {
+		return nil
+	}
+	c.pending = 0
+	c.cp.ResumeKey = key.Next()
+	// The store may retain the checkpoint, so hand it a copy of the summary,
+	// which keeps being updated.
+	cp := c.cp
+	cp.Txns = append([]InitScanCheckpointTxn(nil), c.cp.Txns...)
+	return c.store.Save(ctx, cp)
+}
+
+// done clears the stored checkpoint once the scan has completed.
+func (c *initScanCheckpointer) done(ctx context.Context) error {
+	return c.store.Clear(ctx)
+}
@@ -0,0 +1,60 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package rangefeed
+
+import (
+	"context"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+)
+
+// initScanSlicer splits an initial resolved timestamp scan into slices that
+// each find a bounded number of bytes worth of intents, see
+// Config.InitScanSliceBytes.
+type initScanSlicer struct {
+	maxBytes int64
+	pause    time.Duration
+
+	// bytes is the size of the intents found by the current slice.
+	bytes int64
+}
+
+// afterIntent records that the current slice found an intent on key, and
+// returns whether the slice has exhausted its budget.
+func (s *initScanSlicer) afterIntent(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+	s.bytes += int64(len(key) + op.Size())
+	return s.bytes >= s.maxBytes
+}
+
+// endSlice ends the current slice. It informs p that the scan is partial and
+// resumes at resumeKey, and waits out the pause before the next slice starts.
+func (s *initScanSlicer) endSlice(
+	ctx context.Context, p processorTaskHelper, resumeKey roachpb.Key,
+) error {
+	s.bytes = 0
+	p.sendEvent(ctx, event{initScanSlice: &initScanSliceEvent{resumeKey: resumeKey}}, 0)
+	if s.pause <= 0 {
+		return ctx.Err()
+	}
+	var timer timeutil.Timer
+	defer timer.Stop()
+	timer.Reset(s.pause)
+	select {
+	case <-timer.C:
+		timer.Read = true
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
@@ -0,0 +1,93 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package rangefeed
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+)
+
+// initScanSummaryVerbosity is the verbosity level at which the initial
+// resolved timestamp scan logs its summary.
+const initScanSummaryVerbosity = 2
+
+// initScanSummary summarizes an initial resolved timestamp scan. It is logged
+// as a single JSON object once the scan completes, for consumption by log
+// analytics.
+type initScanSummary struct {
+	Span          string `json:"span"`
+	Scanner       string `json:"scanner"`
+	FellBack      bool   `json:"fell_back,omitempty"`
+	DurationNanos int64  `json:"duration_nanos"`
+	// KeysScanned is the number of keys visited by the scanners that count
+	// them, see keyCountingIntentScanner.
+	KeysScanned  int64  `json:"keys_scanned"`
+	IntentsFound int64  `json:"intents_found"`
+	MinIntentTS  string `json:"min_intent_ts,omitempty"`
+	MaxIntentTS  string `json:"max_intent_ts,omitempty"`
+	Error        string `json:"error,omitempty"`
+
+	minTS, maxTS hlc.Timestamp
+}
+
+// keyCountingIntentScanner is optionally implemented by an IntentScanner that
+// counts the keys it visits.
+type keyCountingIntentScanner interface {
+	// keysScanned returns the number of keys visited so far.
+	keysScanned() int64
+}
+
+// intentScannerName returns the name of the scanner's implementation.
+func intentScannerName(is IntentScanner) string {
+	switch s := is.(type) {
+	case *SeparatedIntentScanner:
+		if s.pooled {
+			return PooledSeparatedIntentScannerKind.String()
+		}
+		return SeparatedIntentScannerKind.String()
+	case *LegacyIntentScanner:
+		return "legacy"
+	default:
+		return fmt.Sprintf("%T", is)
+	}
+}
+
+// recordIntent adds an intent found by the scan to the summary.
+func (s *initScanSummary) recordIntent(op enginepb.MVCCWriteIntentOp) {
+	s.IntentsFound++
+	if s.minTS.IsEmpty() || op.Timestamp.Less(s.minTS) {
+		s.minTS = op.Timestamp
+	}
+	s.maxTS.Forward(op.Timestamp)
+}
+
+// log logs the summary of a scan that took duration and finished with err.
+func (s *initScanSummary) log(ctx context.Context, duration time.Duration, err error) {
+	s.DurationNanos = duration.Nanoseconds()
+	if !s.minTS.IsEmpty() {
+		s.MinIntentTS, s.MaxIntentTS = s.minTS.String(), s.maxTS.String()
+	}
+	if err != nil {
+		s.Error = err.Error()
+	}
+	data, jsonErr := json.Marshal(s)
+	if jsonErr != nil {
+		log.Warningf(ctx, "unable to encode initial resolved timestamp scan summary: %v", jsonErr)
+		return
+	}
+	log.Infof(ctx, "initial resolved timestamp scan summary: %s", data)
+}
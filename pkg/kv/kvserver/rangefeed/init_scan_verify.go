@@ -0,0 +1,114 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package rangefeed
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
+	"github.com/cockroachdb/errors"
+)
+
+// IntentInconsistency describes an intent whose metadata doesn't match the
+// versions of its key in the MVCC keyspace, which indicates corruption.
+type IntentInconsistency struct {
+	// Key is the key of the intent.
+	Key roachpb.Key
+	// IntentTS is the timestamp of the provisional value that the intent's
+	// metadata refers to.
+	IntentTS hlc.Timestamp
+	// ValueTS is the timestamp of the newest version of Key, or empty if Key
+	// has no versions.
+	ValueTS hlc.Timestamp
+}
+
+func (i IntentInconsistency) String() string {
+	if i.IntentTS.Less(i.ValueTS) {
+		return fmt.Sprintf("value of key %s at %s is newer than its intent's provisional value at %s",
+			i.Key, i.ValueTS, i.IntentTS)
+	}
+	return fmt.Sprintf("intent on key %s has no provisional value at %s", i.Key, i.IntentTS)
+}
+
+type intentInconsistencyConsumer func(IntentInconsistency)
+
+// IntentVerifier is optionally implemented by an IntentScanner that is able to
+// cross-check the intents it finds against the MVCC keyspace.
+type IntentVerifier interface {
+	// VerifyIntents calls report on every intent found on keys between
+	// startKey and endKey whose provisional value isn't the newest version of
+	// its key. Either the provisional value is missing, which leaves the
+	// intent's metadata orphaned, or a newer value exists, which is a
+	// provisional value whose metadata was lost.
+	//
+	// A provisional value that lost its metadata is indistinguishable from a
+	// committed value unless there is still an intent on its key, so such
+	// values can't be detected in general.
+	VerifyIntents(ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, report intentInconsistencyConsumer) error
+}
+
+// InterleavedIntentDetector is optionally implemented by an IntentScanner that
+// only finds separated intents, i.e. those in the lock table, to detect the
+// intents it skips because they are interleaved in the MVCC keyspace instead.
+type InterleavedIntentDetector interface {
+	// ConsumeInterleavedIntents calls consumer with every intent on keys between
+	// startKey and endKey that is stored as an unversioned metadata key in the
+	// MVCC keyspace. Iteration stops if consumer returns false.
+	ConsumeInterleavedIntents(ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer keyedEventConsumer) error
+}
+
+// initScanVerifier reports the inconsistencies found by verifying the intents
+// of an initial resolved timestamp scan.
+type initScanVerifier struct {
+	metrics *Metrics
+	// intents is set if the scan's intents are cross-checked against the MVCC
+	// keyspace, see IntentVerifier.
+	intents bool
+	// interleaved is set if the scan looks for interleaved intents that it
+	// skipped, see InterleavedIntentDetector.
+	interleaved bool
+}
+
+// verify runs the checks the verifier is configured for over the keys between
+// startKey and endKey using is, if it implements them, logging and counting
+// every problem found. Problems don't fail the scan.
+func (v *initScanVerifier) verify(
+	ctx context.Context, is IntentScanner, startKey, endKey roachpb.Key,
+) error {
+	if iv, ok := is.(IntentVerifier); ok && v.intents {
+		if err := iv.VerifyIntents(ctx, startKey, endKey, func(inc IntentInconsistency) {
+			log.Errorf(ctx, "initial resolved timestamp scan found inconsistent intent: %s", inc)
+			if v.metrics != nil {
+				v.metrics.RangeFeedInitScanInconsistencies.Inc(1)
+			}
+		}); err != nil {
+			return errors.Wrap(err, "verifying intents")
+		}
+	}
+	if d, ok := is.(InterleavedIntentDetector); ok && v.interleaved {
+		if err := d.ConsumeInterleavedIntents(ctx, startKey, endKey,
+			func(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+				log.Warningf(ctx, "initial resolved timestamp scan skipped interleaved intent "+
+					"on key %s of txn %s at %s", key, op.TxnID, op.Timestamp)
+				if v.metrics != nil {
+					v.metrics.RangeFeedInitScanInterleavedIntents.Inc(1)
+				}
+				return true
+			}); err != nil {
+			return errors.Wrap(err, "detecting interleaved intents")
+		}
+	}
+	return nil
+}
@@ -14,6 +14,7 @@ import (
 	"fmt"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/base"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/metric"
 )
@@ -37,12 +38,36 @@ var (
 		Measurement: "Events",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaRangeFeedInitScanInconsistencies = metric.Metadata{
+		Name:        "kv.rangefeed.init_scan_intent_inconsistencies",
+		Help:        "Number of inconsistent intents found by verifying RangeFeed initial resolved timestamp scans",
+		Measurement: "Intents",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaRangeFeedInitScanInterleavedIntents = metric.Metadata{
+		Name:        "kv.rangefeed.init_scan_interleaved_intents",
+		Help:        "Number of interleaved intents found and skipped by strict RangeFeed initial resolved timestamp scans",
+		Measurement: "Intents",
+		Unit:        metric.Unit_COUNT,
+	}
+	metaRangeFeedPushTxnsMissingLockSpans = metric.Metadata{
+		Name:        "kv.rangefeed.push_txns_missing_lock_spans",
+		Help:        "Number of finalized transactions found by RangeFeed txn pushes whose intents could not be resolved because they had no lock spans",
+		Measurement: "Transactions",
+		Unit:        metric.Unit_COUNT,
+	}
 	metaRangeFeedRegistrations = metric.Metadata{
 		Name:        "kv.rangefeed.registrations",
 		Help:        "Number of active RangeFeed registrations",
 		Measurement: "Registrations",
 		Unit:        metric.Unit_COUNT,
 	}
+	metaRangeFeedResolvedTSLag = metric.Metadata{
+		Name:        "kv.rangefeed.resolved_timestamp_lag",
+		Help:        "Lag of RangeFeed resolved timestamps behind the current time, recorded whenever a resolved timestamp advances",
+		Measurement: "Latency",
+		Unit:        metric.Unit_NANOSECONDS,
+	}
 	metaRangeFeedProcessorsGO = metric.Metadata{
 		Name:        "kv.rangefeed.processors_goroutine",
 		Help:        "Number of active RangeFeed processors using goroutines",
@@ -75,7 +100,17 @@ type Metrics struct {
 	RangeFeedBudgetExhausted         *metric.Counter
 	RangeFeedBudgetBlocked           *metric.Counter
 	RangeFeedRegistrations           *metric.Gauge
-	RangeFeedSlowClosedTimestampLogN log.EveryN
+	RangeFeedInitScanInconsistencies *metric.Counter
+	// RangeFeedInitScanInterleavedIntents counts the interleaved intents
+	// reported by strict initial resolved timestamp scans, see
+	// Config.StrictSeparatedIntents.
+	RangeFeedInitScanInterleavedIntents *metric.Counter
+	// RangeFeedPushTxnsMissingLockSpans counts the committed and aborted
+	// transactions found by push attempts that had no LockSpans, so their
+	// intents couldn't be resolved by the push attempt and linger until they
+	// are cleaned up by GC or by conflicting requests.
+	RangeFeedPushTxnsMissingLockSpans *metric.Counter
+	RangeFeedSlowClosedTimestampLogN  log.EveryN
 	// RangeFeedSlowClosedTimestampNudgeSem bounds the amount of work that can be
 	// spun up on behalf of the RangeFeed nudger. We don't expect to hit this
 	// limit, but it's here to limit the effect on stability in case something
@@ -86,6 +121,10 @@ type Metrics struct {
 	// is removed.
 	RangeFeedProcessorsGO        *metric.Gauge
 	RangeFeedProcessorsScheduler *metric.Gauge
+	// RangeFeedResolvedTSLag records how far behind the current time each
+	// resolved timestamp that a processor advances to is, to expose the
+	// distribution of resolved timestamp staleness.
+	RangeFeedResolvedTSLag metric.IHistogram
 }
 
 // MetricStruct implements the metric.Struct interface.
@@ -98,10 +137,19 @@ func NewMetrics() *Metrics {
 		RangeFeedBudgetExhausted:             metric.NewCounter(metaRangeFeedExhausted),
 		RangeFeedBudgetBlocked:               metric.NewCounter(metaRangeFeedBudgetBlocked),
 		RangeFeedRegistrations:               metric.NewGauge(metaRangeFeedRegistrations),
+		RangeFeedInitScanInconsistencies:     metric.NewCounter(metaRangeFeedInitScanInconsistencies),
+		RangeFeedInitScanInterleavedIntents:  metric.NewCounter(metaRangeFeedInitScanInterleavedIntents),
+		RangeFeedPushTxnsMissingLockSpans:    metric.NewCounter(metaRangeFeedPushTxnsMissingLockSpans),
 		RangeFeedSlowClosedTimestampLogN:     log.Every(5 * time.Second),
 		RangeFeedSlowClosedTimestampNudgeSem: make(chan struct{}, 1024),
 		RangeFeedProcessorsGO:                metric.NewGauge(metaRangeFeedProcessorsGO),
 		RangeFeedProcessorsScheduler:         metric.NewGauge(metaRangeFeedProcessorsScheduler),
+		RangeFeedResolvedTSLag: metric.NewHistogram(metric.HistogramOptions{
+			Mode:         metric.HistogramModePreferHdrLatency,
+			Metadata:     metaRangeFeedResolvedTSLag,
+			Duration:     base.DefaultHistogramWindowInterval(),
+			BucketConfig: metric.LongRunning60mLatencyBuckets,
+		}),
 	}
 }
 
@@ -14,6 +14,7 @@ import (
 	"context"
 	"fmt"
 	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
@@ -26,6 +27,9 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 )
 
@@ -93,6 +97,70 @@ type Config struct {
 	// PushTxnsAge specifies the age at which a Processor will begin to consider
 	// a transaction old enough to push.
 	PushTxnsAge time.Duration
+	// PushLead is added to the current clock time to compute the timestamp that
+	// old transactions are pushed to. A positive lead pushes transactions
+	// further into the future, which lets the resolved timestamp run ahead of
+	// the push and reduces how often long-running transactions need to be
+	// re-pushed, at the cost of forcing them to commit at higher timestamps.
+	// A negative lead pushes less aggressively. Defaults to zero.
+	PushLead time.Duration
+	// SkipPushPriority, if non-zero, exempts transactions with at least this
+	// priority from being pushed. Their intents are left untouched, so the
+	// resolved timestamp stays pinned behind them until they finish on their
+	// own.
+	SkipPushPriority enginepb.TxnPriority
+	// SkipPushMaxAge, if positive, bounds the exemption granted by
+	// SkipPushPriority: once a transaction's intents are older than this, it
+	// is pushed like any other, so that a legitimately long-running
+	// transaction isn't pushed until it is truly stale, yet can't hold the
+	// resolved timestamp back indefinitely.
+	SkipPushMaxAge time.Duration
+	// SkipPushTxns, if set, is a deny-list of transactions that are never
+	// pushed or aborted, e.g. to protect a known long-running migration. Like
+	// those exempted by SkipPushPriority, their intents are left untouched and
+	// the resolved timestamp stays pinned behind them, but regardless of their
+	// age.
+	SkipPushTxns map[uuid.UUID]struct{}
+	// PushGracePeriod, if positive, exempts transactions from being pushed
+	// until this long after the Processor first observed one of their
+	// intents, to give transactions that are about to commit a chance to do so
+	// before they are pushed. Unlike PushTxnsAge, it is measured from when the
+	// intent was observed rather than from when it was written, so it also
+	// protects transactions with old intents that the Processor only just
+	// found, e.g. in its initial resolved timestamp scan.
+	PushGracePeriod time.Duration
+	// MaxResolveIntentsBytes, if positive, bounds the total size of the intent
+	// resolution requests that a push attempt has outstanding at once, to
+	// avoid memory spikes when cleaning up transactions with many lock spans.
+	// Intents are then resolved in batches of at most this size, each issued
+	// once enough of the earlier ones have completed. If zero, a push attempt
+	// resolves all of its intents in a single request.
+	MaxResolveIntentsBytes int64
+	// CommittedIntentScanner, if set, lets push attempts find and resolve the
+	// intents of committed transactions whose LockSpans are missing, e.g.
+	// because their record was partially GC'd. Otherwise, such intents are left
+	// for others to resolve, and pin the resolved timestamp until they are.
+	// Each attempt that finds such a transaction scans the Processor's range
+	// with a new scanner, which must be a KeyedIntentScanner. If the
+	// constructor fails to create one, it returns nil and the attempt fails.
+	CommittedIntentScanner IntentScannerConstructor
+	// MaxLockSpansPerTxn, if positive, caps the number of lock spans of each
+	// finalized transaction that a push attempt resolves, so that cleaning up
+	// a transaction with an enormous number of lock spans, e.g. that of a bulk
+	// job, doesn't stall the range. The remaining lock spans are deferred to
+	// the following push attempts, which resume where the previous one left
+	// off, as the transaction's intents keep holding back the resolved
+	// timestamp until then. If zero, all lock spans are resolved at once.
+	MaxLockSpansPerTxn int
+	// PushOpOrder orders the MVCCUpdateIntentOps and MVCCAbortTxnOps in the
+	// event that a push attempt emits for the transactions it pushed. By
+	// default, they are in the order in which the transactions were pushed.
+	PushOpOrder PushOpOrder
+
+	// ResolvedTSLagTarget is the lag behind the current clock time that the
+	// resolved timestamp is expected to stay within, typically the closed
+	// timestamp target duration. It is only used to compute LagBudget.
+	ResolvedTSLagTarget time.Duration
 
 	// EventChanCap specifies the capacity to give to the Processor's input
 	// channel.
@@ -117,6 +185,59 @@ type Config struct {
 	// for low-volume system ranges, since the worker pool is small (default 2).
 	// Only has an effect when Scheduler is used.
 	Priority bool
+
+	// EmitInlineValues instructs the initial resolved timestamp scan to emit
+	// inline (non-MVCC) values in the Processor's key range as value events.
+	// Inline values have no timestamp, so they are emitted at the time the
+	// scan is started. This is only useful for consumers of system ranges that
+	// store inline values, e.g. node liveness records.
+	EmitInlineValues bool
+
+	// InitScanCheckpointStore, if set, is used to periodically checkpoint the
+	// progress of the initial resolved timestamp scan, so that a scan that is
+	// interrupted by a restart can resume from its last checkpoint rather than
+	// from the start of the range. It requires a KeyedIntentScanner.
+	InitScanCheckpointStore InitScanCheckpointStore
+	// InitScanCheckpointInterval is the number of intents found by the initial
+	// resolved timestamp scan between checkpoints. Only used if
+	// InitScanCheckpointStore is set.
+	InitScanCheckpointInterval int
+
+	// InitScanSliceBytes, if positive, bounds the size of the intents that the
+	// initial resolved timestamp scan finds in one go, to bound the latency
+	// impact of scanning a range with many intents. Once a slice of the scan
+	// exhausts it, the scan informs the Processor that it is partial, pauses
+	// for InitScanSlicePause, and continues with a new slice after the last
+	// intent found. It requires a KeyedIntentScanner.
+	InitScanSliceBytes int64
+	// InitScanSlicePause is the pause between the slices of the initial
+	// resolved timestamp scan. Only used if InitScanSliceBytes is set.
+	InitScanSlicePause time.Duration
+
+	// VerifyInitScanIntents instructs the initial resolved timestamp scan to
+	// cross-check the intents it finds against the MVCC keyspace, if the
+	// IntentScanner is also an IntentVerifier. Intents whose provisional value
+	// is missing or isn't the newest version of their key indicate corruption,
+	// and are logged and counted in Metrics without failing the scan.
+	VerifyInitScanIntents bool
+	// StrictSeparatedIntents instructs the initial resolved timestamp scan to
+	// report the intents it skips because they are interleaved in the MVCC
+	// keyspace rather than separated into the lock table, if the IntentScanner
+	// is an InterleavedIntentDetector. Such intents are only expected from data
+	// written before intents were separated. They are logged for manual
+	// follow-up and counted in Metrics, without failing the scan.
+	StrictSeparatedIntents bool
+
+	// IntentScannerFactory, if set, is called in place of the
+	// IntentScannerConstructor passed to Start to obtain the IntentScanner for
+	// the initial resolved timestamp scan, even if Start was given none. It
+	// lets tests inject faulty or slow scanners without reconstructing the
+	// engine underneath them.
+	IntentScannerFactory IntentScannerConstructor
+
+	// scannerKind is the IntentScanner implementation selected by NewProcessor
+	// for the initial resolved timestamp scan.
+	scannerKind IntentScannerKind
 }
 
 // SetDefaults initializes unset fields in Config to values
@@ -139,6 +260,211 @@ func (sc *Config) SetDefaults() {
 			sc.PushTxnsAge = defaultPushTxnsAge
 		}
 	}
+	if sc.InitScanCheckpointStore != nil && sc.InitScanCheckpointInterval == 0 {
+		sc.InitScanCheckpointInterval = defaultInitScanCheckpointInterval
+	}
+}
+
+// initScanInlineTS returns the timestamp at which the initial resolved
+// timestamp scan should emit inline values, or an empty timestamp if inline
+// values should not be emitted.
+func (sc *Config) initScanInlineTS() hlc.Timestamp {
+	if !sc.EmitInlineValues {
+		return hlc.Timestamp{}
+	}
+	return sc.Clock.Now()
+}
+
+// intentScannerConstructor returns the constructor of the IntentScanner for
+// the initial resolved timestamp scan, given the one passed to Start.
+func (sc *Config) intentScannerConstructor(
+	newRtsIter IntentScannerConstructor,
+) IntentScannerConstructor {
+	if sc.IntentScannerFactory != nil {
+		return sc.IntentScannerFactory
+	}
+	return newRtsIter
+}
+
+// initScanCheckpointer returns the checkpointer to use for the initial
+// resolved timestamp scan, or nil if the scan isn't checkpointed.
+func (sc *Config) initScanCheckpointer() *initScanCheckpointer {
+	if sc.InitScanCheckpointStore == nil {
+		return nil
+	}
+	return newInitScanCheckpointer(sc.InitScanCheckpointStore, sc.InitScanCheckpointInterval)
+}
+
+// initScanSlicer returns the slicer to use for the initial resolved timestamp
+// scan, or nil if the scan runs to completion in one go.
+func (sc *Config) initScanSlicer() *initScanSlicer {
+	if sc.InitScanSliceBytes <= 0 {
+		return nil
+	}
+	return &initScanSlicer{maxBytes: sc.InitScanSliceBytes, pause: sc.InitScanSlicePause}
+}
+
+// initScanVerifier returns the verifier to use for the initial resolved
+// timestamp scan, or nil if the scan's intents aren't verified.
+func (sc *Config) initScanVerifier() *initScanVerifier {
+	if !sc.VerifyInitScanIntents && !sc.StrictSeparatedIntents {
+		return nil
+	}
+	return &initScanVerifier{
+		metrics:     sc.Metrics,
+		intents:     sc.VerifyInitScanIntents,
+		interleaved: sc.StrictSeparatedIntents,
+	}
+}
+
+// initScanOptions returns the options of the initial resolved timestamp scan.
+func (sc *Config) initScanOptions() initScanOptions {
+	return initScanOptions{
+		inlineTS:     sc.initScanInlineTS(),
+		checkpointer: sc.initScanCheckpointer(),
+		slicer:       sc.initScanSlicer(),
+		verifier:     sc.initScanVerifier(),
+	}
+}
+
+// txnPushAttemptOptions returns the options of a push attempt, which defers
+// lock spans to lockSpans.
+func (sc *Config) txnPushAttemptOptions(lockSpans *lockSpanCursor) txnPushAttemptOptions {
+	return txnPushAttemptOptions{
+		skipPriority:     sc.SkipPushPriority,
+		skipMaxAge:       sc.SkipPushMaxAge,
+		maxResolveBytes:  sc.MaxResolveIntentsBytes,
+		metrics:          sc.Metrics,
+		committedScanner: sc.CommittedIntentScanner,
+		lockSpans:        lockSpans,
+		opOrder:          sc.PushOpOrder,
+	}
+}
+
+// recordResolvedTSAdvance records how far the resolved timestamp that the
+// Processor just advanced to lags behind the current time.
+func (sc *Config) recordResolvedTSAdvance(resolvedTS hlc.Timestamp) {
+	lag := sc.Clock.PhysicalNow() - resolvedTS.WallTime
+	if lag < 0 {
+		lag = 0
+	}
+	sc.Metrics.RangeFeedResolvedTSLag.RecordValue(lag)
+}
+
+// lagBudget returns how far the given resolved timestamp wall time is ahead of
+// the current clock time minus the ResolvedTSLagTarget. The budget is negative
+// if the resolved timestamp has fallen behind the target.
+func (sc *Config) lagBudget(resolvedWallTime int64) time.Duration {
+	target := sc.Clock.Now().WallTime - sc.ResolvedTSLagTarget.Nanoseconds()
+	return time.Duration(resolvedWallTime - target)
+}
+
+// processorStatus is the part of a processor's state that is published by its
+// event loop for other goroutines to read without synchronizing with it. It is
+// shared by both processor implementations.
+type processorStatus struct {
+	// resolvedWallTime is the wall time of the resolved timestamp as of the
+	// last published checkpoint.
+	resolvedWallTime atomic.Int64
+	// lastPushTick is the clock time, in nanoseconds, at which a push attempt
+	// was last due, or at which the processor started if none was yet.
+	lastPushTick atomic.Int64
+}
+
+// publishResolvedTS records the resolved timestamp of a published checkpoint.
+func (s *processorStatus) publishResolvedTS(ts hlc.Timestamp) {
+	s.resolvedWallTime.Store(ts.WallTime)
+}
+
+// publishPushTick records that a push attempt was due at the given clock time,
+// whether or not one was launched.
+func (s *processorStatus) publishPushTick(now time.Time) {
+	s.lastPushTick.Store(now.UnixNano())
+}
+
+// nextPushTime returns the clock time at which the next push attempt is due,
+// given the clock time in nanoseconds at which the last one was. It is zero if
+// no attempts are scheduled.
+func (sc *Config) nextPushTime(lastPushTick int64) time.Time {
+	if sc.PushTxnsInterval <= 0 {
+		return time.Time{}
+	}
+	return timeutil.Unix(0, lastPushTick).Add(sc.PushTxnsInterval)
+}
+
+// txnsToPush returns the TxnMetas of the given old transactions that should be
+// pushed at physical time now, skipping those on the SkipPushTxns deny-list
+// and those that are still within their PushGracePeriod.
+func (sc *Config) txnsToPush(oldTxns []*unresolvedTxn, now time.Time) []enginepb.TxnMeta {
+	toPush := make([]enginepb.TxnMeta, 0, len(oldTxns))
+	for _, txn := range oldTxns {
+		if _, ok := sc.SkipPushTxns[txn.txnID]; ok {
+			continue
+		}
+		if sc.PushGracePeriod > 0 && now.Sub(txn.observedAt) < sc.PushGracePeriod {
+			continue
+		}
+		toPush = append(toPush, txn.asTxnMeta())
+	}
+	return toPush
+}
+
+// makeResolvedTS returns the resolvedTimestamp of a new Processor. Its queue of
+// unresolved intents only records when transactions are observed if there is
+// a PushGracePeriod to measure from it.
+func (sc *Config) makeResolvedTS() resolvedTimestamp {
+	rts := makeResolvedTimestamp(sc.Settings)
+	if sc.PushGracePeriod > 0 {
+		rts.intentQ.clock = sc.Clock
+	}
+	return rts
+}
+
+// pushTxnsTS returns the timestamp that transactions should be pushed to,
+// given the current clock time.
+func (sc *Config) pushTxnsTS(now hlc.Timestamp) hlc.Timestamp {
+	return now.Add(sc.PushLead.Nanoseconds(), 0)
+}
+
+// stalenessBounds tracks the bounds on the staleness of a Processor's resolved
+// timestamp that are in effect, see Processor.BoundStaleness. It is safe for
+// concurrent use.
+type stalenessBounds struct {
+	mu struct {
+		syncutil.Mutex
+		nextID int64
+		bounds map[int64]time.Duration
+	}
+}
+
+// add puts a bound into effect until the returned function is called.
+func (s *stalenessBounds) add(maxStaleness time.Duration) (release func()) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.mu.bounds == nil {
+		s.mu.bounds = make(map[int64]time.Duration)
+	}
+	id := s.mu.nextID
+	s.mu.nextID++
+	s.mu.bounds[id] = maxStaleness
+	return func() {
+		s.mu.Lock()
+		defer s.mu.Unlock()
+		delete(s.mu.bounds, id)
+	}
+}
+
+// pushTxnsAge returns the age at which transactions are old enough to be
+// pushed, which is the configured age unless a tighter bound is in effect.
+// A transaction older than the bound holds the resolved timestamp back past
+// it, so it can't wait until it reaches the configured age.
+func (s *stalenessBounds) pushTxnsAge(age time.Duration) time.Duration {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	for _, bound := range s.mu.bounds {
+		age = min(age, bound)
+	}
+	return age
 }
 
 // Processor manages a set of rangefeed registrations and handles the routing of
@@ -220,6 +546,41 @@ type Processor interface {
 	Filter() *Filter
 	// Len returns the number of registrations attached to the processor.
 	Len() int
+	// LagBudget returns the headroom the processor's resolved timestamp has
+	// before it falls further behind the current time than the configured
+	// ResolvedTSLagTarget. The result is negative if the resolved timestamp is
+	// already behind the target. Until the resolved timestamp is initialized,
+	// the budget is computed against the zero timestamp. It does not
+	// synchronize with the processor's event loop.
+	LagBudget() time.Duration
+	// IntentScannerKind returns the IntentScanner implementation selected for
+	// the processor's initial resolved timestamp scan. The constructor passed
+	// to Start is expected to create scanners of this kind, see
+	// NewIntentScanner.
+	IntentScannerKind() IntentScannerKind
+	// CurrentPushInterval returns the interval at which the processor
+	// schedules push attempts, or zero if it doesn't push transactions.
+	CurrentPushInterval() time.Duration
+	// NextPushTime returns the clock time at which the processor's next push
+	// attempt is due, for diagnostics. An attempt that is due may still be
+	// skipped, e.g. if pushes are disabled or one is already in flight. It is
+	// zero if the processor doesn't push transactions.
+	NextPushTime() time.Time
+	// BoundStaleness requires the processor to keep its resolved timestamp
+	// within maxStaleness of the current time until release is called, e.g. on
+	// behalf of a registration with a staleness SLO. While the bound is in
+	// effect, push attempts push the transactions older than the tightest bound
+	// rather than only those older than PushTxnsAge. The bound is best-effort:
+	// the resolved timestamp still can't pass the closed timestamp, and
+	// transactions are only pushed every PushTxnsInterval, unless exempted.
+	BoundStaleness(maxStaleness time.Duration) (release func())
+	// CancelPushes cancels the push attempt in flight, if any, along with any
+	// push that is pending behind it, and waits for the attempt to unwind. It
+	// lets a controlled shutdown or lease transfer stop pushing promptly rather
+	// than wait for the attempt to finish resolving intents. The wait is bounded
+	// by ctx, whose error is returned if it is done first. An error is also
+	// returned if the processor is stopped.
+	CancelPushes(ctx context.Context) error
 
 	// Data flow.
 
@@ -227,6 +588,10 @@ type Processor interface {
 	// operations. It returns false if consuming the operations hit a timeout, as
 	// specified by the EventChanTimeout configuration. If the method returns false,
 	// the processor will have been stopped, so calling Stop is not necessary.
+	//
+	// MVCCWriteIntentOps for intents written after the initial resolved
+	// timestamp scan hold back the resolved timestamp as soon as they are
+	// consumed, without waiting for their transactions to be pushed.
 	ConsumeLogicalOps(ctx context.Context, ops ...enginepb.MVCCLogicalOp) bool
 	// ConsumeSSTable informs the rangefeed processor of an SSTable that was added
 	// via AddSSTable. It returns false if consuming the SSTable hit a timeout, as
@@ -255,6 +620,9 @@ type Processor interface {
 func NewProcessor(cfg Config) Processor {
 	cfg.SetDefaults()
 	cfg.AmbientContext.AddLogTag("rangefeed", nil)
+	cfg.scannerKind = selectIntentScannerKind(cfg.Settings)
+	log.VInfof(cfg.AmbientContext.AnnotateCtx(context.Background()), 1,
+		"r%d rangefeed processor using %s intent scanner", cfg.RangeID, cfg.scannerKind)
 	if cfg.Scheduler != nil {
 		return NewScheduledProcessor(cfg)
 	}
@@ -263,8 +631,12 @@ func NewProcessor(cfg Config) Processor {
 
 type LegacyProcessor struct {
 	Config
-	reg registry
-	rts resolvedTimestamp
+	reg    registry
+	rts    resolvedTimestamp
+	status processorStatus
+	// lockSpans tracks the lock spans deferred by push attempts, see
+	// Config.MaxLockSpansPerTxn. It is nil if they aren't capped.
+	lockSpans *lockSpanCursor
 
 	regC       chan registration
 	unregC     chan *registration
@@ -272,10 +644,15 @@ type LegacyProcessor struct {
 	lenResC    chan int
 	filterReqC chan struct{}
 	filterResC chan *Filter
+	cancelReqC chan struct{}
+	cancelResC chan chan struct{}
 	eventC     chan *event
 	spanErrC   chan spanErr
 	stopC      chan *kvpb.Error
 	stoppedC   chan struct{}
+	// staleness holds the bounds on the staleness of the resolved timestamp
+	// that are in effect, see BoundStaleness.
+	staleness stalenessBounds
 }
 
 var eventSyncPool = sync.Pool{
@@ -305,6 +682,9 @@ type event struct {
 	initRTS initRTSEvent
 	sst     *sstEvent
 	sync    *syncEvent
+	// initScanSlice marks the end of a slice of a partial initial resolved
+	// timestamp scan.
+	initScanSlice *initScanSliceEvent
 	// Budget allocated to process the event.
 	alloc *SharedBudgetAllocation
 }
@@ -317,6 +697,11 @@ type ctEvent struct {
 
 type initRTSEvent bool
 
+type initScanSliceEvent struct {
+	// resumeKey is the key at which the next slice of the scan resumes.
+	resumeKey roachpb.Key
+}
+
 type sstEvent struct {
 	data []byte
 	span roachpb.Span
@@ -347,9 +732,10 @@ type logicalOpMetadata struct {
 
 func NewLegacyProcessor(cfg Config) *LegacyProcessor {
 	p := &LegacyProcessor{
-		Config: cfg,
-		reg:    makeRegistry(cfg.Metrics),
-		rts:    makeResolvedTimestamp(cfg.Settings),
+		Config:    cfg,
+		reg:       makeRegistry(cfg.Metrics),
+		rts:       cfg.makeResolvedTS(),
+		lockSpans: newLockSpanCursor(cfg.MaxLockSpansPerTxn),
 
 		regC:       make(chan registration),
 		unregC:     make(chan *registration),
@@ -357,6 +743,8 @@ func NewLegacyProcessor(cfg Config) *LegacyProcessor {
 		lenResC:    make(chan int),
 		filterReqC: make(chan struct{}),
 		filterResC: make(chan *Filter),
+		cancelReqC: make(chan struct{}),
+		cancelResC: make(chan chan struct{}),
 		eventC:     make(chan *event, cfg.EventChanCap),
 		spanErrC:   make(chan spanErr),
 		stopC:      make(chan *kvpb.Error, 1),
@@ -410,9 +798,10 @@ func (p *LegacyProcessor) run(
 
 	// Launch an async task to scan over the resolved timestamp iterator and
 	// initialize the unresolvedIntentQueue. Ignore error if quiescing.
+	rtsIterFunc = p.intentScannerConstructor(rtsIterFunc)
 	if rtsIterFunc != nil {
 		rtsIter := rtsIterFunc()
-		initScan := newInitResolvedTSScan(p.Span, p, rtsIter)
+		initScan := newInitResolvedTSScan(p.Span, p, rtsIter, p.initScanOptions())
 		err := stopper.RunAsyncTask(ctx, "rangefeed: init resolved ts", initScan.Run)
 		if err != nil {
 			initScan.Cancel()
@@ -427,11 +816,55 @@ func (p *LegacyProcessor) run(
 	var txnPushTicker *time.Ticker
 	var txnPushTickerC <-chan time.Time
 	var txnPushAttemptC chan struct{}
+	// txnPushCancel cancels the context of the push attempt in flight. It is
+	// nil unless txnPushAttemptC is.
+	var txnPushCancel func()
+	p.status.publishPushTick(p.Clock.PhysicalTime())
 	if p.PushTxnsInterval > 0 {
 		txnPushTicker = time.NewTicker(p.PushTxnsInterval)
 		txnPushTickerC = txnPushTicker.C
 		defer txnPushTicker.Stop()
 	}
+	// txnPushPending is set if the ticker fired while a push attempt was in
+	// flight. Rather than racing the in-flight attempt, such pushes are
+	// coalesced into a single push that starts once it completes.
+	var txnPushPending bool
+	pushOldTxns := func() {
+		// Don't perform transaction push attempts if disabled, until the resolved
+		// timestamp has been initialized, or if we're not tracking any intents.
+		if !PushTxnsEnabled.Get(&p.Settings.SV) || !p.rts.IsInit() || p.rts.intentQ.Len() == 0 {
+			return
+		}
+
+		now := p.Clock.Now()
+		before := now.Add(-p.staleness.pushTxnsAge(p.PushTxnsAge).Nanoseconds(), 0)
+		oldTxns := p.rts.intentQ.Before(before)
+
+		if toPush := p.txnsToPush(oldTxns, p.Clock.PhysicalTime()); len(toPush) > 0 {
+			// Create a push attempt response channel that is closed when the
+			// push attempt completes.
+			attemptC := make(chan struct{})
+			txnPushAttemptC = attemptC
+			attemptCtx, cancel := context.WithCancel(ctx)
+			txnPushCancel = cancel
+
+			// Launch an async transaction push attempt that pushes the
+			// timestamp of all transactions beneath the push offset.
+			// Ignore error if quiescing.
+			pushTxns := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, p, toPush, p.pushTxnsTS(now), func() {
+				close(attemptC)
+			}, p.txnPushAttemptOptions(p.lockSpans))
+			err := stopper.RunAsyncTask(attemptCtx, "rangefeed: pushing old txns", pushTxns.Run)
+			if err != nil {
+				pushTxns.Cancel()
+			}
+		}
+	}
+	defer func() {
+		if txnPushCancel != nil {
+			txnPushCancel()
+		}
+	}()
 
 	for {
 		select {
@@ -498,46 +931,35 @@ func (p *LegacyProcessor) run(
 
 		// Check whether any unresolved intents need a push.
 		case <-txnPushTickerC:
-			// Don't perform transaction push attempts if disabled, until the resolved
-			// timestamp has been initialized, or if we're not tracking any intents.
-			if !PushTxnsEnabled.Get(&p.Settings.SV) || !p.rts.IsInit() || p.rts.intentQ.Len() == 0 {
+			p.status.publishPushTick(p.Clock.PhysicalTime())
+			if txnPushAttemptC != nil {
+				// Don't launch a second concurrent push.
+				txnPushPending = true
 				continue
 			}
-
-			now := p.Clock.Now()
-			before := now.Add(-p.PushTxnsAge.Nanoseconds(), 0)
-			oldTxns := p.rts.intentQ.Before(before)
-
-			if len(oldTxns) > 0 {
-				toPush := make([]enginepb.TxnMeta, len(oldTxns))
-				for i, txn := range oldTxns {
-					toPush[i] = txn.asTxnMeta()
-				}
-
-				// Set the ticker channel to nil so that it can't trigger a
-				// second concurrent push. Create a push attempt response
-				// channel that is closed when the push attempt completes.
-				txnPushTickerC = nil
-				txnPushAttemptC = make(chan struct{})
-
-				// Launch an async transaction push attempt that pushes the
-				// timestamp of all transactions beneath the push offset.
-				// Ignore error if quiescing.
-				pushTxns := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, p, toPush, now, func() {
-					close(txnPushAttemptC)
-				})
-				err := stopper.RunAsyncTask(ctx, "rangefeed: pushing old txns", pushTxns.Run)
-				if err != nil {
-					pushTxns.Cancel()
-				}
+			pushOldTxns()
+
+		// Cancel the push attempt in flight and any pending push, and respond
+		// with the channel that is closed once the attempt unwinds.
+		case <-p.cancelReqC:
+			txnPushPending = false
+			if txnPushCancel != nil {
+				txnPushCancel()
 			}
+			p.cancelResC <- txnPushAttemptC
 
 		// Update the resolved timestamp based on the push attempt.
 		case <-txnPushAttemptC:
-			// Reset the ticker channel so that it can trigger push attempts
-			// again. Set the push attempt channel back to nil.
-			txnPushTickerC = txnPushTicker.C
+			// Set the push attempt channel back to nil, and run any push that was
+			// requested in the meantime. It covers all transactions that became
+			// old while the attempt was in flight.
 			txnPushAttemptC = nil
+			txnPushCancel()
+			txnPushCancel = nil
+			if txnPushPending {
+				txnPushPending = false
+				pushOldTxns()
+			}
 
 		// Close registrations and exit when signaled.
 		case pErr := <-p.stopC:
@@ -628,6 +1050,63 @@ func (p *LegacyProcessor) Len() int {
 	}
 }
 
+// LagBudget implements Processor interface.
+func (p *LegacyProcessor) LagBudget() time.Duration {
+	return p.lagBudget(p.status.resolvedWallTime.Load())
+}
+
+// IntentScannerKind implements Processor interface.
+func (p *LegacyProcessor) IntentScannerKind() IntentScannerKind {
+	return p.scannerKind
+}
+
+// CurrentPushInterval implements Processor interface.
+func (p *LegacyProcessor) CurrentPushInterval() time.Duration {
+	return p.PushTxnsInterval
+}
+
+// NextPushTime implements Processor interface.
+func (p *LegacyProcessor) NextPushTime() time.Time {
+	return p.nextPushTime(p.status.lastPushTick.Load())
+}
+
+// BoundStaleness implements Processor interface.
+func (p *LegacyProcessor) BoundStaleness(maxStaleness time.Duration) (release func()) {
+	return p.staleness.add(maxStaleness)
+}
+
+// CancelPushes implements Processor interface.
+func (p *LegacyProcessor) CancelPushes(ctx context.Context) error {
+	var attemptC chan struct{}
+	// Ask the processor goroutine.
+	select {
+	case p.cancelReqC <- struct{}{}:
+		// Wait for response.
+		attemptC = <-p.cancelResC
+	case <-p.stoppedC:
+		return errors.New("rangefeed processor stopped")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+	return waitForPushAttempt(ctx, attemptC, p.stoppedC)
+}
+
+// waitForPushAttempt waits for the push attempt that closes attemptC to
+// complete. A nil attemptC means that no attempt was in flight.
+func waitForPushAttempt(ctx context.Context, attemptC, stoppedC chan struct{}) error {
+	if attemptC == nil {
+		return nil
+	}
+	select {
+	case <-attemptC:
+		return nil
+	case <-stoppedC:
+		return errors.New("rangefeed processor stopped")
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
 // Filter implements Processor interface.
 func (p *LegacyProcessor) Filter() *Filter {
 	// Ask the processor goroutine.
@@ -802,6 +1281,8 @@ func (p *LegacyProcessor) consumeEvent(ctx context.Context, e *event) {
 		p.initResolvedTS(ctx)
 	case e.sst != nil:
 		p.consumeSSTable(ctx, e.sst.data, e.sst.span, e.sst.ts, e.alloc)
+	case e.initScanSlice != nil:
+		log.VEventf(ctx, 2, "initial resolved timestamp scan paused before %s", e.initScanSlice.resumeKey)
 	case e.sync != nil:
 		if e.sync.testRegCatchupSpan != nil {
 			if err := p.reg.waitForCaughtUp(ctx, *e.sync.testRegCatchupSpan); err != nil {
@@ -958,6 +1439,8 @@ func (p *LegacyProcessor) publishCheckpoint(ctx context.Context) {
 	// TODO(nvanbenschoten): persist resolvedTimestamp. Give Processor a client.DB.
 	// TODO(nvanbenschoten): rate limit these? send them periodically?
 
+	p.status.publishResolvedTS(p.rts.Get())
+	p.recordResolvedTSAdvance(p.rts.Get())
 	event := p.newCheckpointEvent()
 	p.reg.PublishToOverlapping(ctx, all, event, logicalOpMetadata{}, nil)
 }
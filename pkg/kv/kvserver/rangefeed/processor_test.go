@@ -36,6 +36,8 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/mon"
 	"github.com/cockroachdb/cockroach/pkg/util/stop"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 	"github.com/stretchr/testify/assert"
@@ -312,6 +314,12 @@ func withRtsScanner(scanner IntentScanner) option {
 	}
 }
 
+func withIntentScannerFactory(factory IntentScannerConstructor) option {
+	return func(config *testConfig) {
+		config.IntentScannerFactory = factory
+	}
+}
+
 func withChanTimeout(d time.Duration) option {
 	return func(config *testConfig) {
 		config.EventChanTimeout = d
@@ -349,6 +357,51 @@ func withPushTxnsIntervalAge(interval, age time.Duration) option {
 	}
 }
 
+func withPushLead(lead time.Duration) option {
+	return func(config *testConfig) {
+		config.PushLead = lead
+	}
+}
+
+func withSkipPushPriority(pri enginepb.TxnPriority) option {
+	return func(config *testConfig) {
+		config.SkipPushPriority = pri
+	}
+}
+
+func withSkipPushMaxAge(age time.Duration) option {
+	return func(config *testConfig) {
+		config.SkipPushMaxAge = age
+	}
+}
+
+func withSkipPushTxns(txnIDs ...uuid.UUID) option {
+	return func(config *testConfig) {
+		config.SkipPushTxns = make(map[uuid.UUID]struct{}, len(txnIDs))
+		for _, txnID := range txnIDs {
+			config.SkipPushTxns[txnID] = struct{}{}
+		}
+	}
+}
+
+func withPushGracePeriod(grace time.Duration) option {
+	return func(config *testConfig) {
+		config.PushGracePeriod = grace
+	}
+}
+
+func withClock(clock *hlc.Clock) option {
+	return func(config *testConfig) {
+		config.Clock = clock
+	}
+}
+
+func withResolvedTSLagTarget(target time.Duration) option {
+	return func(config *testConfig) {
+		config.ResolvedTSLagTarget = target
+	}
+}
+
 // blockingScanner is a test intent scanner that allows test to track lifecycle
 // of tasks.
 //  1. it will always block on startup and will wait for block to be closed to
@@ -1167,6 +1220,69 @@ func TestProcessorInitializeResolvedTimestamp(t *testing.T) {
 	})
 }
 
+// TestProcessorIntentScannerFactory tests that a Processor obtains the scanner
+// for its initial resolved timestamp scan from the configured factory, and
+// that a scan blocked in it holds back the resolved timestamp until it
+// proceeds or is canceled.
+func TestProcessorIntentScannerFactory(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		txn := makeTxn("txn", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+		data := []storeOp{
+			{kv: makeKV("a", "val1", 10)},
+			{kv: makeProvisionalKV("c", "txnKey", 15), txn: &txn},
+		}
+		// newProcessor starts a Processor whose factory returns a blocking
+		// scanner over data.
+		newProcessor := func(t *testing.T) (*blockingScanner, *processorTestHelper, *stop.Stopper) {
+			scanner, cleanup, err := makeIntentScanner(data, roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")})
+			require.NoError(t, err, "failed to prepare test data")
+			t.Cleanup(cleanup)
+			p, h, stopper := newTestProcessor(t, withProcType(pt),
+				withIntentScannerFactory(func() IntentScanner {
+					return scanner
+				}))
+			p.ForwardClosedTS(context.Background(), hlc.Timestamp{WallTime: 20})
+			return scanner, h, stopper
+		}
+
+		t.Run("unblocked", func(t *testing.T) {
+			scanner, h, stopper := newProcessor(t)
+			defer stopper.Stop(context.Background())
+
+			// Start wasn't given a constructor, so the resolved timestamp
+			// would be initialized right away if the factory weren't used.
+			// Instead, it isn't initialized while the scan is blocked.
+			h.syncEventC()
+			require.False(t, h.rts.IsInit())
+
+			// Once the scan proceeds, the resolved timestamp is initialized
+			// behind the intent it found.
+			close(scanner.block)
+			<-scanner.done
+			h.syncEventC()
+			require.True(t, h.rts.IsInit())
+			require.Equal(t, hlc.Timestamp{WallTime: 14}, h.rts.Get())
+		})
+
+		t.Run("canceled", func(t *testing.T) {
+			scanner, h, stopper := newProcessor(t)
+			h.syncEventC()
+			require.False(t, h.rts.IsInit())
+
+			// Stopping the Processor cancels the blocked scan, which gives up
+			// and releases its scanner rather than waiting to be unblocked.
+			stopper.Stop(context.Background())
+			select {
+			case <-scanner.done:
+			case <-time.After(10 * time.Second):
+				t.Fatal("blocked scan was not canceled")
+			}
+		})
+	})
+}
+
 func TestProcessorTxnPushAttempt(t *testing.T) {
 	defer leaktest.AfterTest(t)()
 
@@ -1348,6 +1464,752 @@ func TestProcessorTxnPushAttempt(t *testing.T) {
 	})
 }
 
+// TestProcessorTxnPushLead tests that the PushLead is applied to the timestamp
+// that transactions are pushed to.
+func TestProcessorTxnPushLead(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		ts := hlc.Timestamp{WallTime: 10}
+		txnMeta := enginepb.TxnMeta{
+			ID:             uuid.MakeV4(),
+			Key:            keyA,
+			IsoLevel:       isolation.Serializable,
+			WriteTimestamp: ts,
+			MinTimestamp:   ts,
+		}
+
+		// pushTS runs a single push attempt with the given lead and returns the
+		// timestamp that the transaction was pushed to.
+		pushTS := func(t *testing.T, lead time.Duration) hlc.Timestamp {
+			pushedC := make(chan hlc.Timestamp, 1)
+			var tp testTxnPusher
+			tp.mockPushTxns(func(
+				ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+			) ([]*roachpb.Transaction, bool, error) {
+				select {
+				case pushedC <- ts:
+				default:
+				}
+				return nil, false, nil
+			})
+
+			// Freeze the clock so that the push timestamp is deterministic.
+			clock := hlc.NewClockForTesting(timeutil.NewManualTime(timeutil.Unix(0, 1e9)))
+			p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+				withClock(clock), withPushLead(lead))
+			ctx := context.Background()
+			defer stopper.Stop(ctx)
+
+			p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txnMeta))
+			h.syncEventC()
+
+			timeoutC := time.After(10 * time.Second)
+			for {
+				if h.scheduler != nil {
+					h.scheduler.Enqueue(PushTxnQueued)
+				}
+				select {
+				case ts := <-pushedC:
+					return ts
+				case <-time.After(10 * time.Millisecond):
+				case <-timeoutC:
+					t.Fatal("failed to get txn push notification")
+				}
+			}
+		}
+
+		const lead = 500 * time.Millisecond
+		noLeadTS := pushTS(t, 0)
+		leadTS := pushTS(t, lead)
+		require.Equal(t, int64(1e9), noLeadTS.WallTime)
+		require.Equal(t, noLeadTS.WallTime+lead.Nanoseconds(), leadTS.WallTime)
+	})
+}
+
+// TestProcessorSkipPushPriority tests that transactions whose records have at
+// least the configured SkipPushPriority are not pushed.
+func TestProcessorSkipPushPriority(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		ts := hlc.Timestamp{WallTime: 10}
+		makeTxn := func(key roachpb.Key) enginepb.TxnMeta {
+			return enginepb.TxnMeta{
+				ID:             uuid.MakeV4(),
+				Key:            key,
+				IsoLevel:       isolation.Serializable,
+				WriteTimestamp: ts,
+				MinTimestamp:   ts,
+			}
+		}
+		highTxn := makeTxn(keyA)
+		normalTxn := makeTxn(keyB)
+		priorities := map[uuid.UUID]enginepb.TxnPriority{
+			highTxn.ID:   enginepb.MaxTxnPriority,
+			normalTxn.ID: 1,
+		}
+
+		pushedC := make(chan []enginepb.TxnMeta, 1)
+		var tp testTxnPusher
+		tp.mockQueryTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta,
+		) ([]*roachpb.Transaction, error) {
+			queriedTxns := make([]*roachpb.Transaction, len(txns))
+			for i, txn := range txns {
+				queriedTxns[i] = &roachpb.Transaction{TxnMeta: txn, Status: roachpb.PENDING}
+				queriedTxns[i].Priority = priorities[txn.ID]
+			}
+			return queriedTxns, nil
+		})
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			select {
+			case pushedC <- txns:
+			default:
+			}
+			return nil, false, errors.New("push failed")
+		})
+
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withSkipPushPriority(enginepb.MaxTxnPriority))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(highTxn), writeIntentOpFromMeta(normalTxn))
+		h.syncEventC()
+
+		timeoutC := time.After(10 * time.Second)
+		for {
+			if h.scheduler != nil {
+				h.scheduler.Enqueue(PushTxnQueued)
+			}
+			select {
+			case txns := <-pushedC:
+				require.Len(t, txns, 1)
+				require.Equal(t, normalTxn.ID, txns[0].ID)
+				return
+			case <-time.After(10 * time.Millisecond):
+			case <-timeoutC:
+				t.Fatal("failed to get txn push notification")
+			}
+		}
+	})
+}
+
+// TestProcessorSkipPushTxns tests that transactions on the SkipPushTxns
+// deny-list are not pushed, even if they are the oldest.
+func TestProcessorSkipPushTxns(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		makeTxn := func(key roachpb.Key, ts hlc.Timestamp) enginepb.TxnMeta {
+			return enginepb.TxnMeta{
+				ID:             uuid.MakeV4(),
+				Key:            key,
+				IsoLevel:       isolation.Serializable,
+				WriteTimestamp: ts,
+				MinTimestamp:   ts,
+			}
+		}
+		txn1 := makeTxn(keyA, hlc.Timestamp{WallTime: 10})
+		txn2 := makeTxn(keyB, hlc.Timestamp{WallTime: 20})
+
+		pushedC := make(chan []enginepb.TxnMeta, 1)
+		var tp testTxnPusher
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			select {
+			case pushedC <- txns:
+			default:
+			}
+			return nil, false, nil
+		})
+
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withSkipPushTxns(txn1.ID))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txn1), writeIntentOpFromMeta(txn2))
+		h.syncEventC()
+
+		timeoutC := time.After(10 * time.Second)
+		for {
+			if h.scheduler != nil {
+				h.scheduler.Enqueue(PushTxnQueued)
+			}
+			select {
+			case txns := <-pushedC:
+				require.Len(t, txns, 1)
+				require.Equal(t, txn2.ID, txns[0].ID)
+				return
+			case <-time.After(10 * time.Millisecond):
+			case <-timeoutC:
+				t.Fatal("failed to get txn push notification")
+			}
+		}
+	})
+}
+
+// TestProcessorSkipPushMaxAge tests that a transaction exempted by
+// SkipPushPriority isn't pushed until its intent is older than the configured
+// SkipPushMaxAge.
+func TestProcessorSkipPushMaxAge(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		manual := timeutil.NewManualTime(timeutil.Unix(0, 1e9))
+		ts := hlc.Timestamp{WallTime: manual.Now().UnixNano()}
+		longTxn := enginepb.TxnMeta{
+			ID:             uuid.MakeV4(),
+			Key:            keyA,
+			IsoLevel:       isolation.Serializable,
+			WriteTimestamp: ts,
+			MinTimestamp:   ts,
+		}
+
+		queriedC := make(chan struct{}, 1)
+		pushedC := make(chan struct{}, 1)
+		var tp testTxnPusher
+		tp.mockQueryTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta,
+		) ([]*roachpb.Transaction, error) {
+			select {
+			case queriedC <- struct{}{}:
+			default:
+			}
+			queriedTxns := make([]*roachpb.Transaction, len(txns))
+			for i, txn := range txns {
+				queriedTxns[i] = &roachpb.Transaction{TxnMeta: txn, Status: roachpb.PENDING}
+				queriedTxns[i].Priority = enginepb.MaxTxnPriority
+			}
+			return queriedTxns, nil
+		})
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			select {
+			case pushedC <- struct{}{}:
+			default:
+			}
+			return nil, false, errors.New("push failed")
+		})
+
+		const maxAge = time.Minute
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withClock(hlc.NewClockForTesting(manual)),
+			withPushTxnsIntervalAge(10*time.Millisecond, time.Millisecond),
+			withSkipPushPriority(enginepb.MaxTxnPriority), withSkipPushMaxAge(maxAge))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(longTxn))
+		h.syncEventC()
+
+		// The intent is old enough to be pushed, but not past maxAge, so the
+		// transaction stays exempt. Push attempts don't overlap, so the first
+		// attempt is over once a second one queries the transaction.
+		manual.Advance(time.Second)
+		h.triggerTxnPushUntilPushed(t, queriedC)
+		h.triggerTxnPushUntilPushed(t, queriedC)
+		select {
+		case <-pushedC:
+			t.Fatal("exempt txn pushed before exceeding its maximum age")
+		default:
+		}
+
+		// Once the intent is older than maxAge, the transaction is pushed.
+		manual.Advance(maxAge)
+		h.triggerTxnPushUntilPushed(t, pushedC)
+	})
+}
+
+// TestProcessorPushGracePeriod tests that a transaction isn't pushed until the
+// configured PushGracePeriod has elapsed since its intent was observed, even
+// if the intent itself is old.
+func TestProcessorPushGracePeriod(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		ts := hlc.Timestamp{WallTime: 10}
+		txn := enginepb.TxnMeta{
+			ID:             uuid.MakeV4(),
+			Key:            keyA,
+			IsoLevel:       isolation.Serializable,
+			WriteTimestamp: ts,
+			MinTimestamp:   ts,
+		}
+
+		pushedC := make(chan struct{}, 1)
+		var tp testTxnPusher
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			select {
+			case pushedC <- struct{}{}:
+			default:
+			}
+			return nil, false, nil
+		})
+
+		const grace = time.Minute
+		manual := timeutil.NewManualTime(timeutil.Unix(0, 1e9))
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withClock(hlc.NewClockForTesting(manual)),
+			withPushTxnsIntervalAge(10*time.Millisecond, time.Millisecond),
+			withPushGracePeriod(grace))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txn))
+		h.syncEventC()
+
+		// The intent is old, but the transaction was only just observed, so it
+		// isn't pushed.
+		for i := 0; i < 10; i++ {
+			if h.scheduler != nil {
+				h.scheduler.Enqueue(PushTxnQueued)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		select {
+		case <-pushedC:
+			t.Fatal("txn pushed within its grace period")
+		default:
+		}
+
+		// Once the grace period has elapsed, it is.
+		manual.Advance(grace)
+		h.triggerTxnPushUntilPushed(t, pushedC)
+	})
+}
+
+// TestProcessorTxnPushCoalescing tests that a push requested while a push
+// attempt is in flight doesn't start a concurrent attempt, and is instead
+// coalesced into a single follow-up attempt covering every old transaction.
+func TestProcessorTxnPushCoalescing(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		ts := hlc.Timestamp{WallTime: 10}
+		txn1Meta := enginepb.TxnMeta{
+			ID: uuid.MakeV4(), Key: keyA, WriteTimestamp: ts, MinTimestamp: ts,
+		}
+		txn2Meta := enginepb.TxnMeta{
+			ID: uuid.MakeV4(), Key: keyB, WriteTimestamp: ts, MinTimestamp: ts,
+		}
+
+		// The first attempt blocks until released. Every attempt leaves the
+		// transactions pending at their original timestamps, so that they stay
+		// old for any follow-up attempt.
+		pushedC := make(chan []enginepb.TxnMeta, 16)
+		releaseC := make(chan struct{})
+		var inFlight atomic.Int32
+		var concurrent atomic.Bool
+		var tp testTxnPusher
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			if inFlight.Add(1) > 1 {
+				concurrent.Store(true)
+			}
+			defer inFlight.Add(-1)
+			select {
+			case pushedC <- txns:
+			default:
+			}
+			<-releaseC
+			pushed := make([]*roachpb.Transaction, len(txns))
+			for i := range txns {
+				pushed[i] = &roachpb.Transaction{TxnMeta: txns[i], Status: roachpb.PENDING}
+			}
+			return pushed, false, nil
+		})
+
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withPushTxnsIntervalAge(10*time.Millisecond, time.Nanosecond))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		nextPush := func() []enginepb.TxnMeta {
+			timeoutC := time.After(10 * time.Second)
+			for {
+				if h.scheduler != nil {
+					h.scheduler.Enqueue(PushTxnQueued)
+				}
+				select {
+				case txns := <-pushedC:
+					return txns
+				case <-time.After(10 * time.Millisecond):
+				case <-timeoutC:
+					t.Fatal("failed to get txn push notification")
+				}
+			}
+		}
+		txnIDs := func(txns []enginepb.TxnMeta) []uuid.UUID {
+			ids := make([]uuid.UUID, len(txns))
+			for i := range txns {
+				ids[i] = txns[i].ID
+			}
+			return ids
+		}
+
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txn1Meta))
+		h.syncEventC()
+		require.Equal(t, []uuid.UUID{txn1Meta.ID}, txnIDs(nextPush()))
+
+		// While the first attempt is blocked, track another txn and request more
+		// pushes. None of them may start an attempt.
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txn2Meta))
+		h.syncEventC()
+		for i := 0; i < 5; i++ {
+			if h.scheduler != nil {
+				h.scheduler.Enqueue(PushTxnQueued)
+			}
+			time.Sleep(10 * time.Millisecond)
+		}
+		require.Empty(t, pushedC)
+
+		// Once released, the requests are served by a follow-up attempt that
+		// covers both txns.
+		close(releaseC)
+		require.ElementsMatch(t, []uuid.UUID{txn1Meta.ID, txn2Meta.ID}, txnIDs(nextPush()))
+		require.False(t, concurrent.Load(), "push attempts ran concurrently")
+	})
+}
+
+// TestProcessorTracksIntentsAfterInitScan tests that an intent written after
+// the initial resolved timestamp scan holds back the resolved timestamp as soon
+// as its write is applied, without waiting for its transaction to be pushed.
+func TestProcessorTracksIntentsAfterInitScan(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		ctx := context.Background()
+		p, h, stopper := newTestProcessor(t, withProcType(pt))
+		defer stopper.Stop(ctx)
+		h.syncEventC()
+		require.True(t, h.rts.IsInit())
+
+		// Write an intent through an op logger, like a replica applying a
+		// command would, and hand the ops to the processor.
+		engine := storage.NewDefaultInMemForTesting()
+		defer engine.Close()
+		batch := engine.NewBatch()
+		defer batch.Close()
+		opLogger := storage.NewOpLoggerBatch(batch)
+		ts := hlc.Timestamp{WallTime: 10}
+		txn := makeTxn("txnKey", uuid.MakeV4(), isolation.Serializable, ts)
+		_, err := storage.MVCCPut(ctx, opLogger, keyB, ts, makeVal("provisional"),
+			storage.MVCCWriteOptions{Txn: &txn})
+		require.NoError(t, err)
+		require.True(t, p.ConsumeLogicalOps(ctx, opLogger.LogicalOps()...))
+		h.syncEventC()
+		require.Equal(t, 1, h.rts.intentQ.Len())
+
+		// The closed timestamp passing the intent doesn't advance the resolved
+		// timestamp past it.
+		p.ForwardClosedTS(ctx, hlc.Timestamp{WallTime: 20})
+		h.syncEventC()
+		require.Equal(t, ts.Prev(), h.rts.Get())
+	})
+}
+
+// TestProcessorBoundStaleness tests that, while a staleness bound is in effect,
+// push attempts push the transactions that hold the resolved timestamp further
+// behind the clock than the bound, even though they are younger than
+// PushTxnsAge.
+func TestProcessorBoundStaleness(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		txnMeta := func(wallTime int64) enginepb.TxnMeta {
+			ts := hlc.Timestamp{WallTime: wallTime}
+			return enginepb.TxnMeta{
+				ID:             uuid.MakeV4(),
+				Key:            keyA,
+				IsoLevel:       isolation.Serializable,
+				WriteTimestamp: ts,
+				MinTimestamp:   ts,
+			}
+		}
+
+		// Pushes leave the transactions pending at the push timestamp.
+		var pushed []uuid.UUID
+		var mu syncutil.Mutex
+		pushedC := make(chan struct{}, 1)
+		var tp testTxnPusher
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			mu.Lock()
+			defer mu.Unlock()
+			res := make([]*roachpb.Transaction, len(txns))
+			for i := range txns {
+				pushed = append(pushed, txns[i].ID)
+				res[i] = &roachpb.Transaction{TxnMeta: txns[i], Status: roachpb.PENDING}
+				res[i].WriteTimestamp = ts
+			}
+			select {
+			case pushedC <- struct{}{}:
+			default:
+			}
+			return res, false, nil
+		})
+		getPushed := func() []uuid.UUID {
+			mu.Lock()
+			defer mu.Unlock()
+			return append([]uuid.UUID(nil), pushed...)
+		}
+		// triggerPushes schedules push attempts for a while, so that any
+		// transaction that is old enough gets pushed.
+		triggerPushes := func(h *processorTestHelper) {
+			for i := 0; i < 10; i++ {
+				if h.scheduler != nil {
+					h.scheduler.Enqueue(PushTxnQueued)
+				}
+				time.Sleep(10 * time.Millisecond)
+			}
+		}
+
+		// Freeze the clock at 10s, so that transactions are never old enough to
+		// be pushed on their own.
+		now := int64(10 * time.Second)
+		clock := hlc.NewClockForTesting(timeutil.NewManualTime(timeutil.Unix(0, now)))
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withClock(clock), withPushTxnsIntervalAge(10*time.Millisecond, time.Hour))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		// An open transaction holds the resolved timestamp 5s behind the clock.
+		open := txnMeta(int64(5 * time.Second))
+		closedTS := hlc.Timestamp{WallTime: int64(9 * time.Second)}
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(open))
+		p.ForwardClosedTS(ctx, closedTS)
+		h.syncEventC()
+		require.Equal(t, open.WriteTimestamp.Prev(), h.rts.Get())
+
+		triggerPushes(h)
+		require.Empty(t, getPushed())
+
+		// With a bound of 2s, the transaction is pushed so that the resolved
+		// timestamp advances to the closed timestamp, within the bound.
+		const maxStaleness = 2 * time.Second
+		release := p.BoundStaleness(maxStaleness)
+		h.triggerTxnPushUntilPushed(t, pushedC)
+		require.Equal(t, []uuid.UUID{open.ID}, getPushed())
+		testutils.SucceedsSoon(t, func() error {
+			h.syncEventC()
+			if rts := h.rts.Get(); rts != closedTS {
+				return errors.Newf("resolved timestamp %s, expected %s", rts, closedTS)
+			}
+			return nil
+		})
+		require.LessOrEqual(t, now-h.rts.Get().WallTime, maxStaleness.Nanoseconds())
+
+		// Once the bound is released, transactions are left alone again.
+		release()
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txnMeta(int64(6*time.Second))))
+		h.syncEventC()
+		triggerPushes(h)
+		require.Equal(t, []uuid.UUID{open.ID}, getPushed())
+	})
+}
+
+// TestProcessorCancelPushes tests that CancelPushes cancels a push attempt that
+// is blocked, and returns once the attempt has unwound.
+func TestProcessorCancelPushes(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		ts := hlc.Timestamp{WallTime: 10}
+		txnMeta := enginepb.TxnMeta{
+			ID:             uuid.MakeV4(),
+			Key:            keyA,
+			IsoLevel:       isolation.Serializable,
+			WriteTimestamp: ts,
+			MinTimestamp:   ts,
+		}
+
+		// Pushes block until their context is canceled.
+		pushStartedC := make(chan struct{}, 1)
+		var tp testTxnPusher
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			select {
+			case pushStartedC <- struct{}{}:
+			default:
+			}
+			<-ctx.Done()
+			return nil, false, ctx.Err()
+		})
+
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		// Without a push in flight, there is nothing to cancel.
+		require.NoError(t, p.CancelPushes(ctx))
+
+		p.ConsumeLogicalOps(ctx, writeIntentOpFromMeta(txnMeta))
+		h.syncEventC()
+		h.triggerTxnPushUntilPushed(t, pushStartedC)
+
+		// CancelPushes returns once the blocked attempt has unwound, well before
+		// the deadline.
+		cancelCtx, cancel := context.WithTimeout(ctx, 10*time.Second)
+		defer cancel()
+		require.NoError(t, p.CancelPushes(cancelCtx))
+	})
+}
+
+// TestProcessorNextPushTime tests that NextPushTime reports the time at which
+// the next push attempt is due, one CurrentPushInterval after the last one.
+func TestProcessorNextPushTime(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		const interval = 10 * time.Millisecond
+		manual := timeutil.NewManualTime(timeutil.Unix(0, 1e9))
+		var tp testTxnPusher
+		p, h, stopper := newTestProcessor(t, withPusher(&tp), withProcType(pt),
+			withClock(hlc.NewClockForTesting(manual)), withPushTxnsIntervalAge(interval, time.Hour))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		require.Equal(t, interval, p.CurrentPushInterval())
+		// The clock is frozen, so every attempt so far was due at the start.
+		require.Equal(t, manual.Now().Add(interval), p.NextPushTime())
+
+		// Once the clock advances, the next attempt is due one interval after
+		// the first attempt that is due since.
+		manual.Advance(time.Minute)
+		testutils.SucceedsSoon(t, func() error {
+			if h.scheduler != nil {
+				h.scheduler.Enqueue(PushTxnQueued)
+			}
+			if next, expected := p.NextPushTime(), manual.Now().Add(interval); !next.Equal(expected) {
+				return errors.Errorf("expected next push at %s, found %s", expected, next)
+			}
+			return nil
+		})
+	})
+}
+
+// TestProcessorLagBudget tests that the lag budget tracks the distance between
+// the resolved timestamp and the clock minus the lag target.
+func TestProcessorLagBudget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		seconds := func(s int64) hlc.Timestamp {
+			return hlc.Timestamp{WallTime: s * time.Second.Nanoseconds()}
+		}
+		manual := timeutil.NewManualTime(timeutil.Unix(10, 0))
+		p, h, stopper := newTestProcessor(t, withProcType(pt),
+			withClock(hlc.NewClockForTesting(manual)), withResolvedTSLagTarget(3*time.Second))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		// The resolved timestamp trails the clock by 1s, leaving 2s of budget.
+		p.ForwardClosedTS(ctx, seconds(9))
+		h.syncEventC()
+		require.Equal(t, seconds(9), h.rts.Get())
+		require.Equal(t, 2*time.Second, p.LagBudget())
+
+		// The budget shrinks as the clock advances.
+		manual.Advance(time.Second)
+		require.Equal(t, time.Second, p.LagBudget())
+
+		// And goes negative once the resolved timestamp falls behind the target.
+		manual.Advance(2 * time.Second)
+		require.Equal(t, -time.Second, p.LagBudget())
+
+		// Advancing the resolved timestamp restores the budget.
+		p.ForwardClosedTS(ctx, seconds(12))
+		h.syncEventC()
+		require.Equal(t, 2*time.Second, p.LagBudget())
+	})
+}
+
+// TestProcessorResolvedTSLagHistogram tests that the lag of every resolved
+// timestamp advance is recorded in the resolved timestamp lag histogram.
+func TestProcessorResolvedTSLagHistogram(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		seconds := func(s int64) hlc.Timestamp {
+			return hlc.Timestamp{WallTime: s * time.Second.Nanoseconds()}
+		}
+		manual := timeutil.NewManualTime(timeutil.Unix(10, 0))
+		m := NewMetrics()
+		p, h, stopper := newTestProcessor(t, withProcType(pt), withMetrics(m),
+			withClock(hlc.NewClockForTesting(manual)))
+		ctx := context.Background()
+		defer stopper.Stop(ctx)
+
+		// Each advance records the lag of the new resolved timestamp behind the
+		// clock: 1s, then 4s, then 2s.
+		p.ForwardClosedTS(ctx, seconds(9))
+		h.syncEventC()
+		manual.Advance(5 * time.Second)
+		p.ForwardClosedTS(ctx, seconds(11))
+		h.syncEventC()
+		manual.Advance(time.Second)
+		p.ForwardClosedTS(ctx, seconds(14))
+		h.syncEventC()
+		require.Equal(t, seconds(14), h.rts.Get())
+
+		// Closed timestamps that don't advance the resolved timestamp aren't
+		// recorded.
+		p.ForwardClosedTS(ctx, seconds(14))
+		h.syncEventC()
+
+		count, sum := m.RangeFeedResolvedTSLag.CumulativeSnapshot().Total()
+		require.Equal(t, int64(3), count)
+		require.Equal(t, float64((7 * time.Second).Nanoseconds()), sum)
+	})
+}
+
+// TestProcessorIntentScannerKind tests that processors select the intent
+// scanner implementation according to the cluster settings.
+func TestProcessorIntentScannerKind(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	testutils.RunValues(t, "proc type", testTypes, func(t *testing.T, pt procType) {
+		testutils.RunTrueAndFalse(t, "legacy", func(t *testing.T, legacy bool) {
+			ctx := context.Background()
+			st := cluster.MakeTestingClusterSettings()
+			UseLegacyIntentScanner.Override(ctx, &st.SV, legacy)
+
+			p, h, stopper := newTestProcessor(t, withProcType(pt), withSettings(st))
+			defer stopper.Stop(ctx)
+
+			expected := SeparatedIntentScannerKind
+			if legacy {
+				expected = LegacyIntentScannerKind
+			}
+			require.Equal(t, expected, p.IntentScannerKind())
+
+			engine, err := makeTestEngineWithData(nil)
+			require.NoError(t, err)
+			defer engine.Close()
+			scanner, err := NewIntentScanner(ctx, p.IntentScannerKind(), engine, h.span)
+			require.NoError(t, err)
+			defer scanner.Close()
+			if legacy {
+				require.IsType(t, &LegacyIntentScanner{}, scanner)
+			} else {
+				require.IsType(t, &SeparatedIntentScanner{}, scanner)
+			}
+		})
+	})
+}
+
 // TestProcessorTxnPushDisabled tests that processors don't attempt txn pushes
 // when disabled.
 func TestProcessorTxnPushDisabled(t *testing.T) {
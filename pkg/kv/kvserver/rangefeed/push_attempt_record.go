@@ -0,0 +1,135 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package rangefeed
+
+import (
+	"encoding/json"
+	"time"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
+	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/hlc"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/errors"
+)
+
+// PushAttemptRecord captures the inputs of a push attempt, so that the attempt
+// can be replayed elsewhere, e.g. to reproduce an intent cleanup bug seen in
+// production. Push attempts log their record when verbose logging is enabled
+// at level 2.
+type PushAttemptRecord struct {
+	// Span is the key span of the Processor that ran the attempt. Intent
+	// resolution is restricted to it.
+	Span roachpb.RSpan
+	// Txns are the transactions that the attempt pushed.
+	Txns []enginepb.TxnMeta
+	// PushTS is the timestamp that the transactions were pushed to.
+	PushTS hlc.Timestamp
+	// SkipPriority is the priority at or above which transactions were exempt
+	// from the push, or zero if none were.
+	SkipPriority enginepb.TxnPriority
+	// SkipMaxAge is the age past which transactions were pushed regardless of
+	// SkipPriority, or zero if there was none.
+	SkipMaxAge time.Duration
+}
+
+// pushAttemptRecordVersion is the version of the encoding of
+// PushAttemptRecords produced by Encode.
+const pushAttemptRecordVersion = 1
+
+// encodedPushAttemptRecord is the encoding of a PushAttemptRecord. Its messages
+// are encoded as protobufs, so that records remain readable as the messages
+// evolve.
+type encodedPushAttemptRecord struct {
+	Version      int      `json:"version"`
+	StartKey     []byte   `json:"start_key"`
+	EndKey       []byte   `json:"end_key"`
+	Txns         [][]byte `json:"txns"`
+	PushTS       []byte   `json:"push_ts"`
+	SkipPriority int32    `json:"skip_priority,omitempty"`
+	SkipMaxAge   int64    `json:"skip_max_age_nanos,omitempty"`
+}
+
+// Encode encodes the record as JSON, to be loaded by DecodePushAttemptRecord.
+func (r PushAttemptRecord) Encode() ([]byte, error) {
+	enc := encodedPushAttemptRecord{
+		Version:      pushAttemptRecordVersion,
+		StartKey:     r.Span.Key,
+		EndKey:       r.Span.EndKey,
+		Txns:         make([][]byte, len(r.Txns)),
+		SkipPriority: int32(r.SkipPriority),
+		SkipMaxAge:   r.SkipMaxAge.Nanoseconds(),
+	}
+	for i := range r.Txns {
+		b, err := protoutil.Marshal(&r.Txns[i])
+		if err != nil {
+			return nil, errors.Wrapf(err, "encoding txn %s", r.Txns[i].ID)
+		}
+		enc.Txns[i] = b
+	}
+	var err error
+	if enc.PushTS, err = protoutil.Marshal(&r.PushTS); err != nil {
+		return nil, errors.Wrap(err, "encoding push timestamp")
+	}
+	return json.Marshal(enc)
+}
+
+// DecodePushAttemptRecord loads a record produced by PushAttemptRecord.Encode.
+func DecodePushAttemptRecord(data []byte) (PushAttemptRecord, error) {
+	var enc encodedPushAttemptRecord
+	if err := json.Unmarshal(data, &enc); err != nil {
+		return PushAttemptRecord{}, errors.Wrap(err, "decoding push attempt record")
+	}
+	if enc.Version != pushAttemptRecordVersion {
+		return PushAttemptRecord{}, errors.Errorf("unsupported push attempt record version %d", enc.Version)
+	}
+	r := PushAttemptRecord{
+		Span:         roachpb.RSpan{Key: enc.StartKey, EndKey: enc.EndKey},
+		Txns:         make([]enginepb.TxnMeta, len(enc.Txns)),
+		SkipPriority: enginepb.TxnPriority(enc.SkipPriority),
+		SkipMaxAge:   time.Duration(enc.SkipMaxAge),
+	}
+	for i, b := range enc.Txns {
+		if err := protoutil.Unmarshal(b, &r.Txns[i]); err != nil {
+			return PushAttemptRecord{}, errors.Wrapf(err, "decoding txn %d", i)
+		}
+	}
+	if err := protoutil.Unmarshal(enc.PushTS, &r.PushTS); err != nil {
+		return PushAttemptRecord{}, errors.Wrap(err, "decoding push timestamp")
+	}
+	return r, nil
+}
+
+// record returns the record of the push attempt's inputs.
+func (a *txnPushAttempt) record() PushAttemptRecord {
+	return PushAttemptRecord{
+		Span:         a.span,
+		Txns:         a.txns,
+		PushTS:       a.ts,
+		SkipPriority: a.skipPriority,
+		SkipMaxAge:   a.skipMaxAge,
+	}
+}
+
+// newTxnPushAttemptFromRecord returns a push attempt that replays the attempt
+// described by rec, pushing its transactions through pusher and reporting the
+// results to p. It is meant for test harnesses reproducing production push
+// attempts, and resolves all intents in a single request, without capping
+// the lock spans resolved per transaction.
+func newTxnPushAttemptFromRecord(
+	st *cluster.Settings, rec PushAttemptRecord, pusher TxnPusher, p processorTaskHelper, done func(),
+) runnable {
+	return newTxnPushAttempt(st, rec.Span, pusher, p, rec.Txns, rec.PushTS, done, txnPushAttemptOptions{
+		skipPriority: rec.SkipPriority,
+		skipMaxAge:   rec.SkipMaxAge,
+	})
+}
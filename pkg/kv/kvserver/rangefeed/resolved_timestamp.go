@@ -14,6 +14,7 @@ import (
 	"bytes"
 	"context"
 	"fmt"
+	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/clusterversion"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/isolation"
@@ -340,6 +341,9 @@ type unresolvedTxn struct {
 	txnMinTimestamp hlc.Timestamp   // unset if refCount < 0
 	timestamp       hlc.Timestamp
 	refCount        int // count of unresolved intents
+	// observedAt is the physical time at which the transaction started being
+	// tracked. Only set if the queue has a clock.
+	observedAt time.Time
 
 	// The index of the item in the unresolvedTxnHeap, maintained by the
 	// heap.Interface methods.
@@ -416,6 +420,9 @@ type unresolvedIntentQueue struct {
 	txns             map[uuid.UUID]*unresolvedTxn
 	minHeap          unresolvedTxnHeap
 	allowNegRefCount bool
+	// clock, if set, is used to record when each transaction started being
+	// tracked, see unresolvedTxn.observedAt.
+	clock *hlc.Clock
 }
 
 func makeUnresolvedIntentQueue() unresolvedIntentQueue {
@@ -505,6 +512,9 @@ func (uiq *unresolvedIntentQueue) updateTxn(
 			timestamp:       ts,
 			refCount:        delta,
 		}
+		if uiq.clock != nil {
+			txn.observedAt = uiq.clock.PhysicalTime()
+		}
 		uiq.txns[txn.txnID] = txn
 		heap.Push[*unresolvedTxn](&uiq.minHeap, txn)
 
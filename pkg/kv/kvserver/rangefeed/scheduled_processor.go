@@ -41,8 +41,12 @@ type ScheduledProcessor struct {
 	Config
 	scheduler ClientScheduler
 
-	reg registry
-	rts resolvedTimestamp
+	reg    registry
+	rts    resolvedTimestamp
+	status processorStatus
+	// lockSpans tracks the lock spans deferred by push attempts, see
+	// Config.MaxLockSpansPerTxn. It is nil if they aren't capped.
+	lockSpans *lockSpanCursor
 
 	// processCtx is the annotated background context used for process(). It is
 	// stored here to avoid reconstructing it on every call.
@@ -70,6 +74,19 @@ type ScheduledProcessor struct {
 	// stopper passed by start that is used for firing up async work from scheduler.
 	stopper       *stop.Stopper
 	txnPushActive bool
+	// txnPushDoneC is closed when the active push attempt completes. It is nil
+	// unless txnPushActive.
+	txnPushDoneC chan struct{}
+	// txnPushCancel cancels the context of the active push attempt. It is nil
+	// unless txnPushActive.
+	txnPushCancel func()
+	// txnPushPending is set if a push was requested while txnPushActive. Such
+	// requests are coalesced into a single push that runs once the active one
+	// completes.
+	txnPushPending bool
+	// staleness holds the bounds on the staleness of the resolved timestamp
+	// that are in effect, see BoundStaleness.
+	staleness stalenessBounds
 }
 
 // NewScheduledProcessor creates a new scheduler based rangefeed Processor.
@@ -81,8 +98,9 @@ func NewScheduledProcessor(cfg Config) *ScheduledProcessor {
 		Config:     cfg,
 		scheduler:  cfg.Scheduler.NewClientScheduler(),
 		reg:        makeRegistry(cfg.Metrics),
-		rts:        makeResolvedTimestamp(cfg.Settings),
+		rts:        cfg.makeResolvedTS(),
 		processCtx: cfg.AmbientContext.AnnotateCtx(context.Background()),
+		lockSpans:  newLockSpanCursor(cfg.MaxLockSpansPerTxn),
 
 		requestQueue: make(chan request, 20),
 		eventC:       make(chan *event, cfg.EventChanCap),
@@ -104,6 +122,7 @@ func (p *ScheduledProcessor) Start(
 	stopper *stop.Stopper, rtsIterFunc IntentScannerConstructor,
 ) error {
 	p.stopper = stopper
+	p.status.publishPushTick(p.Clock.PhysicalTime())
 	p.taskCtx, p.taskCancel = p.stopper.WithCancelOnQuiesce(
 		p.Config.AmbientContext.AnnotateCtx(context.Background()))
 
@@ -116,9 +135,10 @@ func (p *ScheduledProcessor) Start(
 
 	// Launch an async task to scan over the resolved timestamp iterator and
 	// initialize the unresolvedIntentQueue.
+	rtsIterFunc = p.intentScannerConstructor(rtsIterFunc)
 	if rtsIterFunc != nil {
 		rtsIter := rtsIterFunc()
-		initScan := newInitResolvedTSScan(p.Span, p, rtsIter)
+		initScan := newInitResolvedTSScan(p.Span, p, rtsIter, p.initScanOptions())
 		// TODO(oleg): we need to cap number of tasks that we can fire up across
 		// all feeds as they could potentially generate O(n) tasks during start.
 		err := stopper.RunAsyncTask(p.taskCtx, "rangefeed: init resolved ts", initScan.Run)
@@ -146,6 +166,7 @@ func (p *ScheduledProcessor) process(e processorEventType) processorEventType {
 		p.processEvents(ctx)
 	}
 	if e&PushTxnQueued != 0 {
+		p.status.publishPushTick(p.Clock.PhysicalTime())
 		p.processPushTxn(ctx)
 	}
 	if e&Stopped != 0 {
@@ -189,31 +210,46 @@ func (p *ScheduledProcessor) processEvents(ctx context.Context) {
 }
 
 func (p *ScheduledProcessor) processPushTxn(ctx context.Context) {
+	if p.txnPushActive {
+		p.txnPushPending = true
+		return
+	}
 	// NB: Len() check avoids hlc.Clock.Now() mutex acquisition in the common
 	// case, which can be a significant source of contention.
-	if !p.txnPushActive && p.rts.IsInit() && p.rts.intentQ.Len() > 0 {
+	if p.rts.IsInit() && p.rts.intentQ.Len() > 0 {
 		now := p.Clock.Now()
-		before := now.Add(-p.PushTxnsAge.Nanoseconds(), 0)
+		before := now.Add(-p.staleness.pushTxnsAge(p.PushTxnsAge).Nanoseconds(), 0)
 		oldTxns := p.rts.intentQ.Before(before)
 
-		if len(oldTxns) > 0 {
-			toPush := make([]enginepb.TxnMeta, len(oldTxns))
-			for i, txn := range oldTxns {
-				toPush[i] = txn.asTxnMeta()
-			}
-
+		if toPush := p.txnsToPush(oldTxns, p.Clock.PhysicalTime()); len(toPush) > 0 {
 			// Launch an async transaction push attempt that pushes the
 			// timestamp of all transactions beneath the push offset.
 			// Ignore error if quiescing.
-			pushTxns := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, p, toPush, now, func() {
+			pushTxns := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, p, toPush, p.pushTxnsTS(now), func() {
 				p.enqueueRequest(func(ctx context.Context) {
 					p.txnPushActive = false
+					close(p.txnPushDoneC)
+					p.txnPushDoneC = nil
+					p.txnPushCancel()
+					p.txnPushCancel = nil
+					// Pushes are normally gated on PushTxnsEnabled by the store
+					// before PushTxnQueued is enqueued, so check it here too in
+					// case it was disabled while this attempt was in flight.
+					if p.txnPushPending {
+						p.txnPushPending = false
+						if PushTxnsEnabled.Get(&p.Settings.SV) {
+							p.processPushTxn(ctx)
+						}
+					}
 				})
-			})
+			}, p.txnPushAttemptOptions(p.lockSpans))
 			p.txnPushActive = true
+			p.txnPushDoneC = make(chan struct{})
+			var pushCtx context.Context
+			pushCtx, p.txnPushCancel = context.WithCancel(p.taskCtx)
 			// TODO(oleg): we need to cap number of tasks that we can fire up across
 			// all feeds as they could potentially generate O(n) tasks for push.
-			err := p.stopper.RunAsyncTask(p.taskCtx, "rangefeed: pushing old txns", pushTxns.Run)
+			err := p.stopper.RunAsyncTask(pushCtx, "rangefeed: pushing old txns", pushTxns.Run)
 			if err != nil {
 				pushTxns.Cancel()
 			}
@@ -576,6 +612,48 @@ func (p *ScheduledProcessor) Len() int {
 	})
 }
 
+// LagBudget implements Processor interface.
+func (p *ScheduledProcessor) LagBudget() time.Duration {
+	return p.lagBudget(p.status.resolvedWallTime.Load())
+}
+
+// IntentScannerKind implements Processor interface.
+func (p *ScheduledProcessor) IntentScannerKind() IntentScannerKind {
+	return p.scannerKind
+}
+
+// CurrentPushInterval implements Processor interface.
+func (p *ScheduledProcessor) CurrentPushInterval() time.Duration {
+	return p.PushTxnsInterval
+}
+
+// NextPushTime implements Processor interface.
+func (p *ScheduledProcessor) NextPushTime() time.Time {
+	return p.nextPushTime(p.status.lastPushTick.Load())
+}
+
+// BoundStaleness implements Processor interface.
+func (p *ScheduledProcessor) BoundStaleness(maxStaleness time.Duration) (release func()) {
+	return p.staleness.add(maxStaleness)
+}
+
+// CancelPushes implements Processor interface.
+func (p *ScheduledProcessor) CancelPushes(ctx context.Context) error {
+	var ok bool
+	doneC := runRequest(p, func(_ context.Context, p *ScheduledProcessor) chan struct{} {
+		ok = true
+		p.txnPushPending = false
+		if p.txnPushActive {
+			p.txnPushCancel()
+		}
+		return p.txnPushDoneC
+	})
+	if !ok {
+		return errors.New("rangefeed processor stopped")
+	}
+	return waitForPushAttempt(ctx, doneC, p.stoppedC)
+}
+
 // Filter returns a new operation filter based on the registrations attached to
 // the processor. Returns nil if the processor has been stopped already.
 func (p *ScheduledProcessor) Filter() *Filter {
@@ -644,6 +722,8 @@ func (p *ScheduledProcessor) consumeEvent(ctx context.Context, e *event) {
 		p.initResolvedTS(ctx, e.alloc)
 	case e.sst != nil:
 		p.consumeSSTable(ctx, e.sst.data, e.sst.span, e.sst.ts, e.alloc)
+	case e.initScanSlice != nil:
+		log.VEventf(ctx, 2, "initial resolved timestamp scan paused before %s", e.initScanSlice.resumeKey)
 	case e.sync != nil:
 		if e.sync.testRegCatchupSpan != nil {
 			if err := p.reg.waitForCaughtUp(ctx, *e.sync.testRegCatchupSpan); err != nil {
@@ -802,6 +882,8 @@ func (p *ScheduledProcessor) publishCheckpoint(ctx context.Context, alloc *Share
 	// TODO(nvanbenschoten): persist resolvedTimestamp. Give Processor a client.DB.
 	// TODO(nvanbenschoten): rate limit these? send them periodically?
 
+	p.status.publishResolvedTS(p.rts.Get())
+	p.recordResolvedTSAdvance(p.rts.Get())
 	event := p.newCheckpointEvent()
 	p.reg.PublishToOverlapping(ctx, all, event, logicalOpMetadata{}, alloc)
 }
@@ -12,20 +12,28 @@ package rangefeed
 
 import (
 	"context"
+	"fmt"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/cockroachdb/cockroach/pkg/keys"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/lock"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/settings"
 	"github.com/cockroachdb/cockroach/pkg/settings/cluster"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
 	"github.com/cockroachdb/cockroach/pkg/storage/fs"
+	"github.com/cockroachdb/cockroach/pkg/util/ctxgroup"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/quotapool"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
 	"github.com/cockroachdb/cockroach/pkg/util/timeutil"
+	"github.com/cockroachdb/cockroach/pkg/util/uuid"
 	"github.com/cockroachdb/errors"
 )
 
@@ -50,19 +58,79 @@ type processorTaskHelper interface {
 // the Processor was started and hooked up to a stream of logical operations.
 // The Processor can initialize its resolvedTimestamp once the scan completes
 // because it knows it is now tracking all intents in its key range.
+//
+// Intents are emitted in key order, which is also the order in which the
+// IntentScanner finds them. Intents at identical timestamps, e.g. of different
+// transactions, are thus emitted in the same order by every scan of the same
+// data, regardless of their transaction IDs. The one exception is a scan that
+// resumes from a checkpoint, which first replays the intents found before the
+// checkpoint in the order in which their transactions were first found.
+//
+// If inlineTS is set and the IntentScanner is also an InlineValueScanner, the
+// scan additionally informs the Processor of any inline values in its key
+// range. Inline values carry no MVCC timestamp of their own, so they are
+// emitted as value writes at inlineTS.
+//
+// If checkpointer is set and the IntentScanner is also a KeyedIntentScanner,
+// the scan periodically checkpoints its progress, and resumes from the last
+// checkpoint of a previous, interrupted scan.
+//
+// If slicer is set and the IntentScanner is also a KeyedIntentScanner, the
+// scan is performed in slices that each find a bounded size of intents. The
+// end of each slice is marked by an initScanSlice event, after which the scan
+// pauses before continuing.
+//
+// If verifier is set and the IntentScanner is also an IntentVerifier, the scan
+// additionally cross-checks the intents it found against the MVCC keyspace. If
+// the verifier is strict and the IntentScanner is an InterleavedIntentDetector,
+// the scan also reports the interleaved intents that it skipped.
+//
+// If the IntentScanner was created by NewIntentScannerWithFallback and is a
+// KeyedIntentScanner, a failure to scan for intents is logged and the scan
+// resumes after the last intent found using the fallback scanner.
+//
+// At verbosity level 2, the scan logs a JSON summary once it completes.
 type initResolvedTSScan struct {
-	span roachpb.RSpan
-	p    processorTaskHelper
-	is   IntentScanner
+	initScanOptions
+	span     roachpb.RSpan
+	p        processorTaskHelper
+	is       IntentScanner
+	fallback IntentScanner
+	summary  initScanSummary
+}
+
+// initScanOptions configures the optional behaviors of an initResolvedTSScan
+// described above. The zero value enables none of them.
+type initScanOptions struct {
+	inlineTS     hlc.Timestamp
+	checkpointer *initScanCheckpointer
+	slicer       *initScanSlicer
+	verifier     *initScanVerifier
 }
 
-func newInitResolvedTSScan(span roachpb.RSpan, p processorTaskHelper, c IntentScanner) runnable {
-	return &initResolvedTSScan{span: span, p: p, is: c}
+func newInitResolvedTSScan(
+	span roachpb.RSpan, p processorTaskHelper, c IntentScanner, opts initScanOptions,
+) runnable {
+	s := &initResolvedTSScan{
+		initScanOptions: opts,
+		span:            span,
+		p:               p,
+		is:              c,
+	}
+	if f, ok := c.(*fallbackIntentScanner); ok {
+		s.is, s.fallback = f.primary, f.fallback
+	}
+	return s
 }
 
 func (s *initResolvedTSScan) Run(ctx context.Context) {
 	defer s.Cancel()
-	if err := s.iterateAndConsume(ctx); err != nil {
+	start := timeutil.Now()
+	err := s.iterateAndConsume(ctx)
+	if log.V(initScanSummaryVerbosity) {
+		s.logSummary(ctx, timeutil.Since(start), err)
+	}
+	if err != nil {
 		err = errors.Wrap(err, "initial resolved timestamp scan failed")
 		if ctx.Err() == nil { // cancellation probably caused the error
 			log.Errorf(ctx, "%v", err)
@@ -77,15 +145,122 @@ func (s *initResolvedTSScan) Run(ctx context.Context) {
 func (s *initResolvedTSScan) iterateAndConsume(ctx context.Context) error {
 	startKey := s.span.Key.AsRawKey()
 	endKey := s.span.EndKey.AsRawKey()
-	return s.is.ConsumeIntents(ctx, startKey, endKey, func(op enginepb.MVCCWriteIntentOp) bool {
+	if err := s.consumeIntents(ctx, startKey, endKey); err != nil {
+		return err
+	}
+	if s.verifier != nil {
+		if err := s.verifier.verify(ctx, s.is, startKey, endKey); err != nil {
+			return err
+		}
+	}
+	if s.inlineTS.IsEmpty() {
+		return nil
+	}
+	ivs, ok := s.is.(InlineValueScanner)
+	if !ok {
+		return nil
+	}
+	return ivs.ConsumeInlineValues(ctx, startKey, endKey, func(key roachpb.Key, value []byte) bool {
 		var ops [1]enginepb.MVCCLogicalOp
-		ops[0].SetValue(&op)
+		ops[0].SetValue(&enginepb.MVCCWriteValueOp{
+			Key:       key,
+			Timestamp: s.inlineTS,
+			Value:     value,
+		})
 		return s.p.sendEvent(ctx, event{ops: ops[:]}, 0)
 	})
 }
 
+func (s *initResolvedTSScan) consumeIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key,
+) error {
+	consumer := func(op enginepb.MVCCWriteIntentOp) bool {
+		s.summary.recordIntent(op)
+		var ops [1]enginepb.MVCCLogicalOp
+		ops[0].SetValue(&op)
+		return s.p.sendEvent(ctx, event{ops: ops[:]}, 0)
+	}
+	kis, ok := s.is.(KeyedIntentScanner)
+	if (s.checkpointer == nil && s.fallback == nil && s.slicer == nil) || !ok {
+		return s.is.ConsumeIntents(ctx, startKey, endKey, consumer)
+	}
+
+	resumeKey := startKey
+	if s.checkpointer != nil {
+		var err error
+		resumeKey, err = s.checkpointer.resume(ctx, roachpb.Span{Key: startKey, EndKey: endKey}, consumer)
+		if err != nil {
+			return errors.Wrap(err, "loading initial scan checkpoint")
+		}
+	}
+	// lastKey is the key of the last intent found, which a fallback scan or the
+	// next slice of the scan resumes after.
+	var lastKey roachpb.Key
+	var checkpointErr error
+	for {
+		var sliceDone bool
+		if err := kis.ConsumeKeyedIntents(ctx, resumeKey, endKey,
+			func(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+				consumer(op)
+				if s.fallback != nil || s.slicer != nil {
+					lastKey = append(lastKey[:0], key...)
+				}
+				if s.checkpointer != nil {
+					checkpointErr = s.checkpointer.afterIntent(ctx, key, op)
+				}
+				if s.slicer != nil {
+					sliceDone = s.slicer.afterIntent(key, op)
+				}
+				return checkpointErr == nil && !sliceDone
+			}); err != nil {
+			if s.fallback == nil || ctx.Err() != nil {
+				return err
+			}
+			if lastKey != nil {
+				resumeKey = lastKey.Next()
+			}
+			log.Warningf(ctx, "scanning for intents failed, falling back to legacy intent scanner at %s: %v",
+				resumeKey, err)
+			s.summary.FellBack = true
+			if err := s.fallback.ConsumeIntents(ctx, resumeKey, endKey, consumer); err != nil {
+				return errors.Wrap(err, "scanning for intents with legacy intent scanner")
+			}
+			break
+		} else if checkpointErr != nil {
+			return errors.Wrap(checkpointErr, "checkpointing initial scan")
+		}
+		if !sliceDone {
+			break
+		}
+		resumeKey = lastKey.Next()
+		if err := s.slicer.endSlice(ctx, s.p, resumeKey); err != nil {
+			return err
+		}
+	}
+	if s.checkpointer == nil {
+		return nil
+	}
+	return s.checkpointer.done(ctx)
+}
+
+// logSummary logs the summary of the scan, which took duration and finished
+// with err.
+func (s *initResolvedTSScan) logSummary(ctx context.Context, duration time.Duration, err error) {
+	s.summary.Span = s.span.String()
+	s.summary.Scanner = intentScannerName(s.is)
+	for _, is := range []IntentScanner{s.is, s.fallback} {
+		if kc, ok := is.(keyCountingIntentScanner); ok {
+			s.summary.KeysScanned += kc.keysScanned()
+		}
+	}
+	s.summary.log(ctx, duration, err)
+}
+
 func (s *initResolvedTSScan) Cancel() {
 	s.is.Close()
+	if s.fallback != nil {
+		s.fallback.Close()
+	}
 }
 
 type eventConsumer func(enginepb.MVCCWriteIntentOp) bool
@@ -93,16 +268,227 @@ type eventConsumer func(enginepb.MVCCWriteIntentOp) bool
 // IntentScanner is used by the ResolvedTSScan to find all intents on
 // a range.
 type IntentScanner interface {
-	// ConsumeIntents calls consumer on any intents found on keys between startKey and endKey.
+	// ConsumeIntents calls consumer on any intents found on keys between startKey and endKey,
+	// in key order.
 	ConsumeIntents(ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer eventConsumer) error
 	// Close closes the IntentScanner.
 	Close()
 }
 
+type keyedEventConsumer func(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool
+
+// KeyedIntentScanner is optionally implemented by an IntentScanner that is
+// able to report the key of each intent it finds. The initial resolved
+// timestamp scan can only checkpoint its progress using such a scanner.
+type KeyedIntentScanner interface {
+	// ConsumeKeyedIntents is like ConsumeIntents, but also passes consumer the
+	// key of each intent, which is only valid for the duration of the call.
+	// Scanning stops early if consumer returns false.
+	ConsumeKeyedIntents(ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer keyedEventConsumer) error
+}
+
+type inlineValueConsumer func(key roachpb.Key, value []byte) bool
+
+// InlineValueScanner is optionally implemented by an IntentScanner that is
+// also able to find inline (non-MVCC) values on a range.
+type InlineValueScanner interface {
+	// ConsumeInlineValues calls consumer on any inline values found on keys
+	// between startKey and endKey. The value passed to consumer is the raw
+	// bytes of the roachpb.Value.
+	ConsumeInlineValues(ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer inlineValueConsumer) error
+}
+
 // SeparatedIntentScanner is an IntentScanner that scans the lock table keyspace
-// and searches for intents.
+// and searches for intents. It is also a KeyedIntentScanner, an
+// InlineValueScanner, an IntentVerifier and an InterleavedIntentDetector.
 type SeparatedIntentScanner struct {
-	iter *storage.LockTableIterator
+	reader storage.Reader
+	iter   *storage.LockTableIterator
+
+	// pooled is set if the scanner was obtained from separatedIntentScannerPool
+	// and should be returned to it on Close.
+	pooled bool
+	// readOnly, if set, is the read-only engine view that a pooled scanner
+	// opens its iterator on. The view is itself pooled by the engine along with
+	// its engine iterator, which is reconfigured with the scan's bounds rather
+	// than allocated anew. It is closed along with the scanner.
+	readOnly storage.ReadWriter
+	// Buffers for the lock table keys used to bound and seek the iterator.
+	// These are retained by pooled scanners across scans.
+	lowerBuf, upperBuf, seekBuf []byte
+	// scanned is the number of lock table keys visited.
+	scanned int64
+}
+
+// UseLegacyIntentScanner controls whether the initial resolved timestamp scan
+// of a rangefeed finds intents by walking the MVCC keyspace, which also finds
+// interleaved intents, instead of scanning the lock table.
+var UseLegacyIntentScanner = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.legacy_intent_scanner.enabled",
+	"if enabled, rangefeed initial resolved timestamp scans find intents by walking the "+
+		"MVCC keyspace, which also finds interleaved intents, instead of scanning the lock table",
+	false,
+)
+
+// IntentScannerKind identifies the IntentScanner implementation used for a
+// Processor's initial resolved timestamp scan.
+type IntentScannerKind int
+
+const (
+	// SeparatedIntentScannerKind scans the lock table for separated intents
+	// using a SeparatedIntentScanner.
+	SeparatedIntentScannerKind IntentScannerKind = iota
+	// LegacyIntentScannerKind walks the MVCC keyspace for interleaved intents
+	// using a LegacyIntentScanner.
+	LegacyIntentScannerKind
+)
+
+func (k IntentScannerKind) String() string {
+	switch k {
+	case SeparatedIntentScannerKind:
+		return "separated"
+	case LegacyIntentScannerKind:
+		return "legacy"
+	default:
+		return fmt.Sprintf("IntentScannerKind(%d)", int(k))
+	}
+}
+
+// selectIntentScannerKind returns the IntentScannerKind to use under the given
+// cluster settings.
+func selectIntentScannerKind(st *cluster.Settings) IntentScannerKind {
+	if st != nil && UseLegacyIntentScanner.Get(&st.SV) {
+		return LegacyIntentScannerKind
+	}
+	return SeparatedIntentScannerKind
+}
+
+// NewIntentScanner returns an IntentScanner of the given kind.
+func NewIntentScanner(
+	ctx context.Context, kind IntentScannerKind, reader storage.Reader, span roachpb.RSpan,
+) (IntentScanner, error) {
+	switch kind {
+	case SeparatedIntentScannerKind:
+		return NewSeparatedIntentScanner(ctx, reader, span)
+	case LegacyIntentScannerKind:
+		return NewLegacyIntentScanner(reader, span)
+	default:
+		return nil, errors.AssertionFailedf("unknown intent scanner kind %s", kind)
+	}
+}
+
+// fallbackIntentScanner is an IntentScanner whose initial resolved timestamp
+// scan falls back to another scanner if scanning for intents fails. Its own
+// ConsumeIntents only uses the primary scanner.
+type fallbackIntentScanner struct {
+	primary  IntentScanner
+	fallback IntentScanner
+}
+
+// NewIntentScannerWithFallback returns an IntentScanner that scans for intents
+// using primary, but that the initial resolved timestamp scan falls back to
+// fallback for if primary fails, e.g. due to a bug in its implementation. The
+// fallback must read the same state as primary, so both should be created at
+// the same time, and it is closed along with primary.
+func NewIntentScannerWithFallback(primary, fallback IntentScanner) IntentScanner {
+	return &fallbackIntentScanner{primary: primary, fallback: fallback}
+}
+
+// ConsumeIntents implements the IntentScanner interface.
+func (f *fallbackIntentScanner) ConsumeIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer eventConsumer,
+) error {
+	return f.primary.ConsumeIntents(ctx, startKey, endKey, consumer)
+}
+
+// Close implements the IntentScanner interface.
+func (f *fallbackIntentScanner) Close() {
+	f.primary.Close()
+	f.fallback.Close()
+}
+
+// LegacyIntentScanner is an IntentScanner that searches for intents by walking
+// the MVCC keyspace with an intent interleaving iterator, like rangefeeds did
+// before intents were separated. It finds intents that are still interleaved
+// with MVCC values, but is much slower than the SeparatedIntentScanner. As it
+// doesn't share the SeparatedIntentScanner's code path, it also serves as its
+// fallback.
+type LegacyIntentScanner struct {
+	iter storage.MVCCIterator
+	// scanned is the number of MVCC keys visited.
+	scanned int64
+}
+
+// NewLegacyIntentScanner returns a LegacyIntentScanner over the given span.
+func NewLegacyIntentScanner(reader storage.Reader, span roachpb.RSpan) (IntentScanner, error) {
+	// See the comment in NewSeparatedIntentScanner about not using ctx.
+	iter, err := reader.NewMVCCIterator(context.Background(), storage.MVCCKeyAndIntentsIterKind, storage.IterOptions{
+		LowerBound:   span.Key.AsRawKey(),
+		UpperBound:   span.EndKey.AsRawKey(),
+		KeyTypes:     storage.IterKeyTypePointsOnly,
+		ReadCategory: fs.RangefeedReadCategory,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &LegacyIntentScanner{iter: iter}, nil
+}
+
+// ConsumeIntents implements the IntentScanner interface.
+func (l *LegacyIntentScanner) ConsumeIntents(
+	ctx context.Context, startKey roachpb.Key, _ roachpb.Key, consumer eventConsumer,
+) error {
+	var meta enginepb.MVCCMetadata
+	for l.iter.SeekGE(storage.MVCCKey{Key: startKey}); ; l.iter.NextKey() {
+		if ok, err := l.iter.Valid(); err != nil {
+			return err
+		} else if !ok {
+			// We depend on the iterator having an UpperBound set and becoming
+			// invalid when it hits the UpperBound.
+			break
+		}
+
+		l.scanned++
+		// Intents are interleaved as unversioned metadata keys, which are
+		// otherwise only used for inline values.
+		unsafeKey := l.iter.UnsafeKey()
+		if unsafeKey.IsValue() {
+			continue
+		}
+		v, err := l.iter.UnsafeValue()
+		if err != nil {
+			return err
+		}
+		if err := protoutil.Unmarshal(v, &meta); err != nil {
+			return errors.Wrapf(err, "unmarshaling mvcc meta for key %s", unsafeKey)
+		}
+		if meta.Txn == nil {
+			continue
+		}
+		consumer(enginepb.MVCCWriteIntentOp{
+			TxnID:           meta.Txn.ID,
+			TxnKey:          meta.Txn.Key,
+			TxnIsoLevel:     meta.Txn.IsoLevel,
+			TxnMinTimestamp: meta.Txn.MinTimestamp,
+			Timestamp:       meta.Txn.WriteTimestamp,
+		})
+	}
+	return nil
+}
+
+// Close implements the IntentScanner interface.
+func (l *LegacyIntentScanner) Close() {
+	l.iter.Close()
+}
+
+// keysScanned implements the keyCountingIntentScanner interface.
+func (l *LegacyIntentScanner) keysScanned() int64 {
+	return l.scanned
+}
+
+var separatedIntentScannerPool = sync.Pool{
+	New: func() interface{} { return new(SeparatedIntentScanner) },
 }
 
 // NewSeparatedIntentScanner returns an IntentScanner appropriate for
@@ -110,8 +496,42 @@ type SeparatedIntentScanner struct {
 func NewSeparatedIntentScanner(
 	ctx context.Context, reader storage.Reader, span roachpb.RSpan,
 ) (IntentScanner, error) {
-	lowerBound, _ := keys.LockTableSingleKey(span.Key.AsRawKey(), nil)
-	upperBound, _ := keys.LockTableSingleKey(span.EndKey.AsRawKey(), nil)
+	s := &SeparatedIntentScanner{}
+	if err := s.init(reader, span); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// NewPooledSeparatedIntentScanner is like NewSeparatedIntentScanner, but
+// reuses a scanner from a pool that is shared across initial resolved timestamp
+// scans, avoiding allocation churn when rangefeeds are restarted frequently.
+//
+// If reader is an Engine, the scanner's iterator is opened on a pooled
+// read-only view of it, whose engine iterator is reused with the new bounds
+// instead of being allocated for every scan. The view pins the engine's state
+// when the iterator is opened, so the scanner always observes the current
+// state of the engine, like a fresh one would.
+func NewPooledSeparatedIntentScanner(
+	ctx context.Context, reader storage.Reader, span roachpb.RSpan,
+) (IntentScanner, error) {
+	s := separatedIntentScannerPool.Get().(*SeparatedIntentScanner)
+	s.pooled = true
+	if eng, ok := reader.(storage.Engine); ok {
+		s.readOnly = eng.NewReadOnly(storage.StandardDurability)
+		reader = s.readOnly
+	}
+	if err := s.init(reader, span); err != nil {
+		s.release()
+		return nil, err
+	}
+	return s, nil
+}
+
+func (s *SeparatedIntentScanner) init(reader storage.Reader, span roachpb.RSpan) error {
+	var lowerBound, upperBound roachpb.Key
+	lowerBound, s.lowerBuf = keys.LockTableSingleKey(span.Key.AsRawKey(), s.lowerBuf)
+	upperBound, s.upperBuf = keys.LockTableSingleKey(span.EndKey.AsRawKey(), s.upperBuf)
 	iter, err := storage.NewLockTableIterator(
 		// Do not use ctx, since it is not the ctx passed in when ConsumeIntents
 		// is called. See https://github.com/cockroachdb/cockroach/issues/116440.
@@ -126,16 +546,46 @@ func NewSeparatedIntentScanner(
 			ReadCategory: fs.RangefeedReadCategory,
 		})
 	if err != nil {
-		return nil, err
+		return err
 	}
-	return &SeparatedIntentScanner{iter: iter}, nil
+	s.reader = reader
+	s.iter = iter
+	return nil
+}
+
+// release returns a pooled scanner to the pool, retaining its buffers.
+func (s *SeparatedIntentScanner) release() {
+	if s.readOnly != nil {
+		s.readOnly.Close()
+		s.readOnly = nil
+	}
+	if !s.pooled {
+		return
+	}
+	*s = SeparatedIntentScanner{
+		lowerBuf: s.lowerBuf,
+		upperBuf: s.upperBuf,
+		seekBuf:  s.seekBuf,
+	}
+	separatedIntentScannerPool.Put(s)
 }
 
 // ConsumeIntents implements the IntentScanner interface.
 func (s *SeparatedIntentScanner) ConsumeIntents(
-	ctx context.Context, startKey roachpb.Key, _ roachpb.Key, consumer eventConsumer,
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer eventConsumer,
 ) error {
-	ltStart, _ := keys.LockTableSingleKey(startKey, nil)
+	return s.ConsumeKeyedIntents(ctx, startKey, endKey, func(_ roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+		consumer(op)
+		return true
+	})
+}
+
+// ConsumeKeyedIntents implements the KeyedIntentScanner interface.
+func (s *SeparatedIntentScanner) ConsumeKeyedIntents(
+	ctx context.Context, startKey roachpb.Key, _ roachpb.Key, consumer keyedEventConsumer,
+) error {
+	var ltStart roachpb.Key
+	ltStart, s.seekBuf = keys.LockTableSingleKey(startKey, s.seekBuf)
 	var meta enginepb.MVCCMetadata
 	// TODO(sumeer): ctx is not used for iteration. Fix by adding a method to
 	// EngineIterator to replace the context.
@@ -149,6 +599,7 @@ func (s *SeparatedIntentScanner) ConsumeIntents(
 			break
 		}
 
+		s.scanned++
 		engineKey, err := s.iter.UnsafeEngineKey()
 		if err != nil {
 			return err
@@ -172,19 +623,228 @@ func (s *SeparatedIntentScanner) ConsumeIntents(
 			return errors.Newf("expected transaction metadata but found none for %s", ltKey)
 		}
 
-		consumer(enginepb.MVCCWriteIntentOp{
+		if !consumer(ltKey.Key, enginepb.MVCCWriteIntentOp{
 			TxnID:           meta.Txn.ID,
 			TxnKey:          meta.Txn.Key,
 			TxnIsoLevel:     meta.Txn.IsoLevel,
 			TxnMinTimestamp: meta.Txn.MinTimestamp,
 			Timestamp:       meta.Txn.WriteTimestamp,
-		})
+		}) {
+			break
+		}
 	}
 	return nil
 }
 
-// Close implements the IntentScanner interface.
-func (s *SeparatedIntentScanner) Close() { s.iter.Close() }
+// ConsumeInlineValues implements the InlineValueScanner interface.
+func (s *SeparatedIntentScanner) ConsumeInlineValues(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer inlineValueConsumer,
+) error {
+	// See the comment in NewSeparatedIntentScanner about not using ctx.
+	iter, err := s.reader.NewMVCCIterator(context.Background(), storage.MVCCKeyIterKind, storage.IterOptions{
+		LowerBound:   startKey,
+		UpperBound:   endKey,
+		KeyTypes:     storage.IterKeyTypePointsOnly,
+		ReadCategory: fs.RangefeedReadCategory,
+	})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	var meta enginepb.MVCCMetadata
+	for iter.SeekGE(storage.MVCCKey{Key: startKey}); ; iter.NextKey() {
+		if ok, err := iter.Valid(); err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+
+		// Intents live in the lock table, so the only unversioned keys in the
+		// MVCC keyspace are inline values.
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.IsValue() {
+			continue
+		}
+		v, err := iter.UnsafeValue()
+		if err != nil {
+			return err
+		}
+		if err := protoutil.Unmarshal(v, &meta); err != nil {
+			return errors.Wrapf(err, "unmarshaling mvcc meta for key %s", unsafeKey)
+		}
+		if !meta.IsInline() {
+			continue
+		}
+		if !consumer(unsafeKey.Key.Clone(), meta.RawBytes) {
+			break
+		}
+	}
+	return nil
+}
+
+// ConsumeInterleavedIntents implements the InterleavedIntentDetector interface.
+func (s *SeparatedIntentScanner) ConsumeInterleavedIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer keyedEventConsumer,
+) error {
+	// See the comment in NewSeparatedIntentScanner about not using ctx.
+	iter, err := s.reader.NewMVCCIterator(context.Background(), storage.MVCCKeyIterKind, storage.IterOptions{
+		LowerBound:   startKey,
+		UpperBound:   endKey,
+		KeyTypes:     storage.IterKeyTypePointsOnly,
+		ReadCategory: fs.RangefeedReadCategory,
+	})
+	if err != nil {
+		return err
+	}
+	defer iter.Close()
+
+	var meta enginepb.MVCCMetadata
+	for iter.SeekGE(storage.MVCCKey{Key: startKey}); ; iter.NextKey() {
+		if ok, err := iter.Valid(); err != nil {
+			return err
+		} else if !ok {
+			break
+		}
+
+		// An unversioned key in the MVCC keyspace that isn't an inline value
+		// is metadata that was written before intents were separated.
+		unsafeKey := iter.UnsafeKey()
+		if unsafeKey.IsValue() {
+			continue
+		}
+		v, err := iter.UnsafeValue()
+		if err != nil {
+			return err
+		}
+		if err := protoutil.Unmarshal(v, &meta); err != nil {
+			return errors.Wrapf(err, "unmarshaling mvcc meta for key %s", unsafeKey)
+		}
+		if meta.Txn == nil {
+			continue
+		}
+		if !consumer(unsafeKey.Key.Clone(), enginepb.MVCCWriteIntentOp{
+			TxnID:           meta.Txn.ID,
+			TxnKey:          meta.Txn.Key,
+			TxnIsoLevel:     meta.Txn.IsoLevel,
+			TxnPriority:     meta.Txn.Priority,
+			TxnMinTimestamp: meta.Txn.MinTimestamp,
+			Timestamp:       meta.Txn.WriteTimestamp,
+		}) {
+			break
+		}
+	}
+	return nil
+}
+
+// VerifyIntents implements the IntentVerifier interface.
+func (s *SeparatedIntentScanner) VerifyIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, report intentInconsistencyConsumer,
+) error {
+	// The lock table and the MVCC keyspace are read by separate iterators,
+	// which must observe the same state for intents that are concurrently
+	// resolved not to be mistaken for inconsistencies.
+	reader := s.reader
+	if !reader.ConsistentIterators() {
+		eng, ok := reader.(storage.Engine)
+		if !ok {
+			return errors.AssertionFailedf("cannot verify intents using reader %T", reader)
+		}
+		reader = eng.NewSnapshot()
+		defer reader.Close()
+	}
+
+	// See the comment in NewSeparatedIntentScanner about not using ctx.
+	lowerBound, _ := keys.LockTableSingleKey(startKey, nil)
+	upperBound, _ := keys.LockTableSingleKey(endKey, nil)
+	ltIter, err := storage.NewLockTableIterator(context.Background(), reader, storage.LockTableIteratorOptions{
+		LowerBound:   lowerBound,
+		UpperBound:   upperBound,
+		MatchMinStr:  lock.Intent,
+		ReadCategory: fs.RangefeedReadCategory,
+	})
+	if err != nil {
+		return err
+	}
+	defer ltIter.Close()
+	mvccIter, err := reader.NewMVCCIterator(context.Background(), storage.MVCCKeyIterKind, storage.IterOptions{
+		LowerBound:   startKey,
+		UpperBound:   endKey,
+		KeyTypes:     storage.IterKeyTypePointsOnly,
+		ReadCategory: fs.RangefeedReadCategory,
+	})
+	if err != nil {
+		return err
+	}
+	defer mvccIter.Close()
+
+	var meta enginepb.MVCCMetadata
+	for valid, err := ltIter.SeekEngineKeyGE(storage.EngineKey{Key: lowerBound}); ; valid, err = ltIter.NextEngineKey() {
+		if err != nil {
+			return err
+		} else if !valid {
+			break
+		}
+		engineKey, err := ltIter.UnsafeEngineKey()
+		if err != nil {
+			return err
+		}
+		ltKey, err := engineKey.ToLockTableKey()
+		if err != nil {
+			return errors.Wrapf(err, "decoding LockTable key: %s", ltKey)
+		}
+		v, err := ltIter.UnsafeValue()
+		if err != nil {
+			return err
+		}
+		if err := protoutil.Unmarshal(v, &meta); err != nil {
+			return errors.Wrapf(err, "unmarshaling mvcc meta for locked key %s", ltKey)
+		}
+
+		// Find the newest version of the intent's key, which should be its
+		// provisional value.
+		var valueTS hlc.Timestamp
+		for mvccIter.SeekGE(storage.MVCCKey{Key: ltKey.Key}); ; mvccIter.Next() {
+			if ok, err := mvccIter.Valid(); err != nil {
+				return err
+			} else if !ok {
+				break
+			}
+			unsafeKey := mvccIter.UnsafeKey()
+			if !unsafeKey.Key.Equal(ltKey.Key) {
+				break
+			}
+			if unsafeKey.IsValue() {
+				valueTS = unsafeKey.Timestamp
+				break
+			}
+		}
+		if intentTS := meta.Timestamp.ToTimestamp(); valueTS != intentTS {
+			report(IntentInconsistency{
+				Key:      ltKey.Key.Clone(),
+				IntentTS: intentTS,
+				ValueTS:  valueTS,
+			})
+		}
+	}
+	return nil
+}
+
+// Close implements the IntentScanner interface. It is a no-op if the scanner
+// is already closed.
+func (s *SeparatedIntentScanner) Close() {
+	if s.iter == nil {
+		return
+	}
+	s.iter.Close()
+	s.iter = nil
+	s.release()
+}
+
+// keysScanned implements the keyCountingIntentScanner interface.
+func (s *SeparatedIntentScanner) keysScanned() int64 {
+	return s.scanned
+}
 
 // TxnPusher is capable of pushing transactions to a new timestamp and
 // cleaning up the intents of transactions that are found to be committed.
@@ -196,6 +856,9 @@ type TxnPusher interface {
 	//
 	// NB: anyAmbiguousAbort may be false with nodes <24.1.
 	PushTxns(context.Context, []enginepb.TxnMeta, hlc.Timestamp) ([]*roachpb.Transaction, bool, error)
+	// QueryTxns returns the current transaction records of the specified
+	// transactions, in the same order, without pushing them.
+	QueryTxns(context.Context, []enginepb.TxnMeta) ([]*roachpb.Transaction, error)
 	// ResolveIntents resolves the specified intents.
 	ResolveIntents(ctx context.Context, intents []roachpb.LockUpdate) error
 	// Barrier waits for all past and ongoing write commands in the range to have
@@ -203,6 +866,51 @@ type TxnPusher interface {
 	Barrier(ctx context.Context) error
 }
 
+// PushOpOrder determines the order of the logical ops in the event that a push
+// attempt emits for the transactions it pushed.
+type PushOpOrder int
+
+const (
+	// PushOpsInPushOrder emits the ops in the order in which the transactions
+	// were pushed.
+	PushOpsInPushOrder PushOpOrder = iota
+	// PushOpsAbortsFirst emits the MVCCAbortTxnOps of the aborted transactions
+	// before the MVCCUpdateIntentOps of the others, e.g. so that consumers can
+	// clean up after the aborted transactions first.
+	PushOpsAbortsFirst
+	// PushOpsUpdatesFirst emits the MVCCUpdateIntentOps before the
+	// MVCCAbortTxnOps.
+	PushOpsUpdatesFirst
+)
+
+func (o PushOpOrder) String() string {
+	switch o {
+	case PushOpsInPushOrder:
+		return "in_push_order"
+	case PushOpsAbortsFirst:
+		return "aborts_first"
+	case PushOpsUpdatesFirst:
+		return "updates_first"
+	default:
+		return fmt.Sprintf("PushOpOrder(%d)", int(o))
+	}
+}
+
+// apply reorders ops according to o. The ops of each kind keep the order in
+// which their transactions were pushed.
+func (o PushOpOrder) apply(ops []enginepb.MVCCLogicalOp) {
+	if o != PushOpsAbortsFirst && o != PushOpsUpdatesFirst {
+		return
+	}
+	first := func(op enginepb.MVCCLogicalOp) bool {
+		_, abort := op.GetValue().(*enginepb.MVCCAbortTxnOp)
+		return abort == (o == PushOpsAbortsFirst)
+	}
+	sort.SliceStable(ops, func(i, j int) bool {
+		return first(ops[i]) && !first(ops[j])
+	})
+}
+
 // txnPushAttempt pushes all old transactions that have unresolved intents on
 // the range which are blocking the resolved timestamp from moving forward. It
 // does so in two steps.
@@ -221,6 +929,7 @@ type TxnPusher interface {
 //     - ABORTED:   inform the Processor to stop caring about the transaction.
 //     It will never commit and its intents can be safely ignored.
 type txnPushAttempt struct {
+	txnPushAttemptOptions
 	st     *cluster.Settings
 	span   roachpb.RSpan
 	pusher TxnPusher
@@ -230,6 +939,30 @@ type txnPushAttempt struct {
 	done   func()
 }
 
+// txnPushAttemptOptions configures the optional behaviors of a txnPushAttempt.
+// The zero value enables none of them.
+type txnPushAttemptOptions struct {
+	// skipPriority, if non-zero, exempts transactions whose records have at
+	// least this priority from the push.
+	skipPriority enginepb.TxnPriority
+	// skipMaxAge, if positive, ends the exemption of transactions whose intents
+	// are older than this at the push timestamp.
+	skipMaxAge time.Duration
+	// maxResolveBytes, if positive, bounds the total size of the outstanding
+	// intent resolution requests.
+	maxResolveBytes int64
+	// metrics, if set, counts the finalized transactions without LockSpans.
+	metrics *Metrics
+	// committedScanner, if set, is used to find the intents of committed
+	// transactions without LockSpans, see Config.CommittedIntentScanner.
+	committedScanner IntentScannerConstructor
+	// lockSpans, if set, caps the lock spans resolved per transaction, see
+	// Config.MaxLockSpansPerTxn.
+	lockSpans *lockSpanCursor
+	// opOrder orders the ops of the emitted event, see Config.PushOpOrder.
+	opOrder PushOpOrder
+}
+
 func newTxnPushAttempt(
 	st *cluster.Settings,
 	span roachpb.RSpan,
@@ -238,20 +971,29 @@ func newTxnPushAttempt(
 	txns []enginepb.TxnMeta,
 	ts hlc.Timestamp,
 	done func(),
+	opts txnPushAttemptOptions,
 ) runnable {
 	return &txnPushAttempt{
-		st:     st,
-		span:   span,
-		pusher: pusher,
-		p:      p,
-		txns:   txns,
-		ts:     ts,
-		done:   done,
+		txnPushAttemptOptions: opts,
+		st:                    st,
+		span:                  span,
+		pusher:                pusher,
+		p:                     p,
+		txns:                  txns,
+		ts:                    ts,
+		done:                  done,
 	}
 }
 
 func (a *txnPushAttempt) Run(ctx context.Context) {
 	defer a.Cancel()
+	if log.ExpensiveLogEnabled(ctx, 2) {
+		if rec, err := a.record().Encode(); err != nil {
+			log.VEventf(ctx, 2, "unable to record push attempt: %v", err)
+		} else {
+			log.VEventf(ctx, 2, "push attempt record: %s", rec)
+		}
+	}
 	if err := a.pushOldTxns(ctx); err != nil {
 		if ctx.Err() == nil { // cancellation probably caused the error
 			log.Errorf(ctx, "pushing old intents failed: %v", err)
@@ -259,25 +1001,75 @@ func (a *txnPushAttempt) Run(ctx context.Context) {
 	}
 }
 
+// exemptHighPriorityTxns returns the given transactions without those whose
+// records have at least the attempt's skipPriority, unless their intents are
+// older than skipMaxAge. Intents don't carry their transaction's priority, so
+// the records are queried first.
+func (a *txnPushAttempt) exemptHighPriorityTxns(
+	ctx context.Context, txns []enginepb.TxnMeta,
+) ([]enginepb.TxnMeta, error) {
+	queriedTxns, err := a.pusher.QueryTxns(ctx, txns)
+	if err != nil {
+		return nil, err
+	}
+	if len(queriedTxns) != len(txns) {
+		return nil, errors.AssertionFailedf("tried to query %d transactions, got response for %d",
+			len(txns), len(queriedTxns))
+	}
+	toPush := make([]enginepb.TxnMeta, 0, len(txns))
+	for i, txn := range queriedTxns {
+		if txn.Priority >= a.skipPriority && !a.exemptionExpired(txns[i]) {
+			log.VEventf(ctx, 2, "not pushing txn %s with priority %d", txn.ID.Short(), txn.Priority)
+			continue
+		}
+		toPush = append(toPush, txns[i])
+	}
+	return toPush, nil
+}
+
+// exemptionExpired returns whether the intents of the given transaction are
+// older than skipMaxAge at the push timestamp.
+func (a *txnPushAttempt) exemptionExpired(txn enginepb.TxnMeta) bool {
+	return a.skipMaxAge > 0 && txn.WriteTimestamp.Add(a.skipMaxAge.Nanoseconds(), 0).Less(a.ts)
+}
+
 func (a *txnPushAttempt) pushOldTxns(ctx context.Context) error {
 	// Push all transactions using the TxnPusher to the current time.
 	// This may cause transaction restarts, but span refreshing should
 	// prevent a restart for any transaction that has not been written
 	// over at a larger timestamp.
-	pushedTxns, anyAmbiguousAbort, err := a.pusher.PushTxns(ctx, a.txns, a.ts)
+	txns := a.txns
+	if a.skipPriority != 0 {
+		var err error
+		if txns, err = a.exemptHighPriorityTxns(ctx, txns); err != nil {
+			return err
+		}
+		if len(txns) == 0 {
+			return nil
+		}
+	}
+	pushedTxns, anyAmbiguousAbort, err := a.pusher.PushTxns(ctx, txns, a.ts)
 	if err != nil {
 		return err
 	}
-	if len(pushedTxns) != len(a.txns) {
+	if len(pushedTxns) != len(txns) {
 		// We expect results for all txns. In particular, if no txns have been pushed, we'd
 		// crash later cause we'd be creating an invalid empty event.
 		return errors.AssertionFailedf("tried to push %d transactions, got response for %d",
-			len(a.txns), len(pushedTxns))
+			len(txns), len(pushedTxns))
 	}
 
 	// Inform the Processor of the results of the push for each transaction.
 	ops := make([]enginepb.MVCCLogicalOp, len(pushedTxns))
 	var intentsToCleanup []roachpb.LockUpdate
+	// resumeAt records where the next attempt resumes resolving the lock spans
+	// of each transaction whose lock spans were capped.
+	var resumeAt map[uuid.UUID]int
+	if a.lockSpans != nil {
+		a.lockSpans.retain(a.txns)
+		resumeAt = make(map[uuid.UUID]int)
+	}
+	var committedWithoutLockSpans []*roachpb.Transaction
 	for i, txn := range pushedTxns {
 		switch txn.Status {
 		case roachpb.PENDING, roachpb.STAGING:
@@ -305,8 +1097,16 @@ func (a *txnPushAttempt) pushOldTxns(ctx context.Context) error {
 			// intents are resolved before the resolved timestamp can advance past the
 			// transaction's commit timestamp, so the best we can do is help speed up
 			// the resolution.
-			txnIntents := intentsInBound(txn, a.span.AsRawSpanWithNoLocals())
-			intentsToCleanup = append(intentsToCleanup, txnIntents...)
+			txnIntents, ignored := intentsInBound(ctx, txn, a.span.AsRawSpanWithNoLocals())
+			intentsToCleanup = append(intentsToCleanup, a.capLockSpans(ctx, txn, txnIntents, resumeAt)...)
+			a.logIgnored(ctx, txn, ignored)
+			a.countMissingLockSpans(txn)
+
+			// Without LockSpans, the intents can only be found by scanning the
+			// range for them, if configured to.
+			if len(txn.LockSpans) == 0 && a.committedScanner != nil {
+				committedWithoutLockSpans = append(committedWithoutLockSpans, txn)
+			}
 		case roachpb.ABORTED:
 			// The transaction is aborted, so it doesn't need to be tracked
 			// anymore nor does it need to prevent the resolved timestamp from
@@ -332,8 +1132,10 @@ func (a *txnPushAttempt) pushOldTxns(ctx context.Context) error {
 			// LockSpans populated. If, however, we ran into a transaction that its
 			// coordinator tried to rollback but didn't follow up with garbage
 			// collection, then LockSpans will be populated.
-			txnIntents := intentsInBound(txn, a.span.AsRawSpanWithNoLocals())
-			intentsToCleanup = append(intentsToCleanup, txnIntents...)
+			txnIntents, ignored := intentsInBound(ctx, txn, a.span.AsRawSpanWithNoLocals())
+			intentsToCleanup = append(intentsToCleanup, a.capLockSpans(ctx, txn, txnIntents, resumeAt)...)
+			a.logIgnored(ctx, txn, ignored)
+			a.countMissingLockSpans(txn)
 		}
 	}
 
@@ -380,17 +1182,226 @@ func (a *txnPushAttempt) pushOldTxns(ctx context.Context) error {
 		}
 	}
 
+	if len(committedWithoutLockSpans) > 0 {
+		txnIntents, err := a.scanCommittedIntents(ctx, committedWithoutLockSpans)
+		if err != nil {
+			return err
+		}
+		intentsToCleanup = append(intentsToCleanup, txnIntents...)
+	}
+
 	// Inform the processor of all logical ops.
+	a.opOrder.apply(ops)
 	a.p.sendEvent(ctx, event{ops: ops}, 0)
 
-	// Resolve intents, if necessary.
-	return a.pusher.ResolveIntents(ctx, intentsToCleanup)
+	// Resolve intents, if necessary. The next attempt only moves on to the
+	// deferred lock spans once those of this one have been resolved.
+	if err := a.resolveIntents(ctx, intentsToCleanup); err != nil {
+		return err
+	}
+	if a.lockSpans != nil {
+		a.lockSpans.advance(resumeAt)
+	}
+	return nil
+}
+
+// capLockSpans returns the portion of the given LockUpdates of a finalized
+// transaction that the attempt resolves, and records in resumeAt where the
+// next attempt resumes if some are deferred. Lock spans are only capped if
+// lockSpans is set.
+func (a *txnPushAttempt) capLockSpans(
+	ctx context.Context,
+	txn *roachpb.Transaction,
+	updates []roachpb.LockUpdate,
+	resumeAt map[uuid.UUID]int,
+) []roachpb.LockUpdate {
+	if a.lockSpans == nil {
+		return updates
+	}
+	from, to := a.lockSpans.next(txn.ID, len(updates))
+	if to < len(updates) {
+		log.VEventf(ctx, 2, "txn %s: resolving lock spans %d-%d of %d, deferring the rest",
+			txn.Short(), from, to, len(updates))
+		resumeAt[txn.ID] = to
+	} else {
+		resumeAt[txn.ID] = 0
+	}
+	return updates[from:to]
+}
+
+// resolveIntents resolves the given intents. If maxResolveBytes is set, they
+// are resolved in batches of at most that size, which are issued concurrently
+// as long as the total size of the outstanding batches stays within it.
+func (a *txnPushAttempt) resolveIntents(ctx context.Context, intents []roachpb.LockUpdate) error {
+	if a.maxResolveBytes <= 0 || len(intents) == 0 {
+		return a.pusher.ResolveIntents(ctx, intents)
+	}
+	budget := quotapool.NewIntPool("rangefeed-resolve-intents", uint64(a.maxResolveBytes))
+	g := ctxgroup.WithContext(ctx)
+	for len(intents) > 0 {
+		// Each batch holds at least one intent, even if that exceeds the budget,
+		// in which case it waits for the entire budget.
+		n, batchBytes := 1, int64(intents[0].Size())
+		for ; n < len(intents); n++ {
+			size := int64(intents[n].Size())
+			if batchBytes+size > a.maxResolveBytes {
+				break
+			}
+			batchBytes += size
+		}
+		batch := intents[:n]
+		intents = intents[n:]
+
+		alloc, err := budget.Acquire(ctx, uint64(batchBytes))
+		if err != nil {
+			_ = g.Wait()
+			return err
+		}
+		g.GoCtx(func(ctx context.Context) error {
+			defer alloc.Release()
+			return a.pusher.ResolveIntents(ctx, batch)
+		})
+	}
+	return g.Wait()
+}
+
+// logIgnored logs, at verbosity level 1, the lock spans of the transaction that
+// lie entirely outside of the processor's range and that the attempt thus
+// leaves for the other ranges' rangefeeds or the transaction's coordinator to
+// resolve.
+func (a *txnPushAttempt) logIgnored(
+	ctx context.Context, txn *roachpb.Transaction, ignored []roachpb.Span,
+) {
+	if len(ignored) > 0 {
+		log.VEventf(ctx, 1, "txn %s: ignored lock spans outside of %s: %v",
+			txn.Short(), a.span, ignored)
+	}
+}
+
+// scanCommittedIntents scans the range for the intents of the given committed
+// transactions, whose LockSpans are missing, and returns the LockUpdates that
+// resolve them.
+func (a *txnPushAttempt) scanCommittedIntents(
+	ctx context.Context, txns []*roachpb.Transaction,
+) ([]roachpb.LockUpdate, error) {
+	scanner := a.committedScanner()
+	if scanner == nil {
+		return nil, errors.New("failed to create a scanner for committed intents")
+	}
+	defer scanner.Close()
+	kis, ok := scanner.(KeyedIntentScanner)
+	if !ok {
+		return nil, errors.AssertionFailedf("%T can't scan for committed intents", scanner)
+	}
+	byID := make(map[uuid.UUID]*roachpb.Transaction, len(txns))
+	for _, txn := range txns {
+		byID[txn.ID] = txn
+	}
+	bound := a.span.AsRawSpanWithNoLocals()
+	var intents []roachpb.LockUpdate
+	if err := kis.ConsumeKeyedIntents(ctx, bound.Key, bound.EndKey,
+		func(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+			if txn, ok := byID[op.TxnID]; ok {
+				intents = append(intents, roachpb.MakeLockUpdate(txn, roachpb.Span{Key: key.Clone()}))
+			}
+			return true
+		}); err != nil {
+		return nil, errors.Wrap(err, "scanning for committed intents")
+	}
+	log.VEventf(ctx, 2, "found %d intents of %d committed txns without lock spans",
+		len(intents), len(txns))
+	return intents, nil
+}
+
+// countMissingLockSpans counts the finalized txn if it has no LockSpans, in
+// which case none of its intents could be resolved by the push attempt.
+func (a *txnPushAttempt) countMissingLockSpans(txn *roachpb.Transaction) {
+	if a.metrics != nil && len(txn.LockSpans) == 0 {
+		a.metrics.RangeFeedPushTxnsMissingLockSpans.Inc(1)
+	}
 }
 
 func (a *txnPushAttempt) Cancel() {
 	a.done()
 }
 
+// lockSpanCursor caps the number of lock spans of each transaction that a push
+// attempt resolves, see Config.MaxLockSpansPerTxn, and remembers across
+// attempts how many of each transaction's lock spans were resolved so far.
+// Lock spans are counted after they have been clamped to the range, and are
+// resolved in order, since the lock spans of a finalized transaction don't
+// change.
+type lockSpanCursor struct {
+	max int
+	mu  struct {
+		syncutil.Mutex
+		// resolved is the number of lock spans resolved so far, for each
+		// transaction with deferred lock spans.
+		resolved map[uuid.UUID]int
+	}
+}
+
+// newLockSpanCursor returns a lockSpanCursor that caps the lock spans resolved
+// per transaction at max, or nil if max isn't positive.
+func newLockSpanCursor(max int) *lockSpanCursor {
+	if max <= 0 {
+		return nil
+	}
+	c := &lockSpanCursor{max: max}
+	c.mu.resolved = make(map[uuid.UUID]int)
+	return c
+}
+
+// next returns the range [from, to) of the n lock spans of the transaction to
+// resolve next.
+func (c *lockSpanCursor) next(txnID uuid.UUID, n int) (from, to int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	from = c.mu.resolved[txnID]
+	if from >= n {
+		// The lock spans changed under us, so start over.
+		from = 0
+	}
+	to = from + c.max
+	if to > n {
+		to = n
+	}
+	return from, to
+}
+
+// advance records the number of lock spans of each transaction that have been
+// resolved. Zero marks a transaction whose lock spans have all been resolved,
+// which is forgotten.
+func (c *lockSpanCursor) advance(resolved map[uuid.UUID]int) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for txnID, n := range resolved {
+		if n == 0 {
+			delete(c.mu.resolved, txnID)
+		} else {
+			c.mu.resolved[txnID] = n
+		}
+	}
+}
+
+// retain forgets the transactions that aren't being pushed, e.g. because their
+// remaining intents were resolved by someone else. If such a transaction is
+// pushed again after all, its lock spans are resolved from the start, which is
+// wasteful but harmless.
+func (c *lockSpanCursor) retain(txns []enginepb.TxnMeta) {
+	pushed := make(map[uuid.UUID]struct{}, len(txns))
+	for _, txn := range txns {
+		pushed[txn.ID] = struct{}{}
+	}
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	for txnID := range c.mu.resolved {
+		if _, ok := pushed[txnID]; !ok {
+			delete(c.mu.resolved, txnID)
+		}
+	}
+}
+
 // intentsInBound returns LockUpdates for the provided transaction's LockSpans
 // that intersect with the rangefeed Processor's range boundaries. For ranged
 // LockSpans, a LockUpdate containing only the portion that overlaps with the
@@ -410,12 +1421,31 @@ func (a *txnPushAttempt) Cancel() {
 // (see OpLoggerBatch.logLogicalOp). So even if this transaction has LockSpans
 // in the range's global and local keyspace, we only need to resolve those in
 // the global keyspace.
-func intentsInBound(txn *roachpb.Transaction, bound roachpb.Span) []roachpb.LockUpdate {
-	var ret []roachpb.LockUpdate
+//
+// The LockSpans that lie entirely outside of the bound are returned as ignored.
+// At verbosity level 2, the way each LockSpan was clamped to the bound is
+// logged, to help debug the cleanup of transactions spanning many ranges.
+func intentsInBound(
+	ctx context.Context, txn *roachpb.Transaction, bound roachpb.Span,
+) (ret []roachpb.LockUpdate, ignored []roachpb.Span) {
+	verbose := log.ExpensiveLogEnabled(ctx, 2)
 	for _, sp := range txn.LockSpans {
-		if in := sp.Intersect(bound); in.Valid() {
+		in := sp.Intersect(bound)
+		if verbose {
+			switch {
+			case !in.Valid():
+				log.VEventf(ctx, 2, "txn %s lock span %s: outside of %s, skipped", txn.Short(), sp, bound)
+			case in.Equal(sp):
+				log.VEventf(ctx, 2, "txn %s lock span %s: unchanged", txn.Short(), sp)
+			default:
+				log.VEventf(ctx, 2, "txn %s lock span %s: truncated to %s", txn.Short(), sp, in)
+			}
+		}
+		if in.Valid() {
 			ret = append(ret, roachpb.MakeLockUpdate(txn, in))
+		} else {
+			ignored = append(ignored, sp)
 		}
 	}
-	return ret
+	return ret, ignored
 }
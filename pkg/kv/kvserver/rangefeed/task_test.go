@@ -12,19 +12,30 @@ package rangefeed
 
 import (
 	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"regexp"
 	"slices"
+	"strings"
 	"testing"
 	"time"
 
+	"github.com/cockroachdb/cockroach/pkg/kv/kvpb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/isolation"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/concurrency/lock"
 	"github.com/cockroachdb/cockroach/pkg/roachpb"
 	"github.com/cockroachdb/cockroach/pkg/storage"
 	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/testutils"
 	"github.com/cockroachdb/cockroach/pkg/util/hlc"
 	"github.com/cockroachdb/cockroach/pkg/util/leaktest"
+	"github.com/cockroachdb/cockroach/pkg/util/log"
 	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/cockroach/pkg/util/syncutil"
+	"github.com/cockroachdb/cockroach/pkg/util/tracing"
 	"github.com/cockroachdb/cockroach/pkg/util/uuid"
+	"github.com/cockroachdb/errors"
 	"github.com/stretchr/testify/require"
 )
 
@@ -72,6 +83,11 @@ func makeProvisionalKV(key, val string, ts int64) storage.MVCCKeyValue {
 	return makeKV(key, val, ts)
 }
 
+// makeInline returns an inline (unversioned) key-value pair.
+func makeInline(key, val string) storage.MVCCKeyValue {
+	return makeKV(key, val, 0)
+}
+
 func makeMetaKV(key string, meta enginepb.MVCCMetadata) storage.MVCCKeyValue {
 	b, err := protoutil.Marshal(&meta)
 	if err != nil {
@@ -335,30 +351,778 @@ func TestInitResolvedTSScan(t *testing.T) {
 		{initRTS: true},
 	}
 
-	engine := makeEngine()
+	kinds := []IntentScannerKind{SeparatedIntentScannerKind, LegacyIntentScannerKind}
+	testutils.RunValues(t, "scanner", kinds, func(t *testing.T, kind IntentScannerKind) {
+		engine := makeEngine()
+		defer engine.Close()
+
+		// Mock processor. We just needs its eventC.
+		p := LegacyProcessor{
+			Config: Config{
+				Span: span,
+			},
+			eventC: make(chan *event, 100),
+		}
+
+		scanner, err := NewIntentScanner(ctx, kind, engine, span)
+		require.NoError(t, err, "failed to create scanner")
+		initScan := newInitResolvedTSScan(p.Span, &p, scanner, initScanOptions{})
+		initScan.Run(ctx)
+		// Compare the event channel to the expected events.
+		require.Equal(t, len(expEvents), len(p.eventC))
+		for _, expEvent := range expEvents {
+			require.Equal(t, expEvent, <-p.eventC)
+		}
+	})
+}
+
+// TestInitResolvedTSScanTiedTimestamps verifies that intents of different
+// transactions at identical timestamps are emitted in key order, independent
+// of their transaction IDs and of the scanner, on every scan.
+func TestInitResolvedTSScanTiedTimestamps(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	ts := hlc.Timestamp{WallTime: 15}
+	// The transaction with the larger ID writes the smaller key, so that key
+	// order and transaction ID order disagree.
+	txn1ID := uuid.FromStringOrNil("00000000-0000-0000-0000-000000000002")
+	txn1 := makeTxn("txnKey1", txn1ID, isolation.Serializable, ts)
+	txn2ID := uuid.FromStringOrNil("00000000-0000-0000-0000-000000000001")
+	txn2 := makeTxn("txnKey2", txn2ID, isolation.Serializable, ts)
+	engine, err := makeTestEngineWithData([]storeOp{
+		{txn: &txn2, kv: makeProvisionalKV("e", "txnKey2", 15)},
+		{txn: &txn1, kv: makeProvisionalKV("c", "txnKey1", 15)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	expEvents := []*event{
+		{ops: []enginepb.MVCCLogicalOp{
+			writeIntentOpWithKey(txn1ID, []byte("txnKey1"), isolation.Serializable, ts),
+		}},
+		{ops: []enginepb.MVCCLogicalOp{
+			writeIntentOpWithKey(txn2ID, []byte("txnKey2"), isolation.Serializable, ts),
+		}},
+		{initRTS: true},
+	}
+	for i := 0; i < 3; i++ {
+		separated, err := NewSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err)
+		require.Equal(t, expEvents, scanIntents(t, span, separated), "scan %d", i)
+		legacy, err := NewLegacyIntentScanner(engine, span)
+		require.NoError(t, err)
+		require.Equal(t, expEvents, scanIntents(t, span, legacy), "scan %d", i)
+	}
+}
+
+func TestInitResolvedTSScanInlineValues(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+
+	txnID := uuid.MakeV4()
+	txnTS := hlc.Timestamp{WallTime: 15}
+	txn := makeTxn("txnKey1", txnID, isolation.Serializable, txnTS)
+
+	engine, err := makeTestEngineWithData([]storeOp{
+		{kv: makeInline("b", "inline1")},
+		{kv: makeKV("c", "val1", 10)},
+		{kv: makeInline("g", "inline2")},
+		{kv: makeKV("m", "val2", 11)},
+		{txn: &txn, kv: makeProvisionalKV("n", "txnKey1", 15)},
+		{kv: makeInline("x", "inline3")},
+	})
+	require.NoError(t, err, "failed to populate store with data")
+	defer engine.Close()
+
+	inlineTS := hlc.Timestamp{WallTime: 42}
+	intentEvent := &event{ops: []enginepb.MVCCLogicalOp{
+		writeIntentOpWithKey(txnID, []byte("txnKey1"), isolation.Serializable, txnTS),
+	}}
+	inlineEvent := func(key, val string) *event {
+		return &event{ops: []enginepb.MVCCLogicalOp{
+			writeValueOpWithKV(roachpb.Key(key), inlineTS, makeVal(val).RawBytes),
+		}}
+	}
+
+	testutils.RunTrueAndFalse(t, "emitInlineValues", func(t *testing.T, emitInlineValues bool) {
+		var expEvents []*event
+		var scanTS hlc.Timestamp
+		if emitInlineValues {
+			scanTS = inlineTS
+			expEvents = []*event{
+				intentEvent,
+				inlineEvent("b", "inline1"),
+				inlineEvent("g", "inline2"),
+				inlineEvent("x", "inline3"),
+				{initRTS: true},
+			}
+		} else {
+			expEvents = []*event{
+				intentEvent,
+				{initRTS: true},
+			}
+		}
+
+		// Mock processor. We just need its eventC.
+		p := LegacyProcessor{
+			Config: Config{
+				Span: span,
+			},
+			eventC: make(chan *event, 100),
+		}
+
+		scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err, "failed to create scanner")
+		initScan := newInitResolvedTSScan(p.Span, &p, scanner, initScanOptions{inlineTS: scanTS})
+		initScan.Run(ctx)
+		// Compare the event channel to the expected events.
+		require.Equal(t, len(expEvents), len(p.eventC))
+		for _, expEvent := range expEvents {
+			require.Equal(t, expEvent, <-p.eventC)
+		}
+	})
+}
+
+// memInitScanCheckpointStore is an in-memory InitScanCheckpointStore.
+type memInitScanCheckpointStore struct {
+	cp    *InitScanCheckpoint
+	saves int
+	// failSave, if positive, is the save that fails, simulating a restart.
+	failSave int
+}
+
+func (m *memInitScanCheckpointStore) Load(context.Context) (InitScanCheckpoint, bool, error) {
+	if m.cp == nil {
+		return InitScanCheckpoint{}, false, nil
+	}
+	return *m.cp, true, nil
+}
+
+func (m *memInitScanCheckpointStore) Save(_ context.Context, cp InitScanCheckpoint) error {
+	m.saves++
+	if m.saves == m.failSave {
+		return errors.New("injected checkpoint failure")
+	}
+	m.cp = &cp
+	return nil
+}
+
+func (m *memInitScanCheckpointStore) Clear(context.Context) error {
+	m.cp = nil
+	return nil
+}
+
+// recordingTaskHelper is a processorTaskHelper that records the events sent to
+// it and how the task finished.
+type recordingTaskHelper struct {
+	events      []*event
+	err         *kvpb.Error
+	initialized bool
+}
+
+func (h *recordingTaskHelper) StopWithErr(pErr *kvpb.Error) {
+	h.err = pErr
+}
+
+func (h *recordingTaskHelper) setResolvedTSInitialized(context.Context) {
+	h.initialized = true
+}
+
+func (h *recordingTaskHelper) sendEvent(_ context.Context, e event, _ time.Duration) bool {
+	h.events = append(h.events, &e)
+	return true
+}
+
+// TestInitResolvedTSScanCheckpoint verifies that an initial resolved timestamp
+// scan that is interrupted after a checkpoint resumes from it, and that the
+// resumed scan emits the same events as an uninterrupted one.
+func TestInitResolvedTSScanCheckpoint(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	txn1 := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	txn2 := makeTxn("txnKey2", uuid.MakeV4(), isolation.ReadCommitted, hlc.Timestamp{WallTime: 21})
+	engine, err := makeTestEngineWithData([]storeOp{
+		{kv: makeKV("b", "val1", 10)},
+		{txn: &txn1, kv: makeProvisionalKV("c", "txnKey1", 15)},
+		{txn: &txn2, kv: makeProvisionalKV("e", "txnKey2", 21)},
+		{kv: makeKV("g", "val2", 10)},
+		{txn: &txn1, kv: makeProvisionalKV("h", "txnKey1", 15)},
+		{txn: &txn2, kv: makeProvisionalKV("m", "txnKey2", 21)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	scan := func(checkpointer *initScanCheckpointer) *recordingTaskHelper {
+		var h recordingTaskHelper
+		scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err)
+		newInitResolvedTSScan(span, &h, scanner, initScanOptions{checkpointer: checkpointer}).Run(ctx)
+		return &h
+	}
+
+	uninterrupted := scan(nil)
+	require.True(t, uninterrupted.initialized)
+	require.Len(t, uninterrupted.events, 4)
+
+	// Checkpoint after every intent, and fail the second checkpoint so that
+	// the scan stops after the intent on c has been checkpointed.
+	store := &memInitScanCheckpointStore{failSave: 2}
+	interrupted := scan(newInitScanCheckpointer(store, 1))
+	require.NotNil(t, interrupted.err)
+	require.False(t, interrupted.initialized)
+	require.NotNil(t, store.cp)
+	require.Equal(t, roachpb.Key("c").Next(), store.cp.ResumeKey)
+	require.Len(t, store.cp.Txns, 1)
+	require.Equal(t, txn1.ID, store.cp.Txns[0].Op.TxnID)
+
+	// Restart the scan, which resumes from the checkpoint and clears it once
+	// it completes.
+	store.failSave = 0
+	resumed := scan(newInitScanCheckpointer(store, 1))
+	require.Nil(t, resumed.err)
+	require.True(t, resumed.initialized)
+	require.Equal(t, uninterrupted.events, resumed.events)
+	require.Nil(t, store.cp)
+}
+
+// TestInitResolvedTSScanSlices verifies that an initial resolved timestamp
+// scan with a byte budget is performed in multiple slices, each ended by an
+// initScanSlice event, and that it emits the same events as a scan without
+// one.
+func TestInitResolvedTSScanSlices(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	txn := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	const numIntents = 50
+	var ops []storeOp
+	for i := 0; i < numIntents; i++ {
+		ops = append(ops, storeOp{txn: &txn, kv: makeProvisionalKV(fmt.Sprintf("k%03d", i), "txnKey1", 15)})
+	}
+	engine, err := makeTestEngineWithData(ops)
+	require.NoError(t, err)
 	defer engine.Close()
 
-	// Mock processor. We just needs its eventC.
+	scan := func(slicer *initScanSlicer) *recordingTaskHelper {
+		var h recordingTaskHelper
+		scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err)
+		newInitResolvedTSScan(span, &h, scanner, initScanOptions{slicer: slicer}).Run(ctx)
+		require.Nil(t, h.err)
+		require.True(t, h.initialized)
+		return &h
+	}
+
+	unsliced := scan(nil)
+	require.Len(t, unsliced.events, numIntents)
+
+	// Budget each slice for exactly intentsPerSlice intents. All of them have
+	// keys of the same length and identical ops.
+	const intentsPerSlice = 7
+	intentSize := len("k000") + unsliced.events[0].ops[0].GetValue().(*enginepb.MVCCWriteIntentOp).Size()
+	sliced := scan(&initScanSlicer{maxBytes: int64(intentsPerSlice * intentSize)})
+
+	var intents []*event
+	var slices [][]*event
+	var slice []*event
+	for _, e := range sliced.events {
+		if e.initScanSlice == nil {
+			intents = append(intents, e)
+			slice = append(slice, e)
+			continue
+		}
+		slices = append(slices, slice)
+		slice = nil
+		require.Equal(t, roachpb.Key(fmt.Sprintf("k%03d", len(intents)-1)).Next(), e.initScanSlice.resumeKey)
+	}
+	require.Equal(t, unsliced.events, intents)
+	require.Len(t, slices, numIntents/intentsPerSlice)
+	for _, slice := range slices {
+		require.Len(t, slice, intentsPerSlice)
+	}
+	require.Len(t, slice, numIntents%intentsPerSlice)
+}
+
+// TestInitResolvedTSScanVerifyIntents verifies that an initial resolved
+// timestamp scan that verifies its intents reports those that are inconsistent
+// with the MVCC keyspace, without failing.
+func TestInitResolvedTSScanVerifyIntents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	txn := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	engine, err := makeTestEngineWithData([]storeOp{
+		{kv: makeKV("b", "val1", 10)},
+		{txn: &txn, kv: makeProvisionalKV("c", "txnKey1", 15)},
+		{txn: &txn, kv: makeProvisionalKV("h", "txnKey1", 15)},
+		{txn: &txn, kv: makeProvisionalKV("m", "txnKey1", 15)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	// Orphan the intent on h by removing its provisional value, and orphan a
+	// provisional value on m by writing it above the one its intent refers to.
+	require.NoError(t, engine.ClearMVCC(
+		storage.MVCCKey{Key: roachpb.Key("h"), Timestamp: txn.WriteTimestamp}, storage.ClearOptions{}))
+	orphanTS := hlc.Timestamp{WallTime: 20}
+	require.NoError(t, engine.PutMVCC(
+		storage.MVCCKey{Key: roachpb.Key("m"), Timestamp: orphanTS},
+		makeMVCCVal("txnKey1", enginepb.MVCCValueHeader{})))
+
+	metrics := NewMetrics()
+	var h recordingTaskHelper
+	scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	newInitResolvedTSScan(span, &h, scanner, initScanOptions{
+		verifier: &initScanVerifier{metrics: metrics, intents: true},
+	}).Run(ctx)
+	require.Nil(t, h.err)
+	require.True(t, h.initialized)
+	require.Len(t, h.events, 3)
+	require.Equal(t, int64(2), metrics.RangeFeedInitScanInconsistencies.Count())
+
+	scanner, err = NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	defer scanner.Close()
+	var inconsistencies []IntentInconsistency
+	require.NoError(t, scanner.(IntentVerifier).VerifyIntents(ctx, roachpb.Key("a"), roachpb.Key("z"),
+		func(inc IntentInconsistency) {
+			inconsistencies = append(inconsistencies, inc)
+		}))
+	require.Equal(t, []IntentInconsistency{
+		{Key: roachpb.Key("h"), IntentTS: txn.WriteTimestamp},
+		{Key: roachpb.Key("m"), IntentTS: txn.WriteTimestamp, ValueTS: orphanTS},
+	}, inconsistencies)
+}
+
+// TestInitResolvedTSScanStrictSeparatedIntents verifies that a strict initial
+// resolved timestamp scan over a mix of separated and interleaved intents
+// reports the interleaved ones that it skips, without failing.
+func TestInitResolvedTSScanStrictSeparatedIntents(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	separated := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	engine, err := makeTestEngineWithData([]storeOp{
+		{kv: makeInline("b", "inline1")},
+		{txn: &separated, kv: makeProvisionalKV("c", "txnKey1", 15)},
+		{kv: makeKV("m", "val1", 10)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	// Write an intent on h the way it was written before intents were
+	// separated: as metadata interleaved with its provisional value.
+	interleavedID := uuid.MakeV4()
+	interleaved := makeIntent("h", interleavedID, "txnKey2", 20)
+	require.NoError(t, engine.PutUnversioned(interleaved.Key.Key, interleaved.Value))
+	require.NoError(t, engine.PutMVCC(
+		storage.MVCCKey{Key: roachpb.Key("h"), Timestamp: hlc.Timestamp{WallTime: 20}},
+		makeMVCCVal("txnKey2", enginepb.MVCCValueHeader{})))
+
+	metrics := NewMetrics()
+	var h recordingTaskHelper
+	scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	newInitResolvedTSScan(span, &h, scanner, initScanOptions{
+		verifier: &initScanVerifier{metrics: metrics, interleaved: true},
+	}).Run(ctx)
+	require.Nil(t, h.err)
+	require.True(t, h.initialized)
+	require.Len(t, h.events, 1)
+	require.Equal(t, separated.ID, h.events[0].ops[0].GetValue().(*enginepb.MVCCWriteIntentOp).TxnID)
+	require.Equal(t, int64(1), metrics.RangeFeedInitScanInterleavedIntents.Count())
+
+	scanner, err = NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	defer scanner.Close()
+	var keys []roachpb.Key
+	var txnIDs []uuid.UUID
+	require.NoError(t, scanner.(InterleavedIntentDetector).ConsumeInterleavedIntents(ctx,
+		roachpb.Key("a"), roachpb.Key("z"), func(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+			keys = append(keys, key)
+			txnIDs = append(txnIDs, op.TxnID)
+			return true
+		}))
+	require.Equal(t, []roachpb.Key{roachpb.Key("h")}, keys)
+	require.Equal(t, []uuid.UUID{interleavedID}, txnIDs)
+}
+
+// failingIntentScanner is a SeparatedIntentScanner that fails after finding
+// failAfter intents.
+type failingIntentScanner struct {
+	*SeparatedIntentScanner
+	failAfter int
+}
+
+// ConsumeIntents implements the IntentScanner interface.
+func (f *failingIntentScanner) ConsumeIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer eventConsumer,
+) error {
+	return f.ConsumeKeyedIntents(ctx, startKey, endKey, func(_ roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+		return consumer(op)
+	})
+}
+
+// ConsumeKeyedIntents implements the KeyedIntentScanner interface.
+func (f *failingIntentScanner) ConsumeKeyedIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer keyedEventConsumer,
+) error {
+	var found int
+	if err := f.SeparatedIntentScanner.ConsumeKeyedIntents(ctx, startKey, endKey,
+		func(key roachpb.Key, op enginepb.MVCCWriteIntentOp) bool {
+			if found == f.failAfter {
+				return false
+			}
+			found++
+			return consumer(key, op)
+		}); err != nil {
+		return err
+	}
+	if found == f.failAfter {
+		return errors.New("injected intent scanner failure")
+	}
+	return nil
+}
+
+// TestInitResolvedTSScanFallback verifies that an initial resolved timestamp
+// scan whose intent scanner fails falls back to the legacy intent scanner,
+// which picks up after the last intent found.
+func TestInitResolvedTSScanFallback(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.ScopeWithoutShowLogs(t).Close(t)
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	txn1 := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	txn2 := makeTxn("txnKey2", uuid.MakeV4(), isolation.ReadCommitted, hlc.Timestamp{WallTime: 21})
+	engine, err := makeTestEngineWithData([]storeOp{
+		{kv: makeKV("b", "val1", 10)},
+		{txn: &txn1, kv: makeProvisionalKV("c", "txnKey1", 15)},
+		{txn: &txn2, kv: makeProvisionalKV("e", "txnKey2", 21)},
+		{kv: makeKV("g", "val2", 10)},
+		{txn: &txn1, kv: makeProvisionalKV("h", "txnKey1", 15)},
+		{txn: &txn2, kv: makeProvisionalKV("m", "txnKey2", 21)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	var expected recordingTaskHelper
+	scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	newInitResolvedTSScan(span, &expected, scanner, initScanOptions{}).Run(ctx)
+	require.True(t, expected.initialized)
+	require.Len(t, expected.events, 4)
+
+	// Fail the separated scan after the intent on e. Without a fallback, the
+	// scan fails.
+	newFailingScanner := func() IntentScanner {
+		scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err)
+		return &failingIntentScanner{SeparatedIntentScanner: scanner.(*SeparatedIntentScanner), failAfter: 2}
+	}
+	var failed recordingTaskHelper
+	newInitResolvedTSScan(span, &failed, newFailingScanner(), initScanOptions{}).Run(ctx)
+	require.NotNil(t, failed.err)
+	require.False(t, failed.initialized)
+
+	// With a fallback, the legacy scanner finds the remaining intents, and the
+	// scan emits the same events as a successful separated scan.
+	var h recordingTaskHelper
+	fallback, err := NewLegacyIntentScanner(engine, span)
+	require.NoError(t, err)
+	newInitResolvedTSScan(span, &h, NewIntentScannerWithFallback(newFailingScanner(), fallback),
+		initScanOptions{}).Run(ctx)
+	require.Nil(t, h.err)
+	require.True(t, h.initialized)
+	require.Equal(t, expected.events, h.events)
+
+	log.FlushFiles()
+	entries, err := log.FetchEntriesFromFiles(0, math.MaxInt64, 100,
+		regexp.MustCompile("falling back to legacy intent scanner"), log.WithFlattenedSensitiveData)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+}
+
+// TestInitResolvedTSScanSummary verifies that an initial resolved timestamp
+// scan logs a JSON summary of its results at verbosity level 2.
+func TestInitResolvedTSScanSummary(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	sc := log.ScopeWithoutShowLogs(t)
+	prevVModule := log.GetVModule()
+	_ = log.SetVModule("task=2")
+	defer func() { _ = log.SetVModule(prevVModule) }()
+	defer sc.Close(t)
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	txn1 := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	txn2 := makeTxn("txnKey2", uuid.MakeV4(), isolation.ReadCommitted, hlc.Timestamp{WallTime: 21})
+	engine, err := makeTestEngineWithData([]storeOp{
+		{kv: makeKV("b", "val1", 10)},
+		{txn: &txn1, kv: makeProvisionalKV("c", "txnKey1", 15)},
+		{txn: &txn2, kv: makeProvisionalKV("e", "txnKey2", 21)},
+		{kv: makeKV("g", "val2", 10)},
+		{txn: &txn1, kv: makeProvisionalKV("h", "txnKey1", 15)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	var h recordingTaskHelper
+	scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	newInitResolvedTSScan(span, &h, scanner, initScanOptions{}).Run(ctx)
+	require.True(t, h.initialized)
+
+	const prefix = "initial resolved timestamp scan summary: "
+	log.FlushFiles()
+	entries, err := log.FetchEntriesFromFiles(0, math.MaxInt64, 100,
+		regexp.MustCompile(prefix), log.WithFlattenedSensitiveData)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	msg := entries[0].Message
+	var summary initScanSummary
+	require.NoError(t, json.Unmarshal([]byte(msg[strings.Index(msg, prefix)+len(prefix):]), &summary))
+	summary.DurationNanos = 0
+	require.Equal(t, initScanSummary{
+		Span:         span.String(),
+		Scanner:      "separated",
+		KeysScanned:  3,
+		IntentsFound: 3,
+		MinIntentTS:  txn1.WriteTimestamp.String(),
+		MaxIntentTS:  txn2.WriteTimestamp.String(),
+	}, summary)
+}
+
+// scanIntents runs an initial resolved timestamp scan over span using the
+// given scanner and returns the events it emitted.
+func scanIntents(t testing.TB, span roachpb.RSpan, scanner IntentScanner) []*event {
+	// Mock processor. We just need its eventC.
 	p := LegacyProcessor{
 		Config: Config{
 			Span: span,
 		},
 		eventC: make(chan *event, 100),
 	}
+	newInitResolvedTSScan(p.Span, &p, scanner, initScanOptions{}).Run(context.Background())
+	events := make([]*event, 0, len(p.eventC))
+	for len(p.eventC) > 0 {
+		events = append(events, <-p.eventC)
+	}
+	require.NotEmpty(t, events)
+	require.True(t, events[len(events)-1].initRTS, "expected scan to initialize resolved timestamp")
+	return events
+}
 
-	scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
-	require.NoError(t, err, "failed to create scanner")
-	initScan := newInitResolvedTSScan(p.Span, &p, scanner)
-	initScan.Run(ctx)
-	// Compare the event channel to the expected events.
-	require.Equal(t, len(expEvents), len(p.eventC))
-	for _, expEvent := range expEvents {
-		require.Equal(t, expEvent, <-p.eventC)
+func TestPooledSeparatedIntentScanner(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("d"), EndKey: roachpb.RKey("w")}
+
+	txn1 := makeTxn("txnKey1", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	txn2 := makeTxn("txnKey2", uuid.MakeV4(), isolation.ReadCommitted, hlc.Timestamp{WallTime: 21})
+	engine, err := makeTestEngineWithData([]storeOp{
+		{txn: &txn1, kv: makeProvisionalKV("c", "txnKey1", 15)},
+		{kv: makeKV("d", "val1", 19)},
+		{txn: &txn2, kv: makeProvisionalKV("d", "txnKey2", 21)},
+		{txn: &txn1, kv: makeProvisionalKV("n", "txnKey1", 15)},
+		{txn: &txn1, kv: makeProvisionalKV("w", "txnKey1", 15)},
+	})
+	require.NoError(t, err, "failed to populate store with data")
+	defer engine.Close()
+
+	scanFresh := func() []*event {
+		scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err)
+		return scanIntents(t, span, scanner)
+	}
+	scanPooled := func() []*event {
+		scanner, err := NewPooledSeparatedIntentScanner(ctx, engine, span)
+		require.NoError(t, err)
+		return scanIntents(t, span, scanner)
+	}
+
+	// Repeated scans with pooled scanners must be indistinguishable from scans
+	// with fresh ones, including after the engine has been written to.
+	for i, key := range []string{"e", "f", "v"} {
+		require.Equal(t, scanFresh(), scanPooled(), "scan %d", i)
+		require.Equal(t, scanPooled(), scanPooled(), "scan %d", i)
+
+		_, err := storage.MVCCPut(ctx, engine, roachpb.Key(key), txn2.WriteTimestamp,
+			makeVal("txnKey2"), storage.MVCCWriteOptions{Txn: &txn2})
+		require.NoError(t, err)
+		require.Len(t, scanPooled(), 4+i)
+	}
+
+	// Closing a scanner more than once is a no-op.
+	for _, newScanner := range []func(context.Context, storage.Reader, roachpb.RSpan) (IntentScanner, error){
+		NewSeparatedIntentScanner, NewPooledSeparatedIntentScanner,
+	} {
+		scanner, err := newScanner(ctx, engine, span)
+		require.NoError(t, err)
+		scanner.Close()
+		scanner.Close()
+	}
+}
+
+func BenchmarkInitResolvedTSScan(b *testing.B) {
+	ctx := context.Background()
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+
+	txn := makeTxn("txnKey", uuid.MakeV4(), isolation.Serializable, hlc.Timestamp{WallTime: 15})
+	var ops []storeOp
+	for c := 'a'; c < 'z'; c++ {
+		ops = append(ops, storeOp{txn: &txn, kv: makeProvisionalKV(string(c), "txnKey", 15)})
+	}
+	engine, err := makeTestEngineWithData(ops)
+	require.NoError(b, err)
+	defer engine.Close()
+
+	for _, pooled := range []bool{false, true} {
+		newScanner := NewSeparatedIntentScanner
+		if pooled {
+			newScanner = NewPooledSeparatedIntentScanner
+		}
+		b.Run(fmt.Sprintf("pooled=%t", pooled), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scanner, err := newScanner(ctx, engine, span)
+				if err != nil {
+					b.Fatal(err)
+				}
+				var n int
+				err = scanner.ConsumeIntents(ctx, span.Key.AsRawKey(), span.EndKey.AsRawKey(),
+					func(enginepb.MVCCWriteIntentOp) bool {
+						n++
+						return true
+					})
+				scanner.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != len(ops) {
+					b.Fatalf("expected %d intents, found %d", len(ops), n)
+				}
+			}
+		})
+	}
+}
+
+// makeSyntheticIntentData returns numKeys keys between "a" and "z", every
+// intentEvery-th of which has an intent of its own transaction and the rest a
+// committed value. It returns them both as the key-value pairs seen by an
+// intent interleaving iterator, for NewSliceIntentScanner, and as the writes
+// that store them in an engine.
+func makeSyntheticIntentData(
+	numKeys, intentEvery int,
+) (kvs []storage.MVCCKeyValue, ops []storeOp) {
+	ts := hlc.Timestamp{WallTime: 15}
+	for i := 0; i < numKeys; i++ {
+		key := fmt.Sprintf("k%08d", i)
+		kv := makeKV(key, "val", ts.WallTime)
+		if i%intentEvery != 0 {
+			kvs = append(kvs, kv)
+			ops = append(ops, storeOp{kv: kv})
+			continue
+		}
+		txn := makeTxn("txnKey", uuid.MakeV4(), isolation.Serializable, ts)
+		kvs = append(kvs, makeMetaKV(key, enginepb.MVCCMetadata{
+			Txn:       &txn.TxnMeta,
+			Timestamp: ts.ToLegacyTimestamp(),
+		}), kv)
+		ops = append(ops, storeOp{txn: &txn, kv: kv})
+	}
+	return kvs, ops
+}
+
+// TestSliceIntentScanner verifies that an initial resolved timestamp scan
+// using a slice intent scanner emits the same events as scans using the
+// engine-backed scanners over the same data.
+func TestSliceIntentScanner(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	kvs, ops := makeSyntheticIntentData(200, 5)
+	engine, err := makeTestEngineWithData(ops)
+	require.NoError(t, err)
+	defer engine.Close()
+
+	scanner, err := NewSliceIntentScanner(kvs)
+	require.NoError(t, err)
+	events := scanIntents(t, span, scanner)
+	require.Len(t, events, 200/5+1)
+
+	separated, err := NewSeparatedIntentScanner(ctx, engine, span)
+	require.NoError(t, err)
+	require.Equal(t, events, scanIntents(t, span, separated))
+	legacy, err := NewLegacyIntentScanner(engine, span)
+	require.NoError(t, err)
+	require.Equal(t, events, scanIntents(t, span, legacy))
+
+	_, err = NewSliceIntentScanner([]storage.MVCCKeyValue{kvs[1], kvs[0]})
+	require.Error(t, err)
+}
+
+// BenchmarkIntentScanners compares the throughput of the intent scanners over
+// the same synthetic data. The slice scanner doesn't read from an engine, so
+// it serves as a baseline.
+func BenchmarkIntentScanners(b *testing.B) {
+	ctx := context.Background()
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+
+	const numKeys, intentEvery = 100000, 10
+	kvs, ops := makeSyntheticIntentData(numKeys, intentEvery)
+	engine, err := makeTestEngineWithData(ops)
+	require.NoError(b, err)
+	defer engine.Close()
+
+	for _, tc := range []struct {
+		name       string
+		newScanner func() (IntentScanner, error)
+	}{
+		{"slice", func() (IntentScanner, error) { return NewSliceIntentScanner(kvs) }},
+		{"legacy", func() (IntentScanner, error) { return NewLegacyIntentScanner(engine, span) }},
+		{"separated", func() (IntentScanner, error) { return NewSeparatedIntentScanner(ctx, engine, span) }},
+	} {
+		b.Run(fmt.Sprintf("scanner=%s", tc.name), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				scanner, err := tc.newScanner()
+				if err != nil {
+					b.Fatal(err)
+				}
+				var n int
+				err = scanner.ConsumeIntents(ctx, span.Key.AsRawKey(), span.EndKey.AsRawKey(),
+					func(enginepb.MVCCWriteIntentOp) bool {
+						n++
+						return true
+					})
+				scanner.Close()
+				if err != nil {
+					b.Fatal(err)
+				}
+				if n != numKeys/intentEvery {
+					b.Fatalf("expected %d intents, found %d", numKeys/intentEvery, n)
+				}
+			}
+		})
 	}
 }
 
 type testTxnPusher struct {
 	pushTxnsFn       func(context.Context, []enginepb.TxnMeta, hlc.Timestamp) ([]*roachpb.Transaction, bool, error)
+	queryTxnsFn      func(context.Context, []enginepb.TxnMeta) ([]*roachpb.Transaction, error)
 	resolveIntentsFn func(ctx context.Context, intents []roachpb.LockUpdate) error
 }
 
@@ -368,6 +1132,12 @@ func (tp *testTxnPusher) PushTxns(
 	return tp.pushTxnsFn(ctx, txns, ts)
 }
 
+func (tp *testTxnPusher) QueryTxns(
+	ctx context.Context, txns []enginepb.TxnMeta,
+) ([]*roachpb.Transaction, error) {
+	return tp.queryTxnsFn(ctx, txns)
+}
+
 func (tp *testTxnPusher) ResolveIntents(ctx context.Context, intents []roachpb.LockUpdate) error {
 	return tp.resolveIntentsFn(ctx, intents)
 }
@@ -382,6 +1152,12 @@ func (tp *testTxnPusher) mockPushTxns(
 	tp.pushTxnsFn = fn
 }
 
+func (tp *testTxnPusher) mockQueryTxns(
+	fn func(context.Context, []enginepb.TxnMeta) ([]*roachpb.Transaction, error),
+) {
+	tp.queryTxnsFn = fn
+}
+
 func (tp *testTxnPusher) mockResolveIntentsFn(
 	fn func(context.Context, []roachpb.LockUpdate) error,
 ) {
@@ -488,17 +1264,61 @@ func TestTxnPushAttempt(t *testing.T) {
 
 	txns := []enginepb.TxnMeta{txn1Meta, txn2Meta, txn3Meta, txn4Meta}
 	doneC := make(chan struct{})
-	pushAttempt := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, &p, txns, hlc.Timestamp{WallTime: 15},
-		func() {
-			close(doneC)
-		})
-	pushAttempt.Run(context.Background())
+	metrics := NewMetrics()
+	pushAttempt := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, &p, txns, hlc.Timestamp{WallTime: 15}, func() {
+		close(doneC)
+	}, txnPushAttemptOptions{metrics: metrics})
+	// Record the attempt's trace to capture its lock span diagnostics.
+	ctx, getRecAndFinish := tracing.ContextWithRecordingSpan(
+		context.Background(), tracing.NewTracer(), "push attempt")
+	pushAttempt.Run(ctx)
 	select {
 	case <-doneC: // check if closed
 	case <-time.After(30 * time.Second):
 		t.Fatal("push attempt failed to complete in 30 seconds")
 	}
 
+	// The diagnostics list how each lock span was clamped to the range.
+	var diagnostics []string
+	for _, sp := range getRecAndFinish() {
+		for _, l := range sp.Logs {
+			diagnostics = append(diagnostics, l.Msg.StripMarkers())
+		}
+	}
+	expDiagnostic := func(txnID uuid.UUID, original roachpb.Span, outcome string) string {
+		return fmt.Sprintf("txn %s lock span %s: %s", txnID.Short(), original, outcome)
+	}
+	truncated := func(key, endKey string) string {
+		return fmt.Sprintf("truncated to %s", roachpb.Span{Key: roachpb.Key(key), EndKey: roachpb.Key(endKey)})
+	}
+	bound := p.Span.AsRawSpanWithNoLocals()
+	for _, exp := range []string{
+		expDiagnostic(txn2, txn2LockSpans[0], "unchanged"),
+		expDiagnostic(txn2, txn2LockSpans[1], "unchanged"),
+		expDiagnostic(txn2, txn2LockSpans[2], fmt.Sprintf("outside of %s, skipped", bound)),
+		expDiagnostic(txn4, txn4LockSpans[0], "unchanged"),
+		expDiagnostic(txn4, txn4LockSpans[1], "unchanged"),
+		expDiagnostic(txn4, txn4LockSpans[2], truncated("b", "d")),
+		expDiagnostic(txn4, txn4LockSpans[3], truncated("j", "m")),
+		expDiagnostic(txn4, txn4LockSpans[4], truncated("b", "m")),
+	} {
+		require.Contains(t, diagnostics, exp)
+	}
+
+	// Only txn2 has a lock span outside of the range, which is reported as
+	// ignored.
+	var ignored []string
+	for _, d := range diagnostics {
+		if strings.Contains(d, "ignored lock spans") {
+			ignored = append(ignored, d)
+		}
+	}
+	require.Equal(t, []string{fmt.Sprintf("txn %s: ignored lock spans outside of %s: %v",
+		txn2.Short(), p.Span, []roachpb.Span{txn2LockSpans[2]})}, ignored)
+
+	// txn3 is the only finalized txn without LockSpans.
+	require.Equal(t, int64(1), metrics.RangeFeedPushTxnsMissingLockSpans.Count())
+
 	// Compare the event channel to the expected events.
 	expEvents := []*event{
 		{ops: []enginepb.MVCCLogicalOp{
@@ -513,3 +1333,364 @@ func TestTxnPushAttempt(t *testing.T) {
 		require.Equal(t, expEvent, <-p.eventC)
 	}
 }
+
+// TestTxnPushAttemptCommittedWithoutLockSpans verifies that a push attempt
+// configured with a CommittedIntentScanner scans its range for the intents of
+// a committed transaction without LockSpans, and resolves them.
+func TestTxnPushAttemptCommittedWithoutLockSpans(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	ctx := context.Background()
+
+	span := roachpb.RSpan{Key: roachpb.RKey("b"), EndKey: roachpb.RKey("m")}
+	ts := hlc.Timestamp{WallTime: 10}
+	committed := makeTxn("c", uuid.MakeV4(), isolation.Serializable, ts)
+	other := makeTxn("d", uuid.MakeV4(), isolation.Serializable, ts)
+	engine, err := makeTestEngineWithData([]storeOp{
+		{txn: &committed, kv: makeProvisionalKV("c", "val1", 10)},
+		{txn: &other, kv: makeProvisionalKV("d", "val2", 10)},
+		{txn: &committed, kv: makeProvisionalKV("e", "val3", 10)},
+		// Outside of the range.
+		{txn: &committed, kv: makeProvisionalKV("x", "val4", 10)},
+	})
+	require.NoError(t, err)
+	defer engine.Close()
+
+	committedProto := committed.Clone()
+	committedProto.Status = roachpb.COMMITTED
+
+	testutils.RunTrueAndFalse(t, "scan", func(t *testing.T, scan bool) {
+		var tp testTxnPusher
+		tp.mockPushTxns(func(
+			ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+		) ([]*roachpb.Transaction, bool, error) {
+			return []*roachpb.Transaction{committedProto}, false, nil
+		})
+		var resolved []roachpb.LockUpdate
+		tp.mockResolveIntentsFn(func(ctx context.Context, intents []roachpb.LockUpdate) error {
+			resolved = append(resolved, intents...)
+			return nil
+		})
+		var committedScanner IntentScannerConstructor
+		if scan {
+			committedScanner = func() IntentScanner {
+				scanner, err := NewSeparatedIntentScanner(ctx, engine, span)
+				require.NoError(t, err)
+				return scanner
+			}
+		}
+
+		p := LegacyProcessor{eventC: make(chan *event, 100)}
+		p.Span = span
+		p.TxnPusher = &tp
+		doneC := make(chan struct{})
+		newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, &p, []enginepb.TxnMeta{committed.TxnMeta}, ts.Add(5, 0), func() {
+			close(doneC)
+		}, txnPushAttemptOptions{committedScanner: committedScanner}).Run(ctx)
+		<-doneC
+
+		if !scan {
+			// The intents are left for others to resolve.
+			require.Empty(t, resolved)
+			return
+		}
+		require.Len(t, resolved, 2)
+		for i, key := range []string{"c", "e"} {
+			require.Equal(t, roachpb.Span{Key: roachpb.Key(key)}, resolved[i].Span)
+			require.Equal(t, committed.ID, resolved[i].Txn.ID)
+			require.Equal(t, roachpb.COMMITTED, resolved[i].Status)
+		}
+	})
+}
+
+// TestTxnPushAttemptReplay verifies that a push attempt replayed from its
+// encoded record has the same effects as the original attempt.
+func TestTxnPushAttemptReplay(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	txn1, txn2, txn3, txn4 := uuid.MakeV4(), uuid.MakeV4(), uuid.MakeV4(), uuid.MakeV4()
+	ts1, ts2, ts3, ts4 := hlc.Timestamp{WallTime: 1}, hlc.Timestamp{WallTime: 2}, hlc.Timestamp{WallTime: 3}, hlc.Timestamp{WallTime: 4}
+	txnMetas := []enginepb.TxnMeta{
+		{ID: txn1, Key: keyA, IsoLevel: isolation.Serializable, WriteTimestamp: ts1, MinTimestamp: ts1, Priority: 7},
+		{ID: txn2, Key: keyB, IsoLevel: isolation.Snapshot, WriteTimestamp: ts2, MinTimestamp: ts2, Epoch: 2},
+		{ID: txn3, Key: keyC, IsoLevel: isolation.ReadCommitted, WriteTimestamp: ts3, MinTimestamp: ts3},
+		{ID: txn4, Key: keyC, WriteTimestamp: ts3, MinTimestamp: ts4, Sequence: 5},
+	}
+	lockSpans := []roachpb.Span{
+		{Key: roachpb.Key("b"), EndKey: roachpb.Key("c")},
+		{Key: roachpb.Key("y"), EndKey: roachpb.Key("z")},
+	}
+
+	// The pusher pushes txn1, and finds txn2 committed and txn3 and txn4
+	// aborted, as in TestTxnPushAttempt.
+	var tp testTxnPusher
+	tp.mockPushTxns(func(
+		ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+	) ([]*roachpb.Transaction, bool, error) {
+		pushed := make([]*roachpb.Transaction, len(txns))
+		for i, txn := range txns {
+			pushed[i] = &roachpb.Transaction{TxnMeta: txn, Status: roachpb.ABORTED}
+			switch txn.ID {
+			case txn1:
+				pushed[i].Status = roachpb.PENDING
+				pushed[i].WriteTimestamp = ts
+			case txn2:
+				pushed[i].Status = roachpb.COMMITTED
+				pushed[i].LockSpans = lockSpans
+			}
+		}
+		return pushed, false, nil
+	})
+	var resolved [][]roachpb.LockUpdate
+	tp.mockResolveIntentsFn(func(ctx context.Context, intents []roachpb.LockUpdate) error {
+		resolved = append(resolved, intents)
+		return nil
+	})
+
+	// run runs a push attempt built by mk and returns the events it emitted
+	// and the intents it resolved.
+	span := roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("m")}
+	run := func(
+		mk func(p *LegacyProcessor, done func()) runnable,
+	) ([]*event, [][]roachpb.LockUpdate) {
+		resolved = nil
+		p := LegacyProcessor{eventC: make(chan *event, 100)}
+		p.Span = span
+		p.TxnPusher = &tp
+		doneC := make(chan struct{})
+		mk(&p, func() { close(doneC) }).Run(context.Background())
+		<-doneC
+		close(p.eventC)
+		var events []*event
+		for e := range p.eventC {
+			events = append(events, e)
+		}
+		return events, resolved
+	}
+
+	pushTS := hlc.Timestamp{WallTime: 15, Logical: 3}
+	var rec PushAttemptRecord
+	origEvents, origResolved := run(func(p *LegacyProcessor, done func()) runnable {
+		a := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, p, txnMetas, pushTS, done, txnPushAttemptOptions{})
+		rec = a.(*txnPushAttempt).record()
+		return a
+	})
+	require.Len(t, origEvents, 1)
+	require.Len(t, origResolved, 1)
+
+	encoded, err := rec.Encode()
+	require.NoError(t, err)
+	loaded, err := DecodePushAttemptRecord(encoded)
+	require.NoError(t, err)
+	require.Equal(t, rec, loaded)
+
+	replayedEvents, replayedResolved := run(func(p *LegacyProcessor, done func()) runnable {
+		return newTxnPushAttemptFromRecord(p.Settings, loaded, p.TxnPusher, p, done)
+	})
+	require.Equal(t, origEvents, replayedEvents)
+	require.Equal(t, origResolved, replayedResolved)
+
+	// Records of unknown versions are rejected.
+	_, err = DecodePushAttemptRecord([]byte(`{"version": 99}`))
+	require.ErrorContains(t, err, "unsupported push attempt record version 99")
+}
+
+// TestTxnPushAttemptResolveBudget verifies that a push attempt keeps the total
+// size of its outstanding intent resolution requests within its budget.
+func TestTxnPushAttemptResolveBudget(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ts := hlc.Timestamp{WallTime: 1}
+	txnMeta := enginepb.TxnMeta{ID: uuid.MakeV4(), Key: keyA, WriteTimestamp: ts, MinTimestamp: ts}
+	const numSpans = 50
+	var lockSpans []roachpb.Span
+	for i := 0; i < numSpans; i++ {
+		lockSpans = append(lockSpans, roachpb.Span{Key: roachpb.Key(fmt.Sprintf("k%03d", i))})
+	}
+	txnProto := &roachpb.Transaction{TxnMeta: txnMeta, Status: roachpb.COMMITTED, LockSpans: lockSpans}
+
+	// Allow for three intents' worth of outstanding requests.
+	intentBytes := int64(roachpb.MakeLockUpdate(txnProto, lockSpans[0]).Size())
+	budget := 3 * intentBytes
+
+	var mu syncutil.Mutex
+	var outstanding, maxOutstanding int64
+	var resolved, calls int
+	var tp testTxnPusher
+	tp.mockPushTxns(func(
+		ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+	) ([]*roachpb.Transaction, bool, error) {
+		return []*roachpb.Transaction{txnProto}, false, nil
+	})
+	tp.mockResolveIntentsFn(func(ctx context.Context, intents []roachpb.LockUpdate) error {
+		var size int64
+		for _, intent := range intents {
+			size += int64(intent.Size())
+		}
+		func() {
+			mu.Lock()
+			defer mu.Unlock()
+			outstanding += size
+			maxOutstanding = max(maxOutstanding, outstanding)
+			resolved += len(intents)
+			calls++
+		}()
+		// Give other requests a chance to be issued concurrently.
+		time.Sleep(time.Millisecond)
+		mu.Lock()
+		defer mu.Unlock()
+		outstanding -= size
+		return nil
+	})
+
+	p := LegacyProcessor{eventC: make(chan *event, 100)}
+	p.Span = roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	p.TxnPusher = &tp
+
+	doneC := make(chan struct{})
+	pushAttempt := newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, &p,
+		[]enginepb.TxnMeta{txnMeta}, hlc.Timestamp{WallTime: 15}, func() {
+			close(doneC)
+		}, txnPushAttemptOptions{maxResolveBytes: budget})
+	pushAttempt.Run(context.Background())
+	<-doneC
+
+	mu.Lock()
+	defer mu.Unlock()
+	require.Equal(t, numSpans, resolved)
+	require.GreaterOrEqual(t, calls, numSpans/3)
+	require.LessOrEqual(t, maxOutstanding, budget)
+}
+
+// TestTxnPushAttemptMaxLockSpansPerTxn tests that push attempts resolve at most
+// MaxLockSpansPerTxn of a transaction's lock spans, deferring the remainder to
+// the following attempts, which only move on once the lock spans of the
+// previous one have been resolved.
+func TestTxnPushAttemptMaxLockSpansPerTxn(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	ts := hlc.Timestamp{WallTime: 1}
+	txnMeta := enginepb.TxnMeta{ID: uuid.MakeV4(), Key: keyA, WriteTimestamp: ts, MinTimestamp: ts}
+	var lockSpans []roachpb.Span
+	for i := 0; i < 10; i++ {
+		lockSpans = append(lockSpans, roachpb.Span{Key: roachpb.Key(fmt.Sprintf("k%03d", i))})
+	}
+	txnProto := &roachpb.Transaction{TxnMeta: txnMeta, Status: roachpb.COMMITTED, LockSpans: lockSpans}
+
+	var resolved []string
+	var resolveErr error
+	var tp testTxnPusher
+	tp.mockPushTxns(func(
+		ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+	) ([]*roachpb.Transaction, bool, error) {
+		return []*roachpb.Transaction{txnProto}, false, nil
+	})
+	tp.mockResolveIntentsFn(func(ctx context.Context, intents []roachpb.LockUpdate) error {
+		resolved = resolved[:0]
+		for _, intent := range intents {
+			resolved = append(resolved, string(intent.Key))
+		}
+		return resolveErr
+	})
+
+	p := LegacyProcessor{eventC: make(chan *event, 100)}
+	p.Span = roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+	p.TxnPusher = &tp
+	cursor := newLockSpanCursor(4)
+
+	attempt := func() {
+		doneC := make(chan struct{})
+		newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, &p,
+			[]enginepb.TxnMeta{txnMeta}, hlc.Timestamp{WallTime: 15}, func() {
+				close(doneC)
+			}, txnPushAttemptOptions{lockSpans: cursor}).Run(context.Background())
+		<-doneC
+	}
+
+	attempt()
+	require.Equal(t, []string{"k000", "k001", "k002", "k003"}, resolved)
+
+	// A failed attempt leaves its lock spans for the next one.
+	resolveErr = errors.New("boom")
+	attempt()
+	require.Equal(t, []string{"k004", "k005", "k006", "k007"}, resolved)
+	resolveErr = nil
+	attempt()
+	require.Equal(t, []string{"k004", "k005", "k006", "k007"}, resolved)
+
+	attempt()
+	require.Equal(t, []string{"k008", "k009"}, resolved)
+	// The transaction's lock spans have all been resolved, so it is forgotten.
+	require.Empty(t, cursor.mu.resolved)
+}
+
+// TestTxnPushAttemptPushOpOrder tests that push attempts order the ops of the
+// event they emit according to their PushOpOrder.
+func TestTxnPushAttemptPushOpOrder(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+
+	txn1, txn2, txn3, txn4 := uuid.MakeV4(), uuid.MakeV4(), uuid.MakeV4(), uuid.MakeV4()
+	ts := hlc.Timestamp{WallTime: 1}
+	pushTS := hlc.Timestamp{WallTime: 15}
+	txn1Meta := enginepb.TxnMeta{ID: txn1, Key: keyA, WriteTimestamp: ts, MinTimestamp: ts}
+	txn2Meta := enginepb.TxnMeta{ID: txn2, Key: keyB, WriteTimestamp: ts, MinTimestamp: ts}
+	txn3Meta := enginepb.TxnMeta{ID: txn3, Key: keyC, WriteTimestamp: ts, MinTimestamp: ts}
+	txn4Meta := enginepb.TxnMeta{ID: txn4, Key: keyD, WriteTimestamp: ts, MinTimestamp: ts}
+	txns := []enginepb.TxnMeta{txn1Meta, txn2Meta, txn3Meta, txn4Meta}
+
+	var tp testTxnPusher
+	tp.mockPushTxns(func(
+		ctx context.Context, txns []enginepb.TxnMeta, ts hlc.Timestamp,
+	) ([]*roachpb.Transaction, bool, error) {
+		txn2Pushed := &roachpb.Transaction{TxnMeta: txn2Meta, Status: roachpb.PENDING}
+		txn2Pushed.WriteTimestamp = ts
+		return []*roachpb.Transaction{
+			{TxnMeta: txn1Meta, Status: roachpb.ABORTED},
+			txn2Pushed,
+			{TxnMeta: txn3Meta, Status: roachpb.ABORTED},
+			{TxnMeta: txn4Meta, Status: roachpb.COMMITTED},
+		}, false, nil
+	})
+	tp.mockResolveIntentsFn(func(ctx context.Context, intents []roachpb.LockUpdate) error {
+		return nil
+	})
+
+	testCases := []struct {
+		order  PushOpOrder
+		expOps []enginepb.MVCCLogicalOp
+	}{
+		{
+			order: PushOpsInPushOrder,
+			expOps: []enginepb.MVCCLogicalOp{
+				abortTxnOp(txn1), updateIntentOp(txn2, pushTS), abortTxnOp(txn3), updateIntentOp(txn4, ts),
+			},
+		},
+		{
+			order: PushOpsAbortsFirst,
+			expOps: []enginepb.MVCCLogicalOp{
+				abortTxnOp(txn1), abortTxnOp(txn3), updateIntentOp(txn2, pushTS), updateIntentOp(txn4, ts),
+			},
+		},
+		{
+			order: PushOpsUpdatesFirst,
+			expOps: []enginepb.MVCCLogicalOp{
+				updateIntentOp(txn2, pushTS), updateIntentOp(txn4, ts), abortTxnOp(txn1), abortTxnOp(txn3),
+			},
+		},
+	}
+	for _, tc := range testCases {
+		t.Run(tc.order.String(), func(t *testing.T) {
+			p := LegacyProcessor{eventC: make(chan *event, 100)}
+			p.Span = roachpb.RSpan{Key: roachpb.RKey("a"), EndKey: roachpb.RKey("z")}
+			p.TxnPusher = &tp
+
+			doneC := make(chan struct{})
+			newTxnPushAttempt(p.Settings, p.Span, p.TxnPusher, &p, txns, pushTS, func() {
+				close(doneC)
+			}, txnPushAttemptOptions{opOrder: tc.order}).Run(context.Background())
+			<-doneC
+
+			require.Equal(t, 1, len(p.eventC))
+			require.Equal(t, &event{ops: tc.expOps}, <-p.eventC)
+		})
+	}
+}
@@ -10,6 +10,18 @@
 
 package rangefeed
 
+import (
+	"context"
+	"slices"
+	"sort"
+
+	"github.com/cockroachdb/cockroach/pkg/roachpb"
+	"github.com/cockroachdb/cockroach/pkg/storage"
+	"github.com/cockroachdb/cockroach/pkg/storage/enginepb"
+	"github.com/cockroachdb/cockroach/pkg/util/protoutil"
+	"github.com/cockroachdb/errors"
+)
+
 func NewTestProcessor(id int64) Processor {
 	if id > 0 {
 		return &ScheduledProcessor{
@@ -18,3 +30,58 @@ func NewTestProcessor(id int64) Processor {
 	}
 	return &LegacyProcessor{}
 }
+
+// sliceIntentScanner is an IntentScanner over an in-memory slice of MVCC
+// key-value pairs.
+type sliceIntentScanner struct {
+	kvs []storage.MVCCKeyValue
+}
+
+// NewSliceIntentScanner returns an IntentScanner over kvs, which must be sorted
+// and lay out intents the way an intent interleaving iterator presents them:
+// as MVCCMetadata at the unversioned key, followed by the versions of the key.
+// It doesn't read from an engine, so it measures the cost of consuming intents
+// without the cost of finding them, e.g. as a baseline in benchmarks of the
+// engine-backed scanners over the same data.
+func NewSliceIntentScanner(kvs []storage.MVCCKeyValue) (IntentScanner, error) {
+	if !slices.IsSortedFunc(kvs, func(a, b storage.MVCCKeyValue) int {
+		return a.Key.Compare(b.Key)
+	}) {
+		return nil, errors.AssertionFailedf("unsorted key-value pairs")
+	}
+	return &sliceIntentScanner{kvs: kvs}, nil
+}
+
+// ConsumeIntents implements the IntentScanner interface.
+func (s *sliceIntentScanner) ConsumeIntents(
+	ctx context.Context, startKey roachpb.Key, endKey roachpb.Key, consumer eventConsumer,
+) error {
+	var meta enginepb.MVCCMetadata
+	i := sort.Search(len(s.kvs), func(i int) bool {
+		return s.kvs[i].Key.Key.Compare(startKey) >= 0
+	})
+	for ; i < len(s.kvs) && s.kvs[i].Key.Key.Compare(endKey) < 0; i++ {
+		kv := s.kvs[i]
+		if kv.Key.IsValue() {
+			continue
+		}
+		if err := protoutil.Unmarshal(kv.Value, &meta); err != nil {
+			return errors.Wrapf(err, "unmarshaling mvcc meta for key %s", kv.Key)
+		}
+		if meta.Txn == nil {
+			continue
+		}
+		consumer(enginepb.MVCCWriteIntentOp{
+			TxnID:           meta.Txn.ID,
+			TxnKey:          meta.Txn.Key,
+			TxnIsoLevel:     meta.Txn.IsoLevel,
+			TxnPriority:     meta.Txn.Priority,
+			TxnMinTimestamp: meta.Txn.MinTimestamp,
+			Timestamp:       meta.Txn.WriteTimestamp,
+		})
+	}
+	return nil
+}
+
+// Close implements the IntentScanner interface.
+func (s *sliceIntentScanner) Close() {}
@@ -900,6 +900,18 @@ type Replica struct {
 		opFilter *rangefeed.Filter
 	}
 
+	// rangefeedInitScanCheckpoint retains the latest checkpoint of the initial
+	// resolved timestamp scan of the Replica's rangefeed processor across
+	// processor restarts. See replicaInitScanCheckpointStore.
+	rangefeedInitScanCheckpoint struct {
+		syncutil.Mutex
+		// appliedIndex is the raft applied index of the state that the
+		// checkpointed scan read.
+		appliedIndex kvpb.RaftIndex
+		cp           rangefeed.InitScanCheckpoint
+		ok           bool
+	}
+
 	// Throttle how often we offer this Replica to the split and merge queues.
 	// We have triggers downstream of Raft that do so based on limited
 	// information and without explicit throttling some replicas will offer once
@@ -1626,6 +1638,13 @@ func (r *Replica) State(ctx context.Context) kvserverpb.RangeInfo {
 	// However, it does require coordination between multiple goroutines, so
 	// it's best to keep it out of the Replica.mu critical section.
 	ri.RangefeedRegistrations = int64(r.numRangefeedRegistrations())
+	if p := r.getRangefeedProcessor(); p != nil {
+		ri.RangefeedLagBudget = p.LagBudget()
+		ri.RangefeedPushInterval = p.CurrentPushInterval()
+		if next := p.NextPushTime(); !next.IsZero() {
+			ri.RangefeedNextPush = hlc.Timestamp{WallTime: next.UnixNano()}
+		}
+	}
 
 	r.mu.RLock()
 	defer r.mu.RUnlock()
@@ -13,6 +13,7 @@ package kvserver
 import (
 	"context"
 	"fmt"
+	"strings"
 	"sync"
 	"time"
 
@@ -79,6 +80,162 @@ var RangeFeedSmearInterval = settings.RegisterDurationSetting(
 	settings.NonNegativeDuration,
 )
 
+// RangeFeedSystemInlineValues controls whether the initial resolved timestamp
+// scan of a rangefeed over system ranges emits the inline values it finds.
+var RangeFeedSystemInlineValues = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.system_inline_values.enabled",
+	"if enabled, rangefeeds over system ranges emit the inline values, such as "+
+		"node liveness records, found by their initial resolved timestamp scan",
+	false,
+)
+
+// RangeFeedReuseIntentScanners controls whether the initial resolved timestamp
+// scan of a rangefeed uses a pooled intent scanner.
+var RangeFeedReuseIntentScanners = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.reuse_intent_scanners.enabled",
+	"reuse intent scanners across rangefeed initial resolved timestamp scans "+
+		"to reduce allocations when rangefeeds restart frequently",
+	metamorphic.ConstantWithTestBool("kv_rangefeed_reuse_intent_scanners_enabled", false),
+)
+
+// RangeFeedPushTxnsLead controls how far ahead of the current time rangefeeds
+// push old transactions.
+var RangeFeedPushTxnsLead = settings.RegisterDurationSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.lead",
+	"the duration added to the current time to compute the timestamp that rangefeeds "+
+		"push old transactions to; a positive lead lets the resolved timestamp run ahead "+
+		"of the push, a negative lead pushes less aggressively",
+	0,
+)
+
+// RangeFeedPushTxnsSkipPriority exempts transactions with at least the given
+// priority from rangefeed pushes.
+var RangeFeedPushTxnsSkipPriority = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.skip_priority",
+	"if non-zero, transactions with at least this priority are not pushed by rangefeeds, "+
+		"which holds back the resolved timestamp until they finish on their own",
+	0,
+	settings.NonNegativeIntWithMaximum(int64(enginepb.MaxTxnPriority)),
+)
+
+// RangeFeedPushTxnsSkipPriorityMaxAge bounds the exemption granted by
+// RangeFeedPushTxnsSkipPriority.
+var RangeFeedPushTxnsSkipPriorityMaxAge = settings.RegisterDurationSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.skip_priority.max_age",
+	"if non-zero, the age past which the intents of transactions exempted from rangefeed "+
+		"pushes by kv.rangefeed.push_txns.skip_priority are pushed regardless",
+	0,
+	settings.NonNegativeDuration,
+)
+
+// RangeFeedPushTxnsResolveBudget bounds the size of the intent resolution
+// requests that a rangefeed push attempt has outstanding at once.
+var RangeFeedPushTxnsResolveBudget = settings.RegisterByteSizeSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.resolve_intents_budget",
+	"if non-zero, the maximum total size of the intent resolution requests that a rangefeed "+
+		"txn push attempt has in flight at once; intents beyond it are resolved in later batches",
+	0,
+)
+
+// RangeFeedPushTxnsMaxLockSpansPerTxn caps the lock spans of each transaction
+// that a rangefeed push attempt resolves.
+var RangeFeedPushTxnsMaxLockSpansPerTxn = settings.RegisterIntSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.max_lock_spans_per_txn",
+	"if non-zero, the maximum number of lock spans of a finalized transaction that a "+
+		"rangefeed txn push attempt resolves; the remaining lock spans are resolved by later "+
+		"attempts",
+	0,
+	settings.NonNegativeInt,
+)
+
+// RangeFeedPushTxnsOpOrder orders the ops that rangefeed push attempts emit for
+// the transactions they pushed.
+var RangeFeedPushTxnsOpOrder = settings.RegisterEnumSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.op_order",
+	"the order of the intent updates and txn aborts that a rangefeed txn push attempt emits "+
+		"for the transactions it pushed: in the order they were pushed, aborts first, or "+
+		"updates first",
+	rangefeed.PushOpsInPushOrder.String(),
+	map[rangefeed.PushOpOrder]string{
+		rangefeed.PushOpsInPushOrder:  rangefeed.PushOpsInPushOrder.String(),
+		rangefeed.PushOpsAbortsFirst:  rangefeed.PushOpsAbortsFirst.String(),
+		rangefeed.PushOpsUpdatesFirst: rangefeed.PushOpsUpdatesFirst.String(),
+	},
+)
+
+// RangeFeedPushTxnsGracePeriod exempts transactions from rangefeed pushes until
+// they have been tracked by the processor for this long.
+var RangeFeedPushTxnsGracePeriod = settings.RegisterDurationSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.grace_period",
+	"if non-zero, the time a rangefeed waits after first observing an intent of a "+
+		"transaction before pushing it, regardless of the age of the intent",
+	0,
+	settings.NonNegativeDuration,
+)
+
+// RangeFeedPushTxnsScanCommittedIntents controls whether rangefeed push
+// attempts scan for the intents of committed transactions without lock spans.
+var RangeFeedPushTxnsScanCommittedIntents = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.scan_committed_intents.enabled",
+	"if set, rangefeed txn push attempts scan their range for the intents of committed "+
+		"transactions whose records lack lock spans, and resolve them, rather than leaving "+
+		"them to hold back the resolved timestamp until others resolve them",
+	false,
+)
+
+// RangeFeedPushTxnsSkipTxns is a deny-list of transactions that rangefeeds
+// never push.
+var RangeFeedPushTxnsSkipTxns = settings.RegisterStringSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.push_txns.skip_txns",
+	"comma-separated list of the IDs of transactions that are not pushed by rangefeeds, "+
+		"regardless of their age, which holds back the resolved timestamp until they finish "+
+		"on their own",
+	"",
+	settings.WithValidateString(func(_ *settings.Values, val string) error {
+		_, err := parseRangeFeedSkipPushTxns(val)
+		return err
+	}),
+)
+
+// parseRangeFeedSkipPushTxns parses the value of RangeFeedPushTxnsSkipTxns.
+func parseRangeFeedSkipPushTxns(val string) (map[uuid.UUID]struct{}, error) {
+	if val == "" {
+		return nil, nil
+	}
+	txnIDs := strings.Split(val, ",")
+	ret := make(map[uuid.UUID]struct{}, len(txnIDs))
+	for _, s := range txnIDs {
+		txnID, err := uuid.FromString(strings.TrimSpace(s))
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid transaction ID %q", s)
+		}
+		ret[txnID] = struct{}{}
+	}
+	return ret, nil
+}
+
+// RangeFeedInitScanCheckpoints controls whether rangefeed processors checkpoint
+// their initial resolved timestamp scan, so that a processor that is restarted
+// before its replica applies further commands can resume the scan.
+var RangeFeedInitScanCheckpoints = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.init_scan_checkpoints.enabled",
+	"if enabled, rangefeed initial resolved timestamp scans are checkpointed in memory "+
+		"and resumed by a restarted processor if the range has not changed in the meantime",
+	false,
+)
+
 // RangeFeedUseScheduler controls type of rangefeed processor is used to process
 // raft updates and sends updates to clients.
 var RangeFeedUseScheduler = settings.RegisterBoolSetting(
@@ -90,6 +247,61 @@ var RangeFeedUseScheduler = settings.RegisterBoolSetting(
 	metamorphic.ConstantWithTestBool("kv_rangefeed_scheduler_enabled", true),
 )
 
+// RangeFeedVerifyInitScanIntents controls whether the initial resolved
+// timestamp scan of a rangefeed cross-checks the intents it finds against the
+// MVCC keyspace.
+var RangeFeedVerifyInitScanIntents = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.verify_init_scan_intents.enabled",
+	"verify that every intent found by a rangefeed's initial resolved timestamp "+
+		"scan has a matching provisional value, and report those that don't",
+	false,
+)
+
+// RangeFeedStrictSeparatedIntents controls whether the initial resolved
+// timestamp scan of a rangefeed reports the interleaved intents it skips.
+var RangeFeedStrictSeparatedIntents = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.strict_separated_intents.enabled",
+	"report intents that a rangefeed's initial resolved timestamp scan skips "+
+		"because they are interleaved in the MVCC keyspace rather than separated "+
+		"into the lock table",
+	false,
+)
+
+// RangeFeedInitScanFallback controls whether the initial resolved timestamp
+// scan of a rangefeed falls back to the legacy intent scanner if scanning the
+// lock table fails.
+var RangeFeedInitScanFallback = settings.RegisterBoolSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.init_scan_fallback.enabled",
+	"if enabled, a rangefeed whose initial resolved timestamp scan fails to scan the "+
+		"lock table retries the scan by walking the MVCC keyspace",
+	false,
+)
+
+// RangeFeedInitScanSliceBytes bounds the size of the intents that the initial
+// resolved timestamp scan of a rangefeed finds before pausing.
+var RangeFeedInitScanSliceBytes = settings.RegisterByteSizeSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.init_scan.slice_bytes",
+	"if non-zero, the size of the intents that a rangefeed's initial resolved timestamp "+
+		"scan finds before pausing for kv.rangefeed.init_scan.slice_pause, to bound the "+
+		"latency impact of scanning ranges with many intents",
+	0,
+)
+
+// RangeFeedInitScanSlicePause is the pause between the slices of the initial
+// resolved timestamp scan of a rangefeed.
+var RangeFeedInitScanSlicePause = settings.RegisterDurationSetting(
+	settings.SystemOnly,
+	"kv.rangefeed.init_scan.slice_pause",
+	"the pause between slices of a rangefeed's initial resolved timestamp scan; only "+
+		"used if kv.rangefeed.init_scan.slice_bytes is set",
+	10*time.Millisecond,
+	settings.NonNegativeDuration,
+)
+
 // RangefeedSchedulerDisabled is a kill switch for scheduler based rangefeed
 // processors. To be removed in 24.1 after new processor becomes default.
 var RangefeedSchedulerDisabled = envutil.EnvOrDefaultBool("COCKROACH_RANGEFEED_DISABLE_SCHEDULER",
@@ -164,6 +376,31 @@ func (tp *rangefeedTxnPusher) PushTxns(
 	return pushedTxns, anyAmbiguousAbort, nil
 }
 
+// QueryTxns is part of the rangefeed.TxnPusher interface. It queries the
+// transaction record of each of the specified transactions.
+func (tp *rangefeedTxnPusher) QueryTxns(
+	ctx context.Context, txns []enginepb.TxnMeta,
+) ([]*roachpb.Transaction, error) {
+	b := &kv.Batch{}
+	b.Header.Timestamp = tp.r.Clock().Now()
+	for _, txn := range txns {
+		b.AddRawRequest(&kvpb.QueryTxnRequest{
+			RequestHeader: kvpb.RequestHeader{
+				Key: txn.Key,
+			},
+			Txn: txn,
+		})
+	}
+	if err := tp.r.store.db.Run(ctx, b); err != nil {
+		return nil, err
+	}
+	queriedTxns := make([]*roachpb.Transaction, len(txns))
+	for i, ru := range b.RawResponse().Responses {
+		queriedTxns[i] = &ru.GetInner().(*kvpb.QueryTxnResponse).QueriedTxn
+	}
+	return queriedTxns, nil
+}
+
 // ResolveIntents is part of the rangefeed.TxnPusher interface.
 func (tp *rangefeedTxnPusher) ResolveIntents(
 	ctx context.Context, intents []roachpb.LockUpdate,
@@ -335,6 +572,13 @@ func (r *Replica) RangeFeed(
 	)
 	r.raftMu.Unlock()
 
+	// Hold the processor to the staleness bound of the registration for as long
+	// as it lasts.
+	if p != nil && args.MaxStaleness > 0 {
+		release := p.BoundStaleness(args.MaxStaleness)
+		done.WhenReady(func(error) { release() })
+	}
+
 	// This call is a no-op if we have successfully registered; but in case we
 	// encountered an error after we created processor, disconnect if processor
 	// is empty.
@@ -354,6 +598,27 @@ func (r *Replica) getRangefeedProcessor() rangefeed.Processor {
 	return p
 }
 
+// rangefeedCancelPushesTimeout bounds how long cancelRangefeedPushes waits for
+// the push attempt of a replica's rangefeed processor to unwind.
+const rangefeedCancelPushesTimeout = time.Second
+
+// cancelRangefeedPushes cancels the transaction push attempts of the replica's
+// rangefeed processor, if any. It is called by a draining store before the
+// lease is transferred away, so that the processor doesn't keep pushing
+// transactions and resolving intents on behalf of a range it is about to stop
+// leading. Errors are logged and otherwise ignored.
+func (r *Replica) cancelRangefeedPushes(ctx context.Context) {
+	p := r.getRangefeedProcessor()
+	if p == nil {
+		return
+	}
+	if err := timeutil.RunWithTimeout(
+		ctx, "cancel rangefeed pushes", rangefeedCancelPushesTimeout, p.CancelPushes,
+	); err != nil {
+		log.VEventf(ctx, 1, "failed to cancel rangefeed pushes: %v", err)
+	}
+}
+
 func (r *Replica) setRangefeedProcessor(p rangefeed.Processor) {
 	r.rangefeedMu.Lock()
 	defer r.rangefeedMu.Unlock()
@@ -498,12 +763,49 @@ func (r *Replica) registerWithRangefeedRaftMuLocked(
 		TxnPusher:        &tp,
 		PushTxnsInterval: r.store.TestingKnobs().RangeFeedPushTxnsInterval,
 		PushTxnsAge:      r.store.TestingKnobs().RangeFeedPushTxnsAge,
+		PushLead:         RangeFeedPushTxnsLead.Get(&r.ClusterSettings().SV),
+		SkipPushPriority: enginepb.TxnPriority(RangeFeedPushTxnsSkipPriority.Get(&r.ClusterSettings().SV)),
+		SkipPushMaxAge:   RangeFeedPushTxnsSkipPriorityMaxAge.Get(&r.ClusterSettings().SV),
+		PushGracePeriod:  RangeFeedPushTxnsGracePeriod.Get(&r.ClusterSettings().SV),
 		EventChanCap:     defaultEventChanCap,
 		EventChanTimeout: defaultEventChanTimeout,
 		Metrics:          r.store.metrics.RangeFeedMetrics,
 		MemBudget:        feedBudget,
 		Scheduler:        sched,
 		Priority:         isSystemSpan, // only takes effect when Scheduler != nil
+		EmitInlineValues: isSystemSpan && RangeFeedSystemInlineValues.Get(&r.ClusterSettings().SV),
+
+		MaxResolveIntentsBytes: RangeFeedPushTxnsResolveBudget.Get(&r.ClusterSettings().SV),
+		MaxLockSpansPerTxn:     int(RangeFeedPushTxnsMaxLockSpansPerTxn.Get(&r.ClusterSettings().SV)),
+		PushOpOrder:            RangeFeedPushTxnsOpOrder.Get(&r.ClusterSettings().SV),
+		ResolvedTSLagTarget:    closedts.TargetDuration.Get(&r.store.ClusterSettings().SV),
+		VerifyInitScanIntents:  RangeFeedVerifyInitScanIntents.Get(&r.store.ClusterSettings().SV),
+		StrictSeparatedIntents: RangeFeedStrictSeparatedIntents.Get(&r.store.ClusterSettings().SV),
+		InitScanSliceBytes:     RangeFeedInitScanSliceBytes.Get(&r.store.ClusterSettings().SV),
+		InitScanSlicePause:     RangeFeedInitScanSlicePause.Get(&r.store.ClusterSettings().SV),
+	}
+	if RangeFeedPushTxnsScanCommittedIntents.Get(&r.ClusterSettings().SV) {
+		cfg.CommittedIntentScanner = func() rangefeed.IntentScanner {
+			// The scanner is created by push attempts, which outlive the
+			// registration that created the processor.
+			ctx := r.AnnotateCtx(context.Background())
+			scanner, err := rangefeed.NewSeparatedIntentScanner(ctx, r.store.TODOEngine(), desc.RSpan())
+			if err != nil {
+				log.Warningf(ctx, "failed to scan for committed intents: %v", err)
+				return nil
+			}
+			return scanner
+		}
+	}
+	// The setting's validation guarantees that the value parses.
+	cfg.SkipPushTxns, _ = parseRangeFeedSkipPushTxns(RangeFeedPushTxnsSkipTxns.Get(&r.ClusterSettings().SV))
+	if RangeFeedInitScanCheckpoints.Get(&r.ClusterSettings().SV) {
+		// The applied index is stable while raftMu is held, so it identifies
+		// the state that the initial scan will read.
+		r.mu.RLock()
+		appliedIndex := r.mu.state.RaftAppliedIndex
+		r.mu.RUnlock()
+		cfg.InitScanCheckpointStore = &replicaInitScanCheckpointStore{r: r, appliedIndex: appliedIndex}
 	}
 	p = rangefeed.NewProcessor(cfg)
 
@@ -515,11 +817,31 @@ func (r *Replica) registerWithRangefeedRaftMuLocked(
 		// waiting for the Register call below to return.
 		r.raftMu.AssertHeld()
 
-		scanner, err := rangefeed.NewSeparatedIntentScanner(ctx, r.store.TODOEngine(), desc.RSpan())
+		var scanner rangefeed.IntentScanner
+		var err error
+		kind := p.IntentScannerKind()
+		if kind == rangefeed.SeparatedIntentScannerKind &&
+			RangeFeedReuseIntentScanners.Get(&r.ClusterSettings().SV) {
+			scanner, err = rangefeed.NewPooledSeparatedIntentScanner(ctx, r.store.TODOEngine(), desc.RSpan())
+		} else {
+			scanner, err = rangefeed.NewIntentScanner(ctx, kind, r.store.TODOEngine(), desc.RSpan())
+		}
 		if err != nil {
 			done.Set(err)
 			return nil
 		}
+		if kind == rangefeed.SeparatedIntentScannerKind &&
+			RangeFeedInitScanFallback.Get(&r.store.ClusterSettings().SV) {
+			// The fallback is created under raftMu too, so that it reads the same
+			// state as the primary scanner.
+			fallback, err := rangefeed.NewLegacyIntentScanner(r.store.TODOEngine(), desc.RSpan())
+			if err != nil {
+				scanner.Close()
+				done.Set(err)
+				return nil
+			}
+			return rangefeed.NewIntentScannerWithFallback(scanner, fallback)
+		}
 		return scanner
 	}
 
@@ -621,6 +943,56 @@ func (r *Replica) numRangefeedRegistrations() int {
 	return p.Len()
 }
 
+// replicaInitScanCheckpointStore is a rangefeed.InitScanCheckpointStore that
+// retains the checkpoint of the initial resolved timestamp scan of a Replica's
+// rangefeed processor in memory. A checkpoint is only loaded by a processor
+// that scans the same applied state as the one that saved it, since intents
+// may have been resolved by any command applied in the meantime.
+type replicaInitScanCheckpointStore struct {
+	r *Replica
+	// appliedIndex is the raft applied index of the state scanned by the
+	// processor that the store was created for.
+	appliedIndex kvpb.RaftIndex
+}
+
+var _ rangefeed.InitScanCheckpointStore = (*replicaInitScanCheckpointStore)(nil)
+
+// Load implements the rangefeed.InitScanCheckpointStore interface.
+func (s *replicaInitScanCheckpointStore) Load(
+	context.Context,
+) (rangefeed.InitScanCheckpoint, bool, error) {
+	c := &s.r.rangefeedInitScanCheckpoint
+	c.Lock()
+	defer c.Unlock()
+	if !c.ok || c.appliedIndex != s.appliedIndex {
+		return rangefeed.InitScanCheckpoint{}, false, nil
+	}
+	return c.cp, true, nil
+}
+
+// Save implements the rangefeed.InitScanCheckpointStore interface.
+func (s *replicaInitScanCheckpointStore) Save(
+	_ context.Context, cp rangefeed.InitScanCheckpoint,
+) error {
+	c := &s.r.rangefeedInitScanCheckpoint
+	c.Lock()
+	defer c.Unlock()
+	c.appliedIndex, c.cp, c.ok = s.appliedIndex, cp, true
+	return nil
+}
+
+// Clear implements the rangefeed.InitScanCheckpointStore interface. It leaves
+// the checkpoint of a scan of a later state in place.
+func (s *replicaInitScanCheckpointStore) Clear(context.Context) error {
+	c := &s.r.rangefeedInitScanCheckpoint
+	c.Lock()
+	defer c.Unlock()
+	if c.appliedIndex <= s.appliedIndex {
+		c.cp, c.ok = rangefeed.InitScanCheckpoint{}, false
+	}
+	return nil
+}
+
 // populatePrevValsInLogicalOpLog updates the provided logical op
 // log with previous values read from the reader, which is expected to reflect
 // the state of the Replica before the operations in the logical op log are
@@ -46,6 +46,7 @@ import (
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/liveness/livenesspb"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/lockspanset"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/raftlog"
+	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/rangefeed"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/rditer"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/spanset"
 	"github.com/cockroachdb/cockroach/pkg/kv/kvserver/stateloader"
@@ -14889,3 +14890,39 @@ func TestLockAcquisitions1PCInteractions(t *testing.T) {
 		})
 	})
 }
+
+// TestReplicaInitScanCheckpointStore tests that the checkpoint of a rangefeed
+// initial scan is only loaded by scans of the state it was taken from.
+func TestReplicaInitScanCheckpointStore(t *testing.T) {
+	defer leaktest.AfterTest(t)()
+	defer log.Scope(t).Close(t)
+
+	ctx := context.Background()
+	r := &Replica{}
+	cp := rangefeed.InitScanCheckpoint{ResumeKey: roachpb.Key("b")}
+
+	s1 := &replicaInitScanCheckpointStore{r: r, appliedIndex: 10}
+	_, ok, err := s1.Load(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+	require.NoError(t, s1.Save(ctx, cp))
+
+	// A restarted processor scanning the same state resumes the scan.
+	restarted := &replicaInitScanCheckpointStore{r: r, appliedIndex: 10}
+	loaded, ok, err := restarted.Load(ctx)
+	require.NoError(t, err)
+	require.True(t, ok)
+	require.Equal(t, cp, loaded)
+
+	// One scanning a later state doesn't.
+	later := &replicaInitScanCheckpointStore{r: r, appliedIndex: 11}
+	_, ok, err = later.Load(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+
+	// Completing the scan clears the checkpoint.
+	require.NoError(t, restarted.Clear(ctx))
+	_, ok, err = s1.Load(ctx)
+	require.NoError(t, err)
+	require.False(t, ok)
+}
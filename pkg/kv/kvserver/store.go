@@ -1922,6 +1922,10 @@ func (s *Store) SetDraining(drain bool, reporter func(int, redact.SafeString), v
 						// The lease reacquisition succeeded. Proceed to the lease transfer.
 					}
 
+					// Stop the rangefeed processor from pushing transactions on behalf
+					// of a range whose lease is about to move away.
+					r.cancelRangefeedPushes(ctx)
+
 					// Note that this code doesn't deal with transferring the Raft
 					// leadership. Leadership tries to follow the lease, so when leases
 					// are transferred, leadership will be transferred too. For ranges
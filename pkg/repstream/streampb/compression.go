@@ -0,0 +1,129 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package streampb
+
+import (
+	"bytes"
+	"io"
+
+	"github.com/cockroachdb/errors"
+	"github.com/golang/snappy"
+	"github.com/klauspost/compress/zstd"
+)
+
+// MaxCompressionLevel is the highest compression level a consumer may ask
+// for, see StreamPartitionSpec.CompressionLevel.
+const MaxCompressionLevel = 22
+
+// zstdMagic starts every zstd frame. A snappy block never starts with it, as
+// the first element of a block must be a literal, while the byte following the
+// 0x28 length varint would be the tag of a copy.
+var zstdMagic = []byte{0x28, 0xb5, 0x2f, 0xfd}
+
+// zstdDecoder decodes zstd frames. DecodeAll is safe for concurrent use.
+var zstdDecoder, _ = zstd.NewReader(nil)
+
+// EventCompressor compresses encoded StreamEvents at a compression level.
+// Level 0 compresses with snappy, which is understood by every consumer that
+// asks for compression. Levels 1 through MaxCompressionLevel are zstd levels,
+// trading CPU for smaller events as the level increases.
+type EventCompressor struct {
+	zstd *zstd.Encoder
+}
+
+// NewEventCompressor returns a compressor for the given level. It must be
+// closed once it is no longer used.
+func NewEventCompressor(level int32) (*EventCompressor, error) {
+	if level < 0 || level > MaxCompressionLevel {
+		return nil, errors.Newf("compression level must be between 0 and %d, got %d",
+			MaxCompressionLevel, level)
+	}
+	if level == 0 {
+		return &EventCompressor{}, nil
+	}
+	enc, err := zstd.NewWriter(nil,
+		zstd.WithEncoderLevel(zstd.EncoderLevelFromZstd(int(level))), zstd.WithEncoderConcurrency(1))
+	if err != nil {
+		return nil, err
+	}
+	return &EventCompressor{zstd: enc}, nil
+}
+
+// Compress compresses an encoded event.
+func (c *EventCompressor) Compress(data []byte) []byte {
+	if c.zstd == nil {
+		return snappy.Encode(nil, data)
+	}
+	return c.zstd.EncodeAll(data, nil)
+}
+
+// Close releases the resources of the compressor.
+func (c *EventCompressor) Close() {
+	if c.zstd != nil {
+		_ = c.zstd.Close()
+	}
+}
+
+// ErrDecompressedEventTooLarge is returned by DecompressEventLimited for an
+// event that decompresses to more than the limit.
+var ErrDecompressedEventTooLarge = errors.New("decompressed event too large")
+
+// DecompressEvent decompresses an event compressed by an EventCompressor at
+// any level.
+func DecompressEvent(data []byte) ([]byte, error) {
+	if bytes.HasPrefix(data, zstdMagic) {
+		return zstdDecoder.DecodeAll(data, nil)
+	}
+	return snappy.Decode(nil, data)
+}
+
+// DecompressEventLimited is like DecompressEvent, but returns an error wrapping
+// ErrDecompressedEventTooLarge rather than decompress the event to more than
+// maxSize bytes, so that a malformed or malicious event can't exhaust the
+// memory of its consumer. It allocates at most about maxSize bytes for the
+// decompressed event.
+func DecompressEventLimited(data []byte, maxSize int64) ([]byte, error) {
+	tooLarge := func() error {
+		return errors.Wrapf(ErrDecompressedEventTooLarge,
+			"event of %d bytes decompresses to more than %d bytes", len(data), maxSize)
+	}
+	if !bytes.HasPrefix(data, zstdMagic) {
+		// A snappy block is prefixed with its decoded length, which bounds the
+		// allocation of snappy.Decode.
+		n, err := snappy.DecodedLen(data)
+		if err != nil {
+			return nil, err
+		}
+		if int64(n) > maxSize {
+			return nil, tooLarge()
+		}
+		return snappy.Decode(nil, data)
+	}
+	// The content size in a zstd frame header is optional, so the frame is
+	// decoded as a stream that is cut off past the limit instead.
+	dec, err := zstd.NewReader(bytes.NewReader(data),
+		zstd.WithDecoderConcurrency(1), zstd.WithDecoderMaxMemory(uint64(maxSize)+1))
+	if err != nil {
+		return nil, err
+	}
+	defer dec.Close()
+	decompressed, err := io.ReadAll(io.LimitReader(dec, maxSize+1))
+	if err != nil {
+		if errors.Is(err, zstd.ErrDecoderSizeExceeded) || errors.Is(err, zstd.ErrWindowSizeExceeded) {
+			return nil, tooLarge()
+		}
+		return nil, err
+	}
+	if int64(len(decompressed)) > maxSize {
+		return nil, tooLarge()
+	}
+	return decompressed, nil
+}
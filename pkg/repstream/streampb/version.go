@@ -0,0 +1,32 @@
+// Copyright 2024 The Cockroach Authors.
+//
+// Use of this software is governed by the Business Source License
+// included in the file licenses/BSL.txt.
+//
+// As of the Change Date specified in that file, in accordance with
+// the Business Source License, use of this software will be governed
+// by the Apache License, Version 2.0, included in the file
+// licenses/APL.txt.
+
+package streampb
+
+// StreamProtocolVersion is the version of the stream partition wire format
+// spoken by this binary. It must be bumped whenever the encoding of the events
+// emitted by a producer changes in a way older consumers cannot decode.
+//
+// Version history:
+//   - 1: the original stream partition format.
+//   - 2: producers emit a terminal StreamCanceled event when their job is
+//     canceled mid-stream.
+const StreamProtocolVersion uint32 = 2
+
+// StreamCanceledProtocolVersion is the first protocol version in which a
+// producer may emit a StreamCanceled event.
+const StreamCanceledProtocolVersion uint32 = 2
+
+// MinStreamProtocolVersion is the oldest consumer protocol version a producer
+// running this binary can serve.
+//
+// A consumer that does not specify a version predates protocol versioning and
+// is treated as speaking version 1.
+const MinStreamProtocolVersion uint32 = 1
@@ -2601,6 +2601,11 @@ var builtinOidsArray = []string{
 	2633: `inner_product(v1: vector, v2: vector) -> float`,
 	2634: `vector_dims(vector: vector) -> int`,
 	2635: `vector_norm(vector: vector) -> float`,
+	2636: `crdb_internal.pause_replication_stream(stream_id: int) -> int`,
+	2637: `crdb_internal.resume_replication_stream(stream_id: int) -> int`,
+	2638: `crdb_internal.replication_stream_history(stream_id: int) -> bytes`,
+	2639: `crdb_internal.replication_stream_protocol_versions() -> int[]`,
+	2640: `crdb_internal.replication_stream_protected_timestamp(stream_id: int) -> bytes`,
 }
 
 var builtinOidsBySignature map[string]oid.Oid
@@ -287,6 +287,97 @@ var replicationBuiltins = map[string]builtinDefinition{
 		},
 	),
 
+	"crdb_internal.replication_stream_history": makeBuiltin(
+		tree.FunctionProperties{
+			Category:         builtinconstants.CategoryClusterReplication,
+			Undocumented:     true,
+			DistsqlBlocklist: true,
+		},
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "stream_id", Typ: types.Int},
+			},
+			ReturnType: tree.FixedReturnType(types.Bytes),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, args tree.Datums) (tree.Datum, error) {
+				mgr, err := evalCtx.StreamManagerFactory.GetReplicationStreamManager(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				streamID := int64(tree.MustBeDInt(args[0]))
+				history, err := mgr.GetReplicationStreamHistory(ctx, streampb.StreamID(streamID))
+				if err != nil {
+					return nil, err
+				}
+				rawHistory, err := protoutil.Marshal(history)
+				if err != nil {
+					return nil, err
+				}
+				return tree.NewDBytes(tree.DBytes(rawHistory)), err
+			},
+			Info: "This function can be used on the consumer side to get the status transitions " +
+				"of the producer job of the specified stream, e.g. to find out why it stopped.",
+			Volatility: volatility.Volatile,
+		},
+	),
+	"crdb_internal.replication_stream_protected_timestamp": makeBuiltin(
+		tree.FunctionProperties{
+			Category:         builtinconstants.CategoryClusterReplication,
+			Undocumented:     true,
+			DistsqlBlocklist: true,
+		},
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "stream_id", Typ: types.Int},
+			},
+			ReturnType: tree.FixedReturnType(types.Bytes),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, args tree.Datums) (tree.Datum, error) {
+				mgr, err := evalCtx.StreamManagerFactory.GetReplicationStreamManager(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				streamID := int64(tree.MustBeDInt(args[0]))
+				record, err := mgr.GetReplicationStreamProtectedTimestamp(ctx, streampb.StreamID(streamID))
+				if err != nil {
+					return nil, err
+				}
+				rawRecord, err := protoutil.Marshal(record)
+				if err != nil {
+					return nil, err
+				}
+				return tree.NewDBytes(tree.DBytes(rawRecord)), err
+			},
+			Info: "This function can be used on the consumer side to get the protected timestamp " +
+				"record of the producer job of the specified stream.",
+			Volatility: volatility.Volatile,
+		},
+	),
+
+	"crdb_internal.replication_stream_protocol_versions": makeBuiltin(
+		tree.FunctionProperties{
+			Category:         builtinconstants.CategoryClusterReplication,
+			Undocumented:     true,
+			DistsqlBlocklist: true,
+		},
+		tree.Overload{
+			Types:      tree.ParamTypes{},
+			ReturnType: tree.FixedReturnType(types.IntArray),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, args tree.Datums) (tree.Datum, error) {
+				versions := tree.NewDArray(types.Int)
+				for _, v := range []uint32{streampb.MinStreamProtocolVersion, streampb.StreamProtocolVersion} {
+					if err := versions.Append(tree.NewDInt(tree.DInt(v))); err != nil {
+						return nil, err
+					}
+				}
+				return versions, nil
+			},
+			Info: "This function can be used on the consumer side to get the oldest and newest versions " +
+				"of the stream wire format that the producer supports, before subscribing to a stream.",
+			Volatility: volatility.Volatile,
+		},
+	),
+
 	"crdb_internal.complete_replication_stream": makeBuiltin(
 		tree.FunctionProperties{
 			Category:         builtinconstants.CategoryClusterReplication,
@@ -319,6 +410,60 @@ var replicationBuiltins = map[string]builtinDefinition{
 			Volatility: volatility.Volatile,
 		},
 	),
+	"crdb_internal.pause_replication_stream": makeBuiltin(
+		tree.FunctionProperties{
+			Category:         builtinconstants.CategoryClusterReplication,
+			Undocumented:     true,
+			DistsqlBlocklist: true,
+		},
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "stream_id", Typ: types.Int},
+			},
+			ReturnType: tree.FixedReturnType(types.Int),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, args tree.Datums) (tree.Datum, error) {
+				mgr, err := evalCtx.StreamManagerFactory.GetReplicationStreamManager(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				streamID := int64(tree.MustBeDInt(args[0]))
+				if err := mgr.PauseReplicationStream(ctx, streampb.StreamID(streamID)); err != nil {
+					return nil, err
+				}
+				return tree.NewDInt(tree.DInt(streamID)), err
+			},
+			Info:       "This function can be used on the consumer side to pause the producer job of a replication stream.",
+			Volatility: volatility.Volatile,
+		},
+	),
+	"crdb_internal.resume_replication_stream": makeBuiltin(
+		tree.FunctionProperties{
+			Category:         builtinconstants.CategoryClusterReplication,
+			Undocumented:     true,
+			DistsqlBlocklist: true,
+		},
+		tree.Overload{
+			Types: tree.ParamTypes{
+				{Name: "stream_id", Typ: types.Int},
+			},
+			ReturnType: tree.FixedReturnType(types.Int),
+			Fn: func(ctx context.Context, evalCtx *eval.Context, args tree.Datums) (tree.Datum, error) {
+				mgr, err := evalCtx.StreamManagerFactory.GetReplicationStreamManager(ctx)
+				if err != nil {
+					return nil, err
+				}
+
+				streamID := int64(tree.MustBeDInt(args[0]))
+				if err := mgr.ResumeReplicationStream(ctx, streampb.StreamID(streamID)); err != nil {
+					return nil, err
+				}
+				return tree.NewDInt(tree.DInt(streamID)), err
+			},
+			Info:       "This function can be used on the consumer side to resume the paused producer job of a replication stream.",
+			Volatility: volatility.Volatile,
+		},
+	),
 	"crdb_internal.setup_span_configs_stream": makeBuiltin(
 		tree.FunctionProperties{
 			Category:           builtinconstants.CategoryClusterReplication,
@@ -911,6 +911,27 @@ type ReplicationStreamManager interface {
 		successfulIngestion bool,
 	) error
 
+	// PauseReplicationStream pauses the producer job of a replication stream.
+	PauseReplicationStream(ctx context.Context, streamID streampb.StreamID) error
+
+	// ResumeReplicationStream resumes the paused producer job of a replication
+	// stream.
+	ResumeReplicationStream(ctx context.Context, streamID streampb.StreamID) error
+
+	// GetReplicationStreamHistory gets the status transitions of the producer
+	// job of a replication stream, oldest first.
+	GetReplicationStreamHistory(
+		ctx context.Context,
+		streamID streampb.StreamID,
+	) (*streampb.StreamStatusHistory, error)
+
+	// GetReplicationStreamProtectedTimestamp gets the protected timestamp record
+	// of the producer job of a replication stream.
+	GetReplicationStreamProtectedTimestamp(
+		ctx context.Context,
+		streamID streampb.StreamID,
+	) (*streampb.StreamProtectedTimestamp, error)
+
 	DebugGetProducerStatuses(ctx context.Context) []*streampb.DebugProducerStatus
 	DebugGetLogicalConsumerStatuses(ctx context.Context) []*streampb.DebugLogicalConsumerStatus
 